@@ -0,0 +1,143 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+)
+
+const unexpectedAccessMetricPrefix = "unexpected-access-"
+
+// alertDescriptions describe the alerts of the default metrics of a project.
+// The display names match the alerts created by the Python scripts so projects deployed by them are updated in place.
+var alertDescriptions = map[string]struct{ displayName, content string }{
+	"iam-policy-change-count": {
+		displayName: "IAM Policy Change Alert",
+		content:     "This policy ensures the designated user/group is notified when IAM policies are altered.",
+	},
+	"bucket-permission-change-count": {
+		displayName: "Bucket Permission Change Alert",
+		content:     "This policy ensures the designated user/group is notified when bucket/object permissions are altered.",
+	},
+	"bigquery-settings-change-count": {
+		displayName: "Bigquery Update Alert",
+		content:     "This policy ensures the designated user/group is notified when Bigquery dataset settings are altered.",
+	},
+}
+
+// createAlerts creates an email notification channel for the Stackdriver alert email of the project and an
+// alerting policy for each of its log based metrics. Existing channels and policies are kept.
+func createAlerts(project *config.Project, opts *Options) error {
+	if project.StackdriverAlertEmail == "" {
+		opts.logf("No Stackdriver alert email specified, skipping creation of Stackdriver alerts.")
+		return nil
+	}
+	for _, w := range project.GeneratedFields.Warnings {
+		if w == missingStackdriverWarning {
+			opts.logf("Stackdriver account was not created, skipping creation of Stackdriver alerts.")
+			return nil
+		}
+	}
+
+	c := opts.client()
+	channel, err := getOrCreateEmailChannel(project.ID, project.StackdriverAlertEmail, c, opts)
+	if err != nil {
+		return err
+	}
+
+	policies, err := c.ListAlertPolicies(project.ID)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for _, p := range policies {
+		existing[p.DisplayName] = true
+	}
+
+	for _, m := range project.Metrics {
+		policy := alertPolicy(m, channel)
+		if existing[policy.DisplayName] {
+			opts.logf("Alert policy %q already exists, skipping.", policy.DisplayName)
+			continue
+		}
+		if err := c.CreateAlertPolicy(project.ID, policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getOrCreateEmailChannel returns the name of the email notification channel for the email, creating it if it does not exist.
+func getOrCreateEmailChannel(projectID, email string, c gcp.Client, opts *Options) (string, error) {
+	channels, err := c.ListNotificationChannels(projectID)
+	if err != nil {
+		return "", err
+	}
+	for _, ch := range channels {
+		if ch.Type == "email" && ch.Labels["email_address"] == email {
+			opts.logf("Stackdriver notification channel already exists for %s.", email)
+			return ch.Name, nil
+		}
+	}
+	return c.CreateNotificationChannel(projectID, &gcp.NotificationChannel{
+		Type:        "email",
+		DisplayName: "Email",
+		Labels:      map[string]string{"email_address": email},
+	})
+}
+
+// alertPolicy returns the policy that alerts the channel as soon as the log based metric is above zero.
+// The metrics count events that should never happen, so there is no tolerance.
+func alertPolicy(m *config.Metric, channel string) *gcp.AlertPolicy {
+	d, ok := alertDescriptions[m.Name()]
+	switch {
+	case ok:
+	case strings.HasPrefix(m.Name(), unexpectedAccessMetricPrefix):
+		bucket := strings.TrimPrefix(m.Name(), unexpectedAccessMetricPrefix)
+		d.displayName = fmt.Sprintf("Unexpected Access to %s Alert", bucket)
+		d.content = fmt.Sprintf("This policy ensures the designated user/group is notified when bucket %s is accessed by an unexpected user.", bucket)
+	default:
+		d.displayName = fmt.Sprintf("%s Alert", m.Name())
+		d.content = m.Description
+	}
+
+	return &gcp.AlertPolicy{
+		DisplayName: d.displayName,
+		Documentation: &gcp.AlertDocumentation{
+			Content:  d.content,
+			MimeType: "text/markdown",
+		},
+		Conditions: []*gcp.AlertCondition{{
+			DisplayName: fmt.Sprintf("No tolerance on %s!", m.Name()),
+			ConditionThreshold: &gcp.ConditionThreshold{
+				Filter: fmt.Sprintf(`metric.type="logging.googleapis.com/user/%s"`, m.Name()),
+				Aggregations: []*gcp.Aggregation{{
+					AlignmentPeriod:  "60s",
+					PerSeriesAligner: "ALIGN_SUM",
+				}},
+				Comparison:     "COMPARISON_GT",
+				ThresholdValue: 0,
+				Duration:       "0s",
+			},
+		}},
+		Combiner:             "AND",
+		Enabled:              true,
+		NotificationChannels: []string{channel},
+	}
+}
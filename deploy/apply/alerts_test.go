@@ -0,0 +1,112 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/testconf"
+	"github.com/google/go-cmp/cmp"
+)
+
+const alertsConfig = `
+stackdriver_alert_email: alerts@my-domain.com
+resources:
+  gcs_buckets:
+  - expected_users:
+    - user@my-domain.com
+    properties:
+      name: foo-bucket
+      location: us-east1`
+
+func TestCreateAlerts(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, &testconf.ConfigData{alertsConfig})
+	fake := newFakeWithProject(conf, project)
+	p := fake.Project(project.ID)
+	// Channels for other emails are not used.
+	p.NotificationChannels = []*gcp.NotificationChannel{
+		{Name: "projects/my-project/notificationChannels/other", Type: "email", Labels: map[string]string{"email_address": "other@my-domain.com"}},
+	}
+
+	// Alerts are only created once.
+	for i := 0; i < 2; i++ {
+		if err := createAlerts(project, &Options{Client: fake}); err != nil {
+			t.Fatalf("createAlerts = %v", err)
+		}
+	}
+
+	wantChannels := []*gcp.NotificationChannel{
+		{Name: "projects/my-project/notificationChannels/other", Type: "email", Labels: map[string]string{"email_address": "other@my-domain.com"}},
+		{Name: "projects/my-project/notificationChannels/2", Type: "email", DisplayName: "Email", Labels: map[string]string{"email_address": "alerts@my-domain.com"}},
+	}
+	if diff := cmp.Diff(p.NotificationChannels, wantChannels); diff != "" {
+		t.Errorf("notification channels differ (-got +want):\n%v", diff)
+	}
+
+	var got []string
+	for _, a := range p.AlertPolicies {
+		got = append(got, a.DisplayName)
+		if diff := cmp.Diff(a.NotificationChannels, []string{"projects/my-project/notificationChannels/2"}); diff != "" {
+			t.Errorf("notification channels of policy %q differ (-got +want):\n%v", a.DisplayName, diff)
+		}
+	}
+	want := []string{
+		"Bigquery Update Alert",
+		"IAM Policy Change Alert",
+		"Bucket Permission Change Alert",
+		"Unexpected Access to foo-bucket Alert",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("alert policies differ (-got +want):\n%v", diff)
+	}
+
+	wantPolicy := &gcp.AlertPolicy{
+		Name:        "projects/my-project/alertPolicies/4",
+		DisplayName: "Unexpected Access to foo-bucket Alert",
+		Documentation: &gcp.AlertDocumentation{
+			Content:  "This policy ensures the designated user/group is notified when bucket foo-bucket is accessed by an unexpected user.",
+			MimeType: "text/markdown",
+		},
+		Conditions: []*gcp.AlertCondition{{
+			DisplayName: "No tolerance on unexpected-access-foo-bucket!",
+			ConditionThreshold: &gcp.ConditionThreshold{
+				Filter:       `metric.type="logging.googleapis.com/user/unexpected-access-foo-bucket"`,
+				Aggregations: []*gcp.Aggregation{{AlignmentPeriod: "60s", PerSeriesAligner: "ALIGN_SUM"}},
+				Comparison:   "COMPARISON_GT",
+				Duration:     "0s",
+			},
+		}},
+		Combiner:             "AND",
+		Enabled:              true,
+		NotificationChannels: []string{"projects/my-project/notificationChannels/2"},
+	}
+	if len(p.AlertPolicies) == 4 {
+		if diff := cmp.Diff(p.AlertPolicies[3], wantPolicy); diff != "" {
+			t.Errorf("alert policy differs (-got +want):\n%v", diff)
+		}
+	}
+}
+
+func TestCreateAlertsNoEmail(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, nil)
+	fake := newFakeWithProject(conf, project)
+	if err := createAlerts(project, &Options{Client: fake}); err != nil {
+		t.Fatalf("createAlerts = %v", err)
+	}
+	if p := fake.Project(project.ID); len(p.NotificationChannels) != 0 || len(p.AlertPolicies) != 0 {
+		t.Errorf("created channels %v and policies %v, want none", p.NotificationChannels, p.AlertPolicies)
+	}
+}
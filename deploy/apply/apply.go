@@ -18,20 +18,15 @@
 package apply
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
-	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
 )
 
 const (
@@ -44,30 +39,16 @@ const (
 // deploymentManagerRoles are the roles granted to the DM service account.
 var deploymentManagerRoles = []string{"owner", "storage.admin"}
 
+// stackdriverPollInterval is the time to wait between checks for a Stackdriver account in non-interactive mode.
+var stackdriverPollInterval = 30 * time.Second
+
+// missingStackdriverWarning is recorded in the generated fields of a project whose Stackdriver account was
+// not created in non-interactive mode.
+const missingStackdriverWarning = "Stackdriver account not created, so Stackdriver alerts were not created. Create the account and apply the project again."
+
 // deploymentRetryWaitTime is the time to wait between retrying a deployment to allow for concurrent operations to finish.
 const deploymentRetryWaitTime = time.Minute
 
-// The following vars are stubbed in tests.
-var (
-	cmdCombinedOutput = func(cmd *exec.Cmd) ([]byte, error) {
-		log.Printf("Running: %v", cmd.Args)
-		return cmd.CombinedOutput()
-	}
-	cmdOutput = func(cmd *exec.Cmd) ([]byte, error) {
-		log.Printf("Running: %v", cmd.Args)
-		cmd.Stderr = os.Stderr
-		return cmd.Output()
-	}
-	cmdRun = func(cmd *exec.Cmd) error {
-		log.Printf("Running: %v", cmd.Args)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		return cmd.Run()
-	}
-	upsertDeployment = deploymentmanager.Upsert
-	terraformApply   = terraform.Apply
-)
-
 // deploymentManagerTyper should be implemented by resources that are natively supported by the deployment manager service.
 // Use this if there is no suitable CFT template for a resource and a custom template is not needed.
 // See https://cloud.google.com/deployment-manager/docs/configuration/supported-resource-types for valid types.
@@ -89,76 +70,67 @@ type depender interface {
 
 // Default applies project configurations to a default project.
 func Default(conf *config.Config, project *config.Project, opts *Options) error {
-	if err := verifyOrCreateProject(conf, project); err != nil {
-		return fmt.Errorf("failed to verify or create project: %v", err)
-	}
+	return runSteps(conf, project, opts, defaultSteps())
+}
 
-	if err := setupBilling(project, conf.Overall.BillingAccount); err != nil {
-		return fmt.Errorf("failed to set up billing: %v", err)
+// DeployResources deploys the CFT resources in the project.
+// If terraform is enabled, all resources are deployed with terraform instead of deployment manager.
+func DeployResources(conf *config.Config, project *config.Project, opts *Options) error {
+	if opts.EnableTerraform {
+		return deployTerraformResources(conf, project, opts)
 	}
-
-	if err := enableServiceAPIs(project); err != nil {
-		return fmt.Errorf("failed to enable service APIs: %v", err)
+	c := opts.client()
+	if err := grantDeploymentManagerAccess(project, c); err != nil {
+		return fmt.Errorf("failed to grant deployment manager access to the project: %v", err)
 	}
 
-	if err := createCustomComputeImages(project); err != nil {
-		return fmt.Errorf("failed to create compute images: %v", err)
+	if err := deployPrerequisite(project, c); err != nil {
+		return fmt.Errorf("failed to deploy pre-requisites: %v", err)
 	}
 
-	if err := createDeletionLien(project); err != nil {
-		return fmt.Errorf("failed to create deletion lien: %v", err)
+	if err := importBinauthz(project.ID, project.BinauthzPolicy, opts); err != nil {
+		return fmt.Errorf("failed to import binary authorization policy: %v", err)
 	}
 
-	if err := DeployResources(conf, project, opts); err != nil {
+	if err := deployResources(project, opts); err != nil {
 		return fmt.Errorf("failed to deploy resources: %v", err)
 	}
 
-	if err := createStackdriverAccount(project); err != nil {
-		return fmt.Errorf("failed to create stackdriver account: %v", err)
-	}
-
-	if err := createAlerts(); err != nil {
-		return fmt.Errorf("failed to create alerts: %v", err)
+	if err := updateLogSinkWriter(project, c); err != nil {
+		return err
 	}
 
-	if opts.EnableForseti {
-		if err := GrantForsetiPermissions(project.ID, conf.AllGeneratedFields.Forseti.ServiceAccount); err != nil {
-			return err
-		}
+	if err := deployAudit(project, conf.ProjectForAuditLogs(project), c); err != nil {
+		return fmt.Errorf("failed to deploy audit resources: %v", err)
 	}
-
-	// TODO: write generated fieids.
-
-	return nil
+	return deployPostResources(conf, project, opts)
 }
 
-// DeployResources deploys the CFT resources in the project.
-func DeployResources(conf *config.Config, project *config.Project, opts *Options) error {
-	if opts.EnableTerraform {
-		if err := deployTerraform(conf, project); err != nil {
-			return err
-		}
-		// TODO: return after this once we can deploy all necessary resources like log sinks, etc in terraform.
-	}
-	if err := grantDeploymentManagerAccess(project); err != nil {
-		return fmt.Errorf("failed to grant deployment manager access to the project: %v", err)
+// deployTerraformResources deploys the resources in the project with terraform.
+func deployTerraformResources(conf *config.Config, project *config.Project, opts *Options) error {
+	if err := importBinauthz(project.ID, project.BinauthzPolicy, opts); err != nil {
+		return fmt.Errorf("failed to import binary authorization policy: %v", err)
 	}
 
-	if err := deployPrerequisite(project); err != nil {
-		return fmt.Errorf("failed to deploy pre-requisites: %v", err)
+	if err := deployTerraform(conf, project, nil, nil, opts); err != nil {
+		return fmt.Errorf("failed to deploy terraform resources: %v", err)
 	}
 
-	if err := importBinauthz(project.ID, project.BinauthzPolicy); err != nil {
-		return fmt.Errorf("failed to import binary authorization policy: %v", err)
+	if err := updateLogSinkWriter(project, opts.client()); err != nil {
+		return err
 	}
 
-	if err := deployResources(project); err != nil {
-		return fmt.Errorf("failed to deploy resources: %v", err)
+	if err := deployTerraformAudit(conf, project, nil, nil, opts); err != nil {
+		return fmt.Errorf("failed to deploy terraform audit resources: %v", err)
 	}
+	return deployPostResources(conf, project, opts)
+}
 
+// updateLogSinkWriter records the writer of the log sink of the project and grants it access to the audit logs dataset.
+func updateLogSinkWriter(project *config.Project, c gcp.Client) error {
 	// Always get the latest log sink writer as when the sink is moved between deployments it may
 	// create a new sink writer.
-	sinkSA, err := getLogSinkServiceAccount(project)
+	sinkSA, err := c.GetLogSinkWriter(project.ID, project.BQLogSink.Name())
 	if err != nil {
 		return fmt.Errorf("failed to get log sink service account: %v", err)
 	}
@@ -166,6 +138,7 @@ func DeployResources(conf *config.Config, project *config.Project, opts *Options
 	// Note: if the project was previously deployed, project.Init will already have set the log sink service account permission on the dataset.
 	// An empty currSA implies this is the first time the sink was deployed.
 	if currSA := project.GeneratedFields.LogSinkServiceAccount; currSA == "" {
+		project.GeneratedFields.LogSinkServiceAccount = sinkSA
 		project.AuditLogs.LogsBQDataset.Accesses = append(project.AuditLogs.LogsBQDataset.Accesses, &config.Access{
 			Role: "WRITER", UserByEmail: sinkSA,
 		})
@@ -178,18 +151,18 @@ func DeployResources(conf *config.Config, project *config.Project, opts *Options
 			}
 		}
 	}
+	return nil
+}
 
-	if err := deployAudit(project, conf.ProjectForAuditLogs(project)); err != nil {
-		return fmt.Errorf("failed to deploy audit resources: %v", err)
-	}
-
-	if err := deployGKEWorkloads(project); err != nil {
+// deployPostResources deploys the GKE workloads of the project and removes the owner user once all resources are deployed.
+func deployPostResources(conf *config.Config, project *config.Project, opts *Options) error {
+	if err := deployGKEWorkloads(project, opts); err != nil {
 		return fmt.Errorf("failed to deploy GKE workloads: %v", err)
 	}
 
 	// Only remove owner account if there is an organization to ensure the project has an administrator.
 	if conf.Overall.OrganizationID != "" {
-		if err := removeOwnerUser(project); err != nil {
+		if err := removeOwnerUser(project, opts); err != nil {
 			return fmt.Errorf("failed to remove owner user: %v", err)
 		}
 	}
@@ -202,7 +175,7 @@ func DeployResources(conf *config.Config, project *config.Project, opts *Options
 // This is not a problem on initial deployment since no resources have been created.
 // DM is HIPAA compliant, so it's ok to leave its access.
 // See https://cloud.google.com/iam/docs/granting-changing-revoking-access.
-func grantDeploymentManagerAccess(project *config.Project) error {
+func grantDeploymentManagerAccess(project *config.Project, c gcp.Client) error {
 	pnum := project.GeneratedFields.ProjectNumber
 	if pnum == "" {
 		return fmt.Errorf("project number not set in generated fields %+v", project.GeneratedFields)
@@ -211,7 +184,7 @@ func grantDeploymentManagerAccess(project *config.Project) error {
 
 	// TODO: account for this in the rule generator.
 	for _, role := range deploymentManagerRoles {
-		if err := addBinding(project.ID, serviceAcct, role); err != nil {
+		if err := addBinding(project.ID, serviceAcct, role, c); err != nil {
 			return fmt.Errorf("failed to grant role %q to DM service account %q: %v", role, serviceAcct, err)
 		}
 	}
@@ -219,68 +192,50 @@ func grantDeploymentManagerAccess(project *config.Project) error {
 }
 
 // addBinding adds an IAM policy binding for the given service account for the given role.
-func addBinding(projectID, serviceAccount, role string) error {
-	cmd := exec.Command(
-		"gcloud", "projects", "add-iam-policy-binding", projectID,
-		"--member", fmt.Sprintf("serviceAccount:%s", serviceAccount),
-		"--role", fmt.Sprintf("roles/%s", role),
-		"--project", projectID,
-	)
-	if err := cmdRun(cmd); err != nil {
+func addBinding(projectID, serviceAccount, role string, c gcp.Client) error {
+	if err := c.AddIAMBinding(projectID, fmt.Sprintf("roles/%s", role), fmt.Sprintf("serviceAccount:%s", serviceAccount)); err != nil {
 		return fmt.Errorf("failed to add iam policy binding for service account %q for role %q: %v", serviceAccount, role, err)
 	}
 	return nil
 }
 
-func getLogSinkServiceAccount(project *config.Project) (string, error) {
-	cmd := exec.Command("gcloud", "logging", "sinks", "describe", project.BQLogSink.Name(), "--format", "json", "--project", project.ID)
-
-	out, err := cmdOutput(cmd)
+func deployAudit(project, auditProject *config.Project, c gcp.Client) error {
+	deployment, err := auditDeployment(project)
 	if err != nil {
-		return "", fmt.Errorf("failed to query log sink service account from gcloud: %v", err)
+		return err
 	}
-
-	type sink struct {
-		WriterIdentity string `json:"writerIdentity"`
+	if err := c.UpsertDeployment(auditProject.ID, auditDeploymentNameFor(project), deployment); err != nil {
+		return fmt.Errorf("failed to deploy audit resources: %v", err)
 	}
+	return nil
+}
 
-	s := new(sink)
-	if err := json.Unmarshal(out, s); err != nil {
-		return "", fmt.Errorf("failed to unmarshal sink output: %v", err)
-	}
-	return strings.TrimPrefix(s.WriterIdentity, "serviceAccount:"), nil
+// auditDeploymentNameFor returns the name of the audit deployment of the project.
+// The project ID is appended so each project has unique deployment if there is a remote audit logs project.
+func auditDeploymentNameFor(project *config.Project) string {
+	return fmt.Sprintf("%s-%s", auditDeploymentName, project.ID)
 }
 
-func deployAudit(project, auditProject *config.Project) error {
+// auditDeployment returns the deployment of the audit resources of the project.
+func auditDeployment(project *config.Project) (*deploymentmanager.Deployment, error) {
 	rs := []config.Resource{&project.AuditLogs.LogsBQDataset}
 	if project.AuditLogs.LogsGCSBucket != nil {
 		rs = append(rs, project.AuditLogs.LogsGCSBucket)
 	}
-	deployment, err := getDeployment(project, rs)
-	if err != nil {
-		return err
-	}
-
-	// Append project ID to deployment name so each project has unique deployment if there is
-	// a remote audit logs project.
-	name := fmt.Sprintf("%s-%s", auditDeploymentName, project.ID)
-	if err := upsertDeployment(name, deployment, auditProject.ID); err != nil {
-		return fmt.Errorf("failed to deploy audit resources: %v", err)
-	}
-	return nil
+	return getDeployment(project, rs)
 }
 
-func deployResources(project *config.Project) error {
+func deployResources(project *config.Project, opts *Options) error {
 	rs := project.DeploymentManagerResources()
 	if len(rs) == 0 {
-		log.Println("No resources to deploy.")
+		opts.logf("No resources to deploy.")
 		return nil
 	}
 	deployment, err := getDeployment(project, rs)
 	if err != nil {
 		return err
 	}
-	if err := upsertDeployment(resourceDeploymentName, deployment, project.ID); err != nil {
+	if err := opts.client().UpsertDeployment(project.ID, resourceDeploymentName, deployment); err != nil {
 		return fmt.Errorf("failed to deploy deployment manager resources: %v", err)
 	}
 	return nil
@@ -338,69 +293,38 @@ func getDeployment(project *config.Project, resources []config.Resource) (*deplo
 	return deployment, nil
 }
 
-func removeOwnerUser(project *config.Project) error {
-	cmd := exec.Command("gcloud", "config", "get-value", "account", "--format", "json", "--project", project.ID)
-	out, err := cmdOutput(cmd)
+func removeOwnerUser(project *config.Project, opts *Options) error {
+	c := opts.client()
+	account, err := c.CurrentAccount()
 	if err != nil {
 		return fmt.Errorf("failed to get currently authenticated user: %v", err)
 	}
-	var member string
-	if err := json.Unmarshal(out, &member); err != nil {
-		return fmt.Errorf("failed to unmarshal current user: %v", err)
-	}
 	role := "roles/owner"
-	member = "user:" + member
+	member := "user:" + account
 
 	// TODO: check user specified bindings in case user wants the binding left
-	has, err := hasBinding(project, role, member)
+	policy, err := c.GetIAMPolicy(project.ID)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to get iam policy bindings: %v", err)
 	}
-	if !has {
-		log.Printf("owner user %q already removed", member)
+	if !policy.HasBinding(role, member) {
+		opts.logf("owner user %q already removed", member)
 		return nil
 	}
-
-	cmd = exec.Command(
-		"gcloud", "projects", "remove-iam-policy-binding", project.ID,
-		"--member", member, "--role", role, "--project", project.ID)
-	return cmdRun(cmd)
+	return c.RemoveIAMBinding(project.ID, role, member)
 }
 
-func hasBinding(project *config.Project, role string, member string) (has bool, err error) {
-	cmd := exec.Command(
-		"gcloud", "projects", "get-iam-policy", project.ID,
-		"--project", project.ID,
-		"--format", "json",
-	)
-	out, err := cmdOutput(cmd)
+// deployPrerequisite deploys the CHC resources in the project.
+func deployPrerequisite(project *config.Project, c gcp.Client) error {
+	deployment, err := prerequisiteDeployment(project)
 	if err != nil {
-		return false, fmt.Errorf("failed to get iam policy bindings: %v", err)
-	}
-	log.Printf("Looking for role %q, member %q in:\n%v", role, member, string(out))
-
-	type policy struct {
-		Bindings []config.Binding `json:"bindings"`
-	}
-	p := new(policy)
-	if err := json.Unmarshal(out, p); err != nil {
-		return false, fmt.Errorf("failed to unmarshal get-iam-policy output: %v", err)
-	}
-	for _, b := range p.Bindings {
-		if b.Role == role {
-			for _, m := range b.Members {
-				if m == member {
-					return true, nil
-				}
-			}
-		}
+		return fmt.Errorf("failed to get deployment for pre-requisites: %v", err)
 	}
-
-	return false, nil
+	return c.UpsertDeployment(project.ID, setupPrerequisiteDeploymentName, deployment)
 }
 
-// deployPrerequisite deploys the CHC resources in the project.
-func deployPrerequisite(project *config.Project) error {
+// prerequisiteDeployment returns the deployment of the CHC resources in the project.
+func prerequisiteDeployment(project *config.Project) (*deploymentmanager.Deployment, error) {
 	resources := []config.Resource{
 		&config.DefaultResource{
 			OuterName: "enable-all-audit-log-policies",
@@ -411,11 +335,7 @@ func deployPrerequisite(project *config.Project) error {
 			TmplPath:  "deploy/templates/chc_resource/chc_res_type_provider.jinja",
 		},
 	}
-	deployment, err := getDeployment(project, resources)
-	if err != nil {
-		return fmt.Errorf("failed to get deployment for pre-requisites: %v", err)
-	}
-	return upsertDeployment(setupPrerequisiteDeploymentName, deployment, project.ID)
+	return getDeployment(project, resources)
 }
 
 // verifyOrCreateProject verifies the project if exists or creates the project if does not exist.
@@ -425,45 +345,27 @@ func deployPrerequisite(project *config.Project) error {
 // in the generated fields, it also checks if the project ID corresponds to the project number.
 // In the future, maybe consider changing the folder ID or organization ID of the existing project
 // if different from config.
-func verifyOrCreateProject(conf *config.Config, project *config.Project) error {
-	orgID := conf.Overall.OrganizationID
-	folderID := conf.Overall.FolderID
-	if project.FolderID != "" {
-		folderID = project.FolderID
-	}
-
-	var parentType, parentID string
-	if folderID != "" {
-		parentType = "folder"
-		parentID = folderID
-	} else if orgID != "" {
-		parentType = "organization"
-		parentID = orgID
-	}
+func verifyOrCreateProject(conf *config.Config, project *config.Project, opts *Options) error {
+	c := opts.client()
+	parentType, parentID := projectParent(conf, project)
 
 	// Enforce a check on the existing project number in the generated fields.
-	pnum, err := verifyProject(project.ID, project.GeneratedFields.ProjectNumber, parentType, parentID)
+	pnum, err := verifyProject(project.ID, project.GeneratedFields.ProjectNumber, parentType, parentID, c)
 	if err != nil {
 		return err
 	}
 	if pnum != "" {
 		project.GeneratedFields.ProjectNumber = pnum
-		log.Printf("Project %q exists, skipping project creation.", project.ID)
+		opts.logf("Project %q exists, skipping project creation.", project.ID)
 		return nil
 	}
-	args := []string{"projects", "create", project.ID}
-
 	if parentType == "" {
-		log.Println("Creating project without a parent organization or folder.")
-	} else {
-		args = append(args, fmt.Sprintf("--%s", parentType), parentID)
+		opts.logf("Creating project without a parent organization or folder.")
 	}
-
-	cmd := exec.Command("gcloud", args...)
-	if err := cmdRun(cmd); err != nil {
-		return fmt.Errorf("failed to run project creating command: %v", err)
+	if err := c.CreateProject(project.ID, parentType, parentID); err != nil {
+		return err
 	}
-	pnum, err = verifyProject(project.ID, "", parentType, parentID)
+	pnum, err = verifyProject(project.ID, "", parentType, parentID, c)
 	if err != nil {
 		return fmt.Errorf("failed to verify newly created project: %v", err)
 	}
@@ -472,77 +374,72 @@ func verifyOrCreateProject(conf *config.Config, project *config.Project) error {
 	return nil
 }
 
+// projectParent returns the type and ID of the parent of the project.
+// Both are empty if the project has no parent organization or folder.
+func projectParent(conf *config.Config, project *config.Project) (parentType, parentID string) {
+	folderID := conf.Overall.FolderID
+	if project.FolderID != "" {
+		folderID = project.FolderID
+	}
+	switch {
+	case folderID != "":
+		return "folder", folderID
+	case conf.Overall.OrganizationID != "":
+		return "organization", conf.Overall.OrganizationID
+	default:
+		return "", ""
+	}
+}
+
 // verifyProject checks project existence and enforces project config metadata.
 // It returns the project number if exists and error if any.
-func verifyProject(projectID, projectNumber, parentType, parentID string) (string, error) {
-	cmd := exec.Command("gcloud", "projects", "describe", projectID, "--format", "json")
-	out, err := cmdOutput(cmd)
+func verifyProject(projectID, projectNumber, parentType, parentID string, c gcp.Client) (string, error) {
+	p, err := c.GetProject(projectID)
 	if err != nil {
-		// `gcloud projects describe` command might fail due to reasons other than project does not
-		// exist (e.g. caller does not have sufficient permission). In that case, project could exist
-		// and the code will return project existence as false. The caller might still attempt to create
-		// the project and fail if the project already exists.
+		return "", fmt.Errorf("failed to get project %q: %v", projectID, err)
+	}
+	if p == nil {
 		return "", nil
 	}
 
 	// Project exists.
-	type resourceID struct {
-		ID   string `json:"id"`
-		Type string `json:"type"`
-	}
-	type projectInfo struct {
-		ProjectNumber  string     `json:"projectNumber"`
-		LifecycleState string     `json:"lifecycleState"`
-		Parent         resourceID `json:"parent"`
-	}
-
-	var pi projectInfo
-	if err := json.Unmarshal(out, &pi); err != nil {
-		return "", fmt.Errorf("failed to unmarshal project info output: %v", err)
-	}
-
-	if pi.ProjectNumber == "" {
-		return "", fmt.Errorf("got empty project number: %v", err)
+	if p.ProjectNumber == "" {
+		return "", errors.New("got empty project number")
 	}
 
 	// Enforce check on the input project number if not empty.
-	wantProjectNumber := pi.ProjectNumber
+	wantProjectNumber := p.ProjectNumber
 	if projectNumber != "" {
 		wantProjectNumber = projectNumber
 	}
-	wantInfo := projectInfo{
+	want := gcp.Project{
 		ProjectNumber:  wantProjectNumber,
 		LifecycleState: "ACTIVE",
-		Parent: resourceID{
+		Parent: gcp.Resource{
 			Type: parentType,
 			ID:   parentID,
 		},
 	}
 
-	if pi != wantInfo {
-		return "", fmt.Errorf("project exists but has unexpected metadata: got %+v, want %+v", pi, wantInfo)
+	if *p != want {
+		return "", fmt.Errorf("project exists but has unexpected metadata: got %+v, want %+v", *p, want)
 	}
-	return pi.ProjectNumber, nil
+	return p.ProjectNumber, nil
 }
 
 // setupBilling sets the billing account for the project.
-func setupBilling(project *config.Project, defaultBillingAccount string) error {
+func setupBilling(project *config.Project, defaultBillingAccount string, c gcp.Client) error {
 	ba := defaultBillingAccount
 	if project.BillingAccount != "" {
 		ba = project.BillingAccount
 	}
-
-	cmd := exec.Command("gcloud", "beta", "billing", "projects", "link", project.ID, "--billing-account", ba)
-	if err := cmdRun(cmd); err != nil {
-		return fmt.Errorf("failed to link project to billing account %q: %v", ba, err)
-	}
-	return nil
+	return c.LinkBillingAccount(project.ID, ba)
 }
 
 // enableServiceAPIs enables service APIs for this project.
 // Use this function instead of enabling private APIs in deployment manager because deployment
 // management does not have all the APIs' access, which might triger PERMISSION_DENIED errors.
-func enableServiceAPIs(project *config.Project) error {
+func enableServiceAPIs(project *config.Project, c gcp.Client) error {
 	m := make(map[string]bool)
 	for _, a := range project.EnabledAPIs {
 		m[a] = true
@@ -569,25 +466,7 @@ func enableServiceAPIs(project *config.Project) error {
 	for a := range m {
 		wantAPIs = append(wantAPIs, a)
 	}
-
-	min := func(x, y int) int {
-		if x < y {
-			return x
-		}
-		return y
-	}
-
-	// Send in batches to avoid hitting quota limits.
-	batchN := 10
-	for i := 0; i < len(wantAPIs); i += batchN {
-		args := []string{"--project", project.ID, "services", "enable"}
-		args = append(args, wantAPIs[i:min(i+batchN, len(wantAPIs))]...)
-		cmd := exec.Command("gcloud", args...)
-		if err := cmdRun(cmd); err != nil {
-			return fmt.Errorf("failed to enable service APIs: %v", err)
-		}
-	}
-	return nil
+	return c.EnableServices(project.ID, wantAPIs)
 }
 
 // createComputeImages creates new custom Compute Engine VM images, if specified.
@@ -595,76 +474,77 @@ func enableServiceAPIs(project *config.Project) error {
 // service account doesn't need to be granted access to the image GCS bucket.
 // Note: for updates, only new images will be created. Existing images will not be modified.
 // TODO no longer need this after migrating to Terraform.
-func createCustomComputeImages(project *config.Project) error {
+func createCustomComputeImages(project *config.Project, opts *Options) error {
 	if len(project.Resources.GCEInstances) == 0 {
-		log.Println("No GCE images to create.")
+		opts.logf("No GCE images to create.")
 		return nil
 	}
+	c := opts.client()
 	for _, i := range project.Resources.GCEInstances {
 		if i.CustomBootImage == nil {
 			continue
 		}
 		// Check if custom image already exists.
-		cmd := exec.Command("gcloud", "--project", project.ID, "compute", "images", "list",
-			"--no-standard-images", "--filter", fmt.Sprintf("name=%s", i.CustomBootImage.ImageName), "--format", "value(name)")
-		out, err := cmdOutput(cmd)
+		exists, err := c.ImageExists(project.ID, i.CustomBootImage.ImageName)
 		if err != nil {
-			return fmt.Errorf("failed to check the existence of custom image %q: %v", i.CustomBootImage.ImageName, err)
+			return err
 		}
-		if len(bytes.TrimSpace(out)) != 0 {
-			log.Printf("Custom image %q already exists, skipping image creation.", i.CustomBootImage.ImageName)
+		if exists {
+			opts.logf("Custom image %q already exists, skipping image creation.", i.CustomBootImage.ImageName)
 			continue
 		}
 		// Create the image.
-		cmd = exec.Command("gcloud", "--project", project.ID, "compute", "images", "create", i.CustomBootImage.ImageName, "--source-uri", fmt.Sprintf("gs://%s", i.CustomBootImage.GCSPath))
-		if err := cmdRun(cmd); err != nil {
-			return fmt.Errorf("failed to create custom image %q: %v", i.CustomBootImage.ImageName, err)
+		if err := c.CreateImage(project.ID, i.CustomBootImage.ImageName, fmt.Sprintf("gs://%s", i.CustomBootImage.GCSPath)); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
 // createDeletionLien create the project deletion lien, if specified.
-func createDeletionLien(project *config.Project) error {
+func createDeletionLien(project *config.Project, opts *Options) error {
 	if !project.CreateDeletionLien {
 		return nil
 	}
+	c := opts.client()
 
-	defaultLien := "resourcemanager.projects.delete"
-	cmd := exec.Command("gcloud", "--project", project.ID, "alpha", "resource-manager", "liens",
-		"list", "--filter", fmt.Sprintf("restrictions=%s", defaultLien), "--format", "value(restrictions)")
-	out, err := cmdOutput(cmd)
+	liens, err := c.ListLiens(project.ID)
 	if err != nil {
 		return fmt.Errorf("failed to check existing deletion liens: %v", err)
 	}
-	if len(bytes.TrimSpace(out)) != 0 {
-		log.Printf("Restriction lien %q already exists, skipping lien creation.", defaultLien)
-		return nil
+	for _, l := range liens {
+		for _, r := range l.Restrictions {
+			if r == deletionLienRestriction {
+				opts.logf("Restriction lien %q already exists, skipping lien creation.", deletionLienRestriction)
+				return nil
+			}
+		}
 	}
 	// Create the lien.
-	cmd = exec.Command("gcloud", "--project", project.ID, "alpha", "resource-manager", "liens",
-		"create", "--restrictions", defaultLien, "--reason", "Automated project deletion lien deployment.")
-	if err := cmdRun(cmd); err != nil {
-		return fmt.Errorf("failed to create restriction lien %q: %v", defaultLien, err)
-	}
-	return nil
+	return c.CreateLien(project.ID, deletionLienRestriction, "Automated project deletion lien deployment.")
 }
 
 // TODO use Terraform once https://github.com/terraform-providers/terraform-provider-google/issues/2605 is resolved.
 // createStackdriverAccount prompts the user to create a new Stackdriver Account.
-func createStackdriverAccount(project *config.Project) error {
+// In non-interactive mode, it emits an event asking for the account and waits for it to be created instead.
+func createStackdriverAccount(project *config.Project, opts *Options) error {
 	if project.StackdriverAlertEmail == "" {
-		log.Println("No Stackdriver alert email specified, skipping creation of Stackdriver account.")
+		opts.logf("No Stackdriver alert email specified, skipping creation of Stackdriver account.")
 		return nil
 	}
-	exist, err := stackdriverAccountExists(project.ID)
+	c := opts.client()
+	exist, err := c.MonitoringWorkspaceExists(project.ID)
 	if err != nil {
 		return err
 	}
 	if exist {
-		log.Println("Stackdriver account already exists.")
+		opts.logf("Stackdriver account already exists.")
+		removeWarning(project.GeneratedFields, missingStackdriverWarning)
 		return nil
 	}
+	if opts.NonInteractive {
+		return waitForStackdriverAccount(project, opts)
+	}
 
 	message := fmt.Sprintf(`
 ------------------------------------------------------------------------------
@@ -683,7 +563,7 @@ After the account is created, enter [yes] to continue, or enter [no] to skip the
 creation of Stackdriver account and terminate the deployment.
 ------------------------------------------------------------------------------
 `, project.ID)
-	log.Println(message)
+	opts.logf("%s", message)
 
 	// Keep trying until Stackdriver account is ready, or user skips.
 	for {
@@ -694,15 +574,16 @@ creation of Stackdriver account and terminate the deployment.
 		if !ok {
 			return errors.New("user skipped the creation of Stackdriver account")
 		}
-		exist, err := stackdriverAccountExists(project.ID)
+		exist, err := c.MonitoringWorkspaceExists(project.ID)
 		if err != nil {
 			return err
 		}
 		if exist {
-			log.Println("Stackdriver account has been created.")
+			opts.logf("Stackdriver account has been created.")
+			removeWarning(project.GeneratedFields, missingStackdriverWarning)
 			break
 		}
-		log.Println(`
+		opts.logf(`
 ------------------------------------------------------------------------------
 The account is not created yet. It can take several minutes for it to be created.
 
@@ -714,24 +595,67 @@ creation of Stackdriver account and terminate the deployment.
 	return nil
 }
 
-// stackdriverAccountExists checks whether a Stackdriver account exists in the project.
-func stackdriverAccountExists(projectID string) (bool, error) {
-	cmd := exec.Command("gcloud", "--project", projectID, "alpha", "monitoring", "policies", "list")
-	out, err := cmdCombinedOutput(cmd)
-	if err != nil {
-		if strings.Contains(string(out), "not a Stackdriver workspace") {
-			return false, nil
+// waitForStackdriverAccount emits an event asking to create the Stackdriver account of the project and
+// polls until it is created or the Stackdriver timeout passed.
+func waitForStackdriverAccount(project *config.Project, opts *Options) error {
+	url := fmt.Sprintf("https://console.cloud.google.com/monitoring?project=%s", project.ID)
+	if err := opts.emit(&Event{
+		Type:    "action_required",
+		Project: project.ID,
+		Action:  "create_stackdriver_workspace",
+		URL:     url,
+		Message: "Create a new Stackdriver account for this project, only adding this project.",
+	}); err != nil {
+		return err
+	}
+
+	c := opts.client()
+	deadline := time.Now().Add(opts.StackdriverTimeout)
+	for {
+		exist, err := c.MonitoringWorkspaceExists(project.ID)
+		if err != nil {
+			return err
+		}
+		if exist {
+			opts.logf("Stackdriver account has been created")
+			removeWarning(project.GeneratedFields, missingStackdriverWarning)
+			return nil
 		}
-		return false, fmt.Errorf("failed to check stackdriver account existence: %v [%s]", err, string(out))
+		if !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(stackdriverPollInterval)
 	}
-	return true, nil
-}
 
-func createAlerts() error {
-	//TODO add logic.
+	if !opts.SkipMissingStackdriver {
+		return fmt.Errorf("Stackdriver account was not created within %v, create it at %s", opts.StackdriverTimeout, url)
+	}
+	opts.logf("WARNING: Stackdriver account was not created within %v, skipping creation of Stackdriver alerts", opts.StackdriverTimeout)
+	addWarning(project.GeneratedFields, missingStackdriverWarning)
 	return nil
 }
 
+// addWarning records the warning in the generated fields, unless it is already recorded.
+func addWarning(gf *config.GeneratedFields, warning string) {
+	for _, w := range gf.Warnings {
+		if w == warning {
+			return
+		}
+	}
+	gf.Warnings = append(gf.Warnings, warning)
+}
+
+// removeWarning removes the warning from the generated fields once its cause was fixed.
+func removeWarning(gf *config.GeneratedFields, warning string) {
+	var ws []string
+	for _, w := range gf.Warnings {
+		if w != warning {
+			ws = append(ws, w)
+		}
+	}
+	gf.Warnings = ws
+}
+
 // askForConfirmation prompts the user to answer yes or no for confirmation.
 func askForConfirmation() (bool, error) {
 	var resp string
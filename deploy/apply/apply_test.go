@@ -18,17 +18,16 @@ package apply
 
 import (
 	"bytes"
-	"errors"
-	"fmt"
-	"os"
-	"os/exec"
+	"encoding/json"
 	"path/filepath"
 	"strings"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/testconf"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -169,22 +168,6 @@ resources:
 `
 
 func TestDeploy(t *testing.T) {
-	cmdRun = func(cmd *exec.Cmd) error { return nil }
-	origCmdOutput := cmdOutput
-	cmdOutput = func(cmd *exec.Cmd) ([]byte, error) {
-		args := strings.Join(cmd.Args, " ")
-		var res string
-		switch {
-		case strings.HasPrefix(args, "gcloud config get-value account"):
-			res = `"foo-user@my-domain.com"`
-		case strings.HasPrefix(args, "gcloud projects get-iam-policy"):
-			res = "{}"
-		default:
-			return origCmdOutput(cmd)
-		}
-		return []byte(res), nil
-	}
-
 	tests := []struct {
 		name       string
 		configData *testconf.ConfigData
@@ -521,31 +504,22 @@ resources:
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			conf, project := testconf.ConfigAndProject(t, tc.configData)
+			fake := newFakeWithProject(conf, project)
 
-			type upsertCall struct {
-				Name       string
-				Deployment *deploymentmanager.Deployment
-				ProjectID  string
-			}
-
-			var got []upsertCall
-			upsertDeployment = func(name string, deployment *deploymentmanager.Deployment, projectID string) error {
-				got = append(got, upsertCall{name, deployment, projectID})
-				return nil
-			}
-
-			if err := DeployResources(conf, project, &Options{EnableTerraform: false}); err != nil {
+			if err := DeployResources(conf, project, &Options{EnableTerraform: false, Client: fake}); err != nil {
 				t.Fatalf("Deploy: %v", err)
 			}
 
-			want := []upsertCall{
-				{"data-protect-toolkit-prerequisites", parseTemplateToDeployment(t, wantPreRequisiteDeploymentYAML), project.ID},
-				{"data-protect-toolkit-resources", wantResourceDeployment(t, tc.want), project.ID},
-				{"data-protect-toolkit-audit-my-project", parseTemplateToDeployment(t, wantAuditDeploymentYAML), project.ID},
+			got := fake.Project(project.ID).Deployments
+			want := map[string]*deploymentmanager.Deployment{
+				"data-protect-toolkit-prerequisites":    parseTemplateToDeployment(t, wantPreRequisiteDeploymentYAML),
+				"data-protect-toolkit-resources":        wantResourceDeployment(t, tc.want),
+				"data-protect-toolkit-audit-my-project": parseTemplateToDeployment(t, wantAuditDeploymentYAML),
 			}
 
-			// allow imports and resources to be in any order
+			// allow imports and resources to be in any order, the fake stores deployments as JSON so empty properties are dropped
 			opts := []cmp.Option{
+				cmpopts.EquateEmpty(),
 				cmpopts.SortSlices(func(a, b *deploymentmanager.Resource) bool { return a.Name < b.Name }),
 				cmpopts.SortSlices(func(a, b *deploymentmanager.Import) bool { return a.Path < b.Path }),
 			}
@@ -559,141 +533,105 @@ resources:
 }
 
 func TestVerifyProject(t *testing.T) {
-
 	tests := []struct {
 		name           string
-		projectID      string
 		projectNum     string
 		parentType     string
 		parentID       string
-		resp           string
-		err            error
+		project        *gcp.Project
 		wantProjectNum string
 		wantErr        bool
 	}{
 		{
 			name:       "valid_project",
-			projectID:  "my_project",
 			parentType: "folder",
 			parentID:   "5678",
-			resp: `{
-  "lifecycleState": "ACTIVE",
-  "name": "my_project",
-  "parent": {
-    "id": "5678",
-    "type": "folder"
-  },
-  "projectNumber": "0000"
-}`,
+			project: &gcp.Project{
+				ProjectNumber:  "0000",
+				LifecycleState: "ACTIVE",
+				Parent:         gcp.Resource{ID: "5678", Type: "folder"},
+			},
 			wantProjectNum: "0000",
 		},
 		{
 			name:       "valid_project_with_existing_project_number",
-			projectID:  "my_project",
 			projectNum: "0000",
 			parentType: "folder",
 			parentID:   "5678",
-			resp: `{
-  "lifecycleState": "ACTIVE",
-  "name": "my_project",
-  "parent": {
-    "id": "5678",
-    "type": "folder"
-  },
-  "projectNumber": "0000"
-}`,
+			project: &gcp.Project{
+				ProjectNumber:  "0000",
+				LifecycleState: "ACTIVE",
+				Parent:         gcp.Resource{ID: "5678", Type: "folder"},
+			},
 			wantProjectNum: "0000",
 		},
 		{
 			name:       "invalid_project_number",
-			projectID:  "my_project",
 			projectNum: "wrong_number",
 			parentType: "folder",
 			parentID:   "5678",
-			resp: `{
-  "lifecycleState": "ACTIVE",
-  "name": "my_project",
-  "parent": {
-    "id": "5678",
-    "type": "folder"
-  },
-  "projectNumber": "0000"
-}`,
+			project: &gcp.Project{
+				ProjectNumber:  "0000",
+				LifecycleState: "ACTIVE",
+				Parent:         gcp.Resource{ID: "5678", Type: "folder"},
+			},
 			wantErr: true,
 		},
 		{
 			name:       "invalid_project_state",
-			projectID:  "my_project",
 			parentType: "folder",
 			parentID:   "5678",
-			resp: `{
-  "lifecycleState": "DELETE_REQUESTED",
-  "name": "my_project",
-  "parent": {
-    "id": "5678",
-    "type": "folder"
-  },
-  "projectNumber": "0000"
-}`,
+			project: &gcp.Project{
+				ProjectNumber:  "0000",
+				LifecycleState: "DELETE_REQUESTED",
+				Parent:         gcp.Resource{ID: "5678", Type: "folder"},
+			},
 			wantErr: true,
 		},
 		{
 			name:       "invalid_project_folder_id",
-			projectID:  "my_project",
 			parentType: "folder",
 			parentID:   "5678",
-			resp: `{
-  "lifecycleState": "ACTIVE",
-  "name": "my_project",
-  "parent": {
-    "id": "wrong_id",
-    "type": "folder"
-  },
-  "projectNumber": "0000"
-}`,
+			project: &gcp.Project{
+				ProjectNumber:  "0000",
+				LifecycleState: "ACTIVE",
+				Parent:         gcp.Resource{ID: "wrong_id", Type: "folder"},
+			},
 			wantErr: true,
 		},
 		{
 			name:       "invalid_project_org_id",
-			projectID:  "my_project",
 			parentType: "organization",
 			parentID:   "5678",
-			resp: `{
-  "lifecycleState": "ACTIVE",
-  "name": "my_project",
-  "parent": {
-    "id": "wrong_id",
-    "type": "organization"
-  },
-  "projectNumber": "0000"
-}`,
+			project: &gcp.Project{
+				ProjectNumber:  "0000",
+				LifecycleState: "ACTIVE",
+				Parent:         gcp.Resource{ID: "wrong_id", Type: "organization"},
+			},
 			wantErr: true,
 		},
 		{
-			name:       "invalid_response",
-			projectID:  "my_project",
+			name:       "empty_project_number",
 			parentType: "folder",
 			parentID:   "5678",
-			resp:       `{}`,
+			project:    &gcp.Project{},
 			wantErr:    true,
 		},
 		{
-			name:      "cmd_failed",
-			projectID: "my_project",
-			err:       errors.New("Project does not exist"),
+			name: "project_does_not_exist",
 		},
 	}
 
-	origCmdOutput := cmdOutput
-	defer func() { cmdOutput = origCmdOutput }()
+	const projectID = "my-project"
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			cmdOutput = func(cmd *exec.Cmd) ([]byte, error) {
-				return []byte(tc.resp), tc.err
+			fake := gcp.NewFake()
+			if tc.project != nil {
+				fake.AddProject(projectID, "", "", "").Project = *tc.project
 			}
-			gotProjectNum, gotErr := verifyProject(tc.projectID, tc.projectNum, tc.parentType, tc.parentID)
+			gotProjectNum, gotErr := verifyProject(projectID, tc.projectNum, tc.parentType, tc.parentID, fake)
 			if gotProjectNum != tc.wantProjectNum || (gotErr != nil) != tc.wantErr {
-				t.Fatalf("verifyProject(%s, %s, %s, %s) = %q, %v; want %q, error %t", tc.projectID, tc.projectNum, tc.parentType, tc.parentID, gotProjectNum, gotErr, tc.wantProjectNum, tc.wantErr)
+				t.Fatalf("verifyProject(%s, %s, %s, %s) = %q, %v; want %q, error %t", projectID, tc.projectNum, tc.parentType, tc.parentID, gotProjectNum, gotErr, tc.wantProjectNum, tc.wantErr)
 			}
 		})
 	}
@@ -701,161 +639,271 @@ func TestVerifyProject(t *testing.T) {
 
 func TestSetupBilling(t *testing.T) {
 	tests := []struct {
-		name          string
-		project       *config.Project
-		defaultBA     string
-		wantSubstring string
+		name      string
+		project   *config.Project
+		defaultBA string
+		wantBA    string
 	}{
 		{
 			name: "project_with_billing_account",
 			project: &config.Project{
-				ID:             "my_project",
+				ID:             "my-project",
 				BillingAccount: "my_billing_account",
 			},
-			defaultBA:     "default_billing_account",
-			wantSubstring: "--billing-account my_billing_account",
+			defaultBA: "default_billing_account",
+			wantBA:    "my_billing_account",
 		},
 		{
 			name: "project_without_billing_account",
 			project: &config.Project{
-				ID: "my_project",
+				ID: "my-project",
 			},
-			defaultBA:     "default_billing_account",
-			wantSubstring: "--billing-account default_billing_account",
+			defaultBA: "default_billing_account",
+			wantBA:    "default_billing_account",
 		},
 	}
-	origCmdRun := cmdRun
-	defer func() { cmdRun = origCmdRun }()
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			got := ""
-			cmdRun = func(cmd *exec.Cmd) error {
-				if got != "" {
-					t.Fatal("cmdRun is called more than once")
-				}
-				got = strings.Join(cmd.Args, " ")
-				return nil
-			}
-			if err := setupBilling(tc.project, tc.defaultBA); err != nil {
+			fake := gcp.NewFake()
+			fake.AddProject(tc.project.ID, "1111", "", "")
+			if err := setupBilling(tc.project, tc.defaultBA, fake); err != nil {
 				t.Fatalf("setupBilling = %v", err)
 			}
-			if !strings.Contains(got, tc.wantSubstring) {
-				t.Fatalf("command %q does not contain expected substring %q", got, tc.wantSubstring)
+			if got := fake.Project(tc.project.ID).BillingAccount; got != tc.wantBA {
+				t.Fatalf("billing account = %q, want %q", got, tc.wantBA)
 			}
 		})
 	}
 }
 
 func TestCreateDeletionLien(t *testing.T) {
+	const restriction = "resourcemanager.projects.delete"
 	tests := []struct {
-		name            string
-		project         *config.Project
-		cmdOutput       string
-		wantEmptyCmdRun bool
+		name          string
+		project       *config.Project
+		existingLiens []*gcp.Lien
+		wantLiens     int
 	}{
 		{
 			name: "lien_not_requested",
 			project: &config.Project{
-				ID: "my_project",
+				ID: "my-project",
 			},
-			wantEmptyCmdRun: true,
 		},
 		{
 			name: "lien_requested_and_created",
 			project: &config.Project{
-				ID:                 "my_project",
+				ID:                 "my-project",
 				CreateDeletionLien: true,
 			},
+			wantLiens: 1,
 		},
 		{
 			name: "lien_requested_and_already_exist",
 			project: &config.Project{
-				ID:                 "my_project",
+				ID:                 "my-project",
 				CreateDeletionLien: true,
 			},
-			cmdOutput:       "resourcemanager.projects.delete",
-			wantEmptyCmdRun: true,
+			existingLiens: []*gcp.Lien{{Name: "liens/existing", Restrictions: []string{restriction}}},
+			wantLiens:     1,
 		},
 	}
-	origCmdRun := cmdRun
-	defer func() { cmdRun = origCmdRun }()
-	origCmdOutput := cmdOutput
-	defer func() { cmdOutput = origCmdOutput }()
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			var got string
-			cmdRun = func(cmd *exec.Cmd) error {
-				if got != "" {
-					t.Fatal("cmdRun is called more than once")
-				}
-				got = strings.Join(cmd.Args, " ")
-				return nil
-			}
-			cmdOutput = func(cmd *exec.Cmd) ([]byte, error) {
-				return []byte(tc.cmdOutput), nil
-			}
-			if err := createDeletionLien(tc.project); err != nil {
+			fake := gcp.NewFake()
+			fake.AddProject(tc.project.ID, "1111", "", "").Liens = tc.existingLiens
+			if err := createDeletionLien(tc.project, &Options{Client: fake}); err != nil {
 				t.Fatalf("createDeletionLien = %v", err)
 			}
-			if (len(got) == 0) != tc.wantEmptyCmdRun {
-				t.Fatalf("createDeletionLien(%v) cmdRun args empty = %t; want %t", tc.project, len(got) == 0, tc.wantEmptyCmdRun)
+			liens := fake.Project(tc.project.ID).Liens
+			if len(liens) != tc.wantLiens {
+				t.Fatalf("createDeletionLien(%v) got %d liens; want %d", tc.project, len(liens), tc.wantLiens)
+			}
+			for _, l := range liens {
+				if diff := cmp.Diff(l.Restrictions, []string{restriction}); diff != "" {
+					t.Errorf("lien restrictions differ (-got +want):\n%v", diff)
+				}
 			}
 		})
 	}
 }
 
-func TestStackdriverAccountExist(t *testing.T) {
-	projectID := "my_project"
+func TestDefault(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, &testconf.ConfigData{`
+create_deletion_lien: true`})
+	// Deploy a new project.
+	*project.GeneratedFields = config.GeneratedFields{}
+
+	fake := gcp.NewFake()
+	opts := &Options{EnableForseti: true, Client: fake}
+	if err := Default(conf, project, opts); err != nil {
+		t.Fatalf("Default = %v", err)
+	}
+
+	p := fake.Project(project.ID)
+	if p == nil {
+		t.Fatal("project was not created")
+	}
+	wantParent := gcp.Resource{Type: "folder", ID: "98765321"}
+	if p.Parent != wantParent {
+		t.Errorf("project parent = %+v, want %+v", p.Parent, wantParent)
+	}
+	if got, want := project.GeneratedFields.ProjectNumber, p.ProjectNumber; got != want {
+		t.Errorf("generated project number = %q, want %q", got, want)
+	}
+	if got, want := project.GeneratedFields.LogSinkServiceAccount, p.LogSinkWriters["audit-logs-to-bigquery"]; got == "" || got != want {
+		t.Errorf("generated log sink service account = %q, want %q", got, want)
+	}
+	if got, want := p.BillingAccount, "000000-000000-000000"; got != want {
+		t.Errorf("billing account = %q, want %q", got, want)
+	}
+	for _, s := range []string{"deploymentmanager.googleapis.com", "cloudresourcemanager.googleapis.com"} {
+		if !p.Services[s] {
+			t.Errorf("service %q not enabled", s)
+		}
+	}
+	if len(p.Liens) != 1 {
+		t.Errorf("got %d liens, want 1", len(p.Liens))
+	}
+	dmSA := "serviceAccount:" + p.ProjectNumber + "@cloudservices.gserviceaccount.com"
+	if !p.Policy.HasBinding("roles/owner", dmSA) {
+		t.Errorf("deployment manager service account %q is not owner", dmSA)
+	}
+	if owner := "user:" + fake.Account; p.Policy.HasBinding("roles/owner", owner) {
+		t.Errorf("creating user %q is still owner", owner)
+	}
+	for _, d := range []string{"data-protect-toolkit-prerequisites", "data-protect-toolkit-resources", "data-protect-toolkit-audit-my-project"} {
+		if p.Deployments[d] == nil {
+			t.Errorf("deployment %q not found", d)
+		}
+	}
+	forsetiMember := "serviceAccount:" + conf.AllGeneratedFields.Forseti.ServiceAccount
+	if !p.Policy.HasBinding("roles/iam.securityReviewer", forsetiMember) {
+		t.Errorf("forseti service account %q is not security reviewer", forsetiMember)
+	}
+
+	// Updating the deployed project must not create it again or add another lien.
+	if err := Default(conf, project, opts); err != nil {
+		t.Fatalf("Default update = %v", err)
+	}
+	if got := fake.Project(project.ID); got != p {
+		t.Error("project was recreated on update")
+	}
+	if len(p.Liens) != 1 {
+		t.Errorf("got %d liens after update, want 1", len(p.Liens))
+	}
+}
+
+// workspaceClient is a client whose project becomes a Stackdriver workspace after the given number of checks.
+type workspaceClient struct {
+	gcp.Client
+	checks       int
+	createdAfter int
+}
+
+func (c *workspaceClient) MonitoringWorkspaceExists(string) (bool, error) {
+	c.checks++
+	return c.createdAfter >= 0 && c.checks > c.createdAfter, nil
+}
+
+func TestCreateStackdriverAccountNonInteractive(t *testing.T) {
+	oldInterval := stackdriverPollInterval
+	stackdriverPollInterval = time.Millisecond
+	defer func() { stackdriverPollInterval = oldInterval }()
+
 	tests := []struct {
-		name      string
-		cmdError  error
-		cmdOutput string
-		wantExist bool
-		wantErr   bool
+		name string
+		// createdAfter is the number of checks after which the account exists, or -1 if it is never created.
+		createdAfter int
+		prevWarnings []string
+		skip         bool
+		wantErr      bool
+		wantWarnings []string
+		wantEvents   int
 	}{
 		{
-			name:      "account_exist",
-			cmdOutput: "Listed 0 items.",
-			wantExist: true,
+			name:         "already_exists",
+			createdAfter: 0,
+			prevWarnings: []string{missingStackdriverWarning},
 		},
 		{
-			name:      "account_does_not_exist",
-			cmdError:  errors.New(""),
-			cmdOutput: fmt.Sprintf("INVALID_ARGUMENT: 'projects/%s' is not a Stackdriver workspace.", projectID),
+			name:         "created_while_waiting",
+			createdAfter: 2,
+			wantEvents:   1,
 		},
 		{
-			name:      "unexpected_cmd_error",
-			cmdError:  errors.New(""),
-			cmdOutput: fmt.Sprintf("does not have permission to access project [%s]", projectID),
-			wantErr:   true,
+			name:         "timeout",
+			createdAfter: -1,
+			wantErr:      true,
+			wantEvents:   1,
+		},
+		{
+			name:         "timeout_skipped",
+			createdAfter: -1,
+			skip:         true,
+			wantWarnings: []string{missingStackdriverWarning},
+			wantEvents:   1,
 		},
 	}
 
-	origCmdCombinedOutput := cmdCombinedOutput
-	defer func() { cmdCombinedOutput = origCmdCombinedOutput }()
-
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			cmdCombinedOutput = func(cmd *exec.Cmd) ([]byte, error) {
-				return []byte(tc.cmdOutput), tc.cmdError
+			conf, project := testconf.ConfigAndProject(t, &testconf.ConfigData{`
+stackdriver_alert_email: alerts@my-domain.com`})
+			project.GeneratedFields.Warnings = tc.prevWarnings
+			var events bytes.Buffer
+			opts := &Options{
+				Client:                 &workspaceClient{Client: newFakeWithProject(conf, project), createdAfter: tc.createdAfter},
+				NonInteractive:         true,
+				StackdriverTimeout:     50 * time.Millisecond,
+				SkipMissingStackdriver: tc.skip,
+				Events:                 &events,
+			}
+			err := createStackdriverAccount(project, opts)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("createStackdriverAccount = %v, want error %t", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(project.GeneratedFields.Warnings, tc.wantWarnings, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("warnings differ (-got +want):\n%v", diff)
+			}
+
+			lines := strings.Split(strings.TrimSpace(events.String()), "\n")
+			if tc.wantEvents == 0 {
+				if events.Len() != 0 {
+					t.Errorf("got events %q, want none", events.String())
+				}
+				return
+			}
+			if len(lines) != tc.wantEvents {
+				t.Fatalf("got %d events, want %d: %q", len(lines), tc.wantEvents, events.String())
 			}
-			exist, err := stackdriverAccountExists(projectID)
-			if exist != tc.wantExist || (err != nil) != tc.wantErr {
-				t.Fatalf("stackdriverAccountExists(%s) = %t, %v; want %t, error %t", projectID, exist, err, tc.wantExist, tc.wantErr)
+			got := new(Event)
+			if err := json.Unmarshal([]byte(lines[0]), got); err != nil {
+				t.Fatalf("json.Unmarshal event = %v", err)
+			}
+			want := &Event{
+				Type:    "action_required",
+				Project: "my-project",
+				Action:  "create_stackdriver_workspace",
+				URL:     "https://console.cloud.google.com/monitoring?project=my-project",
+				Message: "Create a new Stackdriver account for this project, only adding this project.",
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("event differs (-got +want):\n%v", diff)
 			}
 		})
 	}
 }
 
-func TestGetLogSinkServiceAccount(t *testing.T) {
-	_, project := testconf.ConfigAndProject(t, nil)
-	got, err := getLogSinkServiceAccount(project)
-	want := "p12345-999999@gcp-sa-logging.iam.gserviceaccount.com"
-	if got != want || err != nil {
-		t.Errorf("getLogSinkServiceAccount(%v) = %q, %v; want %q, nil", project, got, err, want)
-	}
+// newFakeWithProject returns a fake with the deployed project.
+func newFakeWithProject(conf *config.Config, project *config.Project) *gcp.Fake {
+	fake := gcp.NewFake()
+	parentType, parentID := projectParent(conf, project)
+	p := fake.AddProject(project.ID, project.GeneratedFields.ProjectNumber, parentType, parentID)
+	p.LogSinkWriters[project.BQLogSink.Name()] = "p12345-999999@gcp-sa-logging.iam.gserviceaccount.com"
+	return fake
 }
 
 func wantResourceDeployment(t *testing.T, yamlTemplate string) *deploymentmanager.Deployment {
@@ -895,25 +943,3 @@ func abs(p string) string {
 	}
 	return a
 }
-
-func TestMain(m *testing.M) {
-	const logSinkJSON = `{
-		"createTime": "2019-04-15T20:00:16.734389353Z",
-		"destination": "bigquery.googleapis.com/projects/my-project/datasets/audit_logs",
-		"filter": "logName:\"logs/cloudaudit.googleapis.com\"",
-		"name": "audit-logs-to-bigquery",
-		"outputVersionFormat": "V2",
-		"updateTime": "2019-04-15T20:00:16.734389353Z",
-		"writerIdentity": "serviceAccount:p12345-999999@gcp-sa-logging.iam.gserviceaccount.com"
-	}`
-
-	cmdOutput = func(cmd *exec.Cmd) ([]byte, error) {
-		args := []string{"gcloud", "logging", "sinks", "describe"}
-		if cmp.Equal(cmd.Args[:len(args)], args) {
-			return []byte(logSinkJSON), nil
-		}
-		return nil, fmt.Errorf("unexpected args: %v", cmd.Args)
-	}
-
-	os.Exit(m.Run())
-}
@@ -0,0 +1,301 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+)
+
+// deletionLienRestriction is the restriction of the lien created to protect projects from deletion.
+const deletionLienRestriction = "resourcemanager.projects.delete"
+
+// decommissionStep is a single step to decommission a project.
+// Steps are recorded by name in the project's generated fields once they complete, so a decommission
+// that failed or was cancelled can be resumed without repeating them.
+type decommissionStep struct {
+	name        string
+	description string
+	run         func(conf *config.Config, project *config.Project, archiveLocation string, opts *Options) error
+	// skip returns whether the step has nothing to do. Skipped steps are not recorded, so they run when resuming
+	// with different arguments, e.g. an archive location.
+	skip func(archiveLocation string) bool
+}
+
+// decommissionSteps returns the steps to decommission a project, in the order they are run.
+func decommissionSteps() []decommissionStep {
+	return []decommissionStep{
+		{
+			name:        "verify_audit_logs",
+			description: "verify audit logs are kept in the remote audit logs project",
+			run: func(conf *config.Config, project *config.Project, _ string, opts *Options) error {
+				return verifyRemoteAuditLogs(conf, project, opts)
+			},
+		},
+		{
+			name:        "archive_data",
+			description: "archive data",
+			run: func(_ *config.Config, project *config.Project, archiveLocation string, opts *Options) error {
+				return archiveData(project, archiveLocation, opts)
+			},
+			skip: func(archiveLocation string) bool { return archiveLocation == "" },
+		},
+		{
+			name:        "remove_deletion_lien",
+			description: "remove deletion lien",
+			run: func(_ *config.Config, project *config.Project, _ string, opts *Options) error {
+				return removeDeletionLien(project, opts)
+			},
+		},
+		{
+			name:        "abandon_deployments",
+			description: "abandon deployments",
+			run:         abandonDeployments,
+		},
+		{
+			name:        "delete_project",
+			description: "delete project",
+			run: func(_ *config.Config, project *config.Project, _ string, opts *Options) error {
+				return deleteProject(project, opts)
+			},
+		},
+	}
+}
+
+// Decommission retires the project: it verifies the audit logs of the project are kept in its remote
+// audit logs project, exports the data buckets and datasets to the archive location (if not empty),
+// removes the deletion lien, abandons the deployments of the project and requests its deletion.
+// Every destructive step must be confirmed. Progress is recorded in the project's generated fields.
+func Decommission(conf *config.Config, project *config.Project, archiveLocation string, opts *Options) error {
+	gf := project.GeneratedFields
+	if gf.Decommission == nil {
+		gf.Decommission = &config.DecommissionInfo{}
+	}
+	completed := make(map[string]bool)
+	for _, s := range gf.Decommission.CompletedSteps {
+		completed[s] = true
+	}
+
+	steps := decommissionSteps()
+	for i, s := range steps {
+		opts.logf("decommission step %d/%d (%s)", i+1, len(steps), s.description)
+		if completed[s.name] {
+			opts.logf("step %q already completed, skipping", s.name)
+			continue
+		}
+		if s.skip != nil && s.skip(archiveLocation) {
+			opts.logf("step %q has nothing to do, skipping", s.name)
+			continue
+		}
+		if err := s.run(conf, project, archiveLocation, opts); err != nil {
+			return fmt.Errorf("failed to %s (step %q): %v", s.description, s.name, err)
+		}
+		gf.Decommission.CompletedSteps = append(gf.Decommission.CompletedSteps, s.name)
+	}
+	return nil
+}
+
+// verifyRemoteAuditLogs verifies the audit logs dataset and bucket of the project are deployed in a remote
+// audit logs project, so they are kept after the project is deleted.
+func verifyRemoteAuditLogs(conf *config.Config, project *config.Project, opts *Options) error {
+	auditProject := conf.ProjectForAuditLogs(project)
+	if auditProject.ID == project.ID {
+		return fmt.Errorf("audit logs of project %q are stored in the project itself and would be deleted with it", project.ID)
+	}
+	c := opts.client()
+	if opts.EnableTerraform {
+		return verifyTerraformAuditLogs(project, auditProject.ID, c)
+	}
+
+	name := auditDeploymentNameFor(project)
+	d, err := c.GetDeployment(auditProject.ID, name)
+	if err != nil {
+		return fmt.Errorf("failed to get audit deployment %q in project %q: %v", name, auditProject.ID, err)
+	}
+	want := []string{project.AuditLogs.LogsBQDataset.Name()}
+	if project.AuditLogs.LogsGCSBucket != nil {
+		want = append(want, project.AuditLogs.LogsGCSBucket.Name())
+	}
+	got := make(map[string]bool)
+	for _, r := range d.Resources {
+		got[r.Name] = true
+	}
+	for _, n := range want {
+		if !got[n] {
+			return fmt.Errorf("audit logs resource %q not found in deployment %q of project %q", n, name, auditProject.ID)
+		}
+	}
+	return nil
+}
+
+// verifyTerraformAuditLogs verifies the audit logs dataset and bucket of the project deployed with terraform exist in
+// the audit logs project.
+func verifyTerraformAuditLogs(project *config.Project, auditProjectID string, c gcp.Client) error {
+	dataset := project.AuditLogs.LogsBQDataset.Name()
+	ok, err := c.DatasetExists(auditProjectID, dataset)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("audit logs dataset %q not found in project %q", dataset, auditProjectID)
+	}
+	if project.AuditLogs.LogsGCSBucket == nil {
+		return nil
+	}
+	bucket := project.AuditLogs.LogsGCSBucket.Name()
+	urls, err := c.ListBuckets(auditProjectID)
+	if err != nil {
+		return err
+	}
+	for _, u := range urls {
+		if u == "gs://"+bucket {
+			return nil
+		}
+	}
+	return fmt.Errorf("audit logs bucket %q not found in project %q", bucket, auditProjectID)
+}
+
+// archiveData copies the data buckets and exports the tables of the data datasets of the project to the archive location.
+// Buckets are copied to <archive>/<project>/gcs/<bucket> and tables to <archive>/<project>/bigquery/<dataset>/<table>.
+func archiveData(project *config.Project, archiveLocation string, opts *Options) error {
+	c := opts.client()
+	base := fmt.Sprintf("%s/%s", strings.TrimSuffix(archiveLocation, "/"), project.ID)
+
+	for _, b := range project.Resources.GCSBuckets {
+		if err := c.CopyBucket("gs://"+b.Name(), fmt.Sprintf("%s/gcs/%s", base, b.Name())); err != nil {
+			return err
+		}
+	}
+	for _, d := range project.Resources.BQDatasets {
+		tables, err := c.ListTables(project.ID, d.Name())
+		if err != nil {
+			return err
+		}
+		for _, t := range tables {
+			// Wildcards let BigQuery split tables larger than 1 GB into multiple files.
+			dest := fmt.Sprintf("%s/bigquery/%s/%s/*.avro", base, d.Name(), t)
+			if err := c.ExportTable(project.ID, d.Name(), t, dest); err != nil {
+				return err
+			}
+		}
+	}
+	project.GeneratedFields.Decommission.ArchiveLocation = base
+	return nil
+}
+
+// removeDeletionLien removes the liens restricting the deletion of the project, after confirmation.
+func removeDeletionLien(project *config.Project, opts *Options) error {
+	c := opts.client()
+	liens, err := c.ListLiens(project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list liens: %v", err)
+	}
+	var names []string
+	for _, l := range liens {
+		for _, r := range l.Restrictions {
+			if r == deletionLienRestriction {
+				names = append(names, l.Name)
+				break
+			}
+		}
+	}
+	if len(names) == 0 {
+		opts.logf("no deletion lien found")
+		return nil
+	}
+
+	msg := fmt.Sprintf("Remove deletion lien(s) %v of project %q? Enter [yes] to continue, or [no] to cancel:", names, project.ID)
+	if err := confirmDecommission(msg, opts); err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := c.DeleteLien(project.ID, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// abandonDeployments deletes the deployments of the project, leaving their resources in the project, after confirmation.
+// The audit deployment in the remote audit logs project is kept.
+func abandonDeployments(conf *config.Config, project *config.Project, _ string, opts *Options) error {
+	c := opts.client()
+	live, err := c.ListDeployments(project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list deployments: %v", err)
+	}
+	exists := make(map[string]bool)
+	for _, n := range live {
+		exists[n] = true
+	}
+
+	ds, err := Deployments(conf, project)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, d := range ds {
+		if d.ProjectID == project.ID && exists[d.Name] {
+			names = append(names, d.Name)
+		}
+	}
+	if len(names) == 0 {
+		opts.logf("no deployments to abandon")
+		return nil
+	}
+
+	msg := fmt.Sprintf("Abandon deployment(s) %v of project %q? Their resources are kept until the project is deleted. Enter [yes] to continue, or [no] to cancel:", names, project.ID)
+	if err := confirmDecommission(msg, opts); err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := c.AbandonDeployment(project.ID, n); err != nil {
+			return fmt.Errorf("failed to abandon deployment %q: %v", n, err)
+		}
+	}
+	return nil
+}
+
+// deleteProject requests the deletion of the project after confirmation and records the time of the request.
+func deleteProject(project *config.Project, opts *Options) error {
+	msg := fmt.Sprintf(`Delete project %q? The project is shut down immediately and deleted after 30 days.
+It can be restored until then with: gcloud projects undelete %s
+Enter [yes] to continue, or [no] to cancel:`, project.ID, project.ID)
+	if err := confirmDecommission(msg, opts); err != nil {
+		return err
+	}
+	if err := opts.client().DeleteProject(project.ID); err != nil {
+		return err
+	}
+	project.GeneratedFields.Decommission.DeletionRequestTime = time.Now().UTC().Format(time.RFC3339)
+	return nil
+}
+
+// confirmDecommission asks for confirmation of a destructive step and returns an error if it was declined.
+func confirmDecommission(message string, opts *Options) error {
+	ok, err := opts.confirm(message)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("cancelled by user")
+	}
+	return nil
+}
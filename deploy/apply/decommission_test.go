@@ -0,0 +1,262 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/testconf"
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+)
+
+const decommissionProjectConfig = `
+resources:
+  gcs_buckets:
+  - properties:
+      name: foo-bucket
+      location: us-east1
+  bq_datasets:
+  - properties:
+      name: foo_dataset
+      location: US`
+
+const auditLogsProjectYAML = `
+project_id: my-audit-project
+owners_group: my-audit-project-owners@my-domain.com
+auditors_group: my-audit-project-auditors@my-domain.com
+audit_logs:
+  logs_bq_dataset:
+    properties:
+      name: audit_logs
+      location: US
+`
+
+var allDecommissionSteps = []string{"verify_audit_logs", "archive_data", "remove_deletion_lien", "abandon_deployments", "delete_project"}
+
+func TestDecommission(t *testing.T) {
+	conf, project := decommissionConfigAndProject(t)
+	fake := newDeployedFake(t, conf, project)
+
+	var gotMessages []string
+	opts := &Options{
+		Client: fake,
+		Confirm: func(message string) (bool, error) {
+			gotMessages = append(gotMessages, message)
+			return true, nil
+		},
+	}
+	if err := Decommission(conf, project, "gs://my-archive/", opts); err != nil {
+		t.Fatalf("Decommission = %v", err)
+	}
+
+	// The lien, deployments and project deletion are each confirmed.
+	if len(gotMessages) != 3 {
+		t.Errorf("got %d confirmations, want 3: %v", len(gotMessages), gotMessages)
+	}
+
+	p := fake.Project(project.ID)
+	if len(p.Liens) != 0 {
+		t.Errorf("liens = %v, want none", p.Liens)
+	}
+	if len(p.Deployments) != 0 {
+		t.Errorf("deployments = %v, want none", p.Deployments)
+	}
+	if p.LifecycleState != "DELETE_REQUESTED" {
+		t.Errorf("lifecycle state = %q, want DELETE_REQUESTED", p.LifecycleState)
+	}
+	if _, ok := fake.Project("my-audit-project").Deployments[auditDeploymentNameFor(project)]; !ok {
+		t.Error("audit deployment in audit logs project was removed")
+	}
+
+	wantCopies := []*gcp.FakeCopy{
+		{Source: "gs://foo-bucket", Destination: "gs://my-archive/my-project/gcs/foo-bucket"},
+		{Source: "my-project:foo_dataset.foo_table", Destination: "gs://my-archive/my-project/bigquery/foo_dataset/foo_table/*.avro"},
+	}
+	if diff := cmp.Diff(fake.Copies(), wantCopies); diff != "" {
+		t.Errorf("copies differ (-got +want):\n%v", diff)
+	}
+
+	got := project.GeneratedFields.Decommission
+	if diff := cmp.Diff(got.CompletedSteps, allDecommissionSteps); diff != "" {
+		t.Errorf("completed steps differ (-got +want):\n%v", diff)
+	}
+	if got.ArchiveLocation != "gs://my-archive/my-project" {
+		t.Errorf("archive location = %q, want gs://my-archive/my-project", got.ArchiveLocation)
+	}
+	if got.DeletionRequestTime == "" {
+		t.Error("deletion request time not recorded")
+	}
+}
+
+func TestDecommissionResume(t *testing.T) {
+	conf, project := decommissionConfigAndProject(t)
+	fake := newDeployedFake(t, conf, project)
+
+	confirmations := 0
+	opts := &Options{
+		Client: fake,
+		Confirm: func(message string) (bool, error) {
+			confirmations++
+			// Decline the deletion of the project.
+			return confirmations < 3, nil
+		},
+	}
+	if err := Decommission(conf, project, "", opts); err == nil {
+		t.Fatal("Decommission = nil, want error")
+	}
+	if got := fake.Project(project.ID).LifecycleState; got != "ACTIVE" {
+		t.Errorf("lifecycle state = %q, want ACTIVE", got)
+	}
+	// Archiving is skipped without an archive location, so it is not recorded as completed.
+	wantSteps := []string{"verify_audit_logs", "remove_deletion_lien", "abandon_deployments"}
+	if diff := cmp.Diff(project.GeneratedFields.Decommission.CompletedSteps, wantSteps); diff != "" {
+		t.Errorf("completed steps differ (-got +want):\n%v", diff)
+	}
+
+	// Resuming only runs the remaining step.
+	confirmations = 0
+	opts.Confirm = func(string) (bool, error) {
+		confirmations++
+		return true, nil
+	}
+	if err := Decommission(conf, project, "", opts); err != nil {
+		t.Fatalf("Decommission = %v", err)
+	}
+	if confirmations != 1 {
+		t.Errorf("got %d confirmations, want 1", confirmations)
+	}
+	if got := fake.Project(project.ID).LifecycleState; got != "DELETE_REQUESTED" {
+		t.Errorf("lifecycle state = %q, want DELETE_REQUESTED", got)
+	}
+	if len(fake.Copies()) != 0 {
+		t.Errorf("copies = %v, want none without archive location", fake.Copies())
+	}
+}
+
+func TestDecommissionResumeWithArchiveLocation(t *testing.T) {
+	conf, project := decommissionConfigAndProject(t)
+	fake := newDeployedFake(t, conf, project)
+
+	opts := &Options{
+		Client: fake,
+		Confirm: func(message string) (bool, error) {
+			// Decline the deletion of the project.
+			return !strings.HasPrefix(message, "Delete project"), nil
+		},
+	}
+	if err := Decommission(conf, project, "", opts); err == nil {
+		t.Fatal("Decommission = nil, want error")
+	}
+
+	// The data is archived when resuming with an archive location, before the project is deleted.
+	opts.Confirm = func(string) (bool, error) { return true, nil }
+	if err := Decommission(conf, project, "gs://my-archive", opts); err != nil {
+		t.Fatalf("Decommission = %v", err)
+	}
+	wantCopies := []*gcp.FakeCopy{
+		{Source: "gs://foo-bucket", Destination: "gs://my-archive/my-project/gcs/foo-bucket"},
+		{Source: "my-project:foo_dataset.foo_table", Destination: "gs://my-archive/my-project/bigquery/foo_dataset/foo_table/*.avro"},
+	}
+	if diff := cmp.Diff(fake.Copies(), wantCopies); diff != "" {
+		t.Errorf("copies differ (-got +want):\n%v", diff)
+	}
+	got := project.GeneratedFields.Decommission
+	if got.ArchiveLocation != "gs://my-archive/my-project" {
+		t.Errorf("archive location = %q, want gs://my-archive/my-project", got.ArchiveLocation)
+	}
+	if got := fake.Project(project.ID).LifecycleState; got != "DELETE_REQUESTED" {
+		t.Errorf("lifecycle state = %q, want DELETE_REQUESTED", got)
+	}
+}
+
+func TestDecommissionTerraformAuditLogs(t *testing.T) {
+	conf, project := decommissionConfigAndProject(t)
+	fake := newDeployedFake(t, conf, project)
+	// Audit resources deployed with terraform are not in a deployment.
+	delete(fake.Project("my-audit-project").Deployments, auditDeploymentNameFor(project))
+	opts := &Options{
+		Client:          fake,
+		EnableTerraform: true,
+		Confirm:         func(string) (bool, error) { return false, nil },
+	}
+
+	// The audit logs dataset does not exist yet.
+	if err := Decommission(conf, project, "", opts); err == nil || !strings.Contains(err.Error(), "audit logs dataset") {
+		t.Fatalf("Decommission = %v, want audit logs dataset error", err)
+	}
+
+	audit := fake.Project("my-audit-project")
+	audit.Tables["audit_logs"] = nil
+	audit.Buckets = append(audit.Buckets, "gs://my-project-logs")
+	// The audit logs are verified and the lien removal is declined.
+	if err := Decommission(conf, project, "", opts); err == nil || !strings.Contains(err.Error(), "remove_deletion_lien") {
+		t.Fatalf("Decommission = %v, want remove_deletion_lien error", err)
+	}
+	if diff := cmp.Diff(project.GeneratedFields.Decommission.CompletedSteps, []string{"verify_audit_logs"}); diff != "" {
+		t.Errorf("completed steps differ (-got +want):\n%v", diff)
+	}
+}
+
+func TestDecommissionLocalAuditLogs(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, nil)
+	fake := newFakeWithProject(conf, project)
+	opts := &Options{
+		Client: fake,
+		Confirm: func(string) (bool, error) {
+			t.Error("unexpected confirmation")
+			return false, nil
+		},
+	}
+	if err := Decommission(conf, project, "", opts); err == nil {
+		t.Fatal("Decommission = nil, want error")
+	}
+	if got := project.GeneratedFields.Decommission.CompletedSteps; len(got) != 0 {
+		t.Errorf("completed steps = %v, want none", got)
+	}
+}
+
+// decommissionConfigAndProject returns a config whose project keeps its audit logs in a remote audit logs project.
+func decommissionConfigAndProject(t *testing.T) (*config.Config, *config.Project) {
+	t.Helper()
+	conf := testconf.ConfigBeforeInit(t, &testconf.ConfigData{decommissionProjectConfig})
+	conf.AuditLogsProject = new(config.Project)
+	if err := yaml.Unmarshal([]byte(auditLogsProjectYAML), conf.AuditLogsProject); err != nil {
+		t.Fatalf("yaml.Unmarshal audit logs project: %v", err)
+	}
+	genFields := &config.AllGeneratedFields{Projects: map[string]*config.GeneratedFields{
+		"my-project":       {ProjectNumber: "1111"},
+		"my-audit-project": {ProjectNumber: "3333"},
+	}}
+	if err := conf.Init(genFields); err != nil {
+		t.Fatalf("conf.Init = %v", err)
+	}
+	return conf, conf.Projects[0]
+}
+
+// newDeployedFake returns a fake with the project and its audit logs project deployed, and the lien and data of the
+// project.
+func newDeployedFake(t *testing.T, conf *config.Config, project *config.Project) *gcp.Fake {
+	t.Helper()
+	fake := testconf.DeployedFake(t, conf, project, Deployments)
+	if err := fake.CreateLien(project.ID, deletionLienRestriction, "test"); err != nil {
+		t.Fatalf("CreateLien = %v", err)
+	}
+	fake.Project(project.ID).Tables["foo_dataset"] = []string{"foo_table"}
+	return fake
+}
@@ -0,0 +1,355 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
+	"github.com/ghodss/yaml"
+)
+
+// dryRunPlaceholder prefixes values that would only be known after a real deployment.
+const dryRunPlaceholder = "dry-run"
+
+// DryRunAction is a single action recorded during a dry run.
+type DryRunAction struct {
+	// Project is the project being applied when the action was recorded.
+	Project string
+	// Description summarizes the action, e.g. the command that would be run.
+	Description string
+	// Content holds the rendered file for the action (deployment YAML or terraform JSON), if any.
+	Content string
+}
+
+// DryRun is a gcp.Client that records every call that would change GCP without making it.
+// Every call is served by an in-memory fake seeded from the config and its generated fields, so later
+// steps see the state earlier steps would have created. Changes are recorded as the gcloud commands that
+// would have been run, and deployments and terraform configs are recorded with their rendered files.
+type DryRun struct {
+	*gcp.Fake
+
+	conf *config.Config
+	// gcloud renders the commands of changes with a runner that only records them.
+	gcloud *gcp.GCloud
+
+	mu      sync.Mutex
+	project string
+	actions []*DryRunAction
+}
+
+// NewDryRun returns a new dry run for the given config.
+// Pass it as the client in Options to dry run an apply.
+func NewDryRun(conf *config.Config) *DryRun {
+	d := &DryRun{
+		Fake: gcp.NewFake(),
+		conf: conf,
+	}
+	d.gcloud = gcp.NewGCloud(&dryRunRunner{d})
+	d.Fake.Account = dryRunPlaceholder + "-user"
+
+	// Projects with a project number in their generated fields have been deployed before.
+	for _, p := range conf.AllProjects() {
+		gf := p.GeneratedFields
+		if gf == nil || gf.ProjectNumber == "" {
+			continue
+		}
+		parentType, parentID := projectParent(conf, p)
+		fp := d.Fake.AddProject(p.ID, gf.ProjectNumber, parentType, parentID)
+		if gf.LogSinkServiceAccount != "" && p.BQLogSink != nil {
+			fp.LogSinkWriters[p.BQLogSink.Name()] = gf.LogSinkServiceAccount
+		}
+		d.seedForseti(p.ID)
+	}
+	return d
+}
+
+// seedForseti sets the terraform outputs of the Forseti server service account and bucket, as they would
+// only be known after Forseti was installed.
+func (d *DryRun) seedForseti(projectID string) {
+	if d.conf.Forseti == nil || d.conf.Forseti.Project.ID != projectID {
+		return
+	}
+	sa := d.conf.AllGeneratedFields.Forseti.ServiceAccount
+	if sa == "" {
+		sa = fmt.Sprintf("forseti-server-gcp-%s@%s.iam.gserviceaccount.com", dryRunPlaceholder, projectID)
+	}
+	d.Fake.TerraformOutputValues[forsetiServiceAccountOutput] = sa
+	b := strings.TrimSuffix(strings.TrimPrefix(d.conf.AllGeneratedFields.Forseti.ServiceBucket, "gs://"), "/")
+	if b == "" {
+		b = "forseti-server-" + dryRunPlaceholder
+	}
+	d.Fake.TerraformOutputValues[forsetiServerBucketOutput] = b
+}
+
+// SetProject sets the project that subsequent actions are recorded for.
+func (d *DryRun) SetProject(projectID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.project = projectID
+}
+
+// Actions returns the recorded actions in execution order.
+func (d *DryRun) Actions() []*DryRunAction {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*DryRunAction(nil), d.actions...)
+}
+
+// String returns a human readable report of all recorded actions grouped by project, in execution order.
+func (d *DryRun) String() string {
+	var sb strings.Builder
+	project := ""
+	for i, a := range d.Actions() {
+		if i == 0 || a.Project != project {
+			project = a.Project
+			fmt.Fprintf(&sb, "\n=== Project %q ===\n", project)
+		}
+		fmt.Fprintf(&sb, "[%d] %s\n", i+1, a.Description)
+		if a.Content != "" {
+			sb.WriteString(a.Content)
+			if !strings.HasSuffix(a.Content, "\n") {
+				sb.WriteString("\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+func (d *DryRun) record(description, content string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	log.Printf("Dry run: %v", description)
+	d.actions = append(d.actions, &DryRunAction{
+		Project:     d.project,
+		Description: description,
+		Content:     content,
+	})
+}
+
+// CreateProject implements gcp.Client.CreateProject.
+func (d *DryRun) CreateProject(projectID, parentType, parentID string) error {
+	if err := d.gcloud.CreateProject(projectID, parentType, parentID); err != nil {
+		return err
+	}
+	if err := d.Fake.CreateProject(projectID, parentType, parentID); err != nil {
+		return err
+	}
+	d.seedForseti(projectID)
+	return nil
+}
+
+// LinkBillingAccount implements gcp.Client.LinkBillingAccount.
+func (d *DryRun) LinkBillingAccount(projectID, billingAccount string) error {
+	if err := d.gcloud.LinkBillingAccount(projectID, billingAccount); err != nil {
+		return err
+	}
+	return d.Fake.LinkBillingAccount(projectID, billingAccount)
+}
+
+// EnableServices implements gcp.Client.EnableServices.
+func (d *DryRun) EnableServices(projectID string, services []string) error {
+	if err := d.gcloud.EnableServices(projectID, services); err != nil {
+		return err
+	}
+	return d.Fake.EnableServices(projectID, services)
+}
+
+// AddIAMBinding implements gcp.Client.AddIAMBinding.
+func (d *DryRun) AddIAMBinding(projectID, role, member string) error {
+	if err := d.gcloud.AddIAMBinding(projectID, role, member); err != nil {
+		return err
+	}
+	return d.Fake.AddIAMBinding(projectID, role, member)
+}
+
+// RemoveIAMBinding implements gcp.Client.RemoveIAMBinding.
+func (d *DryRun) RemoveIAMBinding(projectID, role, member string) error {
+	if err := d.gcloud.RemoveIAMBinding(projectID, role, member); err != nil {
+		return err
+	}
+	return d.Fake.RemoveIAMBinding(projectID, role, member)
+}
+
+// CreateLien implements gcp.Client.CreateLien.
+func (d *DryRun) CreateLien(projectID, restriction, reason string) error {
+	if err := d.gcloud.CreateLien(projectID, restriction, reason); err != nil {
+		return err
+	}
+	return d.Fake.CreateLien(projectID, restriction, reason)
+}
+
+// DeleteLien implements gcp.Client.DeleteLien.
+func (d *DryRun) DeleteLien(projectID, name string) error {
+	if err := d.gcloud.DeleteLien(projectID, name); err != nil {
+		return err
+	}
+	return d.Fake.DeleteLien(projectID, name)
+}
+
+// DeleteProject implements gcp.Client.DeleteProject.
+func (d *DryRun) DeleteProject(projectID string) error {
+	if err := d.gcloud.DeleteProject(projectID); err != nil {
+		return err
+	}
+	return d.Fake.DeleteProject(projectID)
+}
+
+// CopyBucket implements gcp.Client.CopyBucket.
+func (d *DryRun) CopyBucket(sourceURL, destinationURL string) error {
+	if err := d.gcloud.CopyBucket(sourceURL, destinationURL); err != nil {
+		return err
+	}
+	return d.Fake.CopyBucket(sourceURL, destinationURL)
+}
+
+// ExportTable implements gcp.Client.ExportTable.
+func (d *DryRun) ExportTable(projectID, datasetID, tableID, destinationURI string) error {
+	if err := d.gcloud.ExportTable(projectID, datasetID, tableID, destinationURI); err != nil {
+		return err
+	}
+	return d.Fake.ExportTable(projectID, datasetID, tableID, destinationURI)
+}
+
+// CreateImage implements gcp.Client.CreateImage.
+func (d *DryRun) CreateImage(projectID, imageName, sourceURI string) error {
+	if err := d.gcloud.CreateImage(projectID, imageName, sourceURI); err != nil {
+		return err
+	}
+	return d.Fake.CreateImage(projectID, imageName, sourceURI)
+}
+
+// MonitoringWorkspaceExists implements gcp.Client.MonitoringWorkspaceExists.
+// Stackdriver workspaces can only be created by a user, so assume they exist to plan the remaining steps.
+func (d *DryRun) MonitoringWorkspaceExists(string) (bool, error) {
+	return true, nil
+}
+
+// CreateNotificationChannel implements gcp.Client.CreateNotificationChannel.
+func (d *DryRun) CreateNotificationChannel(projectID string, channel *gcp.NotificationChannel) (string, error) {
+	b, err := yaml.Marshal(channel)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal notification channel: %v", err)
+	}
+	d.record(fmt.Sprintf("create notification channel in project %q:", projectID), string(b))
+	return d.Fake.CreateNotificationChannel(projectID, channel)
+}
+
+// CreateAlertPolicy implements gcp.Client.CreateAlertPolicy.
+func (d *DryRun) CreateAlertPolicy(projectID string, policy *gcp.AlertPolicy) error {
+	b, err := yaml.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert policy: %v", err)
+	}
+	d.record(fmt.Sprintf("create alert policy %q in project %q:", policy.DisplayName, projectID), string(b))
+	return d.Fake.CreateAlertPolicy(projectID, policy)
+}
+
+// UpsertDeployment implements gcp.Client.UpsertDeployment.
+func (d *DryRun) UpsertDeployment(projectID, name string, deployment *deploymentmanager.Deployment) error {
+	b, err := yaml.Marshal(deployment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment: %v", err)
+	}
+	d.record(fmt.Sprintf("upsert deployment %q in project %q:", name, projectID), string(b))
+	return d.Fake.UpsertDeployment(projectID, name, deployment)
+}
+
+// AbandonDeployment implements gcp.Client.AbandonDeployment.
+func (d *DryRun) AbandonDeployment(projectID, name string) error {
+	if err := d.gcloud.AbandonDeployment(projectID, name); err != nil {
+		return err
+	}
+	return d.Fake.AbandonDeployment(projectID, name)
+}
+
+// TerraformApply implements gcp.Client.TerraformApply.
+func (d *DryRun) TerraformApply(tfConf *terraform.Config, dir string, opts *terraform.Options) error {
+	b, err := json.MarshalIndent(tfConf, "", " ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal terraform config: %v", err)
+	}
+	d.record("terraform apply main.tf.json:", string(b))
+	if opts != nil {
+		for _, imp := range opts.Imports {
+			// Like terraform.Apply, only record imports of resources that exist.
+			if imp.Exists != nil {
+				exists, err := imp.Exists()
+				if err != nil {
+					return fmt.Errorf("failed to check whether %q exists: %v", imp.Address, err)
+				}
+				if !exists {
+					continue
+				}
+			}
+			d.record(fmt.Sprintf("terraform import %s %s", imp.Address, imp.ID), "")
+		}
+		if b := opts.MigrateStateTo; b != nil {
+			d.record(fmt.Sprintf("terraform init -migrate-state to gs://%s/%s", b.Bucket, b.Prefix), "")
+		}
+	}
+	return d.Fake.TerraformApply(tfConf, dir, opts)
+}
+
+// GetClusterCredentials implements gcp.Client.GetClusterCredentials.
+func (d *DryRun) GetClusterCredentials(projectID, clusterName, locationType, location string) error {
+	if err := d.gcloud.GetClusterCredentials(projectID, clusterName, locationType, location); err != nil {
+		return err
+	}
+	return d.Fake.GetClusterCredentials(projectID, clusterName, locationType, location)
+}
+
+// ApplyKubernetesConfig implements gcp.Client.ApplyKubernetesConfig.
+func (d *DryRun) ApplyKubernetesConfig(path string) error {
+	if err := d.gcloud.ApplyKubernetesConfig(path); err != nil {
+		return err
+	}
+	return d.Fake.ApplyKubernetesConfig(path)
+}
+
+// ImportBinauthzPolicy implements gcp.Client.ImportBinauthzPolicy.
+func (d *DryRun) ImportBinauthzPolicy(projectID, path string) error {
+	if err := d.gcloud.ImportBinauthzPolicy(projectID, path); err != nil {
+		return err
+	}
+	return d.Fake.ImportBinauthzPolicy(projectID, path)
+}
+
+// dryRunRunner records the commands of a dry run instead of running them.
+// Only commands that change GCP are run through it, so they never need output.
+type dryRunRunner struct {
+	d *DryRun
+}
+
+func (r *dryRunRunner) CmdRun(cmd *exec.Cmd) error {
+	r.d.record(strings.Join(cmd.Args, " "), "")
+	return nil
+}
+
+func (r *dryRunRunner) CmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return nil, fmt.Errorf("unexpected command with output during dry run: %v", cmd.Args)
+}
+
+func (r *dryRunRunner) CmdCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	return nil, fmt.Errorf("unexpected command with output during dry run: %v", cmd.Args)
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/testconf"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDryRun(t *testing.T) {
+	tests := []struct {
+		name          string
+		projectNumber string
+		wantCommands  []string
+	}{
+		{
+			name:          "existing_project",
+			projectNumber: "1111",
+		},
+		{
+			name: "new_project",
+			wantCommands: []string{
+				"gcloud projects create my-project --folder 98765321",
+				"gcloud beta billing projects link my-project --billing-account 000000-000000-000000",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, project := testconf.ConfigAndProject(t, nil)
+			project.GeneratedFields.ProjectNumber = tc.projectNumber
+
+			dr := NewDryRun(conf)
+			dr.SetProject(project.ID)
+			if err := Default(conf, project, &Options{EnableTerraform: true, Client: dr}); err != nil {
+				t.Fatalf("Default = %v", err)
+			}
+
+			var gotCommands, gotDeployments, gotTerraform []string
+			for _, a := range dr.Actions() {
+				if a.Project != project.ID {
+					t.Errorf("action %q recorded for project %q, want %q", a.Description, a.Project, project.ID)
+				}
+				switch {
+				case strings.HasPrefix(a.Description, "upsert deployment"):
+					gotDeployments = append(gotDeployments, a.Description)
+					if a.Content == "" {
+						t.Errorf("deployment action %q has no content", a.Description)
+					}
+				case strings.HasPrefix(a.Description, "terraform apply"):
+					gotTerraform = append(gotTerraform, a.Content)
+				default:
+					gotCommands = append(gotCommands, a.Description)
+				}
+			}
+
+			// Only compare commands that always run in the same order.
+			var gotOrdered []string
+			for _, c := range gotCommands {
+				if strings.HasPrefix(c, "gcloud projects create") || strings.HasPrefix(c, "gcloud beta billing") {
+					gotOrdered = append(gotOrdered, c)
+				}
+			}
+			if diff := cmp.Diff(gotOrdered, tc.wantCommands); diff != "" {
+				t.Errorf("commands differ (-got +want):\n%v", diff)
+			}
+			// All resources are deployed with terraform.
+			if len(gotDeployments) != 0 {
+				t.Errorf("got deployments %v, want none", gotDeployments)
+			}
+			if len(gotTerraform) != 3 {
+				t.Fatalf("got %d terraform configs, want 3 (state bucket, resources and audit resources)", len(gotTerraform))
+			}
+			if !strings.Contains(gotTerraform[0], `"my-project-state"`) || strings.Contains(gotTerraform[0], `"backend"`) {
+				t.Errorf("terraform bootstrap config does not only contain the state bucket with local state:\n%v", gotTerraform[0])
+			}
+			for _, want := range []string{`"my-project-state"`, `"google_logging_project_sink"`, `"prefix": "my-project/resources"`} {
+				if !strings.Contains(gotTerraform[1], want) {
+					t.Errorf("terraform config does not contain %s:\n%v", want, gotTerraform[1])
+				}
+			}
+			if !strings.Contains(gotTerraform[2], `"google_bigquery_dataset"`) {
+				t.Errorf("terraform audit config does not contain the audit logs dataset:\n%v", gotTerraform[2])
+			}
+			wantMigration := "terraform init -migrate-state to gs://my-project-state/my-project/resources"
+			found := false
+			for _, c := range gotCommands {
+				found = found || c == wantMigration
+			}
+			if !found {
+				t.Errorf("commands %v do not contain %q", gotCommands, wantMigration)
+			}
+			if !strings.Contains(dr.String(), `=== Project "my-project" ===`) {
+				t.Errorf("dry run report does not contain project header:\n%v", dr)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+)
+
+// Deployments returns the deployment manager deployments applying the project creates, in the order they are deployed.
+// The audit deployment of a project with remote audit logs is deployed in the remote audit logs project.
+func Deployments(conf *config.Config, project *config.Project) ([]*deploymentmanager.ProjectDeployment, error) {
+	var ds []*deploymentmanager.ProjectDeployment
+
+	d, err := prerequisiteDeployment(project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment for pre-requisites: %v", err)
+	}
+	ds = append(ds, &deploymentmanager.ProjectDeployment{ProjectID: project.ID, Name: setupPrerequisiteDeploymentName, Deployment: d})
+
+	if rs := project.DeploymentManagerResources(); len(rs) > 0 {
+		d, err := getDeployment(project, rs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployment for resources: %v", err)
+		}
+		ds = append(ds, &deploymentmanager.ProjectDeployment{ProjectID: project.ID, Name: resourceDeploymentName, Deployment: d})
+	}
+
+	d, err = auditDeployment(project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment for audit resources: %v", err)
+	}
+	ds = append(ds, &deploymentmanager.ProjectDeployment{ProjectID: conf.ProjectForAuditLogs(project).ID, Name: auditDeploymentNameFor(project), Deployment: d})
+	return ds, nil
+}
+
+// Bindings returns the IAM policy bindings in the project that applying the project grants.
+// Bindings granted to the deployment manager service account are not included.
+func Bindings(conf *config.Config, project *config.Project) []config.Binding {
+	var bs []config.Binding
+	for _, p := range project.Resources.IAMPolicies {
+		bs = append(bs, p.Bindings...)
+	}
+	if conf.Forseti != nil {
+		if sa := conf.AllGeneratedFields.Forseti.ServiceAccount; sa != "" {
+			for _, r := range forsetiStandardRoles {
+				bs = append(bs, config.Binding{Role: "roles/" + r, Members: []string{"serviceAccount:" + sa}})
+			}
+		}
+	}
+	return config.MergeBindings(bs...)
+}
@@ -15,15 +15,12 @@
 package apply
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
-	"os/exec"
-	"strings"
 
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
 )
 
@@ -45,25 +42,33 @@ var forsetiStandardRoles = [...]string{
 
 // Forseti applies project configuration to a Forseti project.
 func Forseti(conf *config.Config, project *config.Project, opts *Options) error {
-	if err := Default(conf, project, opts); err != nil {
-		return err
-	}
+	return runSteps(conf, project, opts, forsetiSteps())
+}
 
-	if err := ForsetiConfig(conf, opts.EnableTerraform); err != nil {
+// Outputs of the Forseti terraform config.
+const (
+	forsetiServiceAccountOutput = "forseti-server-service-account"
+	forsetiServerBucketOutput   = "forseti-server-storage-bucket"
+)
+
+// installForseti installs Forseti in the Forseti project and sets its generated fields from the outputs of the Forseti module.
+func installForseti(conf *config.Config, opts *Options) error {
+	outputs, err := forsetiConfig(conf, opts)
+	if err != nil {
 		return fmt.Errorf("failed to apply forseti config: %v", err)
 	}
 
-	serviceAccount, err := forsetiServerServiceAccount(conf.Forseti.Project.ID)
+	serviceAccount, err := terraform.OutputString(outputs, forsetiServiceAccountOutput)
 	if err != nil {
-		return fmt.Errorf("failed to set Forseti server service account: %v", err)
+		return fmt.Errorf("failed to get Forseti server service account: %v", err)
 	}
 	conf.AllGeneratedFields.Forseti.ServiceAccount = serviceAccount
 
-	serverBucket, err := forsetiServerBucket(conf.Forseti.Project.ID)
+	serverBucket, err := terraform.OutputString(outputs, forsetiServerBucketOutput)
 	if err != nil {
-		return fmt.Errorf("failed to set Forseti server bucket: %v", err)
+		return fmt.Errorf("failed to get Forseti server bucket: %v", err)
 	}
-	conf.AllGeneratedFields.Forseti.ServiceBucket = serverBucket
+	conf.AllGeneratedFields.Forseti.ServiceBucket = "gs://" + serverBucket
 
 	return nil
 }
@@ -71,92 +76,70 @@ func Forseti(conf *config.Config, project *config.Project, opts *Options) error
 // ForsetiConfig applies the forseti config, if it exists. It does not configure
 // other settings such as billing account, deletion lien, etc.
 // TODO Make it private or merge it into Forseti() after removing apply_forseti.go.
-func ForsetiConfig(conf *config.Config, enableRemoteState bool) error {
+func ForsetiConfig(conf *config.Config, enableRemoteState bool, c gcp.Client) error {
+	_, err := forsetiConfig(conf, &Options{EnableTerraform: enableRemoteState, Client: c})
+	return err
+}
+
+// forsetiConfig applies the forseti config with the options and returns the outputs of the Forseti module.
+// The state is remote if terraform is enabled. Forseti resources are only deleted if the options allow deleting
+// protected resources.
+func forsetiConfig(conf *config.Config, opts *Options) (map[string]interface{}, error) {
 	if conf.Forseti == nil {
-		log.Println("no forseti config, nothing to do")
-		return nil
+		opts.logf("no forseti config, nothing to do")
+		return nil, nil
 	}
 	dir, err := ioutil.TempDir("", "")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer os.RemoveAll(dir)
 
-	tfConf := terraform.NewConfig()
+	tfConf := forsetiTerraformConfig(conf)
+	if opts.EnableTerraform {
+		tfConf.Terraform.Backend = forsetiStateBackend(conf)
+	}
+
+	c := opts.client()
+	tfOpts := opts.terraformOptions()
+	tfOpts.Protected = append(tfOpts.Protected, "module.forseti")
+	if err := c.TerraformApply(tfConf, dir, tfOpts); err != nil {
+		return nil, err
+	}
+	return c.TerraformOutputs(dir)
+}
+
+// forsetiTerraformConfig returns the terraform config of the Forseti module with local state.
+func forsetiTerraformConfig(conf *config.Config) *terraform.Config {
+	tfConf := newTerraformConfig(conf, conf.Forseti.Project.ID)
 	tfConf.Modules = []*terraform.Module{{
 		Name:       "forseti",
 		Source:     "./external/terraform_google_forseti",
 		Properties: conf.Forseti.Properties,
 	}}
-
-	if enableRemoteState {
-		tfConf.Terraform.Backend = &terraform.Backend{
-			Bucket: conf.Forseti.Project.TerraformConfig.StateBucket.Name,
-			Prefix: "forseti",
-		}
-	}
-
-	return terraformApply(tfConf, dir, nil)
-}
-
-// forsetiServerServiceAccount gets the server instance service account of the give Forseti project.
-// TODO Use Terraform state or output.
-func forsetiServerServiceAccount(projectID string) (string, error) {
-	cmd := exec.Command(
-		"gcloud", "--project", projectID,
-		"iam", "service-accounts", "list", "--format", "json",
-		"--filter", "email:forseti-server-gcp-*",
-	)
-
-	out, err := cmdOutput(cmd)
-	if err != nil {
-		return "", fmt.Errorf("failed to obtain Forseti server service account: %v", err)
-	}
-
-	type serviceAccount struct {
-		Email string `json:"email"`
+	// Re-export the module outputs so they can be read after the config was applied.
+	for _, o := range []string{forsetiServiceAccountOutput, forsetiServerBucketOutput} {
+		tfConf.Outputs = append(tfConf.Outputs, &terraform.Output{
+			Name:  o,
+			Value: fmt.Sprintf("${module.forseti.%s}", o),
+		})
 	}
-
-	var serviceAccounts []serviceAccount
-	if err := json.Unmarshal(out, &serviceAccounts); err != nil {
-		return "", fmt.Errorf("failed to unmarshal service accounts output: %v", err)
-	}
-	if len(serviceAccounts) != 1 {
-		return "", fmt.Errorf("unexpected number of Forseti server service accounts: got %d, want 1", len(serviceAccounts))
-	}
-
-	return serviceAccounts[0].Email, nil
+	return tfConf
 }
 
-// forsetiServerBucket gets the bucket holding the Forseti server instance's configuration.
-// TODO Use Terraform state or output.
-func forsetiServerBucket(projectID string) (string, error) {
-	cmd := exec.Command("gsutil", "ls", "-p", projectID)
-
-	out, err := cmdOutput(cmd)
-	if err != nil {
-		return "", fmt.Errorf("failed to obtain Forseti server bucket: %v", err)
-	}
-
-	var bs []string
-	for _, b := range strings.Split(strings.TrimSpace(string(out)), "\n") {
-		if strings.HasPrefix(b, "gs://forseti-server-") {
-			bs = append(bs, b)
-		}
-	}
-
-	if len(bs) != 1 {
-		return "", fmt.Errorf("unexpected number of Forseti server buckets: got %d, want 1", len(bs))
+// forsetiStateBackend returns the backend keeping the state of Forseti in the state bucket of the Forseti project.
+func forsetiStateBackend(conf *config.Config) *terraform.Backend {
+	return &terraform.Backend{
+		Bucket: conf.Forseti.Project.TerraformConfig.StateBucket.Name,
+		Prefix: "forseti",
 	}
-
-	return bs[0], nil
 }
 
 // GrantForsetiPermissions grants all necessary permissions to the given Forseti service account in the project.
 // TODO: Use Terraform to deploy these.
-func GrantForsetiPermissions(projectID, serviceAccount string) error {
+func GrantForsetiPermissions(projectID, serviceAccount string, c gcp.Client) error {
 	for _, r := range forsetiStandardRoles {
-		if err := addBinding(projectID, serviceAccount, r); err != nil {
+		if err := addBinding(projectID, serviceAccount, r, c); err != nil {
 			return fmt.Errorf("failed to grant all necessary permissions to Forseti service account %q in project %q: %v", serviceAccount, projectID, err)
 		}
 	}
@@ -16,11 +16,11 @@ package apply
 
 import (
 	"encoding/json"
-	"os/exec"
 	"strings"
 	"testing"
 
-	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/testconf"
 	"github.com/google/go-cmp/cmp"
 )
@@ -28,19 +28,23 @@ import (
 func TestForsetiConfig(t *testing.T) {
 	conf, _ := testconf.ConfigAndProject(t, nil)
 
-	var gotTFConf *terraform.Config
-	terraformApply = func(config *terraform.Config, _ string, _ *terraform.Options) error {
-		gotTFConf = config
-		return nil
-	}
-
-	if err := ForsetiConfig(conf, true); err != nil {
+	fake := newForsetiFake()
+	if err := ForsetiConfig(conf, true, fake); err != nil {
 		t.Fatalf("Forseti = %v", err)
 	}
+	applies := fake.TerraformApplies()
+	if len(applies) != 1 {
+		t.Fatalf("got %d terraform applies, want 1", len(applies))
+	}
+	gotTFConf := applies[0].Config
 
 	wantConfig := `{
 	"terraform": {
 		"required_version": ">= 0.12.0",
+		"required_providers": {
+			"google": "~> 2.20",
+			"google-beta": "~> 2.20"
+		},
 		"backend": {
 			"gcs": {
 				"bucket": "my-forseti-project-state",
@@ -48,6 +52,11 @@ func TestForsetiConfig(t *testing.T) {
 			}
 		}
 	},
+	"provider": [{
+		"google": {"project": "my-forseti-project"}
+	}, {
+		"google-beta": {"project": "my-forseti-project"}
+	}],
 	"module": [{
 		"forseti": {
 			"source": "./external/terraform_google_forseti",
@@ -59,6 +68,15 @@ func TestForsetiConfig(t *testing.T) {
 			 "project_id": "my-forseti-project",
 			 "storage_bucket_location": "us-east1"
 		}
+	}],
+	"output": [{
+		"forseti-server-service-account": {
+			"value": "${module.forseti.forseti-server-service-account}"
+		}
+	}, {
+		"forseti-server-storage-bucket": {
+			"value": "${module.forseti.forseti-server-storage-bucket}"
+		}
 	}]
 }`
 
@@ -78,23 +96,54 @@ func TestForsetiConfig(t *testing.T) {
 	}
 }
 
-func TestGrantForsetiPermissions(t *testing.T) {
-	wantCmdCnt := 9
-	wantCmdPrefix := "gcloud projects add-iam-policy-binding project1 --member serviceAccount:forseti-sa@@forseti-project.iam.gserviceaccount.com --role roles/"
-	var got []string
-	cmdRun = func(cmd *exec.Cmd) error {
-		got = append(got, strings.Join(cmd.Args, " "))
-		return nil
+func TestInstallForseti(t *testing.T) {
+	conf, _ := testconf.ConfigAndProject(t, nil)
+	fake := newForsetiFake()
+	if err := installForseti(conf, &Options{Client: fake}); err != nil {
+		t.Fatalf("installForseti = %v", err)
+	}
+	want := config.ForsetiServiceInfo{
+		ServiceAccount: "forseti-server-gcp-abcdef@my-forseti-project.iam.gserviceaccount.com",
+		ServiceBucket:  "gs://forseti-server-abcdef",
 	}
-	if err := GrantForsetiPermissions("project1", "forseti-sa@@forseti-project.iam.gserviceaccount.com"); err != nil {
+	if diff := cmp.Diff(conf.AllGeneratedFields.Forseti, want); diff != "" {
+		t.Errorf("forseti generated fields differ (-got +want):\n%v", diff)
+	}
+}
+
+func TestInstallForsetiMissingOutput(t *testing.T) {
+	conf, _ := testconf.ConfigAndProject(t, nil)
+	fake := gcp.NewFake()
+	if err := installForseti(conf, &Options{Client: fake}); err == nil {
+		t.Fatal("installForseti without terraform outputs = nil, want error")
+	}
+}
+
+func TestGrantForsetiPermissions(t *testing.T) {
+	wantBindingCnt := 9
+	wantMember := "serviceAccount:forseti-sa@@forseti-project.iam.gserviceaccount.com"
+	fake := gcp.NewFake()
+	p := fake.AddProject("project1", "1111", "folder", "5678")
+	if err := GrantForsetiPermissions("project1", "forseti-sa@@forseti-project.iam.gserviceaccount.com", fake); err != nil {
 		t.Fatalf("GrantForsetiPermissions = %v", err)
 	}
-	if len(got) != wantCmdCnt {
-		t.Fatalf("number of permissions granted differ: got %d, want %d", len(got), wantCmdCnt)
+	if len(p.Policy.Bindings) != wantBindingCnt {
+		t.Fatalf("number of permissions granted differ: got %d, want %d", len(p.Policy.Bindings), wantBindingCnt)
 	}
-	for _, cmd := range got {
-		if !strings.HasPrefix(cmd, wantCmdPrefix) {
-			t.Fatalf("command %q does not contain expected prefix %q", cmd, wantCmdPrefix)
+	for _, b := range p.Policy.Bindings {
+		if !strings.HasPrefix(b.Role, "roles/") {
+			t.Errorf("binding role %q does not have prefix %q", b.Role, "roles/")
+		}
+		if diff := cmp.Diff(b.Members, []string{wantMember}); diff != "" {
+			t.Errorf("binding %q members differ (-got +want):\n%v", b.Role, diff)
 		}
 	}
 }
+
+// newForsetiFake returns a fake with the terraform outputs of an installed Forseti module.
+func newForsetiFake() *gcp.Fake {
+	fake := gcp.NewFake()
+	fake.TerraformOutputValues[forsetiServiceAccountOutput] = "forseti-server-gcp-abcdef@my-forseti-project.iam.gserviceaccount.com"
+	fake.TerraformOutputValues[forsetiServerBucketOutput] = "forseti-server-abcdef"
+	return fake
+}
@@ -18,17 +18,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
-	"os/exec"
+	"sync"
 
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
 )
 
 // deployGKEWorkloads deploys the GKE resources (e.g., workloads, services) in the project.
-func deployGKEWorkloads(project *config.Project) error {
+func deployGKEWorkloads(project *config.Project, opts *Options) error {
 	for _, w := range project.Resources.GKEWorkloads {
-		if err := installClusterWorkload(w.ClusterName, project, w.Properties); err != nil {
+		if err := installClusterWorkload(w.ClusterName, project, w.Properties, opts); err != nil {
 			return fmt.Errorf("failed to deploy workload: %v", err)
 		}
 	}
@@ -36,12 +36,12 @@ func deployGKEWorkloads(project *config.Project) error {
 }
 
 // interfaceToJSONFile writes data to a json file f.
-func interfaceToJSONFile(f *os.File, data interface{}) error {
+func interfaceToJSONFile(f *os.File, data interface{}, opts *Options) error {
 	b, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal data : %v", err)
 	}
-	log.Printf("Creating data:\n%v", string(b))
+	opts.logf("Creating data:\n%v", string(b))
 
 	if _, err := f.Write(b); err != nil {
 		return fmt.Errorf("failed to write deployment to file: %v", err)
@@ -54,21 +54,21 @@ func interfaceToJSONFile(f *os.File, data interface{}) error {
 
 // installClusterWorkload creates and updates (when it exists) not only workloads
 // but also all resources supported by "kubectl apply -f". Data comes from a GKEWorkload struct.
-func installClusterWorkload(clusterName string, project *config.Project, workload interface{}) error {
+func installClusterWorkload(clusterName string, project *config.Project, workload interface{}, opts *Options) error {
 	tmp, err := ioutil.TempFile("", "")
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %v", err)
 	}
 	defer os.Remove(tmp.Name())
 
-	if err := interfaceToJSONFile(tmp, workload); err != nil {
+	if err := interfaceToJSONFile(tmp, workload, opts); err != nil {
 		return fmt.Errorf("failed to create write workload file: %v", err)
 	}
 
-	return installClusterWorkloadFromFile(clusterName, tmp.Name(), project)
+	return installClusterWorkloadFromFile(clusterName, tmp.Name(), project, opts.client())
 }
 
-func importBinauthz(projectID string, binauthz *config.BinAuthz) error {
+func importBinauthz(projectID string, binauthz *config.BinAuthz, opts *Options) error {
 	if binauthz == nil {
 		return nil
 	}
@@ -78,17 +78,22 @@ func importBinauthz(projectID string, binauthz *config.BinAuthz) error {
 	}
 	defer os.Remove(tmp.Name())
 
-	err = interfaceToJSONFile(tmp, binauthz.Properties)
+	err = interfaceToJSONFile(tmp, binauthz.Properties, opts)
 	if err != nil {
 		return fmt.Errorf("failed to create write policy file: %v", err)
 	}
 
-	return configBinauthzPolicy(tmp.Name(), projectID)
+	return opts.client().ImportBinauthzPolicy(projectID, tmp.Name())
 }
 
+// kubeMu serializes fetching the credentials of GKE clusters and applying configs to them. kubectl applies configs to
+// the cluster of the credentials last fetched into the shared kubeconfig, so projects applied in parallel must not
+// interleave the two.
+var kubeMu sync.Mutex
+
 // installClusterWorkloadFromFile creates and updates (when it exists) not only workloads
 // but also all resources supported by "kubectl apply -f".
-func installClusterWorkloadFromFile(clusterName, containerYamlPath string, project *config.Project) error {
+func installClusterWorkloadFromFile(clusterName, containerYamlPath string, project *config.Project, c gcp.Client) error {
 	cluster := getClusterByName(project, clusterName)
 	if cluster == nil {
 		return fmt.Errorf("failed to find cluster: %q", clusterName)
@@ -97,13 +102,12 @@ func installClusterWorkloadFromFile(clusterName, containerYamlPath string, proje
 	if err != nil {
 		return err
 	}
-	if err := getGCloudCredentials(clusterName, locationType, locationValue, project.ID); err != nil {
-		return err
-	}
-	if err := applyClusterWorkload(containerYamlPath); err != nil {
+	kubeMu.Lock()
+	defer kubeMu.Unlock()
+	if err := c.GetClusterCredentials(project.ID, clusterName, locationType, locationValue); err != nil {
 		return err
 	}
-	return nil
+	return c.ApplyKubernetesConfig(containerYamlPath)
 }
 
 // getClusterByName get a cluster that has the given cluster name in a project.
@@ -132,31 +136,3 @@ func getLocationTypeAndValue(cluster *config.GKECluster) (string, string, error)
 		return "", "", fmt.Errorf("failed to get cluster's location: %v", cluster.Name())
 	}
 }
-
-func getGCloudCredentials(clusterName, locationType, locationValue, projectID string) error {
-	cmd := exec.Command("gcloud", "container", "clusters", "get-credentials", clusterName, locationType, locationValue, "--project", projectID)
-	if err := cmdRun(cmd); err != nil {
-		return fmt.Errorf("failed to get cluster credentials for %q: %v", clusterName, err)
-	}
-	return nil
-}
-
-func applyClusterWorkload(containerYamlPath string) error {
-	// kubectl declarative object configuration
-	// https://kubernetes.io/docs/concepts/overview/object-management-kubectl/overview/
-	cmd := exec.Command("kubectl", "apply", "-f", containerYamlPath)
-	if err := cmdRun(cmd); err != nil {
-		return fmt.Errorf("failed to apply workloads with kubectl: %s", err)
-	}
-	return nil
-}
-
-func configBinauthzPolicy(policyYamlPath, projectID string) error {
-	// binaryauthorization.googleapis.com must be enabled
-	// https://cloud.google.com/binary-authorization/docs/quickstart
-	cmd := exec.Command("gcloud", "beta", "container", "binauthz", "policy", "import", policyYamlPath, "--project", projectID)
-	if err := cmdRun(cmd); err != nil {
-		return fmt.Errorf("failed to import policy for %q: %v", projectID, err)
-	}
-	return nil
-}
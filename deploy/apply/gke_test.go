@@ -15,51 +15,20 @@
 package apply
 
 import (
-	"os/exec"
+	"bytes"
+	"fmt"
+	"log"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/testconf"
-	"github.com/google/go-cmp/cmp"
 )
 
-func TestGetGCloudCredentials(t *testing.T) {
-	region := "foo-center"
-	clusterName := "bar-cluster"
-	projectID := "foo-project"
-	var gotArgs [][]string
-	cmdRun = func(cmd *exec.Cmd) error {
-		gotArgs = append(gotArgs, cmd.Args)
-		return nil
-	}
-	wantArgs := [][]string{{
-		"gcloud", "container", "clusters", "get-credentials", clusterName, "--region", region, "--project", projectID}}
-	if err := getGCloudCredentials(clusterName, "--region", region, projectID); err != nil {
-		t.Fatalf("getGCloudCredentials error: %v", err)
-	}
-	if diff := cmp.Diff(gotArgs, wantArgs); len(diff) != 0 {
-		t.Fatalf("getGCloudCredentials commands differ: (-got, +want)\n:%v", diff)
-	}
-}
-
-func TestApplyClusterResource(t *testing.T) {
-	containerYamlPath := "foo/bar/abc.yaml"
-	var gotArgs [][]string
-	cmdRun = func(cmd *exec.Cmd) error {
-		gotArgs = append(gotArgs, cmd.Args)
-		return nil
-	}
-	wantArgs := [][]string{{
-		"kubectl", "apply", "-f", containerYamlPath}}
-	if err := applyClusterWorkload(containerYamlPath); err != nil {
-		t.Fatalf("applyClusterWorkload error: %v", err)
-	}
-	if diff := cmp.Diff(gotArgs, wantArgs); len(diff) != 0 {
-		t.Fatalf("applyClusterWorkload commands differ: (-got, +want)\n:%v", diff)
-	}
-}
-
 func TestLocationTypeAndValue(t *testing.T) {
 	testcases := []struct {
 		in            config.GKECluster
@@ -116,29 +85,122 @@ resources:
       apiVersion: extensions/v1beta1`,
 	}
 
-	wantArgs := [][]string{
-		{"gcloud", "container", "clusters", "get-credentials", "cluster1", "--region", "somewhere1", "--project", "my-project"},
-		{"kubectl", "apply", "-f"},
-	}
-
 	_, project := testconf.ConfigAndProject(t, configExtend)
-	var gotArgs [][]string
-	cmdRun = func(cmd *exec.Cmd) error {
-		gotArgs = append(gotArgs, cmd.Args)
-		return nil
-	}
-	err := deployGKEWorkloads(project)
+	fake := gcp.NewFake()
+	p := fake.AddProject(project.ID, "1111", "folder", "98765321")
+	err := deployGKEWorkloads(project, &Options{Client: fake})
 	if err != nil {
 		t.Fatalf("deployGKEWorkloads error: %v", err)
 	}
-	if len(gotArgs) != 2 {
-		t.Fatalf("deployGKEWorkloads does not run correct number of commands: %d", len(gotArgs))
+	got := p.KubernetesConfigs["cluster1"]
+	if len(got) != 1 {
+		t.Fatalf("deployGKEWorkloads applied %d configs to cluster1, want 1", len(got))
 	}
-	if diff := cmp.Diff(gotArgs[0], wantArgs[0]); len(diff) != 0 {
-		t.Fatalf("get-credentials cmd error: %v", gotArgs[0])
+	if !strings.Contains(got[0], "extensions/v1beta1") {
+		t.Fatalf("applied config does not contain the workload:\n%v", got[0])
 	}
-	if diff := cmp.Diff(gotArgs[1][:3], wantArgs[1]); len(diff) != 0 {
-		t.Fatalf("kubectl cmd error: %v", gotArgs[1])
+}
+
+// slowCredentialsClient is a gcp.Client that takes a while to fetch cluster credentials, so concurrent deployments
+// to clusters interleave unless they are serialized.
+type slowCredentialsClient struct {
+	*gcp.Fake
+}
+
+func (c *slowCredentialsClient) GetClusterCredentials(projectID, clusterName, locationType, location string) error {
+	if err := c.Fake.GetClusterCredentials(projectID, clusterName, locationType, location); err != nil {
+		return err
+	}
+	time.Sleep(10 * time.Millisecond)
+	return nil
+}
+
+func TestInstallClusterWorkloadParallel(t *testing.T) {
+	var workloads strings.Builder
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&workloads, `
+  - cluster_name: cluster1
+    properties:
+      apiVersion: extensions/v1beta1
+      kind: Deployment-%d`, i)
+	}
+	configExtend := &testconf.ConfigData{`
+resources:
+  gke_clusters:
+  - properties:
+      name: cluster1
+      clusterLocationType: Regional
+      region: somewhere1
+      cluster:
+        name: cluster1
+  gke_workloads:` + workloads.String(),
+	}
+
+	fake := gcp.NewFake()
+	var projects []*config.Project
+	for _, id := range []string{"my-project", "my-other-project"} {
+		_, project := testconf.ConfigAndProject(t, configExtend)
+		project.ID = id
+		fake.AddProject(id, "1111", "folder", "98765321")
+		projects = append(projects, project)
+	}
+
+	// Projects are applied with parallelism > 1, so their GKE workloads are deployed concurrently.
+	var wg sync.WaitGroup
+	errs := make([]error, len(projects))
+	for i, project := range projects {
+		wg.Add(1)
+		go func(i int, project *config.Project) {
+			defer wg.Done()
+			errs[i] = deployGKEWorkloads(project, &Options{Client: &slowCredentialsClient{fake}})
+		}(i, project)
+	}
+	wg.Wait()
+
+	for i, project := range projects {
+		if errs[i] != nil {
+			t.Fatalf("deployGKEWorkloads(%q) error: %v", project.ID, errs[i])
+		}
+		if got := len(fake.Project(project.ID).KubernetesConfigs["cluster1"]); got != 5 {
+			t.Errorf("deployGKEWorkloads applied %d configs to cluster1 of %q, want 5", got, project.ID)
+		}
+	}
+}
+
+func TestInstallClusterWorkloadRedactsSecrets(t *testing.T) {
+	configExtend := &testconf.ConfigData{`
+resources:
+  gke_clusters:
+  - properties:
+      name: cluster1
+      clusterLocationType: Regional
+      region: somewhere1
+      cluster:
+        name: cluster1
+  gke_workloads:
+  - cluster_name: cluster1
+    properties:
+      apiVersion: v1
+      kind: Secret
+      stringData:
+        password: s3cr3t-password`,
+	}
+	secrets.Register("s3cr3t-password")
+
+	_, project := testconf.ConfigAndProject(t, configExtend)
+	fake := gcp.NewFake()
+	fake.AddProject(project.ID, "1111", "folder", "98765321")
+	var buf bytes.Buffer
+	opts := &Options{Client: fake, Logger: log.New(&buf, "[my-project] ", 0)}
+	if err := deployGKEWorkloads(project, opts); err != nil {
+		t.Fatalf("deployGKEWorkloads error: %v", err)
+	}
+	got := buf.String()
+	if !strings.Contains(got, "Creating data") {
+		t.Errorf("deployGKEWorkloads did not log the workload:\n%s", got)
+	}
+	if strings.Contains(got, "s3cr3t-password") {
+		t.Errorf("log output contains the secret:\n%s", got)
 	}
 }
 
@@ -226,13 +288,10 @@ resources:
 
 	for _, tc := range testcases {
 		_, project := testconf.ConfigAndProject(t, &tc.in)
-		var gotArgs [][]string
-		cmdRun = func(cmd *exec.Cmd) error {
-			gotArgs = append(gotArgs, cmd.Args)
-			return nil
-		}
+		fake := gcp.NewFake()
+		fake.AddProject(project.ID, "1111", "folder", "98765321")
 
-		err := deployGKEWorkloads(project)
+		err := deployGKEWorkloads(project, &Options{Client: fake})
 		if err == nil || !strings.Contains(err.Error(), tc.err) {
 			t.Errorf("deployGKEWorkloads unexpected error: got %q, want error with substring %q", err, tc.err)
 		}
@@ -244,30 +303,17 @@ func TestImportBinaryAuthorizationPolicy(t *testing.T) {
 binauthz:
   properties: {}`}
 
-	wantArgs := [][]string{
-		{"gcloud", "beta", "container", "binauthz", "policy", "import", "foo.json", "--project", "my-project"},
-	}
-
 	_, project := testconf.ConfigAndProject(t, configExtend)
-	var gotArgs [][]string
-	cmdRun = func(cmd *exec.Cmd) error {
-		gotArgs = append(gotArgs, cmd.Args)
-		return nil
-	}
+	fake := gcp.NewFake()
+	p := fake.AddProject(project.ID, "1111", "folder", "98765321")
 	if project.BinauthzPolicy == nil {
 		return
 	}
 
-	if err := importBinauthz(project.ID, project.BinauthzPolicy); err != nil {
+	if err := importBinauthz(project.ID, project.BinauthzPolicy, &Options{Client: fake}); err != nil {
 		t.Fatalf("importBinauthz error: %v", err)
 	}
-	if len(gotArgs) != 1 {
-		t.Fatalf("importBinauthz does not run correct number of commands: %d", len(gotArgs))
-	}
-	if diff := cmp.Diff(gotArgs[0][:6], wantArgs[0][:6]); diff != "" {
-		t.Fatalf("binauthz cmd error between index 0 and 5: %v", gotArgs[0])
-	}
-	if diff := cmp.Diff(gotArgs[0][7:9], wantArgs[0][7:9]); diff != "" {
-		t.Fatalf("binauthz cmd error between index 7 and 8: %v", gotArgs[0])
+	if p.BinauthzPolicy == "" {
+		t.Fatal("importBinauthz did not import a policy")
 	}
 }
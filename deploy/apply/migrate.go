@@ -0,0 +1,246 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
+)
+
+// auditLogConfigResourceName is the name of the deployment manager resource enabling audit logs in the
+// pre-requisites deployment.
+const auditLogConfigResourceName = "enable-all-audit-log-policies"
+
+// dataResourceTypes are the types of terraform resources holding data. They are protected when migrated so they
+// are never deleted or recreated.
+var dataResourceTypes = map[string]bool{
+	"google_bigquery_dataset":   true,
+	"google_healthcare_dataset": true,
+	tfconfig.DICOMStore:         true,
+	tfconfig.FHIRStore:          true,
+	tfconfig.HL7V2Store:         true,
+	"google_storage_bucket":     true,
+}
+
+// Migration is the mapping of the live deployment manager deployments of a project to terraform resources.
+type Migration struct {
+	ProjectID   string
+	Deployments []*MigratedDeployment
+}
+
+// MigratedDeployment is a live deployment manager deployment whose resources are imported into terraform before
+// the deployment is abandoned.
+type MigratedDeployment struct {
+	// ProjectID is the project the deployment is deployed in.
+	ProjectID string
+	Name      string
+	// StateComponent is the terraform deployment of the project the resources are imported into.
+	StateComponent string
+	Resources      []*MigratedResource
+}
+
+// MigratedResource is a top-level resource of a deployment manager deployment.
+type MigratedResource struct {
+	Name string
+	Type string
+	// Imports of the equivalent terraform resources. If empty, the resource has no terraform equivalent and is
+	// left unmanaged once the deployment is abandoned.
+	Imports []terraform.Import
+}
+
+// imports returns the imports and protected addresses of the deployments migrated into the state component.
+func (m *Migration) imports(component string) (imports []terraform.Import, protected []string) {
+	for _, d := range m.Deployments {
+		if d.StateComponent != component {
+			continue
+		}
+		for _, r := range d.Resources {
+			for _, imp := range r.Imports {
+				imports = append(imports, imp)
+				if isDataAddress(imp.Address) {
+					protected = append(protected, imp.Address)
+				}
+			}
+		}
+	}
+	return imports, protected
+}
+
+// String returns the report of the migration, mapping every deployment manager resource to the terraform resources
+// it is imported as.
+func (m *Migration) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Migration of project %q from deployment manager to terraform:\n", m.ProjectID)
+	if len(m.Deployments) == 0 {
+		sb.WriteString("  no deployment manager deployments to migrate\n")
+		return sb.String()
+	}
+	for _, d := range m.Deployments {
+		fmt.Fprintf(&sb, "  deployment %q in project %q is abandoned, its resources are imported into terraform state %q:\n", d.Name, d.ProjectID, d.StateComponent)
+		for _, r := range d.Resources {
+			fmt.Fprintf(&sb, "    %s (%s):\n", r.Name, r.Type)
+			if len(r.Imports) == 0 {
+				sb.WriteString("      no terraform equivalent, left unmanaged\n")
+			}
+			for _, imp := range r.Imports {
+				var protected string
+				if isDataAddress(imp.Address) {
+					protected = " (protected)"
+				}
+				fmt.Fprintf(&sb, "      %s <- %s%s\n", imp.Address, imp.ID, protected)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// isDataAddress returns whether the terraform address is of a resource holding data.
+func isDataAddress(addr string) bool {
+	i := strings.LastIndex(addr, ".")
+	return i > 0 && dataResourceTypes[addr[:i]]
+}
+
+// PlanMigration reads the live deployment manager deployments of the project and maps their resources to the
+// terraform resources deploying the project.
+func PlanMigration(conf *config.Config, project *config.Project, opts *Options) (*Migration, error) {
+	c := opts.client()
+	m := &Migration{ProjectID: project.ID}
+
+	rs, err := project.TerraformResourcesByName()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get terraform resources: %v", err)
+	}
+	ac, err := project.TerraformAuditConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get terraform audit config: %v", err)
+	}
+	// The type provider for CHC resources is specific to deployment manager and has no terraform equivalent.
+	prerequisites := map[string][]tfconfig.Resource{auditLogConfigResourceName: {ac}}
+
+	auditProject := conf.ProjectForAuditLogs(project)
+	auditRs, err := project.TerraformAuditResourcesByName(auditProject.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get terraform audit resources: %v", err)
+	}
+
+	deployments := []struct {
+		projectID string
+		name      string
+		component string
+		resources map[string][]tfconfig.Resource
+	}{
+		{project.ID, setupPrerequisiteDeploymentName, resourcesStateComponent, prerequisites},
+		{project.ID, resourceDeploymentName, resourcesStateComponent, rs},
+		{auditProject.ID, auditDeploymentNameFor(project), auditStateComponent, auditRs},
+	}
+	live := make(map[string]map[string]bool)
+	for _, d := range deployments {
+		if live[d.projectID] == nil {
+			names, err := c.ListDeployments(d.projectID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list deployments in project %q: %v", d.projectID, err)
+			}
+			live[d.projectID] = make(map[string]bool)
+			for _, n := range names {
+				live[d.projectID][n] = true
+			}
+		}
+		if !live[d.projectID][d.name] {
+			continue
+		}
+		md, err := migrateDeployment(d.projectID, d.name, d.component, d.resources, c)
+		if err != nil {
+			return nil, err
+		}
+		m.Deployments = append(m.Deployments, md)
+	}
+	return m, nil
+}
+
+// migrateDeployment maps the top-level resources in the latest manifest of the deployment to the imports of the
+// terraform resources of the same name.
+func migrateDeployment(projectID, name, component string, resources map[string][]tfconfig.Resource, c gcp.Client) (*MigratedDeployment, error) {
+	d, err := c.GetDeployment(projectID, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %q in project %q: %v", name, projectID, err)
+	}
+	md := &MigratedDeployment{ProjectID: projectID, Name: name, StateComponent: component}
+	for _, r := range d.Resources {
+		mr := &MigratedResource{Name: r.Name, Type: r.Type}
+		for _, tr := range resources[r.Name] {
+			i, ok := tr.(tfconfig.Importer)
+			if !ok {
+				return nil, fmt.Errorf("%s %q of deployment manager resource %q cannot be imported", tr.TerraformResourceName(), tr.ID(), r.Name)
+			}
+			mr.Imports = append(mr.Imports, terraform.Import{
+				Address: tr.TerraformResourceName() + "." + tr.ID(),
+				ID:      i.ImportID(),
+			})
+		}
+		md.Resources = append(md.Resources, mr)
+	}
+	return md, nil
+}
+
+// MigrateToTerraform moves the resources of the project deployed by deployment manager to terraform.
+// The mapping of deployment manager resources to terraform resources is logged and must be confirmed. The resources
+// are then imported into the terraform state of the project and the deployments are abandoned, leaving their
+// resources in place. Data buckets and datasets are never deleted or recreated by the migration.
+// The audit logs project must be migrated before the projects keeping their audit logs in it.
+func MigrateToTerraform(conf *config.Config, project *config.Project, opts *Options) error {
+	m, err := PlanMigration(conf, project, opts)
+	if err != nil {
+		return err
+	}
+	opts.logf("%s", m)
+	if len(m.Deployments) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("Import the resources of the deployments of project %q into terraform and abandon the deployments? Enter [yes] to continue, or [no] to cancel:", project.ID)
+	if err := confirmDecommission(msg, opts); err != nil {
+		return err
+	}
+
+	// Migrated data must be kept regardless of the options.
+	tfOpts := *opts
+	tfOpts.AllowProtectedDeletes = false
+
+	// The deployments are abandoned last, so their manifests can be read again to retry a failed import.
+	imports, protected := m.imports(resourcesStateComponent)
+	if err := deployTerraform(conf, project, imports, protected, &tfOpts); err != nil {
+		return fmt.Errorf("failed to import terraform resources: %v", err)
+	}
+	c := opts.client()
+	if err := updateLogSinkWriter(project, c); err != nil {
+		return err
+	}
+	imports, protected = m.imports(auditStateComponent)
+	if err := deployTerraformAudit(conf, project, imports, protected, &tfOpts); err != nil {
+		return fmt.Errorf("failed to import terraform audit resources: %v", err)
+	}
+
+	for _, d := range m.Deployments {
+		if err := c.AbandonDeployment(d.ProjectID, d.Name); err != nil {
+			return fmt.Errorf("failed to abandon deployment %q in project %q: %v", d.Name, d.ProjectID, err)
+		}
+	}
+	return nil
+}
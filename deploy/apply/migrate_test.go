@@ -0,0 +1,160 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/testconf"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+const migrationProjectConfig = `
+resources:
+  gcs_buckets:
+  - properties:
+      name: foo-bucket
+      location: us-east1
+  bq_datasets:
+  - properties:
+      name: foo_dataset
+      location: US`
+
+func TestPlanMigration(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, &testconf.ConfigData{migrationProjectConfig})
+	fake := testconf.DeployedFake(t, conf, project, Deployments)
+
+	m, err := PlanMigration(conf, project, &Options{Client: fake})
+	if err != nil {
+		t.Fatalf("PlanMigration = %v", err)
+	}
+	var gotDeployments []string
+	got := make(map[string][]terraform.Import)
+	for _, d := range m.Deployments {
+		gotDeployments = append(gotDeployments, d.Name)
+		for _, r := range d.Resources {
+			got[r.Name] = r.Imports
+		}
+	}
+	wantDeployments := []string{setupPrerequisiteDeploymentName, resourceDeploymentName, auditDeploymentNameFor(project)}
+	if diff := cmp.Diff(gotDeployments, wantDeployments); diff != "" {
+		t.Errorf("deployments differ (-got +want):\n%v", diff)
+	}
+
+	want := map[string][]terraform.Import{
+		"enable-all-audit-log-policies": {{Address: "google_project_iam_audit_config.allServices", ID: "my-project allServices"}},
+		"foo_dataset":                   {{Address: "google_bigquery_dataset.foo_dataset", ID: "projects/my-project/datasets/foo_dataset"}},
+		"audit_logs":                    {{Address: "google_bigquery_dataset.audit_logs", ID: "projects/my-project/datasets/audit_logs"}},
+	}
+	for name, w := range want {
+		if diff := cmp.Diff(got[name], w, cmpopts.IgnoreFields(terraform.Import{}, "Exists")); diff != "" {
+			t.Errorf("imports of %q differ (-got +want):\n%v", name, diff)
+		}
+	}
+	if imports, ok := got["chc-type-provider"]; !ok || len(imports) != 0 {
+		t.Errorf("imports of chc-type-provider = %v, %t, want none", imports, ok)
+	}
+	var bucketImported bool
+	for _, imp := range got["foo-bucket"] {
+		if imp.Address == "google_storage_bucket.foo-bucket" && imp.ID == "my-project/foo-bucket" {
+			bucketImported = true
+		}
+	}
+	if !bucketImported {
+		t.Errorf("imports of foo-bucket = %v, want google_storage_bucket.foo-bucket", got["foo-bucket"])
+	}
+
+	report := m.String()
+	for _, w := range []string{
+		"google_bigquery_dataset.foo_dataset <- projects/my-project/datasets/foo_dataset (protected)",
+		"google_storage_bucket.foo-bucket <- my-project/foo-bucket (protected)",
+		"no terraform equivalent, left unmanaged",
+	} {
+		if !strings.Contains(report, w) {
+			t.Errorf("report does not contain %q:\n%s", w, report)
+		}
+	}
+}
+
+func TestMigrateToTerraform(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, &testconf.ConfigData{migrationProjectConfig})
+	fake := testconf.DeployedFake(t, conf, project, Deployments)
+
+	opts := &Options{
+		Client:  fake,
+		Confirm: func(string) (bool, error) { return true, nil },
+		// Migrated data is protected regardless.
+		AllowProtectedDeletes: true,
+	}
+	if err := MigrateToTerraform(conf, project, opts); err != nil {
+		t.Fatalf("MigrateToTerraform = %v", err)
+	}
+	if ds := fake.Project(project.ID).Deployments; len(ds) != 0 {
+		t.Errorf("deployments = %v, want none", ds)
+	}
+
+	// The state bucket is bootstrapped, then the resources and audit resources are imported.
+	applies := fake.TerraformApplies()
+	if len(applies) != 3 {
+		t.Fatalf("got %d terraform applies, want 3", len(applies))
+	}
+	imported := make(map[string]bool)
+	for _, a := range applies[1:] {
+		for _, imp := range a.Imports {
+			imported[imp.Address] = true
+		}
+	}
+	for _, addr := range []string{
+		"google_project_iam_audit_config.allServices",
+		"google_logging_project_sink.audit-logs-to-bigquery",
+		"google_bigquery_dataset.foo_dataset",
+		"google_storage_bucket.foo-bucket",
+		"google_bigquery_dataset.audit_logs",
+	} {
+		if !imported[addr] {
+			t.Errorf("%q not imported", addr)
+		}
+	}
+
+	// Migrating again has nothing left to do.
+	if err := MigrateToTerraform(conf, project, opts); err != nil {
+		t.Fatalf("MigrateToTerraform again = %v", err)
+	}
+	if n := len(fake.TerraformApplies()); n != 3 {
+		t.Errorf("got %d terraform applies after migrating again, want 3", n)
+	}
+}
+
+func TestMigrateToTerraformCancelled(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, &testconf.ConfigData{migrationProjectConfig})
+	fake := testconf.DeployedFake(t, conf, project, Deployments)
+
+	opts := &Options{
+		Client:  fake,
+		Confirm: func(string) (bool, error) { return false, nil },
+	}
+	if err := MigrateToTerraform(conf, project, opts); err == nil {
+		t.Fatal("MigrateToTerraform = nil, want error")
+	}
+	if n := len(fake.Project(project.ID).Deployments); n != 3 {
+		t.Errorf("got %d deployments, want 3", n)
+	}
+	if n := len(fake.TerraformApplies()); n != 0 {
+		t.Errorf("got %d terraform applies, want 0", n)
+	}
+}
@@ -16,6 +16,21 @@
 
 package apply
 
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
+)
+
 // Options configures an apply call.
 type Options struct {
 	// Toggle whether terraform is enabled.
@@ -24,4 +39,112 @@ type Options struct {
 	EnableTerraform bool
 	// Toggle whether Forseti is enabled.
 	EnableForseti bool
+	// Preview deployment manager changes and terraform plans and ask for confirmation before committing them.
+	Preview bool
+	// AllowProtectedDeletes allows terraform to delete protected resources, such as state buckets and Forseti.
+	AllowProtectedDeletes bool
+	// Confirm asks the user to confirm the message, e.g. to commit a previewed deployment.
+	// If nil, the user is asked on stdin.
+	Confirm func(message string) (bool, error)
+	// Client makes all calls to GCP. If nil, calls are made by running gcloud on the local machine, logging the
+	// commands to Logger.
+	Client gcp.Client
+	// Logger logs the progress of the apply call, e.g. with a prefix to tell concurrently applied projects apart.
+	// If nil, the standard logger is used. Registered secrets are redacted from the progress, but not from what
+	// others log to it, so it should write to a redacting writer (see secrets.NewRedactingWriter).
+	Logger *log.Logger
+	// NonInteractive never reads from stdin, e.g. when run in CI. Steps that need an action from a user
+	// emit an event and wait for the action instead of prompting, and confirmations fail unless Confirm is set.
+	NonInteractive bool
+	// StackdriverTimeout is how long to wait for a Stackdriver workspace to be created in non-interactive mode.
+	StackdriverTimeout time.Duration
+	// SkipMissingStackdriver skips the creation of Stackdriver alerts with a warning recorded in the generated
+	// fields if the Stackdriver workspace was not created in time, instead of failing.
+	SkipMissingStackdriver bool
+	// Events receives machine-readable events as JSON lines, e.g. actions required from a user.
+	// If nil, events are written to stdout.
+	Events io.Writer
+	// TerraformCacheDir is the dir with the terraform modules and provider plugins vendored by VendorTerraform.
+	// If set, terraform runs offline and only uses the vendored modules and plugins.
+	TerraformCacheDir string
+}
+
+// Event is a machine-readable event emitted during an apply call.
+type Event struct {
+	// Type is the type of the event, e.g. action_required.
+	Type    string `json:"type"`
+	Project string `json:"project"`
+	// Action is the action required from a user, e.g. create_stackdriver_workspace.
+	Action  string `json:"action,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// eventsMu serializes events of concurrently applied projects so lines are not interleaved.
+var eventsMu sync.Mutex
+
+// logf logs the progress of the apply call to the configured logger, redacting registered secrets, e.g. from
+// previewed deployments and terraform plans.
+func (o *Options) logf(format string, v ...interface{}) {
+	s := secrets.Redact(fmt.Sprintf(format, v...))
+	if o == nil || o.Logger == nil {
+		log.Print(s)
+		return
+	}
+	o.Logger.Print(s)
+}
+
+// terraformOptions returns the options to apply terraform configs with.
+func (o *Options) terraformOptions() *terraform.Options {
+	return &terraform.Options{
+		AllowProtectedDeletes: o.AllowProtectedDeletes,
+		CacheDir:              o.TerraformCacheDir,
+	}
+}
+
+// client returns the client to make calls to GCP with.
+func (o *Options) client() gcp.Client {
+	var c gcp.Client
+	switch {
+	case o == nil:
+		c = gcp.NewGCloud(&runner.Default{})
+	case o.Client == nil:
+		c = gcp.NewGCloud(&runner.Default{Logger: o.Logger, NonInteractive: o.NonInteractive})
+	default:
+		c = o.Client
+	}
+	if o != nil && o.Preview {
+		c = &previewClient{Client: c, opts: o}
+	}
+	return c
+}
+
+// emit writes the event as a JSON line to the configured events writer.
+func (o *Options) emit(e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+	var w io.Writer = os.Stdout
+	if o != nil && o.Events != nil {
+		w = o.Events
+	}
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write event: %v", err)
+	}
+	return nil
+}
+
+// confirm asks the user to confirm the message.
+func (o *Options) confirm(message string) (bool, error) {
+	if o == nil || o.Confirm == nil {
+		if o != nil && o.NonInteractive {
+			return false, fmt.Errorf("confirmation required in non-interactive mode: %s", message)
+		}
+		fmt.Println(message)
+		return askForConfirmation()
+	}
+	return o.Confirm(message)
 }
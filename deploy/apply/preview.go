@@ -0,0 +1,94 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
+)
+
+// previewClient is a gcp.Client that previews every deployment and terraform config and only commits it once the user
+// confirmed the changes.
+// This prevents resources from being silently abandoned, e.g. after they were removed from the config by mistake.
+type previewClient struct {
+	gcp.Client
+	opts *Options
+}
+
+// UpsertDeployment implements gcp.Client.UpsertDeployment.
+func (c *previewClient) UpsertDeployment(projectID, name string, deployment *deploymentmanager.Deployment) error {
+	changes, err := c.Client.PreviewDeployment(projectID, name, deployment)
+	if err != nil {
+		return fmt.Errorf("failed to preview deployment %q: %v", name, err)
+	}
+	c.opts.logf("Preview of deployment %q in project %q:\n%v", name, projectID, changes)
+
+	// Nothing would change, so there is nothing to confirm.
+	if changes.Empty() {
+		return c.Client.CommitDeploymentPreview(projectID, name)
+	}
+
+	message := fmt.Sprintf("Commit the changes above to deployment %q in project %q? Enter [yes] or [no]:", name, projectID)
+	if n := len(changes.Abandoned) + len(changes.Deleted); n > 0 {
+		message = fmt.Sprintf("WARNING: %d resource(s) will no longer be managed by deployment %q.\n%s", n, name, message)
+	}
+	ok, err := c.opts.confirm(message)
+	if err == nil && ok {
+		return c.Client.CommitDeploymentPreview(projectID, name)
+	}
+
+	// Never leave the deployment in preview, it would block any further update.
+	if cerr := c.Client.CancelDeploymentPreview(projectID, name); cerr != nil {
+		return fmt.Errorf("failed to cancel preview of deployment %q: %v", name, cerr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to confirm preview of deployment %q: %v", name, err)
+	}
+	return fmt.Errorf("preview of deployment %q was not confirmed and has been cancelled", name)
+}
+
+// TerraformApply implements gcp.Client.TerraformApply.
+// The plan is confirmed between planning and applying the config, so exactly the confirmed plan is applied.
+func (c *previewClient) TerraformApply(config *terraform.Config, dir string, opts *terraform.Options) error {
+	confirmed := new(terraform.Options)
+	if opts != nil {
+		*confirmed = *opts
+	}
+	confirmed.Confirm = c.confirmPlan
+	return c.Client.TerraformApply(config, dir, confirmed)
+}
+
+// confirmPlan asks the user to confirm the terraform plan, unless nothing would change.
+func (c *previewClient) confirmPlan(s *terraform.PlanSummary) error {
+	c.opts.logf("Terraform plan:\n%v", s)
+	if len(s.Changes) == 0 {
+		return nil
+	}
+	message := "Apply the terraform plan above? Enter [yes] or [no]:"
+	if n := len(s.Deletes()); n > 0 {
+		message = fmt.Sprintf("WARNING: %d resource(s) will be deleted.\n%s", n, message)
+	}
+	ok, err := c.opts.confirm(message)
+	if err != nil {
+		return fmt.Errorf("failed to confirm terraform plan: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("terraform plan was not confirmed")
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/testconf"
+)
+
+func TestPreview(t *testing.T) {
+	oldBucket := &deploymentmanager.Resource{Name: "removed-bucket", Type: "storage.v1.bucket"}
+
+	tests := []struct {
+		name         string
+		confirm      bool
+		confirmErr   error
+		wantErr      bool
+		wantCommited bool
+	}{
+		{
+			name:         "confirmed",
+			confirm:      true,
+			wantCommited: true,
+		},
+		{
+			name:    "not_confirmed",
+			wantErr: true,
+		},
+		{
+			name:       "confirmation_error",
+			confirmErr: errors.New("no input"),
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, project := testconf.ConfigAndProject(t, nil)
+			fake := newFakeWithProject(conf, project)
+			p := fake.Project(project.ID)
+			p.Deployments[resourceDeploymentName] = &deploymentmanager.Deployment{
+				Resources: []*deploymentmanager.Resource{oldBucket},
+			}
+
+			var gotMessages []string
+			opts := &Options{
+				Client:  fake,
+				Preview: true,
+				Confirm: func(message string) (bool, error) {
+					gotMessages = append(gotMessages, message)
+					return tc.confirm, tc.confirmErr
+				},
+			}
+			err := deployResources(project, opts)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("deployResources = %v, want error %t", err, tc.wantErr)
+			}
+
+			if len(gotMessages) != 1 {
+				t.Fatalf("got %d confirmations, want 1: %v", len(gotMessages), gotMessages)
+			}
+			if !strings.Contains(gotMessages[0], "WARNING: 1 resource(s) will no longer be managed") {
+				t.Errorf("confirmation message does not warn about abandoned resource: %q", gotMessages[0])
+			}
+			if len(p.DeploymentPreviews) != 0 {
+				t.Errorf("deployments left in preview: %v", p.DeploymentPreviews)
+			}
+			resources := p.Deployments[resourceDeploymentName].Resources
+			gotCommitted := len(resources) != 1 || resources[0].Name != oldBucket.Name
+			if gotCommitted != tc.wantCommited {
+				t.Errorf("deployment committed = %t, want %t", gotCommitted, tc.wantCommited)
+			}
+		})
+	}
+}
+
+func TestPreviewNoChanges(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, nil)
+	fake := newFakeWithProject(conf, project)
+	opts := &Options{
+		Client:  fake,
+		Preview: true,
+		Confirm: func(message string) (bool, error) { return true, nil },
+	}
+	if err := deployResources(project, opts); err != nil {
+		t.Fatalf("deployResources = %v", err)
+	}
+
+	// Deploying the same resources again must not ask for confirmation.
+	opts.Confirm = func(message string) (bool, error) {
+		t.Errorf("unexpected confirmation: %q", message)
+		return false, nil
+	}
+	if err := deployResources(project, opts); err != nil {
+		t.Fatalf("deployResources without changes = %v", err)
+	}
+}
+
+func TestPreviewTerraform(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, nil)
+	fake := newFakeWithProject(conf, project)
+
+	var gotMessages []string
+	confirm := true
+	opts := &Options{
+		Client:  fake,
+		Preview: true,
+		Confirm: func(message string) (bool, error) {
+			gotMessages = append(gotMessages, message)
+			return confirm, nil
+		},
+	}
+	if err := deployTerraform(conf, project, nil, nil, opts); err != nil {
+		t.Fatalf("deployTerraform = %v", err)
+	}
+	// The plan of all resources is confirmed before the state bucket is bootstrapped, then the applied plan.
+	if len(gotMessages) != 2 || len(fake.TerraformApplies()) != 2 {
+		t.Fatalf("got %d confirmations and %d applies, want 2 and 2", len(gotMessages), len(fake.TerraformApplies()))
+	}
+
+	// Applying the same config again must not ask for confirmation.
+	gotMessages = nil
+	if err := deployTerraform(conf, project, nil, nil, opts); err != nil {
+		t.Fatalf("deployTerraform without changes = %v", err)
+	}
+	if len(gotMessages) != 0 {
+		t.Errorf("got confirmations %v, want none", gotMessages)
+	}
+
+	// A declined plan is not applied.
+	project.TerraformConfig.StateBucket.Location = "EU"
+	confirm = false
+	if err := deployTerraform(conf, project, nil, nil, opts); err == nil {
+		t.Fatal("deployTerraform with declined plan = nil, want error")
+	}
+	if n := len(fake.TerraformApplies()); n != 3 {
+		t.Errorf("got %d applies, want 3", n)
+	}
+}
+
+func TestPreviewTerraformDeclinedBootstrap(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, nil)
+	fake := newFakeWithProject(conf, project)
+
+	var buf bytes.Buffer
+	opts := &Options{
+		Client:  fake,
+		Preview: true,
+		Logger:  log.New(&buf, "", 0),
+		Confirm: func(string) (bool, error) { return false, nil },
+	}
+	if err := deployTerraform(conf, project, nil, nil, opts); err == nil {
+		t.Fatal("deployTerraform with declined plan = nil, want error")
+	}
+
+	// The declined plan must show all resources, not just the state bucket.
+	_, rs, _, err := resourcesTerraformConfig(conf, project, fake)
+	if err != nil {
+		t.Fatalf("resourcesTerraformConfig = %v", err)
+	}
+	for _, r := range rs {
+		addr := r.TerraformResourceName() + "." + r.ID()
+		if !strings.Contains(buf.String(), "+ "+addr) {
+			t.Errorf("plan does not create %q:\n%s", addr, buf.String())
+		}
+	}
+	if n := len(fake.TerraformApplies()); n != 0 {
+		t.Errorf("got %d applies, want 0", n)
+	}
+	exists, err := bucketExists(project.ID, project.TerraformConfig.StateBucket.Name, fake)
+	if err != nil {
+		t.Fatalf("bucketExists = %v", err)
+	}
+	if exists {
+		t.Error("state bucket was created although the plan was declined")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+)
+
+// step is a single step to set up a project.
+// Steps are numbered from 1 in the order they are run. The number of the step that failed
+// is recorded in the project's generated fields so the next run can resume from it.
+type step struct {
+	// description describes the step.
+	description string
+	// updatable is whether the step should be run when updating an already deployed project.
+	updatable bool
+	// run implements the step.
+	run func(conf *config.Config, project *config.Project, opts *Options) error
+}
+
+// setupSteps returns the steps to set up any project.
+// Note: step numbers are persisted in generated fields, so changing the order of existing steps
+// will cause projects that previously failed to resume from the wrong step.
+func setupSteps() []step {
+	return []step{
+		{
+			description: "verify or create project",
+			run: func(conf *config.Config, project *config.Project, opts *Options) error {
+				return verifyOrCreateProject(conf, project, opts)
+			},
+		},
+		{
+			description: "set up billing",
+			run: func(conf *config.Config, project *config.Project, opts *Options) error {
+				return setupBilling(project, conf.Overall.BillingAccount, opts.client())
+			},
+		},
+		{
+			description: "enable service APIs",
+			updatable:   true,
+			run: func(_ *config.Config, project *config.Project, opts *Options) error {
+				return enableServiceAPIs(project, opts.client())
+			},
+		},
+		{
+			description: "create compute images",
+			updatable:   true,
+			run: func(_ *config.Config, project *config.Project, opts *Options) error {
+				return createCustomComputeImages(project, opts)
+			},
+		},
+		{
+			description: "create deletion lien",
+			updatable:   true,
+			run: func(_ *config.Config, project *config.Project, opts *Options) error {
+				return createDeletionLien(project, opts)
+			},
+		},
+		{
+			description: "deploy resources",
+			updatable:   true,
+			run:         DeployResources,
+		},
+		{
+			description: "create stackdriver account",
+			updatable:   true,
+			run: func(_ *config.Config, project *config.Project, opts *Options) error {
+				return createStackdriverAccount(project, opts)
+			},
+		},
+		{
+			description: "create alerts",
+			updatable:   true,
+			run: func(_ *config.Config, project *config.Project, opts *Options) error {
+				return createAlerts(project, opts)
+			},
+		},
+	}
+}
+
+// grantForsetiPermissionsStep grants the Forseti service account access to the project, if Forseti is enabled.
+var grantForsetiPermissionsStep = step{
+	description: "grant forseti permissions",
+	updatable:   true,
+	run: func(conf *config.Config, project *config.Project, opts *Options) error {
+		if !opts.EnableForseti {
+			return nil
+		}
+		return GrantForsetiPermissions(project.ID, conf.AllGeneratedFields.Forseti.ServiceAccount, opts.client())
+	},
+}
+
+// defaultSteps returns the steps to apply to a default project.
+func defaultSteps() []step {
+	return append(setupSteps(), grantForsetiPermissionsStep)
+}
+
+// forsetiSteps returns the steps to apply to a Forseti project.
+// Forseti is installed before granting permissions so its service account is known.
+func forsetiSteps() []step {
+	return append(setupSteps(),
+		step{
+			description: "install forseti",
+			updatable:   true,
+			run: func(conf *config.Config, _ *config.Project, opts *Options) error {
+				return installForseti(conf, opts)
+			},
+		},
+		grantForsetiPermissionsStep,
+	)
+}
+
+// runSteps runs the steps for the project.
+// For a project that was previously deployed, only updatable steps are run.
+// For a project that was not fully deployed, the steps are resumed from the step that previously failed,
+// and the failed step is recorded in the project's generated fields if a step fails again.
+func runSteps(conf *config.Config, project *config.Project, opts *Options, steps []step) error {
+	gf := project.GeneratedFields
+
+	// A project number without a failed step implies the project was fully deployed before.
+	deployed := gf.ProjectNumber != "" && gf.FailedStep == 0
+
+	start := 1
+	if gf.FailedStep > 0 {
+		if gf.FailedStep > len(steps) {
+			return fmt.Errorf("failed step %d out of range, project %q only has %d steps", gf.FailedStep, project.ID, len(steps))
+		}
+		start = gf.FailedStep
+		opts.logf("resuming from previously failed step %d", start)
+	}
+
+	for i := start; i <= len(steps); i++ {
+		s := steps[i-1]
+		opts.logf("step %d/%d (%s)", i, len(steps), s.description)
+		if deployed && !s.updatable {
+			opts.logf("step %d is not updatable, skipping", i)
+			continue
+		}
+		if err := s.run(conf, project, opts); err != nil {
+			// Only record the failed step if the project was not deployed, an update can always start from the beginning.
+			if !deployed {
+				gf.FailedStep = i
+			}
+			return fmt.Errorf("failed to %s (step %d): %v", s.description, i, err)
+		}
+	}
+
+	// The deployment finished, so there is no failed step to resume from anymore.
+	gf.FailedStep = 0
+	return nil
+}
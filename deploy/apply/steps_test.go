@@ -0,0 +1,111 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunSteps(t *testing.T) {
+	tests := []struct {
+		name           string
+		genFields      config.GeneratedFields
+		failStep       int
+		wantRun        []int
+		wantFailedStep int
+		wantErr        bool
+	}{
+		{
+			name:    "new_project",
+			wantRun: []int{1, 2, 3},
+		},
+		{
+			name:           "new_project_fails",
+			failStep:       2,
+			wantRun:        []int{1, 2},
+			wantFailedStep: 2,
+			wantErr:        true,
+		},
+		{
+			name:      "resume_from_failed_step",
+			genFields: config.GeneratedFields{ProjectNumber: "1111", FailedStep: 2},
+			wantRun:   []int{2, 3},
+		},
+		{
+			name:           "resume_fails_again",
+			genFields:      config.GeneratedFields{ProjectNumber: "1111", FailedStep: 2},
+			failStep:       3,
+			wantRun:        []int{2, 3},
+			wantFailedStep: 3,
+			wantErr:        true,
+		},
+		{
+			name:      "deployed_project_skips_non_updatable_steps",
+			genFields: config.GeneratedFields{ProjectNumber: "1111"},
+			wantRun:   []int{2, 3},
+		},
+		{
+			name:      "deployed_project_fails_does_not_record_step",
+			genFields: config.GeneratedFields{ProjectNumber: "1111"},
+			failStep:  3,
+			wantRun:   []int{2, 3},
+			wantErr:   true,
+		},
+		{
+			name:      "failed_step_out_of_range",
+			genFields: config.GeneratedFields{ProjectNumber: "1111", FailedStep: 4},
+			// Keep the failed step so the user can fix the generated fields.
+			wantFailedStep: 4,
+			wantErr:        true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotRun []int
+			newStep := func(n int, updatable bool) step {
+				return step{
+					description: "test step",
+					updatable:   updatable,
+					run: func(*config.Config, *config.Project, *Options) error {
+						gotRun = append(gotRun, n)
+						if n == tc.failStep {
+							return errors.New("step failed")
+						}
+						return nil
+					},
+				}
+			}
+			steps := []step{newStep(1, false), newStep(2, true), newStep(3, true)}
+
+			gf := tc.genFields
+			project := &config.Project{ID: "my-project", GeneratedFields: &gf}
+			err := runSteps(&config.Config{}, project, &Options{}, steps)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("runSteps = %v, want error %t", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(gotRun, tc.wantRun); diff != "" {
+				t.Errorf("steps run differ (-got +want):\n%v", diff)
+			}
+			if gf.FailedStep != tc.wantFailedStep {
+				t.Errorf("failed step = %d, want %d", gf.FailedStep, tc.wantFailedStep)
+			}
+		})
+	}
+}
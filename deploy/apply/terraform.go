@@ -19,33 +19,259 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
 )
 
-func deployTerraform(config *config.Config, project *config.Project) error {
+// Components of the project deployment whose terraform state is kept under their own prefix in the state bucket.
+const (
+	resourcesStateComponent = "resources"
+	auditStateComponent     = "audit"
+)
+
+// deployTerraform deploys the state bucket and all resources of the project with terraform.
+// The state is kept in the state bucket. If the state bucket does not exist yet, it is first created with local
+// state, which is then migrated into the bucket. In preview, the plan of all resources is confirmed before the
+// state bucket is created, so a declined preview leaves the project untouched.
+// Resources migrated from deployment manager are imported into the state and the protected addresses must not be
+// deleted or recreated.
+func deployTerraform(conf *config.Config, project *config.Project, imports []terraform.Import, protected []string, opts *Options) error {
 	if project.TerraformConfig == nil {
 		return errors.New("terraform block in project must be set when terraform is enabled")
 	}
 	b := project.TerraformConfig.StateBucket
 
-	tfConf := terraform.NewConfig()
-	tfConf.Resources = []*terraform.Resource{{
-		Name:       b.ID(),
-		Type:       b.TerraformResourceName(),
-		Properties: b,
-	}}
+	c := opts.client()
+	exists, err := bucketExists(project.ID, b.Name, c)
+	if err != nil {
+		return fmt.Errorf("failed to check whether state bucket %q exists: %v", b.Name, err)
+	}
+	if !exists {
+		bc := c
+		if pc, ok := c.(*previewClient); ok {
+			if err := previewTerraformBootstrap(conf, project, pc, opts); err != nil {
+				return err
+			}
+			// The state bucket is part of the confirmed plan.
+			bc = pc.Client
+		}
+		tfConf := newTerraformConfig(conf, project.ID)
+		tfOpts := opts.terraformOptions()
+		tfOpts.MigrateStateTo = stateBackend(project, project.ID, resourcesStateComponent)
+		if err := applyTerraformResources(tfConf, []tfconfig.Resource{b}, bc, tfOpts); err != nil {
+			return fmt.Errorf("failed to bootstrap state bucket %q: %v", b.Name, err)
+		}
+	}
 
-	dir, err := ioutil.TempDir("", "")
+	tfConf, rs, stateImports, err := resourcesTerraformConfig(conf, project, c)
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(dir)
+	tfOpts := opts.terraformOptions()
+	tfOpts.Imports = append(stateImports, imports...)
+	// Deleting the state bucket would lose the state of all resources in it.
+	tfOpts.Protected = append([]string{"google_storage_bucket." + b.ID()}, protected...)
+	return applyTerraformResources(tfConf, rs, c, tfOpts)
+}
+
+// previewTerraformBootstrap plans all resources of the project before its state bucket exists and asks the user to
+// confirm the plan. The plan is made against empty local state, as nothing has been deployed with terraform yet.
+func previewTerraformBootstrap(conf *config.Config, project *config.Project, c *previewClient, opts *Options) error {
+	tfConf, rs, _, err := resourcesTerraformConfig(conf, project, c)
+	if err != nil {
+		return err
+	}
+	tfConf.Terraform.Backend = nil
+	s, err := planTerraformResources(tfConf, rs, c.Client, opts.terraformOptions())
+	if err != nil {
+		return fmt.Errorf("failed to plan terraform resources: %v", err)
+	}
+	return c.confirmPlan(s)
+}
+
+// resourcesTerraformConfig returns the terraform config of the project with its state in the state bucket, the
+// state bucket and all resources of the project to add to it, and the import of the state bucket.
+func resourcesTerraformConfig(conf *config.Config, project *config.Project, c gcp.Client) (*terraform.Config, []tfconfig.Resource, []terraform.Import, error) {
+	rs, err := project.TerraformResources()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get terraform resources: %v", err)
+	}
+	b := project.TerraformConfig.StateBucket
+	rs = append([]tfconfig.Resource{b}, rs...)
 
 	imports := []terraform.Import{{
 		Address: "google_storage_bucket." + b.ID(),
 		ID:      fmt.Sprintf("%s/%s", project.ID, b.ID()),
+		// The state bucket may have been created before terraform was enabled, e.g. by a previous deployment.
+		Exists: func() (bool, error) {
+			return bucketExists(project.ID, b.Name, c)
+		},
 	}}
-	return terraformApply(tfConf, dir, &terraform.Options{Imports: imports})
+	tfConf := newTerraformConfig(conf, project.ID)
+	tfConf.Terraform.Backend = stateBackend(project, project.ID, resourcesStateComponent)
+	return tfConf, rs, imports, nil
+}
+
+// stateBackend returns the backend keeping the state of the component of the project in the state bucket of the
+// given project.
+func stateBackend(bucketProject *config.Project, projectID, component string) *terraform.Backend {
+	return &terraform.Backend{
+		Bucket: bucketProject.TerraformConfig.StateBucket.Name,
+		Prefix: projectID + "/" + component,
+	}
+}
+
+// bucketExists returns whether the GCS bucket exists in the project.
+func bucketExists(projectID, name string, c gcp.Client) (bool, error) {
+	urls, err := c.ListBuckets(projectID)
+	if err != nil {
+		return false, err
+	}
+	for _, u := range urls {
+		if u == "gs://"+name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// deployTerraformAudit deploys the audit logs dataset and bucket of the project in the audit logs project with terraform.
+// The state is kept in the state bucket of the audit logs project.
+// Resources migrated from deployment manager are imported into the state and the protected addresses must not be
+// deleted or recreated.
+func deployTerraformAudit(conf *config.Config, project *config.Project, imports []terraform.Import, protected []string, opts *Options) error {
+	tfConf, rs, err := auditTerraformConfig(conf, project)
+	if err != nil {
+		return err
+	}
+	tfOpts := opts.terraformOptions()
+	tfOpts.Imports = imports
+	tfOpts.Protected = protected
+	return applyTerraformResources(tfConf, rs, opts.client(), tfOpts)
+}
+
+// auditTerraformConfig returns the terraform config of the audit logs of the project with its state in the state
+// bucket of the audit logs project, and the audit logs dataset and bucket to add to it.
+func auditTerraformConfig(conf *config.Config, project *config.Project) (*terraform.Config, []tfconfig.Resource, error) {
+	auditProject := conf.ProjectForAuditLogs(project)
+	if auditProject.TerraformConfig == nil {
+		return nil, nil, fmt.Errorf("terraform block in audit logs project %q must be set when terraform is enabled", auditProject.ID)
+	}
+	rs, err := project.TerraformAuditResources(auditProject.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get terraform audit resources: %v", err)
+	}
+	tfConf := newTerraformConfig(conf, auditProject.ID)
+	tfConf.Terraform.Backend = stateBackend(auditProject, project.ID, auditStateComponent)
+	return tfConf, rs, nil
+}
+
+// newTerraformConfig returns a terraform config with the overall terraform settings of the config.
+// The google and google-beta providers default to the project.
+func newTerraformConfig(conf *config.Config, projectID string) *terraform.Config {
+	s := conf.Overall.Terraform
+	tfConf := terraform.NewConfig()
+	if s.RequiredVersion != "" {
+		tfConf.Terraform.RequiredVersion = s.RequiredVersion
+	}
+	tfConf.Terraform.RequiredProviders = s.RequiredProviders
+	for _, name := range []string{"google", "google-beta"} {
+		tfConf.Providers = append(tfConf.Providers, &terraform.Provider{
+			Name:    name,
+			Project: projectID,
+			Region:  s.Region,
+		})
+	}
+	return tfConf
+}
+
+// VendorTerraform vendors the remote modules and provider plugins of the terraform configs deployed for the config
+// into the cache dir, so the configs can later be applied without network access.
+func VendorTerraform(conf *config.Config, cacheDir string, rn runner.Runner) error {
+	// The project configs only differ in the default project of their providers, so one config covers all of them.
+	tfConfs := []*terraform.Config{newTerraformConfig(conf, "")}
+	if conf.Forseti != nil {
+		tfConfs = append(tfConfs, forsetiTerraformConfig(conf))
+	}
+	for _, c := range tfConfs {
+		if err := terraform.Vendor(c, cacheDir, rn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportTerraform writes the terraform configs deploying the project to the dir as HCL files, with scripts importing
+// the resources that may already exist: the resources of the project to <dir>/resources, its audit logs to
+// <dir>/audit and, for the Forseti project, Forseti to <dir>/forseti.
+// The configs keep their state in the state buckets, which must exist before the configs are applied.
+func ExportTerraform(conf *config.Config, project *config.Project, dir string, rn runner.Runner) error {
+	if project.TerraformConfig == nil {
+		return fmt.Errorf("terraform block in project %q must be set to export terraform configs", project.ID)
+	}
+	tfConf, rs, imports, err := resourcesTerraformConfig(conf, project, gcp.NewGCloud(rn))
+	if err != nil {
+		return err
+	}
+	addTerraformResources(tfConf, rs)
+	if err := terraform.WriteHCL(tfConf, imports, filepath.Join(dir, resourcesStateComponent), rn); err != nil {
+		return fmt.Errorf("failed to export terraform resources: %v", err)
+	}
+
+	if tfConf, rs, err = auditTerraformConfig(conf, project); err != nil {
+		return err
+	}
+	addTerraformResources(tfConf, rs)
+	if err := terraform.WriteHCL(tfConf, nil, filepath.Join(dir, auditStateComponent), rn); err != nil {
+		return fmt.Errorf("failed to export terraform audit resources: %v", err)
+	}
+
+	if conf.Forseti == nil || conf.Forseti.Project.ID != project.ID {
+		return nil
+	}
+	tfConf = forsetiTerraformConfig(conf)
+	tfConf.Terraform.Backend = forsetiStateBackend(conf)
+	if err := terraform.WriteHCL(tfConf, nil, filepath.Join(dir, "forseti"), rn); err != nil {
+		return fmt.Errorf("failed to export forseti: %v", err)
+	}
+	return nil
+}
+
+// applyTerraformResources adds the resources to the config and applies it in a temporary directory.
+// If the config has no backend, the state is local to the directory, unless it is migrated by the options.
+func applyTerraformResources(tfConf *terraform.Config, rs []tfconfig.Resource, c gcp.Client, opts *terraform.Options) error {
+	addTerraformResources(tfConf, rs)
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	return c.TerraformApply(tfConf, dir, opts)
+}
+
+// planTerraformResources adds the resources to the config and plans it in a temporary dir.
+func planTerraformResources(tfConf *terraform.Config, rs []tfconfig.Resource, c gcp.Client, opts *terraform.Options) (*terraform.PlanSummary, error) {
+	addTerraformResources(tfConf, rs)
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	return c.TerraformPlan(tfConf, dir, opts)
+}
+
+// addTerraformResources adds the resources to the config.
+func addTerraformResources(tfConf *terraform.Config, rs []tfconfig.Resource) {
+	for _, r := range rs {
+		tfConf.Resources = append(tfConf.Resources, &terraform.Resource{
+			Name:       r.ID(),
+			Type:       r.TerraformResourceName(),
+			Properties: r,
+		})
+	}
 }
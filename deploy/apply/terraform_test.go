@@ -16,68 +16,303 @@ package apply
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/testconf"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestDeployTerraform(t *testing.T) {
 	conf, project := testconf.ConfigAndProject(t, nil)
-	var gotConfig *terraform.Config
-	var gotImports []terraform.Import
-	terraformApply = func(config *terraform.Config, _ string, opts *terraform.Options) error {
-		gotConfig = config
-		if opts != nil {
-			gotImports = opts.Imports
+	fake := newFakeWithProject(conf, project)
+	if err := deployTerraform(conf, project, nil, nil, &Options{Client: fake}); err != nil {
+		t.Fatalf("deployTerraform: %v", err)
+	}
+	applies := fake.TerraformApplies()
+	if len(applies) != 2 {
+		t.Fatalf("got %d terraform applies, want 2", len(applies))
+	}
+
+	// The state bucket is bootstrapped with local state.
+	bootstrap := applies[0].Config
+	if diff := cmp.Diff(resourceAddresses(bootstrap), []string{"google_storage_bucket.my-project-state"}); diff != "" {
+		t.Errorf("bootstrap terraform resources differ (-got, +want):\n%v", diff)
+	}
+	if bootstrap.Terraform.Backend != nil {
+		t.Errorf("bootstrap backend = %+v, want nil", bootstrap.Terraform.Backend)
+	}
+
+	gotConfig, gotImports := applies[1].Config, applies[1].Imports
+
+	wantAddresses := []string{
+		"google_storage_bucket.my-project-state",
+		"google_project_iam_audit_config.allServices",
+		"google_logging_project_sink.audit-logs-to-bigquery",
+		"google_logging_metric.bigquery-settings-change-count",
+		"google_logging_metric.iam-policy-change-count",
+		"google_logging_metric.bucket-permission-change-count",
+		"google_project_iam_member.required-project-bindings-roles_owner-group_my-project-owners_my-domain_com",
+		"google_project_iam_member.required-project-bindings-roles_iam_securityReviewer-group_my-project-auditors_my-domain_com",
+	}
+	if diff := cmp.Diff(resourceAddresses(gotConfig), wantAddresses); diff != "" {
+		t.Errorf("terraform resources differ (-got, +want):\n%v", diff)
+	}
+
+	wantBackend := &terraform.Backend{Bucket: "my-project-state", Prefix: "my-project/resources"}
+	if diff := cmp.Diff(gotConfig.Terraform.Backend, wantBackend); diff != "" {
+		t.Errorf("backend differs (-got, +want):\n%v", diff)
+	}
+
+	wantStateBucket := `{
+	"google_storage_bucket": {
+		"my-project-state": {
+			"name": "my-project-state",
+			"project": "my-project",
+			"location": "US",
+			"versioning": {
+				"enabled": true
+			}
 		}
-		return nil
 	}
+}`
+	checkJSON(t, gotConfig.Resources[0], wantStateBucket)
 
-	if err := deployTerraform(conf, project); err != nil {
+	wantImports := []terraform.Import{{
+		Address: "google_storage_bucket.my-project-state",
+		ID:      "my-project/my-project-state",
+	}}
+
+	if diff := cmp.Diff(gotImports, wantImports, cmpopts.IgnoreFields(terraform.Import{}, "Exists")); diff != "" {
+		t.Errorf("imports differ (-got, +want):\n%v", diff)
+	}
+
+	// The state bucket is only imported if it exists, which it does after the bootstrap.
+	exists, err := gotImports[0].Exists()
+	if err != nil || !exists {
+		t.Errorf("Exists = %t, %v, want true, nil", exists, err)
+	}
+
+	// Deploying again uses the migrated state and does not bootstrap the state bucket again.
+	if err := deployTerraform(conf, project, nil, nil, &Options{Client: fake}); err != nil {
+		t.Fatalf("deployTerraform again: %v", err)
+	}
+	if n := len(fake.TerraformApplies()); n != 3 {
+		t.Errorf("got %d terraform applies, want 3", n)
+	}
+	s, err := fake.TerraformPlan(gotConfig, "", nil)
+	if err != nil {
+		t.Fatalf("TerraformPlan = %v", err)
+	}
+	if len(s.Changes) != 0 {
+		t.Errorf("plan after deploying again has changes:\n%v", s)
+	}
+}
+
+func TestDeployTerraformExistingStateBucket(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, nil)
+	fake := newFakeWithProject(conf, project)
+	p := fake.Project(project.ID)
+	p.Buckets = append(p.Buckets, "gs://my-project-state")
+
+	if err := deployTerraform(conf, project, nil, nil, &Options{Client: fake}); err != nil {
 		t.Fatalf("deployTerraform: %v", err)
 	}
+	// The existing state bucket is imported instead of being bootstrapped.
+	applies := fake.TerraformApplies()
+	if len(applies) != 1 {
+		t.Fatalf("got %d terraform applies, want 1", len(applies))
+	}
+	if applies[0].Config.Terraform.Backend == nil {
+		t.Error("terraform config has no backend")
+	}
+}
+
+func TestDeployTerraformAudit(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, nil)
+	fake := newFakeWithProject(conf, project)
+	if err := deployTerraformAudit(conf, project, nil, nil, &Options{Client: fake}); err != nil {
+		t.Fatalf("deployTerraformAudit: %v", err)
+	}
+	applies := fake.TerraformApplies()
+	if len(applies) != 1 {
+		t.Fatalf("got %d terraform applies, want 1", len(applies))
+	}
 
 	wantConfig := `{
 	"terraform": {
-		"required_version": ">= 0.12.0"
+		"required_version": ">= 0.12.0",
+		"required_providers": {
+			"google": "~> 2.20",
+			"google-beta": "~> 2.20"
+		},
+		"backend": {
+			"gcs": {
+				"bucket": "my-project-state",
+				"prefix": "my-project/audit"
+			}
+		}
 	},
+	"provider": [{
+		"google": {"project": "my-project"}
+	}, {
+		"google-beta": {"project": "my-project"}
+	}],
 	"resource": [{
+		"google_bigquery_dataset": {
+			"audit_logs": {
+				"dataset_id": "audit_logs",
+				"project": "my-project",
+				"location": "US",
+				"access": [
+					{"role": "OWNER", "group_by_email": "my-project-owners@my-domain.com"},
+					{"role": "READER", "group_by_email": "my-project-auditors@my-domain.com"},
+					{"role": "WRITER", "user_by_email": "audit-logs-bq@logging-1111.iam.gserviceaccount.com"}
+				]
+			}
+		}
+	}, {
 		"google_storage_bucket": {
-			"my-project-state": {
-				"name": "my-project-state",
+			"my-project-logs": {
+				"name": "my-project-logs",
 				"project": "my-project",
 				"location": "US",
+				"storage_class": "MULTI_REGIONAL",
 				"versioning": {
 					"enabled": true
-				}
+				},
+				"lifecycle_rule": [{
+					"action": {"type": "Delete"},
+					"condition": {"age": 365, "with_state": "LIVE"}
+				}]
+			}
+		}
+	}, {
+		"google_storage_bucket_iam_binding": {
+			"my-project-logs-roles_storage_admin": {
+				"bucket": "${google_storage_bucket.my-project-logs.name}",
+				"role": "roles/storage.admin",
+				"members": ["group:my-project-owners@my-domain.com"]
+			}
+		}
+	}, {
+		"google_storage_bucket_iam_binding": {
+			"my-project-logs-roles_storage_objectCreator": {
+				"bucket": "${google_storage_bucket.my-project-logs.name}",
+				"role": "roles/storage.objectCreator",
+				"members": ["group:cloud-storage-analytics@google.com"]
+			}
+		}
+	}, {
+		"google_storage_bucket_iam_binding": {
+			"my-project-logs-roles_storage_objectViewer": {
+				"bucket": "${google_storage_bucket.my-project-logs.name}",
+				"role": "roles/storage.objectViewer",
+				"members": ["group:my-project-auditors@my-domain.com"]
 			}
 		}
 	}]
 }`
+	checkJSON(t, applies[0].Config, wantConfig)
+}
+
+func TestDeployResourcesTerraform(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, nil)
+	project.GeneratedFields.LogSinkServiceAccount = ""
+	fake := newFakeWithProject(conf, project)
+	delete(fake.Project(project.ID).LogSinkWriters, project.BQLogSink.Name())
+
+	if err := DeployResources(conf, project, &Options{EnableTerraform: true, Client: fake}); err != nil {
+		t.Fatalf("DeployResources = %v", err)
+	}
+	if ds := fake.Project(project.ID).Deployments; len(ds) != 0 {
+		t.Errorf("got deployments %v, want none", ds)
+	}
+	applies := fake.TerraformApplies()
+	if len(applies) != 3 {
+		t.Fatalf("got %d terraform applies, want 3", len(applies))
+	}
+
+	// The writer of the sink created by terraform is granted access to the audit logs dataset.
+	sinkSA := project.GeneratedFields.LogSinkServiceAccount
+	if sinkSA == "" {
+		t.Fatal("log sink service account not recorded in generated fields")
+	}
+	b, err := json.Marshal(applies[2].Config)
+	if err != nil {
+		t.Fatalf("json.Marshal audit config: %v", err)
+	}
+	if !strings.Contains(string(b), `"user_by_email":"`+sinkSA+`"`) {
+		t.Errorf("audit config does not grant access to log sink writer %q:\n%s", sinkSA, b)
+	}
+}
+
+// resourceAddresses returns the addresses of the resources in the config.
+func resourceAddresses(c *terraform.Config) []string {
+	var addrs []string
+	for _, r := range c.Resources {
+		addrs = append(addrs, r.Type+"."+r.Name)
+	}
+	return addrs
+}
 
+// checkJSON checks the JSON marshalled value is equivalent to the wanted JSON.
+func checkJSON(t *testing.T, v interface{}, wantJSON string) {
+	t.Helper()
 	var got, want interface{}
-	b, err := json.Marshal(gotConfig)
+	b, err := json.Marshal(v)
 	if err != nil {
-		t.Fatalf("json.Marshal gotConfig: %v", err)
+		t.Fatalf("json.Marshal got: %v", err)
 	}
 	if err := json.Unmarshal(b, &got); err != nil {
 		t.Fatalf("json.Unmarshal got = %v", err)
 	}
-	if err := json.Unmarshal([]byte(wantConfig), &want); err != nil {
+	if err := json.Unmarshal([]byte(wantJSON), &want); err != nil {
 		t.Fatalf("json.Unmarshal want = %v", err)
 	}
 	if diff := cmp.Diff(got, want); diff != "" {
 		t.Errorf("terraform config differs (-got, +want):\n%v", diff)
 	}
+}
 
-	wantImports := []terraform.Import{{
-		Address: "google_storage_bucket.my-project-state",
-		ID:      "my-project/my-project-state",
-	}}
+func TestExportTerraform(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, nil)
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
 
-	if diff := cmp.Diff(gotImports, wantImports); diff != "" {
-		t.Errorf("imports differ (-got, +want):\n%v", diff)
+	if err := ExportTerraform(conf, project, dir, &runner.Default{}); err != nil {
+		t.Fatalf("ExportTerraform = %v", err)
+	}
+
+	want := map[string][]string{
+		"resources/terraform.tf": {`backend "gcs" {`, `prefix = "my-project/resources"`, `provider "google" {`},
+		"resources/main.tf":      {`resource "google_storage_bucket" "my-project-state" {`, `resource "google_logging_project_sink" "audit-logs-to-bigquery" {`},
+		"resources/import.sh":    {`terraform import 'google_storage_bucket.my-project-state' 'my-project/my-project-state'`},
+		"audit/terraform.tf":     {`prefix = "my-project/audit"`},
+		"audit/main.tf":          {`resource "google_bigquery_dataset" "audit_logs" {`, "bucket  = google_storage_bucket.my-project-logs.name"},
+	}
+	for name, subs := range want {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("ioutil.ReadFile = %v", err)
+			continue
+		}
+		for _, sub := range subs {
+			if !strings.Contains(string(b), sub) {
+				t.Errorf("%s does not contain %q:\n%s", name, sub, b)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "forseti")); !os.IsNotExist(err) {
+		t.Errorf("forseti exported for project that is not the Forseti project: %v", err)
 	}
 }
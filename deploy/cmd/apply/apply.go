@@ -22,26 +22,50 @@
 //     --output_path=my_output.yaml \
 //
 // To preview the commands that will run, use `--dry_run`.
+// To review the changes to every deployment manager deployment and terraform plan before they are committed, use `--preview`.
+// Terraform never deletes state buckets or Forseti resources unless `--allow_protected_deletes` is set.
+// To deploy data projects concurrently, use `--parallelism=N` with `--non_interactive`. The remote audit logs
+// project and the Forseti project are always deployed first.
+// To run without reading from stdin, e.g. in CI, use `--non_interactive`. Actions required from a user,
+// such as creating a Stackdriver account, are then written to stdout as JSON lines and waited for up to
+// `--stackdriver_timeout`.
+// To run terraform without internet access, vendor its modules and plugins with vendor_terraform and pass the
+// cache dir with `--terraform_cache_dir`.
 package main
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"flag"
 	
 	"github.com/GoogleCloudPlatform/healthcare/deploy/apply"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
 )
 
 var (
-	configPath      = flag.String("config_path", "", "Path to project config file")
-	outputPath      = flag.String("output_path", "", "Path to output file to write generated fields")
-	rulesPath       = flag.String("rules_path", "", "Path to local directory or GCS bucket to output rules files. If unset, directly writes to the Forseti server bucket.")
-	dryRun          = flag.Bool("dry_run", false, "Whether or not to run DPT in the dry run mode. If true, prints the commands that will run without executing.")
-	enableTerraform = flag.Bool("enable_terraform", false, "DEV ONLY. Whether terraform is preferred over deployment manager.")
-	projects        arrayFlags
+	configPath             = flag.String("config_path", "", "Path to project config file")
+	outputPath             = flag.String("output_path", "", "Path to output file to write generated fields")
+	rulesPath              = flag.String("rules_path", "", "Path to local directory or GCS bucket to output rules files. If unset, directly writes to the Forseti server bucket.")
+	dryRun                 = flag.Bool("dry_run", false, "Whether or not to run DPT in the dry run mode. If true, prints the commands that will run without executing.")
+	enableTerraform        = flag.Bool("enable_terraform", false, "DEV ONLY. Whether terraform is preferred over deployment manager.")
+	preview                = flag.Bool("preview", false, "Whether to preview deployment manager changes and ask for confirmation before committing them.")
+	allowProtectedDeletes  = flag.Bool("allow_protected_deletes", false, "Whether to allow terraform to delete or replace protected resources, such as state buckets and Forseti.")
+	nonInteractive         = flag.Bool("non_interactive", false, "Whether to never read from stdin. Actions required from a user are written to stdout as JSON lines and waited for instead.")
+	stackdriverTimeout     = flag.Duration("stackdriver_timeout", 15*time.Minute, "How long to wait for a Stackdriver account to be created with --non_interactive.")
+	skipMissingStackdriver = flag.Bool("skip_missing_stackdriver", false, "Whether to skip the creation of Stackdriver alerts with a warning in the generated fields, instead of failing, if the Stackdriver account was not created within --stackdriver_timeout.")
+	terraformCacheDir      = flag.String("terraform_cache_dir", "", "Path to the dir with the terraform modules and provider plugins vendored by vendor_terraform. If set, terraform runs offline.")
+	parallelism            = flag.Int("parallelism", 1, "Maximum number of data projects to deploy concurrently. The remote audit logs project and Forseti project are always deployed first. Values greater than 1 require --non_interactive.")
+	loadOpts               = config.LoadFlags(flag.CommandLine)
+	projects               arrayFlags
 )
 
 type arrayFlags []string
@@ -65,9 +89,122 @@ func (i *arrayFlags) Get() interface{} {
 	return i
 }
 
+// status is the outcome of applying a single project.
+type status string
+
+const (
+	statusSucceeded status = "SUCCEEDED"
+	statusFailed    status = "FAILED"
+	statusSkipped   status = "SKIPPED"
+)
+
+// result is the result of applying a single project.
+type result struct {
+	projectID string
+	status    status
+	err       error
+}
+
+// report collects the results of all projects so they can be summarized once every project was attempted.
+type report struct {
+	mu      sync.Mutex
+	results []*result
+}
+
+// add records the result of the project. It replaces an earlier result of the project, e.g. when a step run for
+// the project after it was applied failed.
+func (r *report) add(projectID string, s status, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, res := range r.results {
+		if res.projectID == projectID {
+			res.status, res.err = s, err
+			return
+		}
+	}
+	r.results = append(r.results, &result{projectID: projectID, status: s, err: err})
+}
+
+// failed returns whether any project failed or was skipped.
+func (r *report) failed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, res := range r.results {
+		if res.status != statusSucceeded {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *report) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sb strings.Builder
+	for _, res := range r.results {
+		fmt.Fprintf(&sb, "%-10s %s", res.status, res.projectID)
+		if res.err != nil {
+			fmt.Fprintf(&sb, ": %v", res.err)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// genFieldsWriter persists generated fields after each project is applied.
+// Projects may be applied concurrently, so it keeps its own copy of the generated fields and only
+// copies a project's fields once the project is done, when no other goroutine modifies them.
+type genFieldsWriter struct {
+	mu        sync.Mutex
+	path      string
+	conf      *config.Config
+	genFields *config.AllGeneratedFields
+	// disabled is set in dry run mode, where nothing is deployed.
+	disabled bool
+}
+
+func newGenFieldsWriter(path string, conf *config.Config, disabled bool) *genFieldsWriter {
+	w := &genFieldsWriter{
+		path: path,
+		conf: conf,
+		genFields: &config.AllGeneratedFields{
+			Projects: make(map[string]*config.GeneratedFields),
+			Forseti:  conf.AllGeneratedFields.Forseti,
+		},
+		disabled: disabled,
+	}
+	for id, gf := range conf.AllGeneratedFields.Projects {
+		w.genFields.Projects[id] = copyGeneratedFields(gf)
+	}
+	return w
+}
+
+// write writes the generated fields with the latest fields of the given project.
+func (w *genFieldsWriter) write(project *config.Project) error {
+	if w.disabled {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.genFields.Projects[project.ID] = copyGeneratedFields(project.GeneratedFields)
+	// Forseti fields are only set while the Forseti project is applied, before any data project.
+	w.genFields.Forseti = w.conf.AllGeneratedFields.Forseti
+	if err := config.WriteGeneratedFields(w.path, w.genFields); err != nil {
+		return fmt.Errorf("failed to write generated fields to %q: %v", w.path, err)
+	}
+	return nil
+}
+
+func copyGeneratedFields(gf *config.GeneratedFields) *config.GeneratedFields {
+	c := *gf
+	c.GCEInstanceInfoList = append([]config.GCEInstanceInfo(nil), gf.GCEInstanceInfoList...)
+	return &c
+}
+
 func main() {
 	flag.Var(&projects, "projects", "Comma separeted project IDs within --config_path to deploy, or leave unspecified to deploy all projects.")
 	flag.Parse()
+	log.SetOutput(secrets.NewRedactingWriter(os.Stderr))
 
 	if *configPath == "" {
 		log.Fatal("--config_path must be set")
@@ -75,12 +212,49 @@ func main() {
 	if *outputPath == "" {
 		log.Fatal("--output_path must be set")
 	}
+	if *parallelism < 1 {
+		log.Fatal("--parallelism must be at least 1")
+	}
+	if *dryRun && *preview {
+		log.Fatal("--dry_run and --preview are mutually exclusive")
+	}
+	if *nonInteractive && *preview {
+		log.Fatal("--non_interactive and --preview are mutually exclusive, as previews must be confirmed")
+	}
+	if *preview && *parallelism > 1 {
+		// Confirmations are asked on stdin, which cannot be shared between concurrently applied projects.
+		log.Println("Preview: ignoring --parallelism, projects are applied one at a time.")
+		*parallelism = 1
+	}
+	if *parallelism > 1 && !*nonInteractive && !*dryRun {
+		// Confirmations are asked on stdin, which cannot be shared between concurrently applied projects.
+		log.Fatal("--parallelism greater than 1 requires --non_interactive")
+	}
 
-	conf, err := config.Load(*configPath, *outputPath)
+	conf, err := config.LoadWithOptions(*configPath, *outputPath, loadOpts)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// client makes all calls to GCP that are not made while applying a project.
+	var client gcp.Client = gcp.NewGCloud(&runner.Default{NonInteractive: *nonInteractive})
+	var dr *apply.DryRun
+	if *dryRun {
+		dr = apply.NewDryRun(conf)
+		client = dr
+		if *parallelism > 1 {
+			// Dry run actions are attributed to the project that is currently applied.
+			log.Println("Dry run: ignoring --parallelism, projects are applied one at a time.")
+			*parallelism = 1
+		}
+	}
+	// setProject attributes subsequent dry run actions to the given project.
+	setProject := func(projectID string) {
+		if dr != nil {
+			dr.SetProject(projectID)
+		}
+	}
+
 	wantProjects := make(map[string]bool)
 
 	for _, p := range projects {
@@ -97,35 +271,111 @@ func main() {
 	enableForseti := conf.Forseti != nil && wantProject(conf.Forseti.Project.ID)
 	enableRemoteAudit := conf.AuditLogsProject != nil && wantProject(conf.AuditLogsProject.ID)
 
+	// newOptions returns the options to apply a project with.
+	newOptions := func(enableForseti bool) *apply.Options {
+		return &apply.Options{
+			EnableTerraform:        *enableTerraform,
+			EnableForseti:          enableForseti,
+			Preview:                *preview,
+			AllowProtectedDeletes:  *allowProtectedDeletes,
+			Client:                 client,
+			NonInteractive:         *nonInteractive,
+			StackdriverTimeout:     *stackdriverTimeout,
+			SkipMissingStackdriver: *skipMissingStackdriver,
+			TerraformCacheDir:      *terraformCacheDir,
+		}
+	}
+
+	rep := new(report)
+	gfw := newGenFieldsWriter(*outputPath, conf, dr != nil)
+
+	// applyProject applies the project with a logger that prefixes every line with the project ID,
+	// then writes the generated fields, even if the project failed so it can be resumed.
+	applyProject := func(project *config.Project, applyFunc func(*config.Config, *config.Project, *apply.Options) error, opts *apply.Options) error {
+		// Secrets are redacted from everything logged for the project, including the commands run.
+		opts.Logger = log.New(secrets.NewRedactingWriter(os.Stderr), fmt.Sprintf("[%s] ", project.ID), log.LstdFlags)
+		if dr == nil {
+			// Commands run for the project are logged with its prefix too.
+			opts.Client = gcp.NewGCloud(&runner.Default{Logger: opts.Logger, NonInteractive: opts.NonInteractive})
+		}
+		opts.Logger.Printf("Applying config for project %q", project.ID)
+		setProject(project.ID)
+		err := applyFunc(conf, project, opts)
+		if werr := gfw.write(project); werr != nil {
+			if err == nil {
+				err = werr
+			} else {
+				err = fmt.Errorf("%v; %v", err, werr)
+			}
+		}
+		if err != nil {
+			opts.Logger.Printf("Failed to apply config for project %q: %v", project.ID, err)
+			rep.add(project.ID, statusFailed, err)
+			return err
+		}
+		opts.Logger.Printf("Successfully applied config for project %q", project.ID)
+		rep.add(project.ID, statusSucceeded, nil)
+		return nil
+	}
+
+	// dependencyErr is set when a project that the remaining projects depend on failed, so they are skipped.
+	var dependencyErr error
+
 	// Always deploy the remote audit logs project first (if present).
 	if enableRemoteAudit {
-		log.Printf("Applying config for remote audit log project %q", conf.AuditLogsProject.ID)
 		// Cannot enable Forseti project until Forseti project is deployed.
-		if err := apply.Default(conf, conf.AuditLogsProject, &apply.Options{EnableTerraform: *enableTerraform, EnableForseti: false}); err != nil {
-			log.Fatalf("Failed to apply config for remote audit log project %q: %v", conf.AuditLogsProject.ID, err)
+		if err := applyProject(conf.AuditLogsProject, apply.Default, newOptions(false)); err != nil {
+			dependencyErr = fmt.Errorf("remote audit logs project %q failed", conf.AuditLogsProject.ID)
 		}
 	}
 
 	if enableForseti {
-		log.Printf("Applying config for Forseti project %q", conf.Forseti.Project.ID)
-		if err := apply.Forseti(conf, conf.Forseti.Project, &apply.Options{EnableTerraform: *enableTerraform, EnableForseti: enableForseti}); err != nil {
-			log.Fatalf("Failed to apply config for Forseti project %q: %v", conf.Forseti.Project.ID, err)
-		}
-		if enableRemoteAudit {
+		if dependencyErr != nil {
+			rep.add(conf.Forseti.Project.ID, statusSkipped, dependencyErr)
+		} else if err := applyProject(conf.Forseti.Project, apply.Forseti, newOptions(enableForseti)); err != nil {
+			dependencyErr = fmt.Errorf("forseti project %q failed", conf.Forseti.Project.ID)
+		} else if enableRemoteAudit {
 			// Grant Forseti permissions in remote audit log project after Forseti project is deployed.
-			if err := apply.GrantForsetiPermissions(conf.AuditLogsProject.ID, conf.AllGeneratedFields.Forseti.ServiceAccount); err != nil {
-				log.Fatalf("Failed to grant Forseti permissions to remote audit logs project: %v", err)
+			setProject(conf.AuditLogsProject.ID)
+			if err := apply.GrantForsetiPermissions(conf.AuditLogsProject.ID, conf.AllGeneratedFields.Forseti.ServiceAccount, client); err != nil {
+				err = fmt.Errorf("failed to grant Forseti permissions: %v", err)
+				rep.add(conf.AuditLogsProject.ID, statusFailed, err)
+				dependencyErr = fmt.Errorf("remote audit logs project %q failed", conf.AuditLogsProject.ID)
 			}
 		}
 	}
+
+	// Data projects are independent of each other, so they can be deployed concurrently.
+	sem := make(chan struct{}, *parallelism)
+	var wg sync.WaitGroup
 	for _, p := range conf.Projects {
 		if !wantProject(p.ID) {
 			continue
 		}
-		log.Printf("Applying config for project %q", p.ID)
-		if err := apply.Default(conf, p, &apply.Options{EnableTerraform: *enableTerraform, EnableForseti: enableForseti}); err != nil {
-			log.Fatalf("Failed to apply config for project %q: %v", p.ID, err)
+		if dependencyErr != nil {
+			rep.add(p.ID, statusSkipped, dependencyErr)
+			continue
 		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(p *config.Project) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			applyProject(p, apply.Default, newOptions(enableForseti))
+		}(p)
 	}
+	wg.Wait()
 
+	// The dry run actions include the rendered configs, and errors may include config values, so secrets are
+	// redacted from the reports.
+	out := secrets.NewRedactingWriter(os.Stdout)
+	if dr != nil {
+		fmt.Fprintf(out, "Dry run: the following actions would be taken in order:\n%v", dr)
+	}
+	fmt.Fprintf(out, "Apply summary:\n%v", rep)
+	if rep.failed() {
+		os.Exit(1)
+	}
 }
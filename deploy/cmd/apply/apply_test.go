@@ -0,0 +1,46 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	r := new(report)
+	r.add("my-audit-project", statusSucceeded, nil)
+	r.add("my-forseti-project", statusSucceeded, nil)
+	if r.failed() {
+		t.Error("failed() = true, want false")
+	}
+
+	// Granting Forseti permissions in the audit logs project after it was applied failed.
+	r.add("my-audit-project", statusFailed, errors.New("failed to grant Forseti permissions"))
+	r.add("my-project", statusSkipped, errors.New(`remote audit logs project "my-audit-project" failed`))
+
+	want := `FAILED     my-audit-project: failed to grant Forseti permissions
+SUCCEEDED  my-forseti-project
+SKIPPED    my-project: remote audit logs project "my-audit-project" failed
+`
+	if got := r.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if !r.failed() {
+		t.Error("failed() = false, want true")
+	}
+}
@@ -18,21 +18,27 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"flag"
 	
 	"github.com/GoogleCloudPlatform/healthcare/deploy/apply"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
 )
 
 var (
 	projectYAMLPath     = flag.String("project_yaml_path", "", "Path to project yaml file")
 	generatedFieldsPath = flag.String("generated_fields_path", "", "Path to generated fields yaml file")
 	enableRemoteState   = flag.Bool("enable_remote_state", false, "DEV ONLY. Enable remote state.")
+	loadOpts            = config.LoadFlags(flag.CommandLine)
 )
 
 func main() {
 	flag.Parse()
+	log.SetOutput(secrets.NewRedactingWriter(os.Stderr))
 
 	if *projectYAMLPath == "" {
 		log.Fatal("--project_yaml_path must be set")
@@ -42,12 +48,12 @@ func main() {
 		log.Fatal("--generated_fields_path must be set")
 	}
 
-	conf, err := config.Load(*projectYAMLPath, *generatedFieldsPath)
+	conf, err := config.LoadWithOptions(*projectYAMLPath, *generatedFieldsPath, loadOpts)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
-	if err := apply.ForsetiConfig(conf, *enableRemoteState); err != nil {
+	if err := apply.ForsetiConfig(conf, *enableRemoteState, gcp.NewGCloud(&runner.Default{})); err != nil {
 		log.Fatalf("failed to apply forseti: %v", err)
 	}
 }
@@ -18,16 +18,20 @@
 //
 // Usage:
 //   $ bazel run :apply_resources -- --project_yaml_path=${PROJECT_YAML_PATH?} --project=${PROJECT_ID?}
+//
+// To review the changes to every deployment manager deployment before they are committed, use `--preview`.
 package main
 
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"flag"
 	
 	"github.com/GoogleCloudPlatform/healthcare/deploy/apply"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
 )
 
 var (
@@ -35,10 +39,13 @@ var (
 	generatedFieldsPath = flag.String("generated_fields_path", "", "Path to generated fields yaml file")
 	projectID           = flag.String("project", "", "Project within the project yaml file to deploy config resources for")
 	enableTerraform     = flag.Bool("enable_terraform", false, "DEV ONLY. Whether terraform is preferred over deployment manager.")
+	preview             = flag.Bool("preview", false, "Whether to preview deployment manager changes and ask for confirmation before committing them.")
+	loadOpts            = config.LoadFlags(flag.CommandLine)
 )
 
 func main() {
 	flag.Parse()
+	log.SetOutput(secrets.NewRedactingWriter(os.Stderr))
 
 	if *projectYAMLPath == "" {
 		log.Fatal("--project_yaml_path must be set")
@@ -52,7 +59,7 @@ func main() {
 		log.Fatal("--project must be set")
 	}
 
-	conf, err := config.Load(*projectYAMLPath, *generatedFieldsPath)
+	conf, err := config.LoadWithOptions(*projectYAMLPath, *generatedFieldsPath, loadOpts)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
@@ -62,7 +69,7 @@ func main() {
 		log.Fatal(err)
 	}
 
-	opts := &apply.Options{EnableTerraform: *enableTerraform}
+	opts := &apply.Options{EnableTerraform: *enableTerraform, Preview: *preview}
 	if err := apply.DeployResources(conf, proj, opts); err != nil {
 		log.Fatalf("failed to deploy %q resources: %v", *projectID, err)
 	}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// decommission retires a data project deployed by the toolkit.
+// It verifies the audit logs of the project are kept in the remote audit logs project, optionally
+// archives the data buckets and datasets, removes the deletion lien, abandons the deployments and
+// requests the deletion of the project. Every destructive step asks for confirmation.
+//
+// Usage:
+//
+//	$ bazel run :decommission -- \
+//	  --config_path=my_config.yaml \
+//	  --output_path=my_output.yaml \
+//	  --project=my-project \
+//	  --archive_location=gs://my-archive-bucket
+//
+// Progress is recorded in the generated fields, so a cancelled decommission resumes where it stopped.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"flag"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/apply"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
+)
+
+var (
+	configPath      = flag.String("config_path", "", "Path to project config file")
+	outputPath      = flag.String("output_path", "", "Path to output file to write generated fields")
+	projectID       = flag.String("project", "", "Project within --config_path to decommission")
+	archiveLocation = flag.String("archive_location", "", "GCS location to export the data buckets and datasets of the project to, e.g. gs://my-archive-bucket. If unset, data is not archived.")
+	enableTerraform = flag.Bool("enable_terraform", false, "DEV ONLY. Whether terraform is preferred over deployment manager.")
+	loadOpts        = config.LoadFlags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	log.SetOutput(secrets.NewRedactingWriter(os.Stderr))
+
+	if *configPath == "" {
+		log.Fatal("--config_path must be set")
+	}
+	if *outputPath == "" {
+		log.Fatal("--output_path must be set")
+	}
+	if *projectID == "" {
+		log.Fatal("--project must be set")
+	}
+	if *archiveLocation != "" && !strings.HasPrefix(*archiveLocation, "gs://") {
+		log.Fatalf("--archive_location must be a GCS location starting with gs://, got %q", *archiveLocation)
+	}
+
+	conf, err := config.LoadWithOptions(*configPath, *outputPath, loadOpts)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	var proj *config.Project
+	for _, p := range conf.Projects {
+		if p.ID == *projectID {
+			proj = p
+		}
+	}
+	if proj == nil {
+		// The remote audit logs and Forseti projects hold data of other projects, so they are never decommissioned.
+		log.Fatalf("project %q not found in the data projects of %q", *projectID, *configPath)
+	}
+
+	opts := &apply.Options{
+		EnableTerraform: *enableTerraform,
+		Logger:          log.New(secrets.NewRedactingWriter(os.Stderr), fmt.Sprintf("[%s] ", proj.ID), log.LstdFlags),
+	}
+	err = apply.Decommission(conf, proj, *archiveLocation, opts)
+	// Always write the generated fields to record the completed steps.
+	if werr := config.WriteGeneratedFields(*outputPath, conf.AllGeneratedFields); werr != nil {
+		log.Printf("failed to write generated fields to %q: %v", *outputPath, werr)
+	}
+	if err != nil {
+		log.Fatalf("failed to decommission project %q: %v", *projectID, err)
+	}
+	log.Printf("Deletion of project %q requested, it will be deleted in 30 days", *projectID)
+}
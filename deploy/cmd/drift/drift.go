@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// drift compares project configurations with the live state of their GCP projects.
+// It lists resources that are missing, would be abandoned, were changed or were created out of band.
+//
+// Usage:
+//
+//	$ bazel run :drift -- \
+//	  --config_path=my_config.yaml \
+//	  --generated_fields_path=my_output.yaml \
+//	  --format=json
+//
+// Pass --enable_terraform for projects deployed with terraform: their deployment manager deployments are not compared.
+// The command exits with status 1 if any project drifted from its config.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"flag"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/drift"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
+)
+
+var (
+	configPath          = flag.String("config_path", "", "Path to project config file")
+	generatedFieldsPath = flag.String("generated_fields_path", "", "Path to generated fields yaml file")
+	format              = flag.String("format", "text", "Output format of the report, one of text or json")
+	enableTerraform     = flag.Bool("enable_terraform", false, "DEV ONLY. Whether terraform is preferred over deployment manager.")
+	loadOpts            = config.LoadFlags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	log.SetOutput(secrets.NewRedactingWriter(os.Stderr))
+
+	if *configPath == "" {
+		log.Fatal("--config_path must be set")
+	}
+	if *generatedFieldsPath == "" {
+		log.Fatal("--generated_fields_path must be set")
+	}
+	if *format != "text" && *format != "json" {
+		log.Fatalf("--format must be one of text or json, got %q", *format)
+	}
+
+	conf, err := config.LoadWithOptions(*configPath, *generatedFieldsPath, loadOpts)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	report, err := drift.Detect(conf, gcp.NewGCloud(&runner.Default{}), *enableTerraform)
+	if err != nil {
+		log.Fatalf("failed to detect drift: %v", err)
+	}
+
+	// The report contains property values, which may be resolved secrets.
+	out := secrets.NewRedactingWriter(os.Stdout)
+	switch *format {
+	case "json":
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("failed to marshal report: %v", err)
+		}
+		fmt.Fprintln(out, string(b))
+	default:
+		fmt.Fprint(out, report)
+	}
+
+	if report.HasDrift() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// export_terraform writes the terraform configs deploying the projects of the config as readable HCL files, so
+// they can be reviewed or applied with terraform directly.
+//
+// Usage:
+//
+//	$ bazel run :export_terraform -- \
+//	  --config_path=my_config.yaml \
+//	  --generated_fields_path=my_output.yaml \
+//	  --output_dir=/path/to/export
+//
+// The configs of each project are written to <output_dir>/<project>/resources and <output_dir>/<project>/audit,
+// and Forseti to <output_dir>/<forseti-project>/forseti. Each dir holds an import.sh script importing the resources
+// that may already exist, to run after terraform init.
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"flag"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/apply"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
+)
+
+var (
+	configPath          = flag.String("config_path", "", "Path to project config file")
+	generatedFieldsPath = flag.String("generated_fields_path", "", "Path to generated fields yaml file")
+	outputDir           = flag.String("output_dir", "", "Path to the dir to write the terraform configs to")
+	projectIDs          = flag.String("projects", "", "Comma separated projects within --config_path to export. If unset, all projects are exported.")
+	loadOpts            = config.LoadFlags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	log.SetOutput(secrets.NewRedactingWriter(os.Stderr))
+
+	if *configPath == "" {
+		log.Fatal("--config_path must be set")
+	}
+	if *generatedFieldsPath == "" {
+		log.Fatal("--generated_fields_path must be set")
+	}
+	if *outputDir == "" {
+		log.Fatal("--output_dir must be set")
+	}
+
+	conf, err := config.LoadWithOptions(*configPath, *generatedFieldsPath, loadOpts)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	want := make(map[string]bool)
+	if *projectIDs != "" {
+		for _, id := range strings.Split(*projectIDs, ",") {
+			want[id] = true
+		}
+	}
+	for _, p := range conf.AllProjects() {
+		if len(want) > 0 && !want[p.ID] {
+			continue
+		}
+		dir := filepath.Join(*outputDir, p.ID)
+		if err := apply.ExportTerraform(conf, p, dir, &runner.Default{}); err != nil {
+			log.Fatalf("failed to export terraform configs of project %q: %v", p.ID, err)
+		}
+		log.Printf("exported terraform configs of project %q to %q", p.ID, dir)
+	}
+}
@@ -26,6 +26,8 @@ import (
 	"flag"
 	
 	"github.com/GoogleCloudPlatform/healthcare/deploy/apply"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
 )
 
 var (
@@ -44,7 +46,7 @@ func main() {
 		log.Fatal("--forseti_service_account must be set")
 	}
 
-	if err := apply.GrantForsetiPermissions(*projectID, *forsetiServiceAccount); err != nil {
+	if err := apply.GrantForsetiPermissions(*projectID, *forsetiServiceAccount, gcp.NewGCloud(&runner.Default{})); err != nil {
 		log.Fatalf("failed to grant forseti permissions: %v", err)
 	}
 }
@@ -12,31 +12,36 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Load_config prints the merged, parsed and validated config to stdout.
+// Load_config prints the merged, parsed and validated config to stdout, with its overlays and the overlays passed
+// with --overlay applied.
 package main
 
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"flag"
 	
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
 )
 
 var (
 	projectYAMLPath     = flag.String("project_yaml_path", "", "Path to project yaml file")
 	generatedFieldsPath = flag.String("generated_fields_path", "", "Path to generated fields yaml file")
+	loadOpts            = config.LoadFlags(flag.CommandLine)
 )
 
 func main() {
 	flag.Parse()
+	log.SetOutput(secrets.NewRedactingWriter(os.Stderr))
 
 	if *projectYAMLPath == "" {
 		log.Fatal("--project_yaml_path must be set")
 	}
 
-	b, err := config.LoadBytes(*projectYAMLPath)
+	b, err := config.LoadBytesWithOptions(*projectYAMLPath, loadOpts)
 	if err != nil {
 		log.Fatalf("failed to load config to bytes: %v", err)
 	}
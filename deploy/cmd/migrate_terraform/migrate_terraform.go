@@ -0,0 +1,110 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// migrate_terraform moves projects deployed with deployment manager to terraform.
+// It maps the resources in the live deployment manager deployments of each project to the terraform resources
+// deploying the project and reports the mapping. After confirmation, the resources are imported into the terraform
+// state of the project and the deployments are abandoned, leaving their resources in place.
+// Data buckets and datasets are never deleted or recreated by the migration.
+//
+// Usage:
+//
+//	$ bazel run :migrate_terraform -- \
+//	  --config_path=my_config.yaml \
+//	  --output_path=my_output.yaml \
+//	  --projects=my-project \
+//	  --dry_run
+//
+// Run with `--dry_run` first to only report the mapping. The remote audit logs project is migrated first, as the
+// state of the audit logs of the other projects is kept in its state bucket.
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"flag"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/apply"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
+)
+
+var (
+	configPath        = flag.String("config_path", "", "Path to project config file")
+	outputPath        = flag.String("output_path", "", "Path to output file to write generated fields")
+	projectIDs        = flag.String("projects", "", "Comma separated projects within --config_path to migrate. If unset, all projects are migrated.")
+	dryRun            = flag.Bool("dry_run", false, "Whether to only report the mapping of deployment manager resources to terraform resources without migrating them.")
+	terraformCacheDir = flag.String("terraform_cache_dir", "", "Path to the dir with the terraform modules and provider plugins vendored by vendor_terraform. If set, terraform runs offline.")
+	loadOpts          = config.LoadFlags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	log.SetOutput(secrets.NewRedactingWriter(os.Stderr))
+
+	if *configPath == "" {
+		log.Fatal("--config_path must be set")
+	}
+	if *outputPath == "" {
+		log.Fatal("--output_path must be set")
+	}
+
+	conf, err := config.LoadWithOptions(*configPath, *outputPath, loadOpts)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	want := make(map[string]bool)
+	if *projectIDs != "" {
+		for _, id := range strings.Split(*projectIDs, ",") {
+			want[id] = true
+		}
+	}
+	var projects []*config.Project
+	if conf.AuditLogsProject != nil {
+		projects = append(projects, conf.AuditLogsProject)
+	}
+	for _, p := range conf.AllProjects() {
+		if p != conf.AuditLogsProject {
+			projects = append(projects, p)
+		}
+	}
+
+	opts := &apply.Options{TerraformCacheDir: *terraformCacheDir}
+	for _, p := range projects {
+		if len(want) > 0 && !want[p.ID] {
+			continue
+		}
+		if *dryRun {
+			m, err := apply.PlanMigration(conf, p, opts)
+			if err != nil {
+				log.Fatalf("failed to plan migration of project %q: %v", p.ID, err)
+			}
+			log.Print(m)
+			continue
+		}
+		err := apply.MigrateToTerraform(conf, p, opts)
+		// Always write the generated fields to record the log sink writers of migrated projects.
+		if werr := config.WriteGeneratedFields(*outputPath, conf.AllGeneratedFields); werr != nil {
+			log.Printf("failed to write generated fields to %q: %v", *outputPath, werr)
+		}
+		if err != nil {
+			log.Fatalf("failed to migrate project %q: %v", p.ID, err)
+		}
+	}
+}
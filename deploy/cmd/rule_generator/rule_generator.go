@@ -20,11 +20,14 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"flag"
 	
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
 	"github.com/GoogleCloudPlatform/healthcare/deploy/rulegen"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
 )
 
 var (
@@ -33,10 +36,12 @@ var (
 	outputPath          = flag.String("output_path", "",
 		"Path to local directory or GCS bucket to write forseti rules. "+
 			"If unset, directly writes to the Forseti server bucket")
+	loadOpts            = config.LoadFlags(flag.CommandLine)
 )
 
 func main() {
 	flag.Parse()
+	log.SetOutput(secrets.NewRedactingWriter(os.Stderr))
 
 	if *projectYAMLPath == "" {
 		log.Fatal("--project_yaml_path must be set")
@@ -45,12 +50,12 @@ func main() {
 		log.Fatal("--generated_fields_path must be set")
 	}
 
-	conf, err := config.Load(*projectYAMLPath, *generatedFieldsPath)
+	conf, err := config.LoadWithOptions(*projectYAMLPath, *generatedFieldsPath, loadOpts)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
-	if err := rulegen.Run(conf, *outputPath); err != nil {
+	if err := rulegen.Run(conf, *outputPath, &runner.Default{}); err != nil {
 		log.Fatal(err)
 	}
 
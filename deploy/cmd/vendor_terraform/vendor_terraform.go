@@ -0,0 +1,71 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// vendor_terraform downloads the terraform modules and provider plugins used to deploy the config and records
+// their checksums, so the config can be applied on hosts without internet access.
+//
+// Usage:
+//
+//	$ bazel run :vendor_terraform -- \
+//	  --config_path=my_config.yaml \
+//	  --generated_fields_path=my_output.yaml \
+//	  --cache_dir=/path/to/terraform_cache
+//
+// Copy the cache dir to the deploy host and pass it to apply with `--terraform_cache_dir`.
+package main
+
+import (
+	"log"
+	"os"
+
+	"flag"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/apply"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
+)
+
+var (
+	configPath          = flag.String("config_path", "", "Path to project config file")
+	generatedFieldsPath = flag.String("generated_fields_path", "", "Path to generated fields yaml file")
+	cacheDir            = flag.String("cache_dir", "", "Path to the dir to vendor terraform modules and provider plugins into")
+	loadOpts            = config.LoadFlags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+	log.SetOutput(secrets.NewRedactingWriter(os.Stderr))
+
+	if *configPath == "" {
+		log.Fatal("--config_path must be set")
+	}
+	if *generatedFieldsPath == "" {
+		log.Fatal("--generated_fields_path must be set")
+	}
+	if *cacheDir == "" {
+		log.Fatal("--cache_dir must be set")
+	}
+
+	conf, err := config.LoadWithOptions(*configPath, *generatedFieldsPath, loadOpts)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	if err := apply.VendorTerraform(conf, *cacheDir, &runner.Default{}); err != nil {
+		log.Fatalf("failed to vendor terraform modules and plugins: %v", err)
+	}
+	log.Printf("vendored terraform modules and plugins into %q", *cacheDir)
+}
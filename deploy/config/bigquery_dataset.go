@@ -18,6 +18,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
 )
 
 // BigqueryDataset represents a bigquery dataset.
@@ -90,3 +92,21 @@ func (d *BigqueryDataset) UnmarshalJSON(data []byte) error {
 func (d *BigqueryDataset) MarshalJSON() ([]byte, error) {
 	return interfacePair{d.raw, aliasBigqueryDataset(*d)}.MarshalJSON()
 }
+
+// TerraformResources returns the terraform resources of this dataset.
+func (d *BigqueryDataset) TerraformResources() []tfconfig.Resource {
+	td := &tfconfig.BigqueryDataset{
+		DatasetID: d.Name(),
+		Location:  d.Location,
+	}
+	for _, a := range d.Accesses {
+		td.Accesses = append(td.Accesses, &tfconfig.Access{
+			Role:         a.Role,
+			UserByEmail:  a.UserByEmail,
+			GroupByEmail: a.GroupByEmail,
+			SpecialGroup: a.SpecialGroup,
+			View:         a.View,
+		})
+	}
+	return []tfconfig.Resource{td}
+}
@@ -20,6 +20,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
 )
 
 // CHCDataset represents a CHC dataset.
@@ -31,6 +33,7 @@ type CHCDataset struct {
 // CHCDatasetProperties represents a partial CFT dataset implementation.
 type CHCDatasetProperties struct {
 	CHCDatasetID string `json:"datasetId"`
+	Location     string `json:"location,omitempty"`
 }
 
 // Init initializes a new dataset with the given project.
@@ -72,3 +75,41 @@ func (d *CHCDataset) UnmarshalJSON(data []byte) error {
 func (d *CHCDataset) MarshalJSON() ([]byte, error) {
 	return interfacePair{d.raw, aliasCHCDataset(*d)}.MarshalJSON()
 }
+
+// TerraformResources returns the terraform resources of this dataset and its stores.
+func (d *CHCDataset) TerraformResources() []tfconfig.Resource {
+	td := &tfconfig.HealthcareDataset{
+		Name:     d.Name(),
+		Location: d.Location,
+	}
+	rs := []tfconfig.Resource{td}
+
+	// Stores are only read from the raw config so their other fields are kept when marshalled for deployment manager.
+	var stores struct {
+		Properties struct {
+			DICOMStores []struct {
+				ID string `json:"dicomStoreId"`
+			} `json:"dicomStores"`
+			FHIRStores []struct {
+				ID string `json:"fhirStoreId"`
+			} `json:"fhirStores"`
+			HL7V2Stores []struct {
+				ID string `json:"hl7V2StoreId"`
+			} `json:"hl7V2Stores"`
+		} `json:"properties"`
+	}
+	if len(d.raw) > 0 {
+		// The raw config was already unmarshalled successfully into the dataset.
+		json.Unmarshal(d.raw, &stores)
+	}
+	for _, s := range stores.Properties.DICOMStores {
+		rs = append(rs, tfconfig.NewHealthcareStore(tfconfig.DICOMStore, s.ID, td))
+	}
+	for _, s := range stores.Properties.FHIRStores {
+		rs = append(rs, tfconfig.NewHealthcareStore(tfconfig.FHIRStore, s.ID, td))
+	}
+	for _, s := range stores.Properties.HL7V2Stores {
+		rs = append(rs, tfconfig.NewHealthcareStore(tfconfig.HL7V2Store, s.ID, td))
+	}
+	return rs
+}
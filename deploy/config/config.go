@@ -30,6 +30,12 @@ import (
 // https://cloud.google.com/storage/docs/access-logs#delivery.
 const accessLogsWriter = "group:cloud-storage-analytics@google.com"
 
+// Default terraform and provider versions, used unless overridden in the overall terraform settings.
+const (
+	defaultTerraformRequiredVersion = ">= 0.12.0"
+	defaultGoogleProviderVersion    = "~> 2.20"
+)
+
 // Config represents a (partial)f representation of a projects YAML file.
 // Only the required fields are present. See project_config.yaml.schema for details.
 type Config struct {
@@ -39,6 +45,8 @@ type Config struct {
 		OrganizationID string   `json:"organization_id"`
 		FolderID       string   `json:"folder_id"`
 		AllowedAPIs    []string `json:"allowed_apis"`
+		// Terraform are the terraform settings shared by all terraform configs.
+		Terraform TerraformSettings `json:"terraform"`
 	} `json:"overall"`
 	AuditLogsProject *Project   `json:"audit_logs_project"`
 	Forseti          *Forseti   `json:"forseti"`
@@ -48,6 +56,16 @@ type Config struct {
 	AllGeneratedFields *AllGeneratedFields `json:"-"`
 }
 
+// TerraformSettings configure the terraform and provider versions and the provider defaults.
+type TerraformSettings struct {
+	RequiredVersion string `json:"required_version"`
+	// RequiredProviders maps provider names to their version constraints.
+	// The google and google-beta providers are always pinned.
+	RequiredProviders map[string]string `json:"required_providers"`
+	// Region is the default region of the providers.
+	Region string `json:"region"`
+}
+
 // Project defines a single project's configuration.
 type Project struct {
 	ID                  string   `json:"project_id"`
@@ -102,7 +120,7 @@ type Project struct {
 // Init initializes the config and all its projects.
 func (c *Config) Init(genFields *AllGeneratedFields) error {
 	if err := c.validate(); err != nil {
-		return fmt.Errorf("failed to validate config: %v", err)
+		return wrapFieldError(err, "failed to validate config")
 	}
 
 	if genFields == nil {
@@ -112,19 +130,24 @@ func (c *Config) Init(genFields *AllGeneratedFields) error {
 		genFields.Projects = make(map[string]*GeneratedFields)
 	}
 	c.AllGeneratedFields = genFields
+	c.initTerraformSettings()
 	if err := c.initForseti(); err != nil {
-		return fmt.Errorf("failed to init forseti: %v", err)
+		return &FieldError{Path: "forseti", Err: fmt.Errorf("failed to init forseti: %v", err)}
 	}
 
 	ids := make(map[string]bool)
 	for _, p := range c.AllProjects() {
 		if ids[p.ID] {
-			return fmt.Errorf("project %q defined more than once", p.ID)
+			return &FieldError{Path: c.projectPath(p), Err: fmt.Errorf("project %q defined more than once", p.ID)}
 		}
 		ids[p.ID] = true
+		// Store new generated fields in the map so fields set during deployment are persisted.
+		if c.AllGeneratedFields.Projects[p.ID] == nil {
+			c.AllGeneratedFields.Projects[p.ID] = new(GeneratedFields)
+		}
 		p.GeneratedFields = c.AllGeneratedFields.Projects[p.ID]
 		if err := p.Init(c.AuditLogsProject); err != nil {
-			return fmt.Errorf("failed to init project %q: %v", p.ID, err)
+			return &FieldError{Path: c.projectPath(p), Err: fmt.Errorf("failed to init project %q: %v", p.ID, err)}
 		}
 	}
 	return nil
@@ -140,13 +163,32 @@ func (c *Config) validate() error {
 	for _, p := range c.AllProjects() {
 		for _, a := range p.EnabledAPIs {
 			if !allowedAPIs[a] {
-				return fmt.Errorf("project %q wants to enable API %q, which is not in the allowed APIs list", p.ID, a)
+				return &FieldError{
+					Path: c.projectPath(p) + ".enabled_apis",
+					Err:  fmt.Errorf("project %q wants to enable API %q, which is not in the allowed APIs list", p.ID, a),
+				}
 			}
 		}
 	}
 	return nil
 }
 
+// projectPath returns the path of the project in the config, e.g. projects.3.
+func (c *Config) projectPath(p *Project) string {
+	switch {
+	case p == c.AuditLogsProject:
+		return "audit_logs_project"
+	case c.Forseti != nil && p == c.Forseti.Project:
+		return "forseti.project"
+	}
+	for i, cp := range c.Projects {
+		if p == cp {
+			return fmt.Sprintf("projects.%d", i)
+		}
+	}
+	return "projects"
+}
+
 // AllFolders returns all folder ids in this config.
 func (c *Config) AllFolders() []string {
 	var ids []string
@@ -187,6 +229,21 @@ func (c *Config) ProjectForAuditLogs(p *Project) *Project {
 	return p
 }
 
+func (c *Config) initTerraformSettings() {
+	s := &c.Overall.Terraform
+	if s.RequiredVersion == "" {
+		s.RequiredVersion = defaultTerraformRequiredVersion
+	}
+	if s.RequiredProviders == nil {
+		s.RequiredProviders = make(map[string]string)
+	}
+	for _, p := range []string{"google", "google-beta"} {
+		if s.RequiredProviders[p] == "" {
+			s.RequiredProviders[p] = defaultGoogleProviderVersion
+		}
+	}
+}
+
 func (c *Config) initForseti() error {
 	if c.Forseti == nil {
 		return nil
@@ -530,3 +587,173 @@ func (p *Project) DeploymentManagerResources() []Resource {
 	}
 	return rs
 }
+
+// terraformResourcer should be implemented by resources that can be deployed with terraform.
+type terraformResourcer interface {
+	Name() string
+	TerraformResources() []tfconfig.Resource
+}
+
+// TerraformResources gets all terraform data resources in this project, initialized with the project.
+// This includes the resources enabling audit logs, the log sink and the metrics.
+// The audit logs dataset and bucket are deployed separately (see TerraformAuditResources).
+func (p *Project) TerraformResources() ([]tfconfig.Resource, error) {
+	trs, err := p.terraformResourcers()
+	if err != nil {
+		return nil, err
+	}
+	rs := []tfconfig.Resource{p.terraformAuditConfig()}
+	for _, tr := range trs {
+		rs = append(rs, tr.TerraformResources()...)
+	}
+	return initTerraformResources(rs, p.ID)
+}
+
+// TerraformResourcesByName gets the terraform resources of each deployment manager resource in this project,
+// initialized with the project and keyed by the name of the deployment manager resource.
+// The resource enabling audit logs is not included (see TerraformAuditConfig).
+func (p *Project) TerraformResourcesByName() (map[string][]tfconfig.Resource, error) {
+	trs, err := p.terraformResourcers()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string][]tfconfig.Resource)
+	for _, tr := range trs {
+		rs, err := initTerraformResources(tr.TerraformResources(), p.ID)
+		if err != nil {
+			return nil, err
+		}
+		m[tr.Name()] = rs
+	}
+	return m, nil
+}
+
+// TerraformAuditConfig gets the terraform resource enabling audit logs of all services in this project,
+// initialized with the project.
+func (p *Project) TerraformAuditConfig() (tfconfig.Resource, error) {
+	rs, err := initTerraformResources([]tfconfig.Resource{p.terraformAuditConfig()}, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	return rs[0], nil
+}
+
+func (p *Project) terraformAuditConfig() tfconfig.Resource {
+	return &tfconfig.ProjectIAMAuditConfig{
+		Service: "allServices",
+		AuditLogConfigs: []*tfconfig.AuditLogConfig{
+			{LogType: "DATA_READ"},
+			{LogType: "DATA_WRITE"},
+			{LogType: "ADMIN_READ"},
+		},
+	}
+}
+
+// terraformResourcers gets the resources in this project that are deployed with terraform, including the log
+// sink and the metrics.
+func (p *Project) terraformResourcers() ([]terraformResourcer, error) {
+	prs := p.Resources
+	unsupported := []struct {
+		name  string
+		count int
+	}{
+		{"cloud_routers", len(prs.CloudRouter)},
+		{"gce_firewalls", len(prs.GCEFirewalls)},
+		{"ip_addresses", len(prs.IPAddresses)},
+		{"vpc_networks", len(prs.VPCNetworks)},
+	}
+	for _, u := range unsupported {
+		if u.count > 0 {
+			return nil, fmt.Errorf("%s are not supported by terraform yet", u.name)
+		}
+	}
+
+	trs := []terraformResourcer{p.BQLogSink}
+	for _, r := range p.Metrics {
+		trs = append(trs, r)
+	}
+	for _, r := range prs.BQDatasets {
+		trs = append(trs, r)
+	}
+	for _, r := range prs.CHCDatasets {
+		trs = append(trs, r)
+	}
+	for _, r := range prs.GCEInstances {
+		trs = append(trs, r)
+	}
+	for _, r := range prs.GCSBuckets {
+		if err := r.checkTerraformProperties(); err != nil {
+			return nil, err
+		}
+		trs = append(trs, r)
+	}
+	for _, r := range prs.GKEClusters {
+		trs = append(trs, r)
+	}
+	for _, r := range prs.IAMCustomRoles {
+		trs = append(trs, r)
+	}
+	for _, r := range prs.IAMPolicies {
+		trs = append(trs, r)
+	}
+	for _, r := range prs.ServiceAccounts {
+		trs = append(trs, r)
+	}
+	for _, r := range prs.Pubsubs {
+		trs = append(trs, r)
+	}
+	return trs, nil
+}
+
+// TerraformAuditResources gets the terraform audit logs dataset and bucket of this project,
+// initialized with the project that holds the audit logs.
+func (p *Project) TerraformAuditResources(auditProjectID string) ([]tfconfig.Resource, error) {
+	trs, err := p.terraformAuditResourcers()
+	if err != nil {
+		return nil, err
+	}
+	var rs []tfconfig.Resource
+	for _, tr := range trs {
+		rs = append(rs, tr.TerraformResources()...)
+	}
+	return initTerraformResources(rs, auditProjectID)
+}
+
+// TerraformAuditResourcesByName gets the terraform resources of the audit logs dataset and bucket of this project,
+// initialized with the project that holds the audit logs and keyed by the name of the deployment manager resource.
+func (p *Project) TerraformAuditResourcesByName(auditProjectID string) (map[string][]tfconfig.Resource, error) {
+	trs, err := p.terraformAuditResourcers()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string][]tfconfig.Resource)
+	for _, tr := range trs {
+		rs, err := initTerraformResources(tr.TerraformResources(), auditProjectID)
+		if err != nil {
+			return nil, err
+		}
+		m[tr.Name()] = rs
+	}
+	return m, nil
+}
+
+// terraformAuditResourcers gets the audit logs dataset and bucket of this project.
+func (p *Project) terraformAuditResourcers() ([]terraformResourcer, error) {
+	trs := []terraformResourcer{&p.AuditLogs.LogsBQDataset}
+	if b := p.AuditLogs.LogsGCSBucket; b != nil {
+		if err := b.checkTerraformProperties(); err != nil {
+			return nil, err
+		}
+		trs = append(trs, b)
+	}
+	return trs, nil
+}
+
+func initTerraformResources(rs []tfconfig.Resource, projectID string) ([]tfconfig.Resource, error) {
+	for _, r := range rs {
+		if err := r.Init(projectID); err != nil {
+			return nil, fmt.Errorf("failed to init %s %q: %v", r.TerraformResourceName(), r.ID(), err)
+		}
+	}
+	return rs, nil
+}
@@ -0,0 +1,298 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/testconf"
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+)
+
+const terraformResourcesYAML = `
+resources:
+  bq_datasets:
+  - properties:
+      name: foo_dataset
+      location: US
+  chc_datasets:
+  - properties:
+      datasetId: foo-chc-dataset
+      location: us-central1
+      fhirStores:
+      - fhirStoreId: foo-fhir-store
+  gce_instances:
+  - properties:
+      name: foo-instance
+      zone: us-east1-a
+      machineType: n1-standard-1
+      diskImage: projects/debian-cloud/global/images/family/debian-9
+  gcs_buckets:
+  - properties:
+      name: foo-bucket
+      location: us-east1
+    expected_users:
+    - auth-user@my-domain.com
+  gke_clusters:
+  - properties:
+      clusterLocationType: Regional
+      region: us-central1
+      cluster:
+        name: foo-cluster
+  iam_custom_roles:
+  - properties:
+      roleId: fooCustomRole
+      includedPermissions:
+      - iam.roles.get
+  iam_policies:
+  - name: foo-owner-binding
+    properties:
+      roles:
+      - role: roles/owner
+        members:
+        - group:foo-owner@my-domain.com
+  pubsubs:
+  - properties:
+      topic: foo-topic
+      accessControl:
+      - role: roles/pubsub.publisher
+        members:
+        - group:foo-publisher@my-domain.com
+      subscriptions:
+      - name: foo-subscription
+        ackDeadlineSeconds: 60
+  service_accounts:
+  - properties:
+      accountId: foo-sa
+      displayName: Foo SA`
+
+func TestProjectTerraformResources(t *testing.T) {
+	_, project := testconf.ConfigAndProject(t, &testconf.ConfigData{terraformResourcesYAML})
+	rs, err := project.TerraformResources()
+	if err != nil {
+		t.Fatalf("TerraformResources = %v", err)
+	}
+	got := make(map[string]interface{})
+	for _, r := range rs {
+		got[r.TerraformResourceName()+"."+r.ID()] = toMap(t, r)
+	}
+
+	// Only check the user defined resources and the ones depending on them.
+	wantYAML := `
+google_bigquery_dataset.foo_dataset:
+  dataset_id: foo_dataset
+  project: my-project
+  location: US
+  access:
+  - role: OWNER
+    group_by_email: my-project-owners@my-domain.com
+  - role: WRITER
+    group_by_email: my-project-readwrite@my-domain.com
+  - role: READER
+    group_by_email: my-project-readonly@my-domain.com
+  - role: READER
+    group_by_email: another-readonly-group@googlegroups.com
+google_healthcare_dataset.foo-chc-dataset:
+  name: foo-chc-dataset
+  project: my-project
+  location: us-central1
+google_healthcare_fhir_store.foo-chc-dataset-foo-fhir-store:
+  name: foo-fhir-store
+  dataset: ${google_healthcare_dataset.foo-chc-dataset.id}
+google_compute_instance.foo-instance:
+  name: foo-instance
+  project: my-project
+  zone: us-east1-a
+  machine_type: n1-standard-1
+  boot_disk:
+    initialize_params:
+      image: projects/debian-cloud/global/images/family/debian-9
+  network_interface:
+  - network: default
+google_storage_bucket.foo-bucket:
+  name: foo-bucket
+  project: my-project
+  location: us-east1
+  versioning:
+    enabled: true
+  logging:
+    log_bucket: my-project-logs
+google_storage_bucket_iam_binding.foo-bucket-roles_storage_admin:
+  bucket: ${google_storage_bucket.foo-bucket.name}
+  role: roles/storage.admin
+  members:
+  - group:my-project-owners@my-domain.com
+google_storage_bucket_iam_binding.foo-bucket-roles_storage_objectAdmin:
+  bucket: ${google_storage_bucket.foo-bucket.name}
+  role: roles/storage.objectAdmin
+  members:
+  - group:my-project-readwrite@my-domain.com
+google_storage_bucket_iam_binding.foo-bucket-roles_storage_objectViewer:
+  bucket: ${google_storage_bucket.foo-bucket.name}
+  role: roles/storage.objectViewer
+  members:
+  - group:my-project-readonly@my-domain.com
+  - group:another-readonly-group@googlegroups.com
+google_container_cluster.foo-cluster:
+  name: foo-cluster
+  project: my-project
+  location: us-central1
+google_project_iam_custom_role.fooCustomRole:
+  role_id: fooCustomRole
+  project: my-project
+  title: fooCustomRole
+  permissions:
+  - iam.roles.get
+google_project_iam_member.foo-owner-binding-roles_owner-group_foo-owner_my-domain_com:
+  project: my-project
+  role: roles/owner
+  member: group:foo-owner@my-domain.com
+google_pubsub_topic.foo-topic:
+  name: foo-topic
+  project: my-project
+google_pubsub_topic_iam_binding.foo-topic-roles_pubsub_publisher:
+  topic: ${google_pubsub_topic.foo-topic.name}
+  project: my-project
+  role: roles/pubsub.publisher
+  members:
+  - group:foo-publisher@my-domain.com
+google_pubsub_subscription.foo-subscription:
+  name: foo-subscription
+  project: my-project
+  topic: ${google_pubsub_topic.foo-topic.name}
+  ack_deadline_seconds: 60
+google_pubsub_subscription_iam_binding.foo-subscription-roles_pubsub_editor:
+  subscription: ${google_pubsub_subscription.foo-subscription.name}
+  project: my-project
+  role: roles/pubsub.editor
+  members:
+  - group:my-project-readwrite@my-domain.com
+google_pubsub_subscription_iam_binding.foo-subscription-roles_pubsub_viewer:
+  subscription: ${google_pubsub_subscription.foo-subscription.name}
+  project: my-project
+  role: roles/pubsub.viewer
+  members:
+  - group:my-project-readonly@my-domain.com
+  - group:another-readonly-group@googlegroups.com
+google_service_account.foo-sa:
+  account_id: foo-sa
+  project: my-project
+  display_name: Foo SA
+`
+	want := make(map[string]interface{})
+	if err := yaml.Unmarshal([]byte(wantYAML), &want); err != nil {
+		t.Fatalf("yaml.Unmarshal want: %v", err)
+	}
+	for addr, w := range want {
+		if diff := cmp.Diff(got[addr], w); diff != "" {
+			t.Errorf("resource %q differs (-got +want):\n%v", addr, diff)
+		}
+	}
+
+	metric, ok := got["google_logging_metric.unexpected-access-foo-bucket"].(map[string]interface{})
+	if !ok {
+		t.Fatal("unexpected access metric of foo-bucket not found")
+	}
+	if diff := cmp.Diff(metric["depends_on"], []interface{}{"google_storage_bucket.foo-bucket"}); diff != "" {
+		t.Errorf("metric dependencies differ (-got +want):\n%v", diff)
+	}
+}
+
+func TestProjectTerraformResourcesUnsupported(t *testing.T) {
+	_, project := testconf.ConfigAndProject(t, &testconf.ConfigData{`
+resources:
+  gce_firewalls:
+  - name: foo-firewall-rules
+    properties:
+      network: default
+      rules:
+      - name: allow-proxy-from-inside
+        allowed:
+        - IPProtocol: tcp
+          ports:
+          - "80"`})
+	if _, err := project.TerraformResources(); err == nil {
+		t.Fatal("TerraformResources with firewalls = nil, want error")
+	}
+}
+
+func TestProjectTerraformResourcesUnsupportedBucketProperties(t *testing.T) {
+	_, project := testconf.ConfigAndProject(t, &testconf.ConfigData{`
+resources:
+  gcs_buckets:
+  - properties:
+      name: foo-bucket
+      location: us-east1
+      retentionPolicy:
+        retentionPeriod: 3600`})
+	_, err := project.TerraformResources()
+	if err == nil || !strings.Contains(err.Error(), "retentionPolicy") {
+		t.Fatalf("TerraformResources with bucket retention policy = %v, want error about retentionPolicy", err)
+	}
+}
+
+func toMap(t *testing.T, r tfconfig.Resource) map[string]interface{} {
+	t.Helper()
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("json.Marshal %q: %v", r.ID(), err)
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("json.Unmarshal %q: %v", r.ID(), err)
+	}
+	return m
+}
+
+func TestTerraformSettings(t *testing.T) {
+	conf, _ := testconf.ConfigAndProject(t, nil)
+	want := config.TerraformSettings{
+		RequiredVersion: ">= 0.12.0",
+		RequiredProviders: map[string]string{
+			"google":      "~> 2.20",
+			"google-beta": "~> 2.20",
+		},
+	}
+	if diff := cmp.Diff(conf.Overall.Terraform, want); diff != "" {
+		t.Errorf("default terraform settings differ (-got +want):\n%v", diff)
+	}
+
+	conf = testconf.ConfigBeforeInit(t, nil)
+	conf.Overall.Terraform = config.TerraformSettings{
+		RequiredVersion:   ">= 0.12.6",
+		RequiredProviders: map[string]string{"google": "= 2.20.0", "random": "~> 2.2"},
+		Region:            "us-central1",
+	}
+	if err := conf.Init(nil); err != nil {
+		t.Fatalf("conf.Init = %v", err)
+	}
+	want = config.TerraformSettings{
+		RequiredVersion: ">= 0.12.6",
+		RequiredProviders: map[string]string{
+			"google":      "= 2.20.0",
+			"google-beta": "~> 2.20",
+			"random":      "~> 2.2",
+		},
+		Region: "us-central1",
+	}
+	if diff := cmp.Diff(conf.Overall.Terraform, want); diff != "" {
+		t.Errorf("terraform settings differ (-got +want):\n%v", diff)
+	}
+}
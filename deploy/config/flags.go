@@ -0,0 +1,46 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"flag"
+	"strings"
+)
+
+// LoadFlags registers the flags of the load options shared by the commands, e.g. --offline, in the flag set, and
+// returns the options they are parsed into.
+func LoadFlags(fs *flag.FlagSet) *LoadOptions {
+	o := new(LoadOptions)
+	fs.StringVar(&o.CacheDir, "import_cache_dir", "", "Path to the dir to cache remote config imports in. Defaults to a dir in the user cache dir.")
+	fs.BoolVar(&o.Offline, "offline", false, "Whether to only read remote config imports from the cache instead of fetching them.")
+	fs.Var((*listFlag)(&o.Overlays), "overlay", "Comma separated paths of overlays to apply to the config after the overlays it lists, e.g. prod.yaml.")
+	fs.StringVar(&o.SecretsFile, "secrets_file", "", "Path to the local encrypted file of the secrets referenced in the config as ${secret:file/<name>}.")
+	fs.StringVar(&o.SecretsKeyFile, "secrets_key_file", "", "Path to the file with the key of --secrets_file.")
+	return o
+}
+
+// listFlag is a flag of a comma separated list. Values of repeated flags are appended.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, strings.Split(value, ",")...)
+	return nil
+}
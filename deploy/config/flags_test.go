@@ -0,0 +1,51 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config_test
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadFlags(t *testing.T) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	got := config.LoadFlags(fs)
+	args := []string{
+		"--import_cache_dir=/tmp/imports",
+		"--offline",
+		"--overlay=prod.yaml,us.yaml",
+		"--overlay=extra.yaml",
+		"--secrets_file=secrets.enc",
+		"--secrets_key_file=secrets.key",
+	}
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("fs.Parse = %v", err)
+	}
+	want := &config.LoadOptions{
+		CacheDir:       "/tmp/imports",
+		Offline:        true,
+		Overlays:       []string{"prod.yaml", "us.yaml", "extra.yaml"},
+		SecretsFile:    "secrets.enc",
+		SecretsKeyFile: "secrets.key",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("load options differ (-got +want):\n%v", diff)
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
 )
 
 // GCEInstance wraps a CFT GCE Instance.
@@ -35,6 +37,8 @@ type GCEInstanceProperties struct {
 	GCEInstanceName string `json:"name"`
 	Zone            string `json:"zone"`
 	DiskImage       string `json:"diskImage,omitempty"`
+	MachineType     string `json:"machineType,omitempty"`
+	Network         string `json:"network,omitempty"`
 }
 
 // Init initializes the instance.
@@ -79,3 +83,19 @@ func (i *GCEInstance) UnmarshalJSON(data []byte) error {
 func (i *GCEInstance) MarshalJSON() ([]byte, error) {
 	return interfacePair{i.raw, aliasGCEInstance(*i)}.MarshalJSON()
 }
+
+// TerraformResources returns the terraform resources of this instance.
+func (i *GCEInstance) TerraformResources() []tfconfig.Resource {
+	ti := &tfconfig.ComputeInstance{
+		Name:        i.Name(),
+		Zone:        i.Zone,
+		MachineType: i.MachineType,
+		BootDisk: &tfconfig.BootDisk{
+			InitializeParams: &tfconfig.InitializeParams{Image: i.DiskImage},
+		},
+	}
+	if i.Network != "" {
+		ti.NetworkInterfaces = []*tfconfig.NetworkInterface{{Network: i.Network}}
+	}
+	return []tfconfig.Resource{ti}
+}
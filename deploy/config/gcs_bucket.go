@@ -18,6 +18,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
 )
 
 // GCSBucket wraps a CFT Cloud Storage Bucket.
@@ -30,15 +33,18 @@ type GCSBucket struct {
 
 // GCSBucketProperties  represents a partial CFT bucket implementation.
 type GCSBucketProperties struct {
-	GCSBucketName              string     `json:"name"`
-	Location                   string     `json:"location"`
-	Bindings                   []Binding  `json:"bindings"`
-	StorageClass               string     `json:"storageClass,omitempty"`
-	Versioning                 versioning `json:"versioning"`
-	Lifecycle                  *lifecycle `json:"lifecycle,omitempty"`
-	PredefinedACL              string     `json:"predefinedAcl,omitempty"`
-	PredefinedDefaultObjectACL string     `json:"predefinedDefaultObjectAcl,omitempty"`
-	Logging                    *logging   `json:"logging,omitempty"`
+	GCSBucketName              string            `json:"name"`
+	Location                   string            `json:"location"`
+	Bindings                   []Binding         `json:"bindings"`
+	StorageClass               string            `json:"storageClass,omitempty"`
+	Versioning                 versioning        `json:"versioning"`
+	Lifecycle                  *lifecycle        `json:"lifecycle,omitempty"`
+	PredefinedACL              string            `json:"predefinedAcl,omitempty"`
+	PredefinedDefaultObjectACL string            `json:"predefinedDefaultObjectAcl,omitempty"`
+	Logging                    *logging          `json:"logging,omitempty"`
+	Labels                     map[string]string `json:"labels,omitempty"`
+	RequesterPays              bool              `json:"requesterPays,omitempty"`
+	Website                    *website          `json:"website,omitempty"`
 }
 
 type versioning struct {
@@ -50,6 +56,11 @@ type logging struct {
 	LogBucket string `json:"logBucket"`
 }
 
+type website struct {
+	MainPageSuffix string `json:"mainPageSuffix,omitempty"`
+	NotFoundPage   string `json:"notFoundPage,omitempty"`
+}
+
 type lifecycle struct {
 	Rules []*LifecycleRule `json:"rule,omitempty"`
 }
@@ -63,12 +74,17 @@ type LifecycleRule struct {
 }
 
 type action struct {
-	Type string `json:"type,omitempty"`
+	Type         string `json:"type,omitempty"`
+	StorageClass string `json:"storageClass,omitempty"`
 }
 
 type condition struct {
-	Age    int  `json:"age,omitempty"`
-	IsLive bool `json:"isLive,omitempty"`
+	Age           int    `json:"age,omitempty"`
+	CreatedBefore string `json:"createdBefore,omitempty"`
+	// Use pointer to differentiate between unset, matching both live and archived objects, and false.
+	IsLive              *bool    `json:"isLive,omitempty"`
+	MatchesStorageClass []string `json:"matchesStorageClass,omitempty"`
+	NumNewerVersions    int      `json:"numNewerVersions,omitempty"`
 }
 
 // aliasGCSBucket is used to prevent infinite recursion when dealing with json marshaling.
@@ -117,7 +133,7 @@ func (b *GCSBucket) Init() error {
 		}
 		b.Lifecycle.Rules = append(b.Lifecycle.Rules, &LifecycleRule{
 			Action:    &action{Type: "Delete"},
-			Condition: &condition{Age: b.TTLDays, IsLive: true},
+			Condition: &condition{Age: b.TTLDays, IsLive: &t},
 		})
 	}
 	return nil
@@ -154,3 +170,93 @@ func (b *GCSBucket) UnmarshalJSON(data []byte) error {
 func (b *GCSBucket) MarshalJSON() ([]byte, error) {
 	return interfacePair{b.raw, aliasGCSBucket(*b)}.MarshalJSON()
 }
+
+// terraformProperties are the properties of a bucket that are deployed with terraform. Versioning is always enabled
+// and predefined ACLs are never set (see Init).
+var terraformProperties = map[string]bool{
+	"name":                       true,
+	"location":                   true,
+	"bindings":                   true,
+	"storageClass":               true,
+	"versioning":                 true,
+	"lifecycle":                  true,
+	"predefinedAcl":              true,
+	"predefinedDefaultObjectAcl": true,
+	"logging":                    true,
+	"labels":                     true,
+	"requesterPays":              true,
+	"website":                    true,
+}
+
+// checkTerraformProperties returns an error if the bucket has properties that cannot be deployed with terraform.
+func (b *GCSBucket) checkTerraformProperties() error {
+	if len(b.raw) == 0 {
+		return nil
+	}
+	var raw struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(b.raw, &raw); err != nil {
+		return fmt.Errorf("failed to unmarshal properties: %v", err)
+	}
+	var unsupported []string
+	for k := range raw.Properties {
+		if !terraformProperties[k] {
+			unsupported = append(unsupported, k)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("properties %v of bucket %q are not supported by terraform yet", unsupported, b.Name())
+	}
+	return nil
+}
+
+// TerraformResources returns the terraform resources of this bucket and its bindings.
+func (b *GCSBucket) TerraformResources() []tfconfig.Resource {
+	tb := &tfconfig.StorageBucket{
+		Name:          b.Name(),
+		Location:      b.Location,
+		StorageClass:  b.StorageClass,
+		Labels:        b.Labels,
+		RequesterPays: b.RequesterPays,
+	}
+	if b.Logging != nil {
+		tb.Logging = &tfconfig.Logging{LogBucket: b.Logging.LogBucket}
+	}
+	if b.Website != nil {
+		tb.Website = &tfconfig.Website{MainPageSuffix: b.Website.MainPageSuffix, NotFoundPage: b.Website.NotFoundPage}
+	}
+	if b.Lifecycle != nil {
+		for _, r := range b.Lifecycle.Rules {
+			tr := new(tfconfig.LifecycleRule)
+			if r.Action != nil {
+				tr.Action = &tfconfig.Action{Type: r.Action.Type, StorageClass: r.Action.StorageClass}
+			}
+			if c := r.Condition; c != nil {
+				tr.Condition = &tfconfig.Condition{
+					Age:                 c.Age,
+					CreatedBefore:       c.CreatedBefore,
+					MatchesStorageClass: c.MatchesStorageClass,
+					NumNewerVersions:    c.NumNewerVersions,
+				}
+				if c.IsLive != nil {
+					tr.Condition.WithState = "ARCHIVED"
+					if *c.IsLive {
+						tr.Condition.WithState = "LIVE"
+					}
+				}
+			}
+			tb.LifecycleRules = append(tb.LifecycleRules, tr)
+		}
+	}
+
+	rs := []tfconfig.Resource{tb}
+	for _, binding := range b.Bindings {
+		if len(binding.Members) == 0 {
+			continue
+		}
+		rs = append(rs, tfconfig.NewStorageBucketIAMBinding(tb, binding.Role, binding.Members))
+	}
+	return rs
+}
@@ -15,6 +15,7 @@
 package config_test
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -112,6 +113,90 @@ properties:
 	}
 }
 
+func TestGCSBucketTerraformResources(t *testing.T) {
+	bucketYAML := `
+properties:
+  name: foo-bucket
+  location: us-east1
+  storageClass: REGIONAL
+  labels:
+    env: prod
+  requesterPays: true
+  website:
+    mainPageSuffix: index.html
+    notFoundPage: 404.html
+  lifecycle:
+    rule:
+    - action:
+        type: SetStorageClass
+        storageClass: NEARLINE
+      condition:
+        age: 36500
+        createdBefore: "2018-08-16"
+        isLive: false
+        matchesStorageClass:
+        - REGIONAL
+        numNewerVersions: 5
+`
+
+	wantBucketYAML := `
+name: foo-bucket
+project: my-project
+location: us-east1
+storage_class: REGIONAL
+versioning:
+  enabled: true
+labels:
+  env: prod
+requester_pays: true
+website:
+  main_page_suffix: index.html
+  not_found_page: 404.html
+lifecycle_rule:
+- action:
+    type: SetStorageClass
+    storage_class: NEARLINE
+  condition:
+    age: 36500
+    created_before: "2018-08-16"
+    with_state: ARCHIVED
+    matches_storage_class:
+    - REGIONAL
+    num_newer_versions: 5
+`
+
+	b := &config.GCSBucket{}
+	if err := yaml.Unmarshal([]byte(bucketYAML), b); err != nil {
+		t.Fatalf("yaml unmarshal: %v", err)
+	}
+	if err := b.Init(); err != nil {
+		t.Fatalf("b.Init: %v", err)
+	}
+	rs := b.TerraformResources()
+	if len(rs) != 1 {
+		t.Fatalf("TerraformResources returned %d resources, want 1", len(rs))
+	}
+	if err := rs[0].Init("my-project"); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	byt, err := json.Marshal(rs[0])
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	got := make(map[string]interface{})
+	want := make(map[string]interface{})
+	if err := yaml.Unmarshal(byt, &got); err != nil {
+		t.Fatalf("yaml.Unmarshal got config: %v", err)
+	}
+	if err := yaml.Unmarshal([]byte(wantBucketYAML), &want); err != nil {
+		t.Fatalf("yaml.Unmarshal want config: %v", err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("terraform bucket differs (-got +want):\n%v", diff)
+	}
+}
+
 func TestGCSBucketErrors(t *testing.T) {
 	tests := []struct {
 		name string
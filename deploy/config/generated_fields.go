@@ -28,10 +28,23 @@ type AllGeneratedFields struct {
 
 // GeneratedFields defines the generated_fields of a single project.
 type GeneratedFields struct {
-	ProjectNumber         string            `json:"project_number"`
-	LogSinkServiceAccount string            `json:"log_sink_service_account"`
-	GCEInstanceInfoList   []GCEInstanceInfo `json:"gce_instance_info"`
-	FailedStep            int               `json:"failed_step"`
+	ProjectNumber         string            `json:"project_number,omitempty"`
+	LogSinkServiceAccount string            `json:"log_sink_service_account,omitempty"`
+	GCEInstanceInfoList   []GCEInstanceInfo `json:"gce_instance_info,omitempty"`
+	FailedStep            int               `json:"failed_step,omitempty"`
+	Decommission          *DecommissionInfo `json:"decommission,omitempty"`
+	// Warnings are problems of the last deployment that did not fail it but need an action from a user.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// DecommissionInfo defines the generated fields of a project that is being or was decommissioned.
+type DecommissionInfo struct {
+	// CompletedSteps are the names of the decommission steps that completed, so they are skipped when resuming.
+	CompletedSteps []string `json:"completed_steps,omitempty"`
+	// ArchiveLocation is the GCS location the data of the project was exported to, if any.
+	ArchiveLocation string `json:"archive_location,omitempty"`
+	// DeletionRequestTime is the time the deletion of the project was requested, in RFC 3339 format.
+	DeletionRequestTime string `json:"deletion_request_time,omitempty"`
 }
 
 // GCEInstanceInfo defines the generated fields for instances in a project.
@@ -42,8 +55,8 @@ type GCEInstanceInfo struct {
 
 // ForsetiServiceInfo defines the generated_fields of the forseti service.
 type ForsetiServiceInfo struct {
-	ServiceAccount string `json:"service_account"`
-	ServiceBucket  string `json:"server_bucket"`
+	ServiceAccount string `json:"service_account,omitempty"`
+	ServiceBucket  string `json:"server_bucket,omitempty"`
 }
 
 // InstanceID returns the ID of the instance with the given name.
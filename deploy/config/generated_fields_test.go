@@ -15,6 +15,9 @@
 package config_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
@@ -97,3 +100,60 @@ func TestGetInstanceID(t *testing.T) {
 		t.Errorf("project.InstanceID(%q): got nil error, want non-nil error", name)
 	}
 }
+
+func TestWriteGeneratedFields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir = %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "generated_fields.yaml")
+
+	existing := `
+projects:
+  untouched-project:
+    project_number: '123123123123'
+forseti:
+  service_account: some-forseti-gcp-reader@some-forseti.iam.gserviceaccount.com
+`
+	if err := ioutil.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile = %v", err)
+	}
+	gf, err := config.LoadGeneratedFields(path)
+	if err != nil {
+		t.Fatalf("LoadGeneratedFields = %v", err)
+	}
+	gf.Projects["new-project"] = &config.GeneratedFields{ProjectNumber: "456456456456", FailedStep: 3}
+	gf.Projects["empty-project"] = &config.GeneratedFields{}
+	gf.Forseti.ServiceBucket = "gs://some-forseti-server"
+
+	if err := config.WriteGeneratedFields(path, gf); err != nil {
+		t.Fatalf("WriteGeneratedFields = %v", err)
+	}
+
+	got, err := config.LoadGeneratedFields(path)
+	if err != nil {
+		t.Fatalf("LoadGeneratedFields = %v", err)
+	}
+	want := &config.AllGeneratedFields{
+		Projects: map[string]*config.GeneratedFields{
+			"untouched-project": &config.GeneratedFields{ProjectNumber: "123123123123"},
+			"new-project":       &config.GeneratedFields{ProjectNumber: "456456456456", FailedStep: 3},
+		},
+		Forseti: config.ForsetiServiceInfo{
+			ServiceAccount: "some-forseti-gcp-reader@some-forseti.iam.gserviceaccount.com",
+			ServiceBucket:  "gs://some-forseti-server",
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Fatalf("AllGeneratedFields mismatch (-got +want):\n%s", diff)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir = %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got %d files in output dir, want 1 (temp files should be removed)", len(files))
+	}
+}
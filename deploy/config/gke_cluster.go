@@ -17,6 +17,8 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
 )
 
 // GKECluster wraps a CFT GKE cluster.
@@ -74,3 +76,15 @@ func (c *GKECluster) UnmarshalJSON(data []byte) error {
 func (c *GKECluster) MarshalJSON() ([]byte, error) {
 	return interfacePair{c.raw, aliasGKECluster(*c)}.MarshalJSON()
 }
+
+// TerraformResources returns the terraform resources of this cluster.
+func (c *GKECluster) TerraformResources() []tfconfig.Resource {
+	location := c.Region
+	if c.ClusterLocationType == "Zonal" {
+		location = c.Zone
+	}
+	return []tfconfig.Resource{&tfconfig.ContainerCluster{
+		Name:     c.Name(),
+		Location: location,
+	}}
+}
@@ -17,6 +17,8 @@ package config
 import (
 	"encoding/json"
 	"errors"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
 )
 
 // IAMCustomRole wraps a CFT IAM custom role.
@@ -27,7 +29,10 @@ type IAMCustomRole struct {
 
 // IAMCustomRoleProperties represents a partial IAM custom role implementation.
 type IAMCustomRoleProperties struct {
-	RoleID string `json:"roleId"`
+	RoleID              string   `json:"roleId"`
+	Title               string   `json:"title,omitempty"`
+	Description         string   `json:"description,omitempty"`
+	IncludedPermissions []string `json:"includedPermissions,omitempty"`
 }
 
 // Init initializes a new custom role with the given project.
@@ -121,3 +126,25 @@ func (i *IAMPolicy) UnmarshalJSON(data []byte) error {
 func (i *IAMPolicy) MarshalJSON() ([]byte, error) {
 	return interfacePair{i.raw, aliasIAMPolicy(*i)}.MarshalJSON()
 }
+
+// TerraformResources returns the terraform resources of this custom role.
+func (i *IAMCustomRole) TerraformResources() []tfconfig.Resource {
+	return []tfconfig.Resource{&tfconfig.ProjectIAMCustomRole{
+		RoleID:      i.RoleID,
+		Title:       i.Title,
+		Description: i.Description,
+		Permissions: i.IncludedPermissions,
+	}}
+}
+
+// TerraformResources returns the terraform resources of the members of this policy.
+// Each member is added to its role without removing other members, like the deployment manager template.
+func (i *IAMPolicy) TerraformResources() []tfconfig.Resource {
+	var rs []tfconfig.Resource
+	for _, b := range i.Bindings {
+		for _, m := range b.Members {
+			rs = append(rs, tfconfig.NewProjectIAMMember(i.Name(), b.Role, m))
+		}
+	}
+	return rs
+}
@@ -22,11 +22,15 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"text/template"
 
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
 	"github.com/ghodss/yaml"
 	"github.com/xeipuuv/gojsonschema"
 	"github.com/imdario/mergo"
@@ -46,7 +50,7 @@ func NormalizePath(path string) (string, error) {
 		return "", err
 	}
 	path = os.ExpandEnv(path)
-	if strings.HasPrefix(path, "gs://") || filepath.IsAbs(path) {
+	if isRemote(path) || filepath.IsAbs(path) {
 		return path, nil
 	}
 	// Path is relative from where the script was launched from.
@@ -61,9 +65,39 @@ func NormalizePath(path string) (string, error) {
 	return filepath.Abs(filepath.Join(cwd, path))
 }
 
+// LoadOptions are the options to load configs with remote imports, e.g. shared base configs published in GCS,
+// overlays and secrets.
+type LoadOptions struct {
+	// CacheDir is the dir remote imports are cached in. Defaults to healthcare-deploy/imports in the user cache dir.
+	CacheDir string
+	// Offline reads remote imports from the cache only.
+	Offline bool
+	// GCS reads gs:// imports. Defaults to running gsutil.
+	GCS GCSReader
+	// HTTPClient fetches https:// imports. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Overlays are the paths of the overlays to apply to the config after the overlays it lists, e.g. to derive a
+	// prod config from a base config.
+	Overlays []string
+	// SecretsFile is the local encrypted file of the secrets referenced with the file provider, e.g.
+	// ${secret:file/alert_email}, and SecretsKeyFile the file of its key.
+	SecretsFile    string
+	SecretsKeyFile string
+	// SecretProviders are the providers of the secrets referenced in the config, keyed by name. They override the
+	// default env, file and secretmanager providers.
+	SecretProviders map[string]secrets.Provider
+}
+
 // Load loads a config from the given path.
 func Load(confPath, genFieldsPath string) (*Config, error) {
-	b, err := LoadBytes(confPath)
+	return LoadWithOptions(confPath, genFieldsPath, nil)
+}
+
+// LoadWithOptions loads a config from the given path, which may import remote configs.
+// References to secrets in the config, e.g. ${secret:env/ALERT_EMAIL}, are resolved and registered to be redacted
+// (see secrets.Register).
+func LoadWithOptions(confPath, genFieldsPath string, opts *LoadOptions) (*Config, error) {
+	_, b, sm, err := loadBytes(confPath, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config to bytes: %v", err)
 	}
@@ -78,46 +112,74 @@ func Load(confPath, genFieldsPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to load generated fields: %v", err)
 	}
 	if err := conf.Init(genFields); err != nil {
-		return nil, fmt.Errorf("failed to initialize config: %v", err)
+		return nil, fmt.Errorf("failed to initialize config: %v", sm.annotate(err))
 	}
 	return conf, nil
 }
 
 // LoadBytes merges, parses and validates the config at path and returns its bytes.
+// References to secrets are resolved to validate the config, but left unresolved in the returned bytes.
+// Validation errors are reported where the invalid values were written, e.g. partial_projects.yaml:42:5.
 func LoadBytes(path string) ([]byte, error) {
-	path, err := NormalizePath(path)
+	return LoadBytesWithOptions(path, nil)
+}
+
+// LoadBytesWithOptions merges, parses and validates the config at path, which may import remote configs, and
+// returns its bytes.
+func LoadBytesWithOptions(path string, opts *LoadOptions) ([]byte, error) {
+	b, _, _, err := loadBytes(path, opts)
+	return b, err
+}
+
+// loadBytes merges, parses and validates the config at path and returns its bytes, its bytes with the references to
+// secrets resolved and its source map.
+func loadBytes(path string, opts *LoadOptions) (raw, resolved []byte, sm sourceMap, err error) {
+	path, err = NormalizePath(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to normalize path %q: %v", path, err)
+		return nil, nil, nil, fmt.Errorf("failed to normalize path %q: %v", path, err)
 	}
-	m, err := loadMap(path, nil)
+	if opts == nil {
+		opts = new(LoadOptions)
+	}
+	l := &loader{opts: opts, loaded: make(map[string]bool), pins: make(map[string]string)}
+	m, sm, err := l.loadMap(path, "", nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load config to map: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to load config to map: %v", err)
+	}
+	if m, err = l.applyOverlays(m, sm); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to apply overlays: %v", err)
 	}
 
-	b, err := yaml.Marshal(m)
+	raw, err = yaml.Marshal(m)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal config map: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to marshal config map: %v", err)
 	}
 
-	if err := ValidateConf(b); err != nil {
-		return nil, err
+	// Secrets are resolved before validating, as the references may not be valid values, e.g. emails.
+	if resolved, err = resolveSecrets(raw, opts.secretProviders()); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to resolve secrets: %v", sm.annotate(err))
 	}
 
-	return b, nil
+	if err := validate(resolved, projectConfigSchema, sm); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return raw, resolved, sm, nil
 }
 
 // ValidateConf validates the input project config against the default schema template.
 func ValidateConf(confYAML []byte) error {
-	return validate(confYAML, projectConfigSchema)
+	return validate(confYAML, projectConfigSchema, nil)
 }
 
 // validateGenFields validates the generated fields config against the default schema template.
 func validateGenFields(genFieldsYAML []byte) error {
-	return validate(genFieldsYAML, generatedFieldsSchema)
+	return validate(genFieldsYAML, generatedFieldsSchema, nil)
 }
 
 // validate validates the input yaml against the given schema template.
-func validate(inputYAML []byte, schemaPath string) error {
+// Errors are prefixed with where the invalid values were written if the source map locates them.
+func validate(inputYAML []byte, schemaPath string, sm sourceMap) error {
 	schemaYAML, err := ioutil.ReadFile(schemaPath)
 	if err != nil {
 		return fmt.Errorf("failed to read schema file at path %q: %v", schemaPath, err)
@@ -143,46 +205,124 @@ func validate(inputYAML []byte, schemaPath string) error {
 	var sb strings.Builder
 	sb.WriteString("config has validation errors:")
 	for _, err := range result.Errors() {
-		sb.WriteString(fmt.Sprintf("\n- %v", err))
+		sb.WriteString("\n- ")
+		if loc, ok := sm.locate(schemaErrorPath(err)); ok {
+			sb.WriteString(loc + ": ")
+		}
+		sb.WriteString(err.String())
 	}
 	return errors.New(sb.String())
 }
 
+// schemaErrorPath returns the path of the value the schema error is about. Errors about a property, e.g. one not
+// allowed, are about the property rather than the object holding it.
+func schemaErrorPath(err gojsonschema.ResultError) string {
+	path := err.Field()
+	if path == "(root)" {
+		path = ""
+	}
+	if p, ok := err.Details()["property"].(string); ok && p != "" {
+		path = joinPath(path, p)
+	}
+	return path
+}
+
 type importsItem struct {
-	Path string                 `json:"path"`
-	Data map[string]interface{} `json:"data"`
+	Path   string                 `json:"path"`
+	SHA256 string                 `json:"sha256"`
+	Data   map[string]interface{} `json:"data"`
 
 	Pattern string `json:"pattern"`
 }
 
+// loader loads a config and its imports.
+type loader struct {
+	opts *LoadOptions
+	// chain is the chain of imports from the root config to the config being loaded.
+	chain []string
+	// loaded holds the keys of the configs already loaded.
+	loaded map[string]bool
+	// pins holds the sha256 checksums the configs at each path have been verified against.
+	pins map[string]string
+}
+
+// importKey returns the key of the config at path executed with the template data.
+// The same template imported with different data is a different config.
+func importKey(path string, data map[string]interface{}) (string, error) {
+	if len(data) == 0 {
+		return path, nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal template data of %q: %v", path, err)
+	}
+	return path + " " + string(b), nil
+}
+
 // loadMap loads the config at path into a map. It will also merge all imported configs.
-// The given path should be absolute.
-func loadMap(path string, data map[string]interface{}) (map[string]interface{}, error) {
-	b, err := ioutil.ReadFile(path)
+// Every config is loaded once: a config imported again, e.g. a shared config imported by two configs, is only
+// merged where it was first imported, so its lists are not appended twice. Import cycles are errors.
+// The returned source map locates the keys and list elements of the merged config. Values of templated imports are
+// located in the executed template.
+// The given path should be absolute or a gs:// or https:// URL. If sum is set, the config must have the sha256
+// checksum, also when it was already loaded. Importing the same path with different checksums is an error.
+func (l *loader) loadMap(path, sum string, data map[string]interface{}) (map[string]interface{}, sourceMap, error) {
+	for i, p := range l.chain {
+		if p == path {
+			chain := append(append([]string(nil), l.chain[i:]...), path)
+			return nil, nil, fmt.Errorf("import cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+	key, err := importKey(path, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file at path %q: %v", path, err)
+		return nil, nil, err
+	}
+	if pin := l.pins[path]; sum != "" && pin != "" && pin != sum {
+		return nil, nil, fmt.Errorf("%q is imported with conflicting sha256 checksums %q and %q", path, pin, sum)
+	}
+	if l.loaded[key] {
+		// A config first imported without a checksum must still match a later one.
+		if sum != "" && l.pins[path] == "" {
+			if _, err := l.opts.read(path, sum); err != nil {
+				return nil, nil, err
+			}
+			l.pins[path] = sum
+		}
+		return make(map[string]interface{}), make(sourceMap), nil
+	}
+	l.loaded[key] = true
+	if sum != "" {
+		l.pins[path] = sum
+	}
+	l.chain = append(l.chain, path)
+	defer func() { l.chain = l.chain[:len(l.chain)-1] }()
+
+	b, err := l.opts.read(path, sum)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	if len(data) > 0 {
 		tmpl, err := template.New(path).Option("missingkey=error").Parse(string(b))
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse %q into template: %v", path, err)
+			return nil, nil, fmt.Errorf("failed to parse %q into template: %v", path, err)
 		}
 		var buf bytes.Buffer
 		if err := tmpl.Execute(&buf, data); err != nil {
-			return nil, fmt.Errorf("failed to execute template for %q: %v", path, err)
+			return nil, nil, fmt.Errorf("failed to execute template for %q: %v", path, err)
 		}
 		b = buf.Bytes()
 	}
+	sm := scanSources(path, b)
 
 	var raw json.RawMessage
 	if err := yaml.Unmarshal(b, &raw); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config at path %q: %v", path, err)
+		return nil, nil, fmt.Errorf("failed to unmarshal config at path %q: %v", path, err)
 	}
 
 	root := make(map[string]interface{})
 	if err := json.Unmarshal(raw, &root); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal raw config to map at path %q: %v", path, err)
+		return nil, nil, fmt.Errorf("failed to unmarshal raw config to map at path %q: %v", path, err)
 	}
 
 	type config struct {
@@ -190,50 +330,51 @@ func loadMap(path string, data map[string]interface{}) (map[string]interface{},
 	}
 	conf := new(config)
 	if err := json.Unmarshal(raw, conf); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal raw config to struct with imports at path %q: %v", path, err)
+		return nil, nil, fmt.Errorf("failed to unmarshal raw config to struct with imports at path %q: %v", path, err)
 	}
 
-	dir := filepath.Dir(path)
 	pathMap := map[string]bool{
 		path: true,
 	}
 	for _, imp := range conf.Imports {
-		impPath := imp.Path
-		if impPath == "" {
+		if imp.Path == "" {
 			continue
 		}
-		if !filepath.IsAbs(impPath) {
-			impPath = filepath.Join(dir, impPath)
+		impPath, err := resolveImport(path, imp.Path)
+		if err != nil {
+			return nil, nil, err
 		}
 		pathMap[impPath] = true
 
-		impMap, err := loadMap(impPath, imp.Data)
+		impMap, impSM, err := l.loadMap(impPath, imp.SHA256, imp.Data)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load %q to map: %v", impPath, err)
+			return nil, nil, fmt.Errorf("failed to load %q to map: %v", impPath, err)
 		}
+		mergeSources(root, impMap, sm, impSM, "")
 		if err := mergo.Merge(&root, impMap, mergo.WithAppendSlice); err != nil {
-			return nil, fmt.Errorf("failed to merge imported file %q: %v", impPath, err)
+			return nil, nil, fmt.Errorf("failed to merge imported file %q: %v", impPath, err)
 		}
 	}
 
 	paths, err := patternPaths(path, conf.Imports)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	for _, p := range paths {
 		if pathMap[p] {
 			continue
 		}
-		impMap, err := loadMap(p, nil)
+		impMap, impSM, err := l.loadMap(p, "", nil)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load %q to map: %v", p, err)
+			return nil, nil, fmt.Errorf("failed to load %q to map: %v", p, err)
 		}
+		mergeSources(root, impMap, sm, impSM, "")
 		if err := mergo.Merge(&root, impMap, mergo.WithAppendSlice); err != nil {
-			return nil, fmt.Errorf("failed to merge imported file %q: %v", p, err)
+			return nil, nil, fmt.Errorf("failed to merge imported file %q: %v", p, err)
 		}
 	}
-	return root, nil
+	return root, sm, nil
 }
 
 // patternPaths returns all files matching the patterns defined
@@ -257,6 +398,9 @@ func patternPaths(projectYAMLPath string, importsList []*importsItem) ([]string,
 		if len(importItem.Data) > 0 {
 			return nil, fmt.Errorf("import cannot have both pattern and data set together")
 		}
+		if isRemote(projectYAMLPath) || isRemote(importItem.Pattern) {
+			return nil, fmt.Errorf("pattern %q must match local files", importItem.Pattern)
+		}
 		if !filepath.IsAbs(joinedPath) {
 			joinedPath = filepath.Join(projectYamlFolder, importItem.Pattern)
 		}
@@ -278,6 +422,8 @@ func patternPaths(projectYAMLPath string, importsList []*importsItem) ([]string,
 	for path := range allMatches {
 		filePathList = append(filePathList, path)
 	}
+	// Sort the paths so the lists of the matched files are always merged in the same order.
+	sort.Strings(filePathList)
 	return filePathList, nil
 }
 
@@ -303,3 +449,52 @@ func LoadGeneratedFields(path string) (*AllGeneratedFields, error) {
 	}
 	return genFields, nil
 }
+
+// WriteGeneratedFields validates and writes the generated fields to the yaml file at path.
+// The file is replaced atomically so a failure never leaves it partially written.
+// Projects without any generated fields are omitted.
+func WriteGeneratedFields(path string, genFields *AllGeneratedFields) error {
+	path, err := NormalizePath(path)
+	if err != nil {
+		return fmt.Errorf("failed to normalize path %q: %v", path, err)
+	}
+
+	out := &AllGeneratedFields{
+		Projects: make(map[string]*GeneratedFields),
+		Forseti:  genFields.Forseti,
+	}
+	for id, gf := range genFields.Projects {
+		if gf != nil && !reflect.DeepEqual(*gf, GeneratedFields{}) {
+			out.Projects[id] = gf
+		}
+	}
+
+	b, err := yaml.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("failed to marshal generated fields: %v", err)
+	}
+	if err := validateGenFields(b); err != nil {
+		return fmt.Errorf("failed to validate generated fields: %v", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write generated fields to %q: %v", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %q: %v", tmp.Name(), err)
+	}
+	// -rw-r--r--
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set permissions of %q: %v", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move generated fields to %q: %v", path, err)
+	}
+	return nil
+}
@@ -17,9 +17,11 @@
 package config_test
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
@@ -176,3 +178,171 @@ projects: []
 		t.Fatalf("config differs (-got +want):\n%v", diff)
 	}
 }
+
+func TestLoadErrorLocation(t *testing.T) {
+	rootYAML := `
+imports:
+- path: project.yaml.tmpl
+  data:
+    id: foo-project
+- pattern: partial_*.yaml
+
+overall:
+  billing_account: 000000-000000-000000
+  organization_id: '12345678'
+  domain: foo.com
+  allowed_apis:
+  - foo-api.googleapis.com
+`
+	projectTmpl := `
+projects:
+- project_id: {{.id}}
+  owners_group: {{.id}}-owners@foo.com
+  auditors_group: {{.id}}-auditors@foo.com
+  audit_logs:
+    logs_bq_dataset:
+      properties:
+        name: audit_logs
+        location: US
+`
+	tests := []struct {
+		name            string
+		projectTmpl     string
+		partialProjects string
+		want            string
+	}{
+		{
+			name:        "schema_error_in_template",
+			projectTmpl: projectTmpl + "  unknown_field: true\n",
+			partialProjects: `
+projects:
+- project_id: bar-project
+`,
+			want: "project.yaml.tmpl:11:3: projects.0: Additional property unknown_field is not allowed",
+		},
+		{
+			name:        "schema_error_in_pattern_import",
+			projectTmpl: projectTmpl,
+			partialProjects: `
+projects:
+- project_id: bar-project
+  owners_group: bar-project-owners@foo.com
+`,
+			want: "partial_projects.yaml:3:1: projects.1: auditors_group is required",
+		},
+		{
+			name:        "init_error",
+			projectTmpl: projectTmpl,
+			partialProjects: `
+projects:
+- project_id: bar-project
+  owners_group: bar-project-owners@foo.com
+  auditors_group: bar-project-auditors@foo.com
+  audit_logs:
+    logs_bq_dataset:
+      properties:
+        name: audit_logs
+        location: US
+  enabled_apis:
+  - bar-api.googleapis.com
+`,
+			want: "partial_projects.yaml:11:3: failed to validate config: project \"bar-project\" wants to enable API",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatalf("ioutil.TempDir = %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			files := map[string]string{
+				"root.yaml":             rootYAML,
+				"project.yaml.tmpl":     tc.projectTmpl,
+				"partial_projects.yaml": tc.partialProjects,
+			}
+			for name, content := range files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0664); err != nil {
+					t.Fatalf("ioutil.WriteFile = %v", err)
+				}
+			}
+			gfn := filepath.Join(dir, "generated_fields.txt")
+			if _, err := os.Create(gfn); err != nil {
+				t.Fatalf("os.Create: %v", err)
+			}
+
+			_, err = config.Load(filepath.Join(dir, "root.yaml"), gfn)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("config.Load = %v, want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.yaml": "imports: [{path: b.yaml}]",
+		"b.yaml": "imports: [{path: c.yaml}]",
+		"c.yaml": "imports: [{path: b.yaml}]",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0664); err != nil {
+			t.Fatalf("ioutil.WriteFile = %v", err)
+		}
+	}
+
+	_, err = config.LoadBytes(filepath.Join(dir, "a.yaml"))
+	b, c := filepath.Join(dir, "b.yaml"), filepath.Join(dir, "c.yaml")
+	want := fmt.Sprintf("import cycle: %s -> %s -> %s", b, c, b)
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("config.LoadBytes = %v, want error containing %q", err, want)
+	}
+}
+
+func TestDiamondImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"root.yaml": `
+imports:
+- path: left.yaml
+- path: right.yaml
+overall:
+  billing_account: 000000-000000-000000
+  organization_id: '12345678'
+  domain: foo.com
+projects: []
+`,
+		"left.yaml":  "imports: [{path: shared.yaml}]",
+		"right.yaml": "imports: [{pattern: 'shared*.yaml'}]",
+		"shared.yaml": `
+overall:
+  allowed_apis:
+  - foo-api.googleapis.com
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0664); err != nil {
+			t.Fatalf("ioutil.WriteFile = %v", err)
+		}
+	}
+
+	b, err := config.LoadBytes(filepath.Join(dir, "root.yaml"))
+	if err != nil {
+		t.Fatalf("config.LoadBytes = %v", err)
+	}
+	if n := strings.Count(string(b), "foo-api.googleapis.com"); n != 1 {
+		t.Errorf("shared allowed API merged %d times, want 1:\n%s", n, b)
+	}
+}
@@ -14,6 +14,10 @@
 
 package config
 
+import (
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
+)
+
 // LogSink wraps a deployment manager Log Sink.
 // Note: log sinks cannot be created by users, so do not implement custom json marshallers.
 // TODO: see if we can use the CFT log sink template.
@@ -43,3 +47,13 @@ func (l *LogSink) Name() string {
 func (*LogSink) DeploymentManagerType() string {
 	return "logging.v2.sink"
 }
+
+// TerraformResources returns the terraform resources of this sink.
+func (l *LogSink) TerraformResources() []tfconfig.Resource {
+	return []tfconfig.Resource{&tfconfig.LoggingProjectSink{
+		Name:                 l.Name(),
+		Destination:          l.Destination,
+		Filter:               l.Filter,
+		UniqueWriterIdentity: l.UniqueWriterIdentity,
+	}}
+}
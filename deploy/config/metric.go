@@ -16,6 +16,8 @@ package config
 
 import (
 	"errors"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
 )
 
 var (
@@ -85,3 +87,30 @@ func (m *Metric) DeploymentManagerType() string {
 func (m *Metric) Dependencies() []string {
 	return m.dependencies
 }
+
+// TerraformResources returns the terraform resources of this metric.
+func (m *Metric) TerraformResources() []tfconfig.Resource {
+	tm := &tfconfig.LoggingMetric{
+		Name:        m.Name(),
+		Description: m.Description,
+		Filter:      m.Filter,
+		MetricDescriptor: &tfconfig.MetricDescriptor{
+			MetricKind: m.Descriptor.MetricKind,
+			ValueType:  m.Descriptor.ValueType,
+			Unit:       m.Descriptor.Unit,
+		},
+		LabelExtractors: m.LabelExtractors,
+	}
+	for _, l := range m.Descriptor.Labels {
+		tm.MetricDescriptor.Labels = append(tm.MetricDescriptor.Labels, &tfconfig.Label{
+			Key:         l.Key,
+			ValueType:   l.ValueType,
+			Description: l.Description,
+		})
+	}
+	// Metrics only depend on the buckets whose access they count.
+	for _, d := range m.dependencies {
+		tm.DependsOn = append(tm.DependsOn, "google_storage_bucket."+d)
+	}
+	return []tfconfig.Resource{tm}
+}
@@ -0,0 +1,321 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+)
+
+// patchDirective is the key of the merge directive of a map or list element in an overlay.
+// Overlays are partial configs applied to the merged config, e.g. to derive a prod config from a base config:
+//   - maps are patched: their keys are set to the values in the overlay, patching maps and lists recursively;
+//   - list elements are matched by their project_id, name or properties.name: matched elements are patched and
+//     others appended;
+//   - {$patch: replace} in a map replaces the map, and in a matched list element replaces the element;
+//   - {$patch: delete} as the value of a key deletes the key, and in a matched list element deletes the element;
+//   - {$patch: append} in a list element appends the element even if it matches another;
+//   - {$patch: patch} in a list element requires the element to match another;
+//   - a {$patch: replace} element in a list replaces the list with the other elements of the list.
+const patchDirective = "$patch"
+
+// Merge directives.
+const (
+	patchMerge   = "patch"
+	patchReplace = "replace"
+	patchDelete  = "delete"
+	patchAppend  = "append"
+)
+
+// overlaysKey is the key of the overlays listed in a config, applied before the overlays in the load options.
+const overlaysKey = "overlays"
+
+// applyOverlays applies the overlays listed in the merged config and then the overlays of the load options to the
+// config, and returns the resulting config. Overlays listed in a config are relative to it.
+func (l *loader) applyOverlays(root map[string]interface{}, sm sourceMap) (map[string]interface{}, error) {
+	var paths []string
+	if v, ok := root[overlaysKey]; ok {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must be a list of paths", overlaysKey)
+		}
+		for i, e := range list {
+			p, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list of paths, got %v", overlaysKey, e)
+			}
+			// The overlay is relative to the config it was listed in, which may be an import.
+			file := sm[""].file
+			if pos, ok := sm[joinPath(overlaysKey, strconv.Itoa(i))]; ok {
+				file = pos.file
+			}
+			p, err := resolveImport(file, p)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, p)
+		}
+		// Overlays are resolved, so they are left out of the merged config.
+		delete(root, overlaysKey)
+		removeSources(sm, overlaysKey)
+	}
+	for _, p := range l.opts.Overlays {
+		p, err := NormalizePath(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to normalize path %q: %v", p, err)
+		}
+		paths = append(paths, p)
+	}
+
+	for _, p := range paths {
+		b, err := l.opts.read(p, "")
+		if err != nil {
+			return nil, err
+		}
+		overlay := make(map[string]interface{})
+		if err := yaml.Unmarshal(b, &overlay); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal overlay at path %q: %v", p, err)
+		}
+		o := &overlayer{sm: sm, osm: scanSources(p, b)}
+		v, err := o.merge(root, overlay, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply overlay %q: %v", p, err)
+		}
+		root = v.(map[string]interface{})
+	}
+	return root, nil
+}
+
+// overlayer applies an overlay and keeps the source map of the config up to date: values set by the overlay are
+// located in the overlay.
+type overlayer struct {
+	sm, osm sourceMap
+}
+
+// errorf returns an error prefixed with where the value at the overlay path was written.
+func (o *overlayer) errorf(op, format string, a ...interface{}) error {
+	err := fmt.Errorf(format, a...)
+	if loc, ok := o.osm.locate(op); ok {
+		return fmt.Errorf("%s: %v", loc, err)
+	}
+	return err
+}
+
+// directive returns the merge directive of the overlay value at the overlay path, if any.
+func (o *overlayer) directive(v interface{}, op string) (string, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+	d, ok := m[patchDirective]
+	if !ok {
+		return "", nil
+	}
+	switch d {
+	case patchMerge, patchReplace, patchDelete, patchAppend:
+		return d.(string), nil
+	}
+	return "", o.errorf(joinPath(op, patchDirective), "unknown merge directive %v, want one of %s, %s, %s or %s", d, patchMerge, patchReplace, patchDelete, patchAppend)
+}
+
+// withoutDirective returns the overlay value without its merge directive.
+func withoutDirective(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	if _, ok := m[patchDirective]; !ok {
+		return m
+	}
+	c := make(map[string]interface{}, len(m)-1)
+	for k, v := range m {
+		if k != patchDirective {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+// replace sets the value at the base path to the overlay value at the overlay path.
+func (o *overlayer) replace(v interface{}, bp, op string) interface{} {
+	removeSources(o.sm, bp)
+	copySources(o.sm, o.osm, op, bp, 0)
+	return withoutDirective(v)
+}
+
+// merge applies the overlay value at the overlay path op to the base value at the base path bp and returns the
+// result.
+func (o *overlayer) merge(base, overlay interface{}, bp, op string) (interface{}, error) {
+	switch ov := overlay.(type) {
+	case map[string]interface{}:
+		d, err := o.directive(ov, op)
+		if err != nil {
+			return nil, err
+		}
+		bm, ok := base.(map[string]interface{})
+		if d == patchReplace || !ok {
+			return o.replace(ov, bp, op), nil
+		}
+		for k, v := range ov {
+			if k == patchDirective {
+				continue
+			}
+			kbp, kop := joinPath(bp, k), joinPath(op, k)
+			vd, err := o.directive(v, kop)
+			if err != nil {
+				return nil, err
+			}
+			if vd == patchDelete {
+				delete(bm, k)
+				removeSources(o.sm, kbp)
+				continue
+			}
+			nv, err := o.merge(bm[k], v, kbp, kop)
+			if err != nil {
+				return nil, err
+			}
+			bm[k] = nv
+		}
+		return bm, nil
+	case []interface{}:
+		bl, ok := base.([]interface{})
+		if !ok {
+			removeSources(o.sm, bp)
+			if pos, ok := o.osm[op]; ok {
+				o.sm[bp] = pos
+			}
+		}
+		return o.mergeList(bl, ov, bp, op)
+	default:
+		return o.replace(overlay, bp, op), nil
+	}
+}
+
+// listSource is where an element of a merged list comes from.
+type listSource struct {
+	// base is the index of the element in the base list, or -1 if the element is from the overlay.
+	base int
+	// overlay is the index of the overlay element replacing, patching or appended as the element, or -1.
+	overlay int
+	patch   bool
+	deleted bool
+}
+
+// mergeList applies the overlay list at the overlay path op to the base list at the base path bp and returns the
+// result.
+func (o *overlayer) mergeList(base, overlay []interface{}, bp, op string) ([]interface{}, error) {
+	var sources []*listSource
+	var elems []interface{}
+	for _, e := range overlay {
+		if m, ok := e.(map[string]interface{}); ok && len(m) == 1 && m[patchDirective] == patchReplace {
+			// The overlay replaces the list, so the base elements are left out.
+			base = nil
+		}
+	}
+	keys := make(map[string]int)
+	for i, e := range base {
+		sources = append(sources, &listSource{base: i, overlay: -1})
+		elems = append(elems, e)
+		if k, ok := elementKey(e); ok {
+			keys[k] = i
+		}
+	}
+
+	for i, e := range overlay {
+		ep := joinPath(op, strconv.Itoa(i))
+		d, err := o.directive(e, ep)
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := e.(map[string]interface{}); ok && len(m) == 1 && d == patchReplace {
+			continue
+		}
+		k, keyed := elementKey(e)
+		j, found := keys[k]
+		if !keyed {
+			found = false
+		}
+		switch {
+		case d == patchAppend || d == "" && !found:
+			sources = append(sources, &listSource{base: -1, overlay: i})
+			elems = append(elems, withoutDirective(e))
+		case !found:
+			return nil, o.errorf(ep, "no element to %s in %s", d, bp)
+		case d == patchDelete:
+			sources[j].deleted = true
+		case d == patchReplace:
+			sources[j].base, sources[j].overlay = -1, i
+			elems[j] = withoutDirective(e)
+		default:
+			sources[j].overlay, sources[j].patch = i, true
+		}
+	}
+
+	// Elements may be deleted, so the positions of the elements are moved to their new indexes.
+	old := make(sourceMap)
+	copySources(old, o.sm, bp, bp, 0)
+	for p := range old {
+		if p != bp {
+			delete(o.sm, p)
+		}
+	}
+	var merged []interface{}
+	for j, s := range sources {
+		if s.deleted {
+			continue
+		}
+		ebp := joinPath(bp, strconv.Itoa(len(merged)))
+		eop := joinPath(op, strconv.Itoa(s.overlay))
+		e := elems[j]
+		if s.base >= 0 {
+			copySources(o.sm, old, joinPath(bp, strconv.Itoa(s.base)), ebp, 0)
+		} else {
+			copySources(o.sm, o.osm, eop, ebp, 0)
+		}
+		if s.patch {
+			var err error
+			if e, err = o.merge(e, overlay[s.overlay], ebp, eop); err != nil {
+				return nil, err
+			}
+		}
+		merged = append(merged, e)
+	}
+	return merged, nil
+}
+
+// elementKey returns the key matching the list element to an overlay element: the project_id of projects, or the
+// name or properties.name of resources.
+func elementKey(e interface{}) (string, bool) {
+	m, ok := e.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	if id, ok := m["project_id"].(string); ok {
+		return id, true
+	}
+	if n, ok := m["name"].(string); ok {
+		return n, true
+	}
+	if props, ok := m["properties"].(map[string]interface{}); ok {
+		if n, ok := props["name"].(string); ok {
+			return n, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+)
+
+const overlayBaseYAML = `
+overlays:
+- prod.yaml
+
+overall:
+  billing_account: 000000-000000-000000
+  organization_id: '12345678'
+  domain: foo.com
+  allowed_apis:
+  - foo-api.googleapis.com
+  - bar-api.googleapis.com
+
+projects:
+- project_id: foo-project
+  owners_group: foo-project-owners@foo.com
+  auditors_group: foo-project-auditors@foo.com
+  audit_logs:
+    logs_bq_dataset:
+      properties:
+        name: audit_logs
+        location: US
+  resources:
+    bq_datasets:
+    - properties:
+        name: foo_dataset
+        location: US
+    - properties:
+        name: bar_dataset
+        location: US
+- project_id: bar-project
+  owners_group: bar-project-owners@foo.com
+  auditors_group: bar-project-auditors@foo.com
+  audit_logs:
+    logs_bq_dataset:
+      properties:
+        name: audit_logs
+        location: US
+`
+
+func TestOverlays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"base.yaml": overlayBaseYAML,
+		"prod.yaml": `
+overall:
+  allowed_apis:
+  - $patch: replace
+  - foo-api.googleapis.com
+projects:
+- project_id: foo-project
+  owners_group: foo-project-prod-owners@foo.com
+  resources:
+    bq_datasets:
+    - properties:
+        name: bar_dataset
+      $patch: delete
+    - properties:
+        name: foo_dataset
+        location: EU
+      $patch: replace
+- project_id: bar-project
+  $patch: delete
+`,
+		"extra.yaml": `
+projects:
+- project_id: baz-project
+  owners_group: baz-project-owners@foo.com
+  auditors_group: baz-project-auditors@foo.com
+  audit_logs:
+    logs_bq_dataset:
+      properties:
+        name: audit_logs
+        location: US
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0664); err != nil {
+			t.Fatalf("ioutil.WriteFile = %v", err)
+		}
+	}
+
+	opts := &config.LoadOptions{Overlays: []string{filepath.Join(dir, "extra.yaml")}}
+	b, err := config.LoadBytesWithOptions(filepath.Join(dir, "base.yaml"), opts)
+	if err != nil {
+		t.Fatalf("LoadBytesWithOptions = %v", err)
+	}
+	var got interface{}
+	if err := yaml.Unmarshal(b, &got); err != nil {
+		t.Fatalf("yaml.Unmarshal = %v", err)
+	}
+
+	var want interface{}
+	wantYAML := `
+overall:
+  billing_account: 000000-000000-000000
+  organization_id: '12345678'
+  domain: foo.com
+  allowed_apis:
+  - foo-api.googleapis.com
+projects:
+- project_id: foo-project
+  owners_group: foo-project-prod-owners@foo.com
+  auditors_group: foo-project-auditors@foo.com
+  audit_logs:
+    logs_bq_dataset:
+      properties:
+        name: audit_logs
+        location: US
+  resources:
+    bq_datasets:
+    - properties:
+        name: foo_dataset
+        location: EU
+- project_id: baz-project
+  owners_group: baz-project-owners@foo.com
+  auditors_group: baz-project-auditors@foo.com
+  audit_logs:
+    logs_bq_dataset:
+      properties:
+        name: audit_logs
+        location: US
+`
+	if err := yaml.Unmarshal([]byte(wantYAML), &want); err != nil {
+		t.Fatalf("yaml.Unmarshal = %v", err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("config differs (-got +want):\n%v", diff)
+	}
+}
+
+func TestOverlaysErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		overlay string
+		want    string
+	}{
+		{
+			name: "patch_missing_project",
+			overlay: `
+projects:
+- project_id: missing-project
+  $patch: patch
+`,
+			want: "prod.yaml:3:1: no element to patch in projects",
+		},
+		{
+			name: "unknown_directive",
+			overlay: `
+overall:
+  $patch: remove
+`,
+			want: "prod.yaml:3:3: unknown merge directive remove",
+		},
+		{
+			name: "invalid_result",
+			overlay: `
+projects:
+- project_id: foo-project
+  owners_groups: foo-project-prod-owners@foo.com
+`,
+			want: "prod.yaml:4:3: projects.0: Additional property owners_groups is not allowed",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatalf("ioutil.TempDir = %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			files := map[string]string{
+				"base.yaml": overlayBaseYAML,
+				"prod.yaml": tc.overlay,
+			}
+			for name, content := range files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0664); err != nil {
+					t.Fatalf("ioutil.WriteFile = %v", err)
+				}
+			}
+
+			_, err = config.LoadBytes(filepath.Join(dir, "base.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("LoadBytes = %v, want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
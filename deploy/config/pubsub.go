@@ -18,6 +18,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
 )
 
 // Pubsub represents a GCP pubsub channel resource.
@@ -29,13 +31,17 @@ type Pubsub struct {
 // PubsubProperties represents a partial CFT pubsub implementation.
 type PubsubProperties struct {
 	TopicName     string          `json:"topic"`
+	Bindings      []Binding       `json:"accessControl,omitempty"`
 	Subscriptions []*Subscription `json:"subscriptions"`
 }
 
 // Subscription represents a partial subscription impementation.
 type Subscription struct {
-	Bindings []Binding `json:"accessControl,omitempty"`
-	raw      json.RawMessage
+	SubscriptionName   string    `json:"name,omitempty"`
+	AckDeadlineSeconds int       `json:"ackDeadlineSeconds,omitempty"`
+	PushEndpoint       string    `json:"pushEndpoint,omitempty"`
+	Bindings           []Binding `json:"accessControl,omitempty"`
+	raw                json.RawMessage
 }
 
 // Init initializes a new pubsub with the given project.
@@ -100,3 +106,30 @@ func (s *Subscription) UnmarshalJSON(data []byte) error {
 func (s *Subscription) MarshalJSON() ([]byte, error) {
 	return interfacePair{s.raw, aliasSubscription(*s)}.MarshalJSON()
 }
+
+// TerraformResources returns the terraform resources of this topic, its subscriptions and their bindings.
+func (p *Pubsub) TerraformResources() []tfconfig.Resource {
+	topic := &tfconfig.PubsubTopic{Name: p.Name()}
+	rs := []tfconfig.Resource{topic}
+	for _, b := range p.Bindings {
+		if len(b.Members) == 0 {
+			continue
+		}
+		rs = append(rs, tfconfig.NewPubsubTopicIAMBinding(topic, b.Role, b.Members))
+	}
+	for _, s := range p.Subscriptions {
+		ts := tfconfig.NewPubsubSubscription(s.SubscriptionName, topic)
+		ts.AckDeadlineSeconds = s.AckDeadlineSeconds
+		if s.PushEndpoint != "" {
+			ts.PushConfig = &tfconfig.PushConfig{PushEndpoint: s.PushEndpoint}
+		}
+		rs = append(rs, ts)
+		for _, b := range s.Bindings {
+			if len(b.Members) == 0 {
+				continue
+			}
+			rs = append(rs, tfconfig.NewPubsubSubscriptionIAMBinding(ts, b.Role, b.Members))
+		}
+	}
+	return rs
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+)
+
+// GCSReader reads objects from GCS.
+type GCSReader interface {
+	// ReadObject returns the content of the object at the URL, e.g. gs://my-bucket/base.yaml.
+	ReadObject(url string) ([]byte, error)
+}
+
+// GSUtil is the GCSReader that reads objects by running gsutil.
+type GSUtil struct {
+	Runner runner.Runner
+}
+
+// ReadObject returns the content of the object at the URL.
+func (g *GSUtil) ReadObject(url string) ([]byte, error) {
+	return g.Runner.CmdOutput(exec.Command("gsutil", "cat", url))
+}
+
+// isRemote returns whether the path is the URL of a remote config.
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, "gs://") || strings.HasPrefix(path, "https://")
+}
+
+// resolveImport returns the path of the import imported by the config at path. Imports of remote configs are
+// resolved against their URL, e.g. /shared/base.yaml against the same host or bucket, and must not be local.
+func resolveImport(path, imp string) (string, error) {
+	if isRemote(imp) {
+		return imp, nil
+	}
+	if !isRemote(path) {
+		if filepath.IsAbs(imp) {
+			return imp, nil
+		}
+		return filepath.Join(filepath.Dir(path), imp), nil
+	}
+	base, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL %q: %v", path, err)
+	}
+	ref, err := url.Parse(filepath.ToSlash(imp))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse import %q: %v", imp, err)
+	}
+	// Local files, e.g. file:// URLs or C:\ paths, must not be read on behalf of remote configs.
+	if ref.Scheme != "" || filepath.VolumeName(imp) != "" {
+		return "", fmt.Errorf("remote config %q must not import local config %q", path, imp)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func (o *LoadOptions) cacheDir() (string, error) {
+	if o.CacheDir != "" {
+		return o.CacheDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user cache dir: %v", err)
+	}
+	return filepath.Join(dir, "healthcare-deploy", "imports"), nil
+}
+
+// read returns the content of the config at the local path or URL. If sum is set, the content must have the
+// sha256 checksum.
+// Remote configs are cached. Pinned configs are read from the cache if cached, others are fetched again unless
+// offline.
+func (o *LoadOptions) read(path, sum string) ([]byte, error) {
+	if !isRemote(path) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file at path %q: %v", path, err)
+		}
+		return b, checkSum(path, b, sum)
+	}
+
+	dir, err := o.cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	cached := filepath.Join(dir, fmt.Sprintf("%x", sha256.Sum256([]byte(path))))
+	if o.Offline || sum != "" {
+		b, err := ioutil.ReadFile(cached)
+		switch {
+		case err == nil && o.Offline:
+			return b, checkSum(path, b, sum)
+		case err == nil && checkSum(path, b, sum) == nil:
+			// Pinned configs cannot change, so the cached copy is used.
+			return b, nil
+		case err != nil && !os.IsNotExist(err):
+			return nil, fmt.Errorf("failed to read cached config %q: %v", cached, err)
+		case o.Offline:
+			return nil, fmt.Errorf("remote config %q is not cached, load it once without --offline", path)
+		}
+	}
+
+	b, err := o.fetch(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSum(path, b, sum); err != nil {
+		return nil, err
+	}
+	if err := writeCache(cached, b); err != nil {
+		return nil, fmt.Errorf("failed to cache remote config %q: %v", path, err)
+	}
+	return b, nil
+}
+
+// fetch returns the content of the remote config at the URL.
+func (o *LoadOptions) fetch(u string) ([]byte, error) {
+	if strings.HasPrefix(u, "gs://") {
+		gcs := o.GCS
+		if gcs == nil {
+			gcs = &GSUtil{Runner: &runner.Default{}}
+		}
+		b, err := gcs.ReadObject(u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q from GCS: %v", u, err)
+		}
+		return b, nil
+	}
+
+	c := o.HTTPClient
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Get(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %q: %v", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %q: %v", u, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response of %q: %v", u, err)
+	}
+	return b, nil
+}
+
+// checkSum returns an error if sum is set and is not the sha256 checksum of the config at path.
+func checkSum(path string, b []byte, sum string) error {
+	if sum == "" {
+		return nil
+	}
+	if got := fmt.Sprintf("%x", sha256.Sum256(b)); got != strings.ToLower(sum) {
+		return fmt.Errorf("sha256 of config %q is %s, want %s", path, got, sum)
+	}
+	return nil
+}
+
+// writeCache atomically writes the remote config to the cache file.
+func writeCache(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
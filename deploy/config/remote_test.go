@@ -0,0 +1,244 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+)
+
+// fakeGCS is a GCSReader of objects keyed by URL.
+type fakeGCS map[string]string
+
+func (f fakeGCS) ReadObject(url string) ([]byte, error) {
+	o, ok := f[url]
+	if !ok {
+		return nil, fmt.Errorf("object %q not found", url)
+	}
+	return []byte(o), nil
+}
+
+const overallYAML = `
+overall:
+  billing_account: 000000-000000-000000
+  organization_id: '12345678'
+  domain: foo.com
+`
+
+// remoteImportsFixture serves overall.yaml over https and projects.yaml, importing allowed_apis.yaml, in GCS.
+type remoteImportsFixture struct {
+	dir     string
+	server  *httptest.Server
+	overall string
+	gcs     fakeGCS
+}
+
+func newRemoteImportsFixture(t *testing.T) *remoteImportsFixture {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir = %v", err)
+	}
+	f := &remoteImportsFixture{
+		dir:     dir,
+		overall: overallYAML,
+		gcs: fakeGCS{
+			"gs://my-bucket/configs/projects.yaml": `
+imports:
+- path: allowed_apis.yaml
+projects: []
+`,
+			"gs://my-bucket/configs/allowed_apis.yaml": `
+overall:
+  allowed_apis:
+  - foo-api.googleapis.com
+`,
+		},
+	}
+	f.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/overall.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, f.overall)
+	}))
+	return f
+}
+
+func (f *remoteImportsFixture) close() {
+	f.server.Close()
+	os.RemoveAll(f.dir)
+}
+
+// writeRoot writes the root config importing the remote configs, pinning overall.yaml to the sum if set.
+func (f *remoteImportsFixture) writeRoot(t *testing.T, sum string) string {
+	t.Helper()
+	root := fmt.Sprintf(`
+imports:
+- path: %s/overall.yaml
+  sha256: '%s'
+- path: gs://my-bucket/configs/projects.yaml
+`, f.server.URL, sum)
+	if sum == "" {
+		root = strings.Replace(root, "  sha256: ''\n", "", 1)
+	}
+	path := filepath.Join(f.dir, "root.yaml")
+	if err := ioutil.WriteFile(path, []byte(root), 0664); err != nil {
+		t.Fatalf("ioutil.WriteFile = %v", err)
+	}
+	return path
+}
+
+func (f *remoteImportsFixture) opts(offline bool) *config.LoadOptions {
+	return &config.LoadOptions{
+		CacheDir:   filepath.Join(f.dir, "cache"),
+		Offline:    offline,
+		GCS:        f.gcs,
+		HTTPClient: f.server.Client(),
+	}
+}
+
+func TestLoadRemoteImports(t *testing.T) {
+	f := newRemoteImportsFixture(t)
+	defer f.close()
+	path := f.writeRoot(t, "")
+
+	if _, err := config.LoadBytesWithOptions(path, f.opts(true)); err == nil {
+		t.Fatal("LoadBytesWithOptions offline before caching = nil, want error")
+	}
+
+	b, err := config.LoadBytesWithOptions(path, f.opts(false))
+	if err != nil {
+		t.Fatalf("LoadBytesWithOptions = %v", err)
+	}
+	for _, want := range []string{"domain: foo.com", "foo-api.googleapis.com"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("merged config does not contain %q:\n%s", want, b)
+		}
+	}
+
+	// Offline loads only read the cache.
+	f.server.Close()
+	for k := range f.gcs {
+		delete(f.gcs, k)
+	}
+	offline, err := config.LoadBytesWithOptions(path, f.opts(true))
+	if err != nil {
+		t.Fatalf("LoadBytesWithOptions offline = %v", err)
+	}
+	if string(offline) != string(b) {
+		t.Errorf("offline config differs:\n%s\nwant:\n%s", offline, b)
+	}
+	if _, err := config.LoadBytesWithOptions(path, f.opts(false)); err == nil {
+		t.Error("LoadBytesWithOptions online with unreachable imports = nil, want error")
+	}
+}
+
+func TestLoadRemoteImportsPinned(t *testing.T) {
+	f := newRemoteImportsFixture(t)
+	defer f.close()
+
+	if _, err := config.LoadBytesWithOptions(f.writeRoot(t, strings.Repeat("0", 64)), f.opts(false)); err == nil || !strings.Contains(err.Error(), "sha256") {
+		t.Fatalf("LoadBytesWithOptions with wrong sha256 = %v, want sha256 error", err)
+	}
+
+	path := f.writeRoot(t, fmt.Sprintf("%x", sha256.Sum256([]byte(overallYAML))))
+	if _, err := config.LoadBytesWithOptions(path, f.opts(false)); err != nil {
+		t.Fatalf("LoadBytesWithOptions = %v", err)
+	}
+
+	// Pinned imports are read from the cache once cached.
+	f.overall = strings.Replace(overallYAML, "foo.com", "bar.com", 1)
+	b, err := config.LoadBytesWithOptions(path, f.opts(false))
+	if err != nil {
+		t.Fatalf("LoadBytesWithOptions = %v", err)
+	}
+	if !strings.Contains(string(b), "domain: foo.com") {
+		t.Errorf("merged config does not contain the pinned domain:\n%s", b)
+	}
+}
+
+func TestLoadRemoteImportsConflictingPins(t *testing.T) {
+	f := newRemoteImportsFixture(t)
+	defer f.close()
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte(overallYAML)))
+	wrong := strings.Repeat("0", 64)
+
+	tests := []struct {
+		name  string
+		first string
+	}{
+		{name: "pinned", first: "  sha256: '" + sum + "'\n"},
+		{name: "unpinned", first: ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := fmt.Sprintf(`
+imports:
+- path: %s/overall.yaml
+%s- path: %s/overall.yaml
+  sha256: '%s'
+`, f.server.URL, tc.first, f.server.URL, wrong)
+			path := filepath.Join(f.dir, "root.yaml")
+			if err := ioutil.WriteFile(path, []byte(root), 0664); err != nil {
+				t.Fatalf("ioutil.WriteFile = %v", err)
+			}
+			if _, err := config.LoadBytesWithOptions(path, f.opts(false)); err == nil || !strings.Contains(err.Error(), "sha256") {
+				t.Fatalf("LoadBytesWithOptions with conflicting sha256 = %v, want sha256 error", err)
+			}
+		})
+	}
+}
+
+func TestLoadRemoteAbsoluteImports(t *testing.T) {
+	f := newRemoteImportsFixture(t)
+	defer f.close()
+	f.gcs["gs://my-bucket/configs/projects.yaml"] = `
+imports:
+- path: /shared/allowed_apis.yaml
+projects: []
+`
+	f.gcs["gs://my-bucket/shared/allowed_apis.yaml"] = f.gcs["gs://my-bucket/configs/allowed_apis.yaml"]
+	path := f.writeRoot(t, "")
+
+	// Absolute imports of remote configs are resolved against their bucket, not read from the local machine.
+	b, err := config.LoadBytesWithOptions(path, f.opts(false))
+	if err != nil {
+		t.Fatalf("LoadBytesWithOptions = %v", err)
+	}
+	if !strings.Contains(string(b), "foo-api.googleapis.com") {
+		t.Errorf("merged config does not contain the imported allowed APIs:\n%s", b)
+	}
+
+	f.gcs["gs://my-bucket/configs/projects.yaml"] = `
+imports:
+- path: file:///shared/allowed_apis.yaml
+projects: []
+`
+	if _, err := config.LoadBytesWithOptions(path, f.opts(false)); err == nil || !strings.Contains(err.Error(), "must not import local config") {
+		t.Errorf("LoadBytesWithOptions with local import in remote config = %v, want local import error", err)
+	}
+}
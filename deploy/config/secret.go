@@ -0,0 +1,93 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
+	"github.com/ghodss/yaml"
+)
+
+// secretProviders returns the providers of the secrets referenced in the config, keyed by name.
+func (o *LoadOptions) secretProviders() map[string]secrets.Provider {
+	ps := map[string]secrets.Provider{
+		secrets.EnvProvider:           secrets.Env{},
+		secrets.SecretManagerProvider: &secrets.SecretManager{Client: &secrets.GCloudSecretManager{Runner: &runner.Default{}}},
+	}
+	if o.SecretsFile != "" {
+		ps[secrets.FileProvider] = &secrets.File{Path: o.SecretsFile, KeyPath: o.SecretsKeyFile}
+	}
+	for name, p := range o.SecretProviders {
+		ps[name] = p
+	}
+	return ps
+}
+
+// resolveSecrets replaces the references to secrets in the string values of the merged config with their values.
+func resolveSecrets(b []byte, providers map[string]secrets.Provider) ([]byte, error) {
+	if !secrets.HasReference(string(b)) {
+		return b, nil
+	}
+	var m interface{}
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %v", err)
+	}
+	m, err := resolveValue(m, "", providers)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(m)
+}
+
+// resolveValue resolves the references to secrets in the value at the path.
+func resolveValue(v interface{}, path string, providers map[string]secrets.Provider) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		s, err := secrets.Resolve(t, providers)
+		if err != nil {
+			return nil, &FieldError{Path: path, Err: err}
+		}
+		return s, nil
+	case map[string]interface{}:
+		// Resolve in order so the first error is always the same.
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			r, err := resolveValue(t[k], joinPath(path, k), providers)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = r
+		}
+	case []interface{}:
+		for i, e := range t {
+			r, err := resolveValue(e, joinPath(path, strconv.Itoa(i)), providers)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = r
+		}
+	}
+	return v, nil
+}
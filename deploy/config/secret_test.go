@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/secrets"
+)
+
+// fakeSecrets is a secret Provider of secrets keyed by path.
+type fakeSecrets map[string]string
+
+func (f fakeSecrets) Get(path string) (string, error) {
+	v, ok := f[path]
+	if !ok {
+		return "", fmt.Errorf("secret %q not found", path)
+	}
+	return v, nil
+}
+
+func TestLoadSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "root.yaml")
+	content := `
+overall:
+  billing_account: 000000-000000-000000
+  organization_id: '12345678'
+  domain: foo.com
+
+projects:
+- project_id: foo-project
+  owners_group: foo-project-owners@foo.com
+  auditors_group: foo-project-auditors@foo.com
+  stackdriver_alert_email: ${secret:fake/alert_email}
+  audit_logs:
+    logs_bq_dataset:
+      properties:
+        name: audit_logs
+        location: US
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0664); err != nil {
+		t.Fatalf("ioutil.WriteFile = %v", err)
+	}
+	gfn := filepath.Join(dir, "generated_fields.txt")
+	if _, err := os.Create(gfn); err != nil {
+		t.Fatalf("os.Create: %v", err)
+	}
+
+	opts := &config.LoadOptions{SecretProviders: map[string]secrets.Provider{
+		"fake": fakeSecrets{"alert_email": "alerts@foo.com"},
+	}}
+	conf, err := config.LoadWithOptions(path, gfn, opts)
+	if err != nil {
+		t.Fatalf("config.LoadWithOptions = %v", err)
+	}
+	if got, want := conf.Projects[0].StackdriverAlertEmail, "alerts@foo.com"; got != want {
+		t.Errorf("stackdriver alert email = %q, want %q", got, want)
+	}
+
+	// Unresolved references are reported where they were written.
+	opts.SecretProviders["fake"] = fakeSecrets{}
+	_, err = config.LoadWithOptions(path, gfn, opts)
+	if want := "root.yaml:11:3: failed to get secret"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("config.LoadWithOptions = %v, want error containing %q", err, want)
+	}
+}
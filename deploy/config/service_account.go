@@ -19,6 +19,8 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config/tfconfig"
 )
 
 // TODO Add service accounts into config.go
@@ -71,3 +73,11 @@ func (sa *ServiceAccount) UnmarshalJSON(data []byte) error {
 func (sa *ServiceAccount) MarshalJSON() ([]byte, error) {
 	return interfacePair{sa.raw, aliasServiceAccount(*sa)}.MarshalJSON()
 }
+
+// TerraformResources returns the terraform resources of this service account.
+func (sa *ServiceAccount) TerraformResources() []tfconfig.Resource {
+	return []tfconfig.Resource{&tfconfig.ServiceAccount{
+		AccountID:   sa.AccountID,
+		DisplayName: sa.DisplayName,
+	}}
+}
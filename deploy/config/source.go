@@ -0,0 +1,326 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FieldError is an error of the value at a path in the merged config, e.g. projects.3.audit_logs.
+// Errors loading a config report where the value was written.
+type FieldError struct {
+	Path string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// wrapFieldError prefixes the message of the error with msg, keeping the path of a *FieldError.
+func wrapFieldError(err error, msg string) error {
+	if fe, ok := err.(*FieldError); ok {
+		return &FieldError{Path: fe.Path, Err: fmt.Errorf("%s: %v", msg, fe.Err)}
+	}
+	return fmt.Errorf("%s: %v", msg, err)
+}
+
+// position is where a value was written in a config file.
+type position struct {
+	file      string
+	line, col int
+}
+
+// sourceMap maps the paths of keys and list elements in a config, e.g. projects.3.audit_logs, to where they were
+// written. The empty path is the start of the root config.
+type sourceMap map[string]position
+
+// keyRE matches a mapping key at the start of a line, quoted or plain, and the rest of the line after the colon.
+var keyRE = regexp.MustCompile(`^("(?:[^"\\]|\\.)*"|'[^']*'|[^\s#'"\-\[\{][^#]*?|-[^\s#][^#]*?)\s*:(?:\s+(.*))?$`)
+
+// scanSources returns the positions of the keys and list elements of the YAML config in the file.
+// Configs are expected in the block style. Values written in the flow style, e.g. [a, b], are located at their key.
+func scanSources(file string, b []byte) sourceMap {
+	sm := sourceMap{"": {file: file, line: 1, col: 1}}
+	s := &sourceScanner{file: file, sm: sm, frames: []*sourceFrame{{col: 0}}}
+	lines := strings.Split(string(b), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t\r")
+		content := strings.TrimLeft(line, " ")
+		if content == "" || strings.HasPrefix(content, "#") || content == "---" || content == "..." {
+			continue
+		}
+		col := len(line) - len(content)
+		skip := s.scan(i+1, col, content)
+		// Skip the lines of block scalars and multi line flow values, which hold no keys.
+		for ; skip != nil && i+1 < len(lines) && skip(lines[i+1]); i++ {
+		}
+	}
+	return sm
+}
+
+// sourceFrame is a mapping or sequence being scanned.
+type sourceFrame struct {
+	col  int
+	path string
+	seq  bool
+	next int
+}
+
+type sourceScanner struct {
+	file   string
+	sm     sourceMap
+	frames []*sourceFrame
+	// pending is the path of the last key or list element without an inline value, whose value follows in the next
+	// lines.
+	pending string
+}
+
+// scan records the positions on the line with content starting at the 0-based col. It returns a func reporting
+// whether the next lines continue the value on this line and must be skipped, or nil.
+func (s *sourceScanner) scan(line, col int, content string) func(string) bool {
+	for len(s.frames) > 1 && s.frames[len(s.frames)-1].col > col {
+		s.frames = s.frames[:len(s.frames)-1]
+	}
+	top := s.frames[len(s.frames)-1]
+
+	if content == "-" || strings.HasPrefix(content, "- ") {
+		if !top.seq || top.col != col {
+			// The sequence is the value of the pending key, which may be as indented as the sequence.
+			top = &sourceFrame{col: col, path: s.pending, seq: true}
+			s.frames = append(s.frames, top)
+		}
+		path := joinPath(top.path, strconv.Itoa(top.next))
+		top.next++
+		s.sm[path] = position{file: s.file, line: line, col: col + 1}
+		s.pending = path
+
+		rest := strings.TrimLeft(strings.TrimPrefix(content, "-"), " ")
+		if rest == "" || strings.HasPrefix(rest, "#") {
+			return nil
+		}
+		restCol := col + len(content) - len(rest)
+		if keyRE.MatchString(rest) || rest == "-" || strings.HasPrefix(rest, "- ") {
+			// The element is a mapping or sequence starting on the same line.
+			return s.scan(line, restCol, rest)
+		}
+		return skipValue(rest, col)
+	}
+
+	m := keyRE.FindStringSubmatch(content)
+	if m == nil {
+		return nil
+	}
+	// A key as indented as a sequence ends the sequence.
+	for len(s.frames) > 1 && top.seq && top.col == col {
+		s.frames = s.frames[:len(s.frames)-1]
+		top = s.frames[len(s.frames)-1]
+	}
+	if top.seq || top.col < col {
+		top = &sourceFrame{col: col, path: s.pending}
+		s.frames = append(s.frames, top)
+	}
+	path := joinPath(top.path, unquoteKey(m[1]))
+	s.sm[path] = position{file: s.file, line: line, col: col + 1}
+
+	value := m[2]
+	if value == "" || strings.HasPrefix(value, "#") {
+		s.pending = path
+		return nil
+	}
+	return skipValue(value, col)
+}
+
+// skipValue returns a func reporting whether a next line continues the value written at the col, or nil if it
+// cannot.
+func skipValue(value string, col int) func(string) bool {
+	indented := func(l string) bool {
+		t := strings.TrimLeft(l, " ")
+		return t == "" || len(l)-len(t) > col
+	}
+	switch {
+	case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+		return indented
+	case strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{"):
+		depth := flowDepth(value)
+		if depth <= 0 {
+			return nil
+		}
+		return func(l string) bool {
+			if depth <= 0 {
+				return false
+			}
+			depth += flowDepth(l)
+			return true
+		}
+	}
+	return nil
+}
+
+// flowDepth returns how many more flow collections the line opens than it closes, ignoring quoted strings.
+func flowDepth(l string) int {
+	depth := 0
+	var quote rune
+	for _, r := range l {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[' || r == '{':
+			depth++
+		case r == ']' || r == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+func unquoteKey(k string) string {
+	if strings.HasPrefix(k, `"`) {
+		if u, err := strconv.Unquote(k); err == nil {
+			return u
+		}
+	}
+	if strings.HasPrefix(k, "'") && strings.HasSuffix(k, "'") && len(k) > 1 {
+		return strings.Replace(k[1:len(k)-1], "''", "'", -1)
+	}
+	return k
+}
+
+func joinPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// mergeSources adds the positions of src to dst the way mergo merges src into dst when loading imports: keys
+// missing or empty in dst are taken from src, maps are merged and lists are appended. It must be called before the
+// values are merged.
+func mergeSources(dst, src map[string]interface{}, dstSM, srcSM sourceMap, prefix string) {
+	for k, sv := range src {
+		path := joinPath(prefix, k)
+		dv, ok := dst[k]
+		if !ok || isEmpty(dv) {
+			copySources(dstSM, srcSM, path, path, 0)
+			continue
+		}
+		switch d := dv.(type) {
+		case map[string]interface{}:
+			if s, ok := sv.(map[string]interface{}); ok {
+				mergeSources(d, s, dstSM, srcSM, path)
+			}
+		case []interface{}:
+			if _, ok := sv.([]interface{}); ok {
+				copySources(dstSM, srcSM, path, path, len(d))
+			}
+		}
+	}
+}
+
+// copySources copies the positions of the value at the src path and its children to the dst path, shifting the
+// indexes of the elements of the value by offset.
+func copySources(dstSM, srcSM sourceMap, srcPath, dstPath string, offset int) {
+	for p, pos := range srcSM {
+		if p == srcPath {
+			if offset == 0 {
+				dstSM[dstPath] = pos
+			}
+			continue
+		}
+		if !strings.HasPrefix(p, srcPath+".") {
+			continue
+		}
+		rest := strings.TrimPrefix(p, srcPath+".")
+		if offset > 0 {
+			parts := strings.SplitN(rest, ".", 2)
+			i, err := strconv.Atoi(parts[0])
+			if err != nil {
+				continue
+			}
+			parts[0] = strconv.Itoa(i + offset)
+			rest = strings.Join(parts, ".")
+		}
+		dstSM[dstPath+"."+rest] = pos
+	}
+}
+
+// removeSources removes the positions of the value at the path and its children.
+func removeSources(sm sourceMap, path string) {
+	for p := range sm {
+		if p == path || strings.HasPrefix(p, path+".") || path == "" {
+			delete(sm, p)
+		}
+	}
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsValid() && reflect.DeepEqual(v, reflect.Zero(rv.Type()).Interface())
+}
+
+// locate returns where the value at the path, or its closest located parent, was written. Files in the directory
+// of the root config are relative to it.
+func (sm sourceMap) locate(path string) (string, bool) {
+	dir := filepath.Dir(sm[""].file)
+	for {
+		if pos, ok := sm[path]; ok {
+			file := pos.file
+			if rel, err := filepath.Rel(dir, file); err == nil && !strings.HasPrefix(rel, "..") {
+				file = rel
+			}
+			return fmt.Sprintf("%s:%d:%d", file, pos.line, pos.col), true
+		}
+		if path == "" {
+			return "", false
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			path = ""
+		} else {
+			path = path[:i]
+		}
+	}
+}
+
+// annotate replaces the path of a *FieldError with where its value was written.
+func (sm sourceMap) annotate(err error) error {
+	fe, ok := err.(*FieldError)
+	if !ok {
+		return err
+	}
+	loc, ok := sm.locate(fe.Path)
+	if !ok {
+		return err
+	}
+	return fmt.Errorf("%s: %v", loc, fe.Err)
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BigqueryDataset represents a Terraform BigQuery dataset.
+type BigqueryDataset struct {
+	DatasetID string    `json:"dataset_id"`
+	Project   string    `json:"project"`
+	Location  string    `json:"location"`
+	Accesses  []*Access `json:"access,omitempty"`
+}
+
+// Access defines a dataset access. Only one non-role field should be set.
+type Access struct {
+	Role         string `json:"role"`
+	UserByEmail  string `json:"user_by_email,omitempty"`
+	GroupByEmail string `json:"group_by_email,omitempty"`
+	SpecialGroup string `json:"special_group,omitempty"`
+
+	// View is not supported and only kept to reject configs that set it.
+	View interface{} `json:"-"`
+}
+
+// Init initializes the dataset.
+func (d *BigqueryDataset) Init(projectID string) error {
+	if d.DatasetID == "" {
+		return errors.New("dataset_id must be set")
+	}
+	if d.Location == "" {
+		return errors.New("location must be set")
+	}
+	if d.Project != "" {
+		return fmt.Errorf("project must not be set: %q", d.Project)
+	}
+	for _, a := range d.Accesses {
+		if a.View != nil {
+			return errors.New("view accesses are not supported")
+		}
+	}
+	d.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (d *BigqueryDataset) TerraformResourceName() string {
+	return "google_bigquery_dataset"
+}
+
+// ID returns the unique identifier of this dataset.
+func (d *BigqueryDataset) ID() string {
+	return d.DatasetID
+}
+
+// ImportID returns the ID to import the dataset with.
+func (d *BigqueryDataset) ImportID() string {
+	return fmt.Sprintf("projects/%s/datasets/%s", d.Project, d.DatasetID)
+}
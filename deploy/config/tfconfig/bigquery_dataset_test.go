@@ -0,0 +1,96 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfconfig
+
+import (
+	"testing"
+)
+
+func TestBigqueryDatasetInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		dataset *BigqueryDataset
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			dataset: &BigqueryDataset{
+				DatasetID: "foo_dataset",
+				Location:  "US",
+				Accesses:  []*Access{{Role: "OWNER", GroupByEmail: "foo-owners@my-domain.com"}},
+			},
+		},
+		{
+			name:    "no_location",
+			dataset: &BigqueryDataset{DatasetID: "foo_dataset"},
+			wantErr: true,
+		},
+		{
+			name:    "project_set",
+			dataset: &BigqueryDataset{DatasetID: "foo_dataset", Location: "US", Project: "other-project"},
+			wantErr: true,
+		},
+		{
+			name: "view_access",
+			dataset: &BigqueryDataset{
+				DatasetID: "foo_dataset",
+				Location:  "US",
+				Accesses:  []*Access{{Role: "READER", View: map[string]interface{}{"tableId": "foo_view"}}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.dataset.Init("foo-project")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Init = %v, want error %t", err, tc.wantErr)
+			}
+			if err == nil && tc.dataset.Project != "foo-project" {
+				t.Errorf("project = %q, want foo-project", tc.dataset.Project)
+			}
+		})
+	}
+}
+
+func TestStandardizeID(t *testing.T) {
+	got := standardizeID("foo-bucket", "roles/storage.objectViewer")
+	if want := "foo-bucket-roles_storage_objectViewer"; got != want {
+		t.Errorf("standardizeID = %q, want %q", got, want)
+	}
+}
+
+func TestImportID(t *testing.T) {
+	d := &HealthcareDataset{Name: "foo-dataset", Location: "us-central1"}
+	tests := []struct {
+		resource Resource
+		want     string
+	}{
+		{&BigqueryDataset{DatasetID: "foo_dataset", Location: "US"}, "projects/foo-project/datasets/foo_dataset"},
+		{&StorageBucket{Name: "foo-bucket", Location: "US"}, "foo-project/foo-bucket"},
+		{d, "projects/foo-project/locations/us-central1/datasets/foo-dataset"},
+		{NewHealthcareStore(FHIRStore, "foo-store", d), "projects/foo-project/locations/us-central1/datasets/foo-dataset/fhirStores/foo-store"},
+		{&ProjectIAMAuditConfig{Service: "allServices"}, "foo-project allServices"},
+		{&PubsubTopic{Name: "foo-topic"}, "projects/foo-project/topics/foo-topic"},
+	}
+	for _, tc := range tests {
+		if err := tc.resource.Init("foo-project"); err != nil {
+			t.Fatalf("%s Init: %v", tc.resource.TerraformResourceName(), err)
+		}
+		if got := tc.resource.(Importer).ImportID(); got != tc.want {
+			t.Errorf("%s ImportID = %q, want %q", tc.resource.TerraformResourceName(), got, tc.want)
+		}
+	}
+}
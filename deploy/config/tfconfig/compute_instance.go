@@ -0,0 +1,84 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ComputeInstance represents a Terraform GCE instance.
+type ComputeInstance struct {
+	Name              string              `json:"name"`
+	Project           string              `json:"project"`
+	Zone              string              `json:"zone"`
+	MachineType       string              `json:"machine_type"`
+	BootDisk          *BootDisk           `json:"boot_disk"`
+	NetworkInterfaces []*NetworkInterface `json:"network_interface"`
+}
+
+// BootDisk defines the boot disk of an instance.
+type BootDisk struct {
+	InitializeParams *InitializeParams `json:"initialize_params,omitempty"`
+}
+
+// InitializeParams defines the parameters of a new boot disk.
+type InitializeParams struct {
+	Image string `json:"image,omitempty"`
+}
+
+// NetworkInterface defines a network the instance is connected to.
+type NetworkInterface struct {
+	Network string `json:"network"`
+}
+
+// Init initializes the instance.
+func (i *ComputeInstance) Init(projectID string) error {
+	if i.Name == "" {
+		return errors.New("name must be set")
+	}
+	if i.Zone == "" {
+		return errors.New("zone must be set")
+	}
+	if i.MachineType == "" {
+		return errors.New("machine_type must be set")
+	}
+	if i.Project != "" {
+		return fmt.Errorf("project must not be set: %q", i.Project)
+	}
+	i.Project = projectID
+	if i.BootDisk == nil {
+		i.BootDisk = new(BootDisk)
+	}
+	if len(i.NetworkInterfaces) == 0 {
+		i.NetworkInterfaces = []*NetworkInterface{{Network: "default"}}
+	}
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (i *ComputeInstance) TerraformResourceName() string {
+	return "google_compute_instance"
+}
+
+// ID returns the unique identifier of this instance.
+func (i *ComputeInstance) ID() string {
+	return i.Name
+}
+
+// ImportID returns the ID to import the instance with.
+func (i *ComputeInstance) ImportID() string {
+	return fmt.Sprintf("projects/%s/zones/%s/instances/%s", i.Project, i.Zone, i.Name)
+}
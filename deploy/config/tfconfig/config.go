@@ -15,3 +15,35 @@
 // Package tfconfig provides utilities to parse terraform resource configurations.
 // This is a temporary package and will be merged back into the parent config package once deployment manager has been deprecated.
 package tfconfig
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Resource is an interface that must be implemented by all concrete terraform resource implementations.
+type Resource interface {
+	// Init initializes the resource with the project it is deployed in.
+	Init(projectID string) error
+
+	// ID returns the name of the resource in the terraform config, which must be unique per resource type.
+	ID() string
+
+	// TerraformResourceName returns the Google provider terraform resource.
+	TerraformResourceName() string
+}
+
+// Importer is implemented by resources that can be imported into the terraform state, e.g. when they were
+// deployed by deployment manager before.
+type Importer interface {
+	// ImportID returns the ID to import the initialized resource with.
+	ImportID() string
+}
+
+var invalidNameChars = regexp.MustCompile("[^a-zA-Z0-9_-]+")
+
+// standardizeID joins the parts into a valid terraform resource name.
+// Terraform resource names may only contain letters, digits, underscores and dashes.
+func standardizeID(parts ...string) string {
+	return invalidNameChars.ReplaceAllString(strings.Join(parts, "-"), "_")
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ContainerCluster represents a Terraform GKE cluster.
+type ContainerCluster struct {
+	Name     string `json:"name"`
+	Project  string `json:"project"`
+	Location string `json:"location"`
+}
+
+// Init initializes the cluster.
+func (c *ContainerCluster) Init(projectID string) error {
+	if c.Name == "" {
+		return errors.New("name must be set")
+	}
+	if c.Location == "" {
+		return errors.New("location must be set")
+	}
+	if c.Project != "" {
+		return fmt.Errorf("project must not be set: %q", c.Project)
+	}
+	c.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (c *ContainerCluster) TerraformResourceName() string {
+	return "google_container_cluster"
+}
+
+// ID returns the unique identifier of this cluster.
+func (c *ContainerCluster) ID() string {
+	return c.Name
+}
+
+// ImportID returns the ID to import the cluster with.
+func (c *ContainerCluster) ImportID() string {
+	return fmt.Sprintf("projects/%s/locations/%s/clusters/%s", c.Project, c.Location, c.Name)
+}
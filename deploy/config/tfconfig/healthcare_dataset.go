@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HealthcareDataset represents a Terraform Cloud Healthcare dataset.
+type HealthcareDataset struct {
+	Name     string `json:"name"`
+	Project  string `json:"project"`
+	Location string `json:"location"`
+}
+
+// Init initializes the dataset.
+func (d *HealthcareDataset) Init(projectID string) error {
+	if d.Name == "" {
+		return errors.New("name must be set")
+	}
+	if d.Location == "" {
+		return errors.New("location must be set")
+	}
+	if d.Project != "" {
+		return fmt.Errorf("project must not be set: %q", d.Project)
+	}
+	d.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (d *HealthcareDataset) TerraformResourceName() string {
+	return "google_healthcare_dataset"
+}
+
+// ID returns the unique identifier of this dataset.
+func (d *HealthcareDataset) ID() string {
+	return d.Name
+}
+
+// ImportID returns the ID to import the dataset with.
+func (d *HealthcareDataset) ImportID() string {
+	return fmt.Sprintf("projects/%s/locations/%s/datasets/%s", d.Project, d.Location, d.Name)
+}
+
+// Types of Cloud Healthcare stores.
+const (
+	DICOMStore = "google_healthcare_dicom_store"
+	FHIRStore  = "google_healthcare_fhir_store"
+	HL7V2Store = "google_healthcare_hl7_v2_store"
+)
+
+// storeCollections maps store types to the collection of the stores in their dataset.
+var storeCollections = map[string]string{
+	DICOMStore: "dicomStores",
+	FHIRStore:  "fhirStores",
+	HL7V2Store: "hl7V2Stores",
+}
+
+// HealthcareStore represents a Terraform Cloud Healthcare DICOM, FHIR or HL7v2 store.
+type HealthcareStore struct {
+	Name    string `json:"name"`
+	Dataset string `json:"dataset"`
+
+	storeType string
+	dataset   *HealthcareDataset
+}
+
+// NewHealthcareStore returns a store of the given type in the dataset.
+func NewHealthcareStore(storeType, name string, d *HealthcareDataset) *HealthcareStore {
+	return &HealthcareStore{
+		Name: name,
+		// Reference the dataset so terraform creates it before the store.
+		Dataset:   fmt.Sprintf("${%s.%s.id}", d.TerraformResourceName(), d.ID()),
+		storeType: storeType,
+		dataset:   d,
+	}
+}
+
+// Init initializes the store.
+// The project of the store is the project of its dataset.
+func (s *HealthcareStore) Init(string) error {
+	if s.Name == "" {
+		return errors.New("name must be set")
+	}
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (s *HealthcareStore) TerraformResourceName() string {
+	return s.storeType
+}
+
+// ID returns the unique identifier of this store.
+// Stores in different datasets may have the same name.
+func (s *HealthcareStore) ID() string {
+	return standardizeID(s.dataset.ID(), s.Name)
+}
+
+// ImportID returns the ID to import the store with.
+func (s *HealthcareStore) ImportID() string {
+	return fmt.Sprintf("%s/%s/%s", s.dataset.ImportID(), storeCollections[s.storeType], s.Name)
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ProjectIAMMember represents a Terraform project IAM member.
+// Unlike a binding, it is not authoritative: other members of the role are kept.
+type ProjectIAMMember struct {
+	Project string `json:"project"`
+	Role    string `json:"role"`
+	Member  string `json:"member"`
+
+	// prefix is used to differentiate members added by different policies.
+	prefix string
+}
+
+// NewProjectIAMMember returns the member of the role, added by the policy with the given name.
+func NewProjectIAMMember(policyName, role, member string) *ProjectIAMMember {
+	return &ProjectIAMMember{
+		Role:   role,
+		Member: member,
+		prefix: policyName,
+	}
+}
+
+// Init initializes the member.
+func (m *ProjectIAMMember) Init(projectID string) error {
+	if m.Role == "" {
+		return errors.New("role must be set")
+	}
+	if m.Member == "" {
+		return errors.New("member must be set")
+	}
+	if m.Project != "" {
+		return fmt.Errorf("project must not be set: %q", m.Project)
+	}
+	m.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (m *ProjectIAMMember) TerraformResourceName() string {
+	return "google_project_iam_member"
+}
+
+// ID returns the unique identifier of this member.
+func (m *ProjectIAMMember) ID() string {
+	return standardizeID(m.prefix, m.Role, m.Member)
+}
+
+// ImportID returns the ID to import the member with.
+func (m *ProjectIAMMember) ImportID() string {
+	return fmt.Sprintf("%s %s %s", m.Project, m.Role, m.Member)
+}
+
+// ProjectIAMCustomRole represents a Terraform project IAM custom role.
+type ProjectIAMCustomRole struct {
+	RoleID      string   `json:"role_id"`
+	Project     string   `json:"project"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// Init initializes the custom role.
+func (r *ProjectIAMCustomRole) Init(projectID string) error {
+	if r.RoleID == "" {
+		return errors.New("role_id must be set")
+	}
+	if len(r.Permissions) == 0 {
+		return fmt.Errorf("permissions of role %q must be set", r.RoleID)
+	}
+	if r.Title == "" {
+		r.Title = r.RoleID
+	}
+	if r.Project != "" {
+		return fmt.Errorf("project must not be set: %q", r.Project)
+	}
+	r.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (r *ProjectIAMCustomRole) TerraformResourceName() string {
+	return "google_project_iam_custom_role"
+}
+
+// ID returns the unique identifier of this custom role.
+func (r *ProjectIAMCustomRole) ID() string {
+	return r.RoleID
+}
+
+// ImportID returns the ID to import the role with.
+func (r *ProjectIAMCustomRole) ImportID() string {
+	return fmt.Sprintf("projects/%s/roles/%s", r.Project, r.RoleID)
+}
+
+// ProjectIAMAuditConfig represents a Terraform project IAM audit config.
+type ProjectIAMAuditConfig struct {
+	Project         string            `json:"project"`
+	Service         string            `json:"service"`
+	AuditLogConfigs []*AuditLogConfig `json:"audit_log_config"`
+}
+
+// AuditLogConfig defines a type of logs that is audited.
+type AuditLogConfig struct {
+	LogType string `json:"log_type"`
+}
+
+// Init initializes the audit config.
+func (c *ProjectIAMAuditConfig) Init(projectID string) error {
+	if c.Service == "" {
+		return errors.New("service must be set")
+	}
+	if c.Project != "" {
+		return fmt.Errorf("project must not be set: %q", c.Project)
+	}
+	c.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (c *ProjectIAMAuditConfig) TerraformResourceName() string {
+	return "google_project_iam_audit_config"
+}
+
+// ID returns the unique identifier of this audit config.
+func (c *ProjectIAMAuditConfig) ID() string {
+	return standardizeID(c.Service)
+}
+
+// ImportID returns the ID to import the audit config with.
+func (c *ProjectIAMAuditConfig) ImportID() string {
+	return fmt.Sprintf("%s %s", c.Project, c.Service)
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LoggingProjectSink represents a Terraform project log sink.
+type LoggingProjectSink struct {
+	Name                 string `json:"name"`
+	Project              string `json:"project"`
+	Destination          string `json:"destination"`
+	Filter               string `json:"filter"`
+	UniqueWriterIdentity bool   `json:"unique_writer_identity"`
+}
+
+// Init initializes the sink.
+func (s *LoggingProjectSink) Init(projectID string) error {
+	if s.Name == "" {
+		return errors.New("name must be set")
+	}
+	if s.Destination == "" {
+		return errors.New("destination must be set")
+	}
+	if s.Project != "" {
+		return fmt.Errorf("project must not be set: %q", s.Project)
+	}
+	s.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (s *LoggingProjectSink) TerraformResourceName() string {
+	return "google_logging_project_sink"
+}
+
+// ID returns the unique identifier of this sink.
+func (s *LoggingProjectSink) ID() string {
+	return s.Name
+}
+
+// ImportID returns the ID to import the sink with.
+func (s *LoggingProjectSink) ImportID() string {
+	return fmt.Sprintf("projects/%s/sinks/%s", s.Project, s.Name)
+}
+
+// LoggingMetric represents a Terraform log based metric.
+type LoggingMetric struct {
+	Name             string            `json:"name"`
+	Project          string            `json:"project"`
+	Description      string            `json:"description,omitempty"`
+	Filter           string            `json:"filter"`
+	MetricDescriptor *MetricDescriptor `json:"metric_descriptor,omitempty"`
+	LabelExtractors  map[string]string `json:"label_extractors,omitempty"`
+
+	// DependsOn holds the addresses of resources that must be created before the metric,
+	// e.g. the bucket whose access logs the metric counts.
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// MetricDescriptor describes the metric.
+type MetricDescriptor struct {
+	MetricKind string   `json:"metric_kind"`
+	ValueType  string   `json:"value_type"`
+	Unit       string   `json:"unit,omitempty"`
+	Labels     []*Label `json:"labels,omitempty"`
+}
+
+// Label describes a label of the metric.
+type Label struct {
+	Key         string `json:"key"`
+	ValueType   string `json:"value_type,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Init initializes the metric.
+func (m *LoggingMetric) Init(projectID string) error {
+	if m.Name == "" {
+		return errors.New("name must be set")
+	}
+	if m.Filter == "" {
+		return errors.New("filter must be set")
+	}
+	if m.Project != "" {
+		return fmt.Errorf("project must not be set: %q", m.Project)
+	}
+	m.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (m *LoggingMetric) TerraformResourceName() string {
+	return "google_logging_metric"
+}
+
+// ID returns the unique identifier of this metric.
+func (m *LoggingMetric) ID() string {
+	return m.Name
+}
+
+// ImportID returns the ID to import the metric with.
+func (m *LoggingMetric) ImportID() string {
+	return fmt.Sprintf("%s %s", m.Project, m.Name)
+}
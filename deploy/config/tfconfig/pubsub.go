@@ -0,0 +1,210 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PubsubTopic represents a Terraform Pub/Sub topic.
+type PubsubTopic struct {
+	Name    string `json:"name"`
+	Project string `json:"project"`
+}
+
+// Init initializes the topic.
+func (t *PubsubTopic) Init(projectID string) error {
+	if t.Name == "" {
+		return errors.New("name must be set")
+	}
+	if t.Project != "" {
+		return fmt.Errorf("project must not be set: %q", t.Project)
+	}
+	t.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (t *PubsubTopic) TerraformResourceName() string {
+	return "google_pubsub_topic"
+}
+
+// ID returns the unique identifier of this topic.
+func (t *PubsubTopic) ID() string {
+	return t.Name
+}
+
+// ImportID returns the ID to import the topic with.
+func (t *PubsubTopic) ImportID() string {
+	return fmt.Sprintf("projects/%s/topics/%s", t.Project, t.Name)
+}
+
+// PubsubTopicIAMBinding represents a Terraform Pub/Sub topic IAM binding.
+// It is authoritative for the role: members not in the binding are removed from the role.
+type PubsubTopicIAMBinding struct {
+	Topic   string   `json:"topic"`
+	Project string   `json:"project"`
+	Role    string   `json:"role"`
+	Members []string `json:"members"`
+
+	topicID string
+}
+
+// NewPubsubTopicIAMBinding returns a binding of the role to the members in the topic.
+func NewPubsubTopicIAMBinding(t *PubsubTopic, role string, members []string) *PubsubTopicIAMBinding {
+	return &PubsubTopicIAMBinding{
+		// Reference the topic so terraform creates it before the binding.
+		Topic:   fmt.Sprintf("${%s.%s.name}", t.TerraformResourceName(), t.ID()),
+		Role:    role,
+		Members: members,
+		topicID: t.ID(),
+	}
+}
+
+// Init initializes the binding.
+func (b *PubsubTopicIAMBinding) Init(projectID string) error {
+	if b.Role == "" {
+		return errors.New("role must be set")
+	}
+	if len(b.Members) == 0 {
+		return fmt.Errorf("members of role %q must be set", b.Role)
+	}
+	if b.Project != "" {
+		return fmt.Errorf("project must not be set: %q", b.Project)
+	}
+	b.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (b *PubsubTopicIAMBinding) TerraformResourceName() string {
+	return "google_pubsub_topic_iam_binding"
+}
+
+// ID returns the unique identifier of this binding.
+func (b *PubsubTopicIAMBinding) ID() string {
+	return standardizeID(b.topicID, b.Role)
+}
+
+// ImportID returns the ID to import the binding with.
+func (b *PubsubTopicIAMBinding) ImportID() string {
+	return fmt.Sprintf("projects/%s/topics/%s %s", b.Project, b.topicID, b.Role)
+}
+
+// PubsubSubscription represents a Terraform Pub/Sub subscription.
+type PubsubSubscription struct {
+	Name               string      `json:"name"`
+	Project            string      `json:"project"`
+	Topic              string      `json:"topic"`
+	AckDeadlineSeconds int         `json:"ack_deadline_seconds,omitempty"`
+	PushConfig         *PushConfig `json:"push_config,omitempty"`
+}
+
+// PushConfig defines the push delivery of a subscription.
+type PushConfig struct {
+	PushEndpoint string `json:"push_endpoint"`
+}
+
+// NewPubsubSubscription returns a subscription with the given name to the topic.
+func NewPubsubSubscription(name string, t *PubsubTopic) *PubsubSubscription {
+	return &PubsubSubscription{
+		Name: name,
+		// Reference the topic so terraform creates it before the subscription.
+		Topic: fmt.Sprintf("${%s.%s.name}", t.TerraformResourceName(), t.ID()),
+	}
+}
+
+// Init initializes the subscription.
+func (s *PubsubSubscription) Init(projectID string) error {
+	if s.Name == "" {
+		return errors.New("name must be set")
+	}
+	if s.Topic == "" {
+		return errors.New("topic must be set")
+	}
+	if s.Project != "" {
+		return fmt.Errorf("project must not be set: %q", s.Project)
+	}
+	s.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (s *PubsubSubscription) TerraformResourceName() string {
+	return "google_pubsub_subscription"
+}
+
+// ID returns the unique identifier of this subscription.
+func (s *PubsubSubscription) ID() string {
+	return s.Name
+}
+
+// ImportID returns the ID to import the subscription with.
+func (s *PubsubSubscription) ImportID() string {
+	return fmt.Sprintf("projects/%s/subscriptions/%s", s.Project, s.Name)
+}
+
+// PubsubSubscriptionIAMBinding represents a Terraform Pub/Sub subscription IAM binding.
+// It is authoritative for the role: members not in the binding are removed from the role.
+type PubsubSubscriptionIAMBinding struct {
+	Subscription string   `json:"subscription"`
+	Project      string   `json:"project"`
+	Role         string   `json:"role"`
+	Members      []string `json:"members"`
+
+	subscriptionID string
+}
+
+// NewPubsubSubscriptionIAMBinding returns a binding of the role to the members in the subscription.
+func NewPubsubSubscriptionIAMBinding(s *PubsubSubscription, role string, members []string) *PubsubSubscriptionIAMBinding {
+	return &PubsubSubscriptionIAMBinding{
+		// Reference the subscription so terraform creates it before the binding.
+		Subscription:   fmt.Sprintf("${%s.%s.name}", s.TerraformResourceName(), s.ID()),
+		Role:           role,
+		Members:        members,
+		subscriptionID: s.ID(),
+	}
+}
+
+// Init initializes the binding.
+func (b *PubsubSubscriptionIAMBinding) Init(projectID string) error {
+	if b.Role == "" {
+		return errors.New("role must be set")
+	}
+	if len(b.Members) == 0 {
+		return fmt.Errorf("members of role %q must be set", b.Role)
+	}
+	if b.Project != "" {
+		return fmt.Errorf("project must not be set: %q", b.Project)
+	}
+	b.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (b *PubsubSubscriptionIAMBinding) TerraformResourceName() string {
+	return "google_pubsub_subscription_iam_binding"
+}
+
+// ID returns the unique identifier of this binding.
+func (b *PubsubSubscriptionIAMBinding) ID() string {
+	return standardizeID(b.subscriptionID, b.Role)
+}
+
+// ImportID returns the ID to import the binding with.
+func (b *PubsubSubscriptionIAMBinding) ImportID() string {
+	return fmt.Sprintf("projects/%s/subscriptions/%s %s", b.Project, b.subscriptionID, b.Role)
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ServiceAccount represents a Terraform service account.
+type ServiceAccount struct {
+	AccountID   string `json:"account_id"`
+	Project     string `json:"project"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// Init initializes the service account.
+func (a *ServiceAccount) Init(projectID string) error {
+	if a.AccountID == "" {
+		return errors.New("account_id must be set")
+	}
+	if a.Project != "" {
+		return fmt.Errorf("project must not be set: %q", a.Project)
+	}
+	a.Project = projectID
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (a *ServiceAccount) TerraformResourceName() string {
+	return "google_service_account"
+}
+
+// ID returns the unique identifier of this service account.
+func (a *ServiceAccount) ID() string {
+	return a.AccountID
+}
+
+// ImportID returns the ID to import the service account with.
+func (a *ServiceAccount) ImportID() string {
+	return fmt.Sprintf("projects/%s/serviceAccounts/%s@%s.iam.gserviceaccount.com", a.Project, a.AccountID, a.Project)
+}
@@ -22,11 +22,17 @@ import (
 
 // StorageBucket represents a Terraform GCS bucket.
 type StorageBucket struct {
-	Name       string     `json:"name"`
-	Project    string     `json:"project"`
-	Location   string     `json:"location"`
-	Versioning versioning `json:"versioning,omitempty"`
-	raw        json.RawMessage
+	Name           string            `json:"name"`
+	Project        string            `json:"project"`
+	Location       string            `json:"location"`
+	StorageClass   string            `json:"storage_class,omitempty"`
+	Versioning     versioning        `json:"versioning,omitempty"`
+	Logging        *Logging          `json:"logging,omitempty"`
+	LifecycleRules []*LifecycleRule  `json:"lifecycle_rule,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	RequesterPays  bool              `json:"requester_pays,omitempty"`
+	Website        *Website          `json:"website,omitempty"`
+	raw            json.RawMessage
 }
 
 type versioning struct {
@@ -34,6 +40,38 @@ type versioning struct {
 	Enabled *bool `json:"enabled"`
 }
 
+// Logging defines the bucket the access logs of a bucket are written to.
+type Logging struct {
+	LogBucket string `json:"log_bucket"`
+}
+
+// Website defines how the bucket behaves when its content is accessed as a web site.
+type Website struct {
+	MainPageSuffix string `json:"main_page_suffix,omitempty"`
+	NotFoundPage   string `json:"not_found_page,omitempty"`
+}
+
+// LifecycleRule defines a bucket lifecycle rule.
+type LifecycleRule struct {
+	Action    *Action    `json:"action,omitempty"`
+	Condition *Condition `json:"condition,omitempty"`
+}
+
+// Action defines the action of a lifecycle rule.
+type Action struct {
+	Type         string `json:"type"`
+	StorageClass string `json:"storage_class,omitempty"`
+}
+
+// Condition defines the condition of a lifecycle rule.
+type Condition struct {
+	Age                 int      `json:"age,omitempty"`
+	CreatedBefore       string   `json:"created_before,omitempty"`
+	WithState           string   `json:"with_state,omitempty"`
+	MatchesStorageClass []string `json:"matches_storage_class,omitempty"`
+	NumNewerVersions    int      `json:"num_newer_versions,omitempty"`
+}
+
 // Init initializes the bucket.
 func (b *StorageBucket) Init(projectID string) error {
 	if b.Name == "" {
@@ -62,6 +100,11 @@ func (b *StorageBucket) ID() string {
 	return b.Name
 }
 
+// ImportID returns the ID to import the bucket with.
+func (b *StorageBucket) ImportID() string {
+	return fmt.Sprintf("%s/%s", b.Project, b.Name)
+}
+
 // aliasStorageBucket is used to prevent infinite recursion when dealing with json marshaling.
 // https://stackoverflow.com/q/52433467
 type aliasStorageBucket StorageBucket
@@ -83,3 +126,50 @@ func (b *StorageBucket) UnmarshalJSON(data []byte) error {
 func (b *StorageBucket) MarshalJSON() ([]byte, error) {
 	return interfacePair{b.raw, aliasStorageBucket(*b)}.MarshalJSON()
 }
+
+// StorageBucketIAMBinding represents a Terraform GCS bucket IAM binding.
+// It is authoritative for the role: members not in the binding are removed from the role.
+type StorageBucketIAMBinding struct {
+	Bucket  string   `json:"bucket"`
+	Role    string   `json:"role"`
+	Members []string `json:"members"`
+
+	bucketID string
+}
+
+// NewStorageBucketIAMBinding returns a binding of the role to the members in the bucket.
+func NewStorageBucketIAMBinding(b *StorageBucket, role string, members []string) *StorageBucketIAMBinding {
+	return &StorageBucketIAMBinding{
+		// Reference the bucket so terraform creates it before the binding.
+		Bucket:   fmt.Sprintf("${%s.%s.name}", b.TerraformResourceName(), b.ID()),
+		Role:     role,
+		Members:  members,
+		bucketID: b.ID(),
+	}
+}
+
+// Init initializes the binding.
+func (b *StorageBucketIAMBinding) Init(string) error {
+	if b.Role == "" {
+		return errors.New("role must be set")
+	}
+	if len(b.Members) == 0 {
+		return fmt.Errorf("members of role %q must be set", b.Role)
+	}
+	return nil
+}
+
+// TerraformResourceName returns the Google provider terraform resource.
+func (b *StorageBucketIAMBinding) TerraformResourceName() string {
+	return "google_storage_bucket_iam_binding"
+}
+
+// ID returns the unique identifier of this binding.
+func (b *StorageBucketIAMBinding) ID() string {
+	return standardizeID(b.bucketID, b.Role)
+}
+
+// ImportID returns the ID to import the binding with.
+func (b *StorageBucketIAMBinding) ImportID() string {
+	return fmt.Sprintf("%s %s", b.bucketID, b.Role)
+}
@@ -23,15 +23,10 @@ import (
 	"os"
 	"os/exec"
 
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
 	"github.com/ghodss/yaml"
 )
 
-// The following vars are stubbed in tests.
-var (
-	cmdRun            = (*exec.Cmd).Run
-	cmdCombinedOutput = (*exec.Cmd).CombinedOutput
-)
-
 // Deployment represents a single deployment which can be used by the GCP Deployment Manager.
 // TODO: move into separate package.
 type Deployment struct {
@@ -39,6 +34,13 @@ type Deployment struct {
 	Resources []*Resource `json:"resources"`
 }
 
+// ProjectDeployment is a deployment in a project, e.g. one of the deployments created when applying a project.
+type ProjectDeployment struct {
+	ProjectID  string
+	Name       string
+	Deployment *Deployment
+}
+
 // Import respresents a deployment manager template import.
 type Import struct {
 	Path string `json:"path"`
@@ -58,7 +60,13 @@ type Metadata struct {
 }
 
 // Upsert creates the deployment if it does not exist, else updates it.
-func Upsert(name string, deployment *Deployment, projectID string) error {
+func Upsert(name string, deployment *Deployment, projectID string, rn runner.Runner) error {
+	return createOrUpdate(name, deployment, projectID, false, rn)
+}
+
+// createOrUpdate creates the deployment if it does not exist, else updates it.
+// If preview is set, the deployment is only previewed and must be committed or cancelled later on.
+func createOrUpdate(name string, deployment *Deployment, projectID string, preview bool, rn runner.Runner) error {
 	b, err := yaml.Marshal(deployment)
 	if err != nil {
 		return fmt.Errorf("failed to marshal deployment : %v", err)
@@ -78,7 +86,7 @@ func Upsert(name string, deployment *Deployment, projectID string) error {
 		return fmt.Errorf("failed to close temp file: %v", err)
 	}
 
-	exists, err := checkDeploymentExists(name, projectID)
+	exists, err := checkDeploymentExists(name, projectID, rn)
 	if err != nil {
 		return fmt.Errorf("failed to check if deployment exists: %v", err)
 	}
@@ -92,6 +100,9 @@ func Upsert(name string, deployment *Deployment, projectID string) error {
 	} else {
 		args = append(args, "create", name)
 	}
+	if preview {
+		args = append(args, "--preview")
+	}
 	args = append(args, "--project", projectID, "--config", tmp.Name())
 
 	log.Printf("Running gcloud command with args: %v", args)
@@ -99,36 +110,80 @@ func Upsert(name string, deployment *Deployment, projectID string) error {
 	cmd := exec.Command("gcloud", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stdout
-	if err := cmdRun(cmd); err != nil {
+	if err := rn.CmdRun(cmd); err != nil {
 		return fmt.Errorf("failed to run command: %v", err)
 	}
 	return nil
 }
 
 // checkDeploymentExists determines whether the deployment with the given name exists in the given project.
-func checkDeploymentExists(name, projectID string) (bool, error) {
+func checkDeploymentExists(name, projectID string, rn runner.Runner) (bool, error) {
+	names, err := List(projectID, rn)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range names {
+		if n == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// List returns the names of the deployments in the given project.
+func List(projectID string, rn runner.Runner) ([]string, error) {
 	type deploymentInfo struct {
 		Name string `json:"name"`
 	}
 
 	cmd := exec.Command("gcloud", "deployment-manager", "deployments", "list", "--format", "json", "--project", projectID)
 
-	out, err := cmdCombinedOutput(cmd)
+	out, err := rn.CmdCombinedOutput(cmd)
 	if err != nil {
-		return false, fmt.Errorf("failed to run command: %v\n%v", err, string(out))
+		return nil, fmt.Errorf("failed to run command: %v\n%v", err, string(out))
 	}
 
 	deploymentInfos := make([]deploymentInfo, 0)
 	if err := json.Unmarshal(out, &deploymentInfos); err != nil {
-		return false, fmt.Errorf("failed to unmarshal deployment list call: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal deployment list call: %v", err)
 	}
 
 	log.Printf("found %v deployments: %v", len(deploymentInfos), deploymentInfos)
 
+	var names []string
 	for _, d := range deploymentInfos {
-		if d.Name == name {
-			return true, nil
-		}
+		names = append(names, d.Name)
 	}
-	return false, nil
+	return names, nil
+}
+
+// Get returns the deployment as configured by the latest manifest of the deployment with the given name.
+// Imports are returned by their name in the manifest, which may differ from the path they were deployed with.
+func Get(name, projectID string, rn runner.Runner) (*Deployment, error) {
+	// Without a manifest ID, the latest manifest of the deployment is described.
+	cmd := exec.Command("gcloud", "deployment-manager", "manifests", "describe", "--deployment", name, "--format", "json", "--project", projectID)
+	out, err := rn.CmdOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe manifest of deployment %q: %v", name, err)
+	}
+
+	type manifest struct {
+		Config struct {
+			Content string `json:"content"`
+		} `json:"config"`
+	}
+	m := new(manifest)
+	if err := json.Unmarshal(out, m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %v", err)
+	}
+	d := new(Deployment)
+	if err := yaml.Unmarshal([]byte(m.Config.Content), d); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest config: %v", err)
+	}
+	return d, nil
+}
+
+// Abandon deletes the deployment with the given name, leaving all of its resources in the project unmanaged.
+func Abandon(name, projectID string, rn runner.Runner) error {
+	return runDeploymentCommand(rn, "delete", name, "--delete-policy", "ABANDON", "--quiet", "--project", projectID)
 }
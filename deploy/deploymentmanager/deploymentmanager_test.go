@@ -93,10 +93,7 @@ resources:
 				wantDeploymentCommand: tc.wantDeploymentCommand,
 			}
 
-			cmdRun = commander.Run
-			cmdCombinedOutput = commander.CombinedOutput
-
-			if err := Upsert("foo-deployment", deployment, projID); err != nil {
+			if err := Upsert("foo-deployment", deployment, projID, commander); err != nil {
 				t.Fatalf("createOrUpdateDeployment = %v", err)
 			}
 
@@ -124,9 +121,9 @@ type fakeCommander struct {
 	gotConfigFileContents []byte
 }
 
-func (c *fakeCommander) Run(cmd *exec.Cmd) error {
+func (c *fakeCommander) CmdRun(cmd *exec.Cmd) error {
 	if !cmp.Equal(cmd.Args[:len(c.wantDeploymentCommand)], c.wantDeploymentCommand) {
-		return fmt.Errorf("fake cmdRun: unexpected args: %v", cmd.Args)
+		return fmt.Errorf("fake CmdRun: unexpected args: %v", cmd.Args)
 	}
 	configFile := cmd.Args[len(cmd.Args)-1] // config file is the last file
 	var err error
@@ -137,11 +134,45 @@ func (c *fakeCommander) Run(cmd *exec.Cmd) error {
 	return nil
 }
 
-func (c *fakeCommander) CombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+func (c *fakeCommander) CmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return nil, fmt.Errorf("fake CmdOutput: unexpected args: %v", cmd.Args)
+}
+
+func (c *fakeCommander) CmdCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
 	listArgs := []string{"gcloud", "deployment-manager", "deployments", "list", "--format", "json"}
 	if cmp.Equal(cmd.Args[:len(listArgs)], listArgs) {
 		out := fmt.Sprintf(`[{"name": "%s"}]`, c.listDeploymentName)
 		return []byte(out), nil
 	}
-	return nil, fmt.Errorf("fake cmdCombinedOutput: unexpected args: %v", cmd.Args)
+	return nil, fmt.Errorf("fake CmdCombinedOutput: unexpected args: %v", cmd.Args)
+}
+
+func TestGet(t *testing.T) {
+	manifest := `{
+		"config": {
+			"content": "imports:\n- path: gcs_bucket.py\nresources:\n- name: foo-bucket\n  type: gcs_bucket.py\n  properties:\n    location: US\n"
+		},
+		"name": "manifest-1234"
+	}`
+	rn := &previewCommander{describeOutput: manifest}
+
+	got, err := Get("foo-deployment", "foo-project", rn)
+	if err != nil {
+		t.Fatalf("Get = %v", err)
+	}
+	want := &Deployment{
+		Imports: []*Import{{Path: "gcs_bucket.py"}},
+		Resources: []*Resource{{
+			Name:       "foo-bucket",
+			Type:       "gcs_bucket.py",
+			Properties: map[string]interface{}{"location": "US"},
+		}},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("deployment differs (-got +want):\n%v", diff)
+	}
+	wantCommands := []string{"gcloud deployment-manager manifests describe --deployment foo-deployment --format json --project foo-project"}
+	if diff := cmp.Diff(rn.gotCommands, wantCommands); diff != "" {
+		t.Errorf("commands differ (-got +want):\n%v", diff)
+	}
 }
@@ -0,0 +1,156 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploymentmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+)
+
+// ResourceChange identifies a resource changed by a deployment.
+type ResourceChange struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Changes are the changes a previewed deployment will make to its resources once committed.
+// Resources that are not changed are not listed.
+type Changes struct {
+	Added     []ResourceChange `json:"added,omitempty"`
+	Updated   []ResourceChange `json:"updated,omitempty"`
+	Abandoned []ResourceChange `json:"abandoned,omitempty"`
+	Deleted   []ResourceChange `json:"deleted,omitempty"`
+}
+
+// Empty returns whether there are no changes.
+func (c *Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Updated) == 0 && len(c.Abandoned) == 0 && len(c.Deleted) == 0
+}
+
+// Sort sorts the changes by resource name.
+func (c *Changes) Sort() {
+	for _, rcs := range [][]ResourceChange{c.Added, c.Updated, c.Abandoned, c.Deleted} {
+		sort.Slice(rcs, func(i, j int) bool { return rcs[i].Name < rcs[j].Name })
+	}
+}
+
+// String returns a human readable summary of the changes.
+func (c *Changes) String() string {
+	if c.Empty() {
+		return "No changes.\n"
+	}
+	var sb strings.Builder
+	write := func(symbol, action string, rcs []ResourceChange) {
+		if len(rcs) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "%d resource(s) will be %s:\n", len(rcs), action)
+		for _, rc := range rcs {
+			fmt.Fprintf(&sb, "  %s %s (%s)\n", symbol, rc.Name, rc.Type)
+		}
+	}
+	write("+", "added", c.Added)
+	write("~", "updated", c.Updated)
+	write("!", "abandoned and must be deleted manually if no longer needed", c.Abandoned)
+	write("-", "deleted", c.Deleted)
+	return sb.String()
+}
+
+// Preview creates or updates the deployment in preview mode and returns the changes it would make.
+// The preview must then be committed with CommitPreview or cancelled with CancelPreview, as no other
+// update can be made to the deployment while it is in preview.
+func Preview(name string, deployment *Deployment, projectID string, rn runner.Runner) (*Changes, error) {
+	if err := createOrUpdate(name, deployment, projectID, true, rn); err != nil {
+		return nil, err
+	}
+	changes, err := previewChanges(name, projectID, rn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changes of preview: %v", err)
+	}
+	return changes, nil
+}
+
+// previewChanges reads the intended update of every resource of a deployment in preview.
+func previewChanges(name, projectID string, rn runner.Runner) (*Changes, error) {
+	cmd := exec.Command("gcloud", "deployment-manager", "deployments", "describe", name, "--format", "json", "--project", projectID)
+	out, err := rn.CmdOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe deployment: %v", err)
+	}
+
+	type description struct {
+		Resources []struct {
+			Name   string `json:"name"`
+			Type   string `json:"type"`
+			Update *struct {
+				Intent string `json:"intent"`
+			} `json:"update"`
+		} `json:"resources"`
+	}
+	d := new(description)
+	if err := json.Unmarshal(out, d); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal deployment description: %v", err)
+	}
+
+	changes := new(Changes)
+	for _, r := range d.Resources {
+		if r.Update == nil {
+			continue
+		}
+		rc := ResourceChange{Name: r.Name, Type: r.Type}
+		switch r.Update.Intent {
+		case "CREATE_OR_ACQUIRE", "CREATE", "ACQUIRE":
+			changes.Added = append(changes.Added, rc)
+		case "UPDATE":
+			changes.Updated = append(changes.Updated, rc)
+		case "ABANDON":
+			changes.Abandoned = append(changes.Abandoned, rc)
+		case "DELETE":
+			changes.Deleted = append(changes.Deleted, rc)
+		default:
+			return nil, fmt.Errorf("unknown intent %q for resource %q", r.Update.Intent, r.Name)
+		}
+	}
+	changes.Sort()
+	return changes, nil
+}
+
+// CommitPreview commits the preview of the deployment, making the previewed changes.
+func CommitPreview(name, projectID string, rn runner.Runner) error {
+	// Updating without a config commits the preview.
+	// Resources removed from the deployment are abandoned, same as for Upsert.
+	return runDeploymentCommand(rn, "update", name, "--delete-policy", "ABANDON", "--project", projectID)
+}
+
+// CancelPreview cancels the preview of the deployment, leaving the deployment unchanged.
+func CancelPreview(name, projectID string, rn runner.Runner) error {
+	return runDeploymentCommand(rn, "cancel-preview", name, "--project", projectID)
+}
+
+func runDeploymentCommand(rn runner.Runner, args ...string) error {
+	cmd := exec.Command("gcloud", append([]string{"deployment-manager", "deployments"}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stdout
+	if err := rn.CmdRun(cmd); err != nil {
+		return fmt.Errorf("failed to run command: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deploymentmanager
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const previewDescription = `{
+	"deployment": {
+		"name": "foo-deployment"
+	},
+	"resources": [
+		{
+			"name": "unchanged-bucket",
+			"type": "storage.v1.bucket"
+		},
+		{
+			"name": "new-bucket",
+			"type": "storage.v1.bucket",
+			"update": {"intent": "CREATE_OR_ACQUIRE", "state": "IN_PREVIEW"}
+		},
+		{
+			"name": "foo-dataset",
+			"type": "bigquery.v2.dataset",
+			"update": {"intent": "UPDATE", "state": "IN_PREVIEW"}
+		},
+		{
+			"name": "removed-bucket",
+			"type": "storage.v1.bucket",
+			"update": {"intent": "ABANDON", "state": "IN_PREVIEW"}
+		}
+	]
+}`
+
+// previewCommander records the commands run and answers deployment list and describe calls.
+type previewCommander struct {
+	describeOutput string
+	gotCommands    []string
+}
+
+func (c *previewCommander) CmdRun(cmd *exec.Cmd) error {
+	args := cmd.Args
+	// Drop the temp config file path as it is random.
+	if len(args) > 2 && args[len(args)-2] == "--config" {
+		args = args[:len(args)-1]
+	}
+	c.gotCommands = append(c.gotCommands, strings.Join(args, " "))
+	return nil
+}
+
+func (c *previewCommander) CmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	c.gotCommands = append(c.gotCommands, strings.Join(cmd.Args, " "))
+	if cmd.Args[3] == "describe" {
+		return []byte(c.describeOutput), nil
+	}
+	return nil, fmt.Errorf("fake CmdOutput: unexpected args: %v", cmd.Args)
+}
+
+func (c *previewCommander) CmdCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	if cmd.Args[3] == "list" {
+		return []byte(`[{"name": "foo-deployment"}]`), nil
+	}
+	return nil, fmt.Errorf("fake CmdCombinedOutput: unexpected args: %v", cmd.Args)
+}
+
+func TestPreview(t *testing.T) {
+	rn := &previewCommander{describeOutput: previewDescription}
+	deployment := &Deployment{Resources: []*Resource{{Name: "new-bucket", Type: "storage.v1.bucket"}}}
+
+	got, err := Preview("foo-deployment", deployment, "foo-project", rn)
+	if err != nil {
+		t.Fatalf("Preview = %v", err)
+	}
+
+	want := &Changes{
+		Added:     []ResourceChange{{Name: "new-bucket", Type: "storage.v1.bucket"}},
+		Updated:   []ResourceChange{{Name: "foo-dataset", Type: "bigquery.v2.dataset"}},
+		Abandoned: []ResourceChange{{Name: "removed-bucket", Type: "storage.v1.bucket"}},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("changes differ (-got +want):\n%v", diff)
+	}
+
+	wantCommands := []string{
+		"gcloud deployment-manager deployments update foo-deployment --delete-policy ABANDON --preview --project foo-project --config",
+		"gcloud deployment-manager deployments describe foo-deployment --format json --project foo-project",
+	}
+	if diff := cmp.Diff(rn.gotCommands, wantCommands); diff != "" {
+		t.Errorf("commands differ (-got +want):\n%v", diff)
+	}
+}
+
+func TestPreviewUnknownIntent(t *testing.T) {
+	rn := &previewCommander{describeOutput: `{"resources": [{"name": "foo", "type": "bar", "update": {"intent": "EXPLODE"}}]}`}
+	if _, err := Preview("foo-deployment", &Deployment{}, "foo-project", rn); err == nil {
+		t.Error("Preview with unknown intent = nil, want error")
+	}
+}
+
+func TestCommitAndCancelPreview(t *testing.T) {
+	rn := &previewCommander{}
+	if err := CommitPreview("foo-deployment", "foo-project", rn); err != nil {
+		t.Fatalf("CommitPreview = %v", err)
+	}
+	if err := CancelPreview("foo-deployment", "foo-project", rn); err != nil {
+		t.Fatalf("CancelPreview = %v", err)
+	}
+	wantCommands := []string{
+		"gcloud deployment-manager deployments update foo-deployment --delete-policy ABANDON --project foo-project",
+		"gcloud deployment-manager deployments cancel-preview foo-deployment --project foo-project",
+	}
+	if diff := cmp.Diff(rn.gotCommands, wantCommands); diff != "" {
+		t.Errorf("commands differ (-got +want):\n%v", diff)
+	}
+}
+
+func TestChangesString(t *testing.T) {
+	c := &Changes{
+		Added:     []ResourceChange{{Name: "new-bucket", Type: "storage.v1.bucket"}},
+		Abandoned: []ResourceChange{{Name: "removed-bucket", Type: "storage.v1.bucket"}},
+	}
+	want := `1 resource(s) will be added:
+  + new-bucket (storage.v1.bucket)
+1 resource(s) will be abandoned and must be deleted manually if no longer needed:
+  ! removed-bucket (storage.v1.bucket)
+`
+	if got := c.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := new(Changes).String(); got != "No changes.\n" {
+		t.Errorf("String() of no changes = %q, want %q", got, "No changes.\n")
+	}
+}
@@ -0,0 +1,437 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package drift detects differences between a config and the live state of its projects.
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/apply"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+)
+
+// Kind is the kind of a difference between the config and the live state.
+type Kind string
+
+// Kinds of differences.
+const (
+	// Missing is for something in the config that does not exist in the project.
+	Missing Kind = "MISSING"
+	// Abandoned is for a resource in a live deployment that is no longer in the config.
+	// The next apply will abandon the resource, leaving it in the project unmanaged.
+	Abandoned Kind = "ABANDONED"
+	// OutOfBand is for something in the project that is not managed by the config.
+	OutOfBand Kind = "OUT_OF_BAND"
+	// Changed is for a resource whose live properties differ from the config.
+	Changed Kind = "CHANGED"
+)
+
+// Types of things that are compared, other than the deployment manager types of resources.
+const (
+	typeProject    = "project"
+	typeDeployment = "deployment"
+	typeIAMBinding = "iam_binding"
+	typeGCSBucket  = "gcs_bucket"
+)
+
+// Difference is a single difference between the config and the live state of a project.
+type Difference struct {
+	Kind Kind `json:"kind"`
+	// Type is the deployment manager type of the resource, or one of project, deployment, iam_binding or gcs_bucket.
+	Type string `json:"type"`
+	// Name identifies the resource, e.g. "roles/owner group:owners@my-domain.com" for an IAM binding.
+	Name string `json:"name"`
+	// Deployment is the deployment of the resource, if any.
+	Deployment string `json:"deployment,omitempty"`
+	// Details lists the differing properties of a changed resource.
+	Details []string `json:"details,omitempty"`
+}
+
+// ProjectReport lists the differences of a single project.
+type ProjectReport struct {
+	ProjectID   string        `json:"projectId"`
+	Differences []*Difference `json:"differences"`
+}
+
+// Report lists the differences of all projects in a config.
+type Report struct {
+	Projects []*ProjectReport `json:"projects"`
+}
+
+// HasDrift returns whether any project differs from the config.
+func (r *Report) HasDrift() bool {
+	for _, p := range r.Projects {
+		if len(p.Differences) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a human readable report.
+func (r *Report) String() string {
+	var sb strings.Builder
+	for _, p := range r.Projects {
+		if len(p.Differences) == 0 {
+			fmt.Fprintf(&sb, "Project %q: no drift\n", p.ProjectID)
+			continue
+		}
+		fmt.Fprintf(&sb, "Project %q: %d difference(s)\n", p.ProjectID, len(p.Differences))
+		for _, d := range p.Differences {
+			fmt.Fprintf(&sb, "  %-11s %s %s", d.Kind, d.Type, d.Name)
+			if d.Deployment != "" {
+				fmt.Fprintf(&sb, " (deployment %s)", d.Deployment)
+			}
+			sb.WriteString("\n")
+			for _, detail := range d.Details {
+				fmt.Fprintf(&sb, "      %s\n", detail)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// expected is the expected state of a single project.
+type expected struct {
+	deployments []*deploymentmanager.ProjectDeployment
+	bindings    []config.Binding
+	buckets     map[string]bool
+	// stateBucket is the name of the terraform state bucket of the project, if any, created by the toolkit.
+	stateBucket string
+	// terraform is whether the resources of the project are deployed with terraform rather than deployments.
+	terraform bool
+}
+
+// Detect compares the expected state of every project in the config with its live state.
+// If terraform is enabled, resources are deployed with terraform instead of deployment manager, so deployments are
+// not compared.
+func Detect(conf *config.Config, c gcp.Client, enableTerraform bool) (*Report, error) {
+	exps, err := expectedStates(conf, enableTerraform)
+	if err != nil {
+		return nil, err
+	}
+	r := new(Report)
+	for _, p := range conf.AllProjects() {
+		diffs, err := detectProject(conf, p.ID, exps[p.ID], c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect drift of project %q: %v", p.ID, err)
+		}
+		r.Projects = append(r.Projects, &ProjectReport{ProjectID: p.ID, Differences: diffs})
+	}
+	return r, nil
+}
+
+// expectedStates returns the expected state of every project in the config by project ID.
+// Deployments and buckets are attributed to the project they are deployed in, e.g. audit resources to the
+// remote audit logs project.
+func expectedStates(conf *config.Config, enableTerraform bool) (map[string]*expected, error) {
+	exps := make(map[string]*expected)
+	get := func(projectID string) *expected {
+		if exps[projectID] == nil {
+			exps[projectID] = &expected{buckets: make(map[string]bool), terraform: enableTerraform}
+		}
+		return exps[projectID]
+	}
+	for _, p := range conf.AllProjects() {
+		if !enableTerraform {
+			ds, err := apply.Deployments(conf, p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get deployments of project %q: %v", p.ID, err)
+			}
+			for _, d := range ds {
+				get(d.ProjectID).deployments = append(get(d.ProjectID).deployments, d)
+			}
+		}
+		exp := get(p.ID)
+		exp.bindings = apply.Bindings(conf, p)
+		if p.TerraformConfig != nil && p.TerraformConfig.StateBucket != nil {
+			exp.stateBucket = p.TerraformConfig.StateBucket.Name
+		}
+		for _, b := range p.Resources.GCSBuckets {
+			exp.buckets[b.Name()] = true
+		}
+		if b := p.AuditLogs.LogsGCSBucket; b != nil {
+			get(conf.ProjectForAuditLogs(p).ID).buckets[b.Name()] = true
+		}
+	}
+	return exps, nil
+}
+
+func detectProject(conf *config.Config, projectID string, exp *expected, c gcp.Client) ([]*Difference, error) {
+	live, err := c.GetProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if live == nil {
+		return []*Difference{{Kind: Missing, Type: typeProject, Name: projectID}}, nil
+	}
+
+	var deploymentDiffs []*Difference
+	if !exp.terraform {
+		deploymentDiffs, err = detectDeployments(projectID, exp.deployments, c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	bindingDiffs, err := detectBindings(conf, projectID, exp.bindings, c)
+	if err != nil {
+		return nil, err
+	}
+	bucketDiffs, err := detectBuckets(conf, projectID, exp.buckets, exp.stateBucket, c)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []*Difference
+	diffs = append(diffs, deploymentDiffs...)
+	diffs = append(diffs, bindingDiffs...)
+	diffs = append(diffs, bucketDiffs...)
+	return diffs, nil
+}
+
+func detectDeployments(projectID string, want []*deploymentmanager.ProjectDeployment, c gcp.Client) ([]*Difference, error) {
+	names, err := c.ListDeployments(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %v", err)
+	}
+	liveNames := make(map[string]bool)
+	for _, n := range names {
+		liveNames[n] = true
+	}
+
+	var diffs []*Difference
+	for _, d := range want {
+		if !liveNames[d.Name] {
+			diffs = append(diffs, &Difference{Kind: Missing, Type: typeDeployment, Name: d.Name})
+			continue
+		}
+		delete(liveNames, d.Name)
+		got, err := c.GetDeployment(projectID, d.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployment %q: %v", d.Name, err)
+		}
+		diffs = append(diffs, compareDeployments(d.Name, d.Deployment, got)...)
+	}
+
+	var outOfBand []string
+	for n := range liveNames {
+		outOfBand = append(outOfBand, n)
+	}
+	sort.Strings(outOfBand)
+	for _, n := range outOfBand {
+		diffs = append(diffs, &Difference{Kind: OutOfBand, Type: typeDeployment, Name: n})
+	}
+	return diffs, nil
+}
+
+// compareDeployments compares the top level resources of the expected and live deployment.
+func compareDeployments(name string, want, got *deploymentmanager.Deployment) []*Difference {
+	gotResources := make(map[string]*deploymentmanager.Resource)
+	for _, r := range got.Resources {
+		gotResources[r.Name] = r
+	}
+
+	var diffs []*Difference
+	for _, w := range want.Resources {
+		g, ok := gotResources[w.Name]
+		if !ok {
+			diffs = append(diffs, &Difference{Kind: Missing, Type: w.Type, Name: w.Name, Deployment: name})
+			continue
+		}
+		delete(gotResources, w.Name)
+
+		var details []string
+		// Imports are stored by name in the manifest, so only compare the file names of templates.
+		if filepath.Base(w.Type) != filepath.Base(g.Type) {
+			details = append(details, fmt.Sprintf("type: want %q, got %q", w.Type, g.Type))
+		}
+		details = append(details, diffValues("properties", normalize(w.Properties), normalize(g.Properties))...)
+		if len(details) > 0 {
+			diffs = append(diffs, &Difference{Kind: Changed, Type: w.Type, Name: w.Name, Deployment: name, Details: details})
+		}
+	}
+
+	for _, g := range got.Resources {
+		if _, ok := gotResources[g.Name]; ok {
+			diffs = append(diffs, &Difference{Kind: Abandoned, Type: g.Type, Name: g.Name, Deployment: name})
+		}
+	}
+	return diffs
+}
+
+// normalize converts the properties to their JSON representation so values of different Go types compare equal.
+func normalize(properties map[string]interface{}) interface{} {
+	if len(properties) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(properties)
+	if err != nil {
+		return properties
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return properties
+	}
+	return v
+}
+
+// diffValues returns the paths of the values that differ, with their expected and live values.
+func diffValues(path string, want, got interface{}) []string {
+	wantMap, wantIsMap := want.(map[string]interface{})
+	gotMap, gotIsMap := got.(map[string]interface{})
+	if wantIsMap && gotIsMap {
+		keys := make(map[string]bool)
+		for k := range wantMap {
+			keys[k] = true
+		}
+		for k := range gotMap {
+			keys[k] = true
+		}
+		var sorted []string
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		var diffs []string
+		for _, k := range sorted {
+			diffs = append(diffs, diffValues(path+"."+k, wantMap[k], gotMap[k])...)
+		}
+		return diffs
+	}
+
+	wantList, wantIsList := want.([]interface{})
+	gotList, gotIsList := got.([]interface{})
+	if wantIsList && gotIsList && len(wantList) == len(gotList) {
+		var diffs []string
+		for i := range wantList {
+			diffs = append(diffs, diffValues(fmt.Sprintf("%s[%d]", path, i), wantList[i], gotList[i])...)
+		}
+		return diffs
+	}
+
+	if reflect.DeepEqual(want, got) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: want %s, got %s", path, valueString(want), valueString(got))}
+}
+
+func valueString(v interface{}) string {
+	if v == nil {
+		return "<unset>"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+func detectBindings(conf *config.Config, projectID string, want []config.Binding, c gcp.Client) ([]*Difference, error) {
+	policy, err := c.GetIAMPolicy(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get iam policy: %v", err)
+	}
+
+	wantSet := make(map[string]bool)
+	var diffs []*Difference
+	for _, b := range want {
+		for _, m := range b.Members {
+			wantSet[b.Role+" "+m] = true
+			if !policy.HasBinding(b.Role, m) {
+				diffs = append(diffs, &Difference{Kind: Missing, Type: typeIAMBinding, Name: b.Role + " " + m})
+			}
+		}
+	}
+
+	for _, b := range policy.Bindings {
+		for _, m := range b.Members {
+			if wantSet[b.Role+" "+m] || isManagedMember(conf, projectID, m) {
+				continue
+			}
+			diffs = append(diffs, &Difference{Kind: OutOfBand, Type: typeIAMBinding, Name: b.Role + " " + m})
+		}
+	}
+	return diffs, nil
+}
+
+// serviceAgentRE matches the emails of Google managed service agents, e.g. the Google APIs service account used by
+// deployment manager, service-<num>@ agents and per-service gcp-sa-* agents. Other Google created service accounts,
+// e.g. the compute and App Engine default service accounts, are not managed and their bindings are reported.
+var serviceAgentRE = regexp.MustCompile(`^(\d+@cloudservices\.gserviceaccount\.com|service-\d+@.+|[^@]+@gcp-sa-[^@]+)$`)
+
+// forsetiServiceAccountRE matches the service accounts created by the Forseti installation in the Forseti project.
+var forsetiServiceAccountRE = regexp.MustCompile(`^forseti-(server|client)-gcp-[^@]+@`)
+
+// isManagedMember returns whether the member is managed by GCP or the toolkit rather than the config.
+// These are Google managed service agents and the service accounts of the Forseti installation in the Forseti
+// project.
+func isManagedMember(conf *config.Config, projectID, member string) bool {
+	email := strings.TrimPrefix(member, "serviceAccount:")
+	if email == member {
+		return false
+	}
+	if serviceAgentRE.MatchString(email) {
+		return true
+	}
+	isForsetiProject := conf.Forseti != nil && conf.Forseti.Project.ID == projectID
+	return isForsetiProject && forsetiServiceAccountRE.MatchString(email) && strings.HasSuffix(email, "@"+projectID+".iam.gserviceaccount.com")
+}
+
+func detectBuckets(conf *config.Config, projectID string, want map[string]bool, stateBucket string, c gcp.Client) ([]*Difference, error) {
+	urls, err := c.ListBuckets(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list buckets: %v", err)
+	}
+	live := make(map[string]bool)
+	for _, u := range urls {
+		live[strings.TrimPrefix(u, "gs://")] = true
+	}
+
+	var diffs []*Difference
+	var wantNames []string
+	for n := range want {
+		wantNames = append(wantNames, n)
+	}
+	sort.Strings(wantNames)
+	for _, n := range wantNames {
+		if !live[n] {
+			diffs = append(diffs, &Difference{Kind: Missing, Type: typeGCSBucket, Name: n})
+		}
+	}
+
+	var liveNames []string
+	for n := range live {
+		liveNames = append(liveNames, n)
+	}
+	sort.Strings(liveNames)
+	isForsetiProject := conf.Forseti != nil && conf.Forseti.Project.ID == projectID
+	for _, n := range liveNames {
+		// Terraform state buckets and the buckets of the Forseti installation are created by the toolkit.
+		if want[n] || n == stateBucket || (isForsetiProject && strings.HasPrefix(n, "forseti-")) {
+			continue
+		}
+		diffs = append(diffs, &Difference{Kind: OutOfBand, Type: typeGCSBucket, Name: n})
+	}
+	return diffs, nil
+}
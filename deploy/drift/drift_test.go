@@ -0,0 +1,281 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drift
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/apply"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/testconf"
+	"github.com/google/go-cmp/cmp"
+)
+
+const bucketConfig = `
+resources:
+  gcs_buckets:
+  - properties:
+      name: foo-bucket
+      location: us-east1
+      versioning:
+        enabled: true`
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(p *gcp.FakeProject)
+		want   []*Difference
+	}{
+		{
+			name:   "no_drift",
+			mutate: func(*gcp.FakeProject) {},
+		},
+		{
+			name: "missing_deployment",
+			mutate: func(p *gcp.FakeProject) {
+				delete(p.Deployments, "data-protect-toolkit-prerequisites")
+			},
+			want: []*Difference{
+				{Kind: Missing, Type: "deployment", Name: "data-protect-toolkit-prerequisites"},
+			},
+		},
+		{
+			name: "changed_and_abandoned_resources",
+			mutate: func(p *gcp.FakeProject) {
+				d := p.Deployments["data-protect-toolkit-resources"]
+				for _, r := range d.Resources {
+					if r.Name == "foo-bucket" {
+						r.Properties["versioning"] = map[string]interface{}{"enabled": false}
+						r.Properties["labels"] = map[string]interface{}{"env": "prod"}
+					}
+				}
+				d.Resources = append(d.Resources, &deploymentmanager.Resource{Name: "old-bucket", Type: "storage.v1.bucket"})
+			},
+			want: []*Difference{
+				{
+					Kind:       Changed,
+					Type:       "deploy/config/templates/gcs_bucket/gcs_bucket.py",
+					Name:       "foo-bucket",
+					Deployment: "data-protect-toolkit-resources",
+					Details: []string{
+						`properties.labels: want <unset>, got {"env":"prod"}`,
+						`properties.versioning.enabled: want true, got false`,
+					},
+				},
+				{Kind: Abandoned, Type: "storage.v1.bucket", Name: "old-bucket", Deployment: "data-protect-toolkit-resources"},
+			},
+		},
+		{
+			name: "missing_resource",
+			mutate: func(p *gcp.FakeProject) {
+				d := p.Deployments["data-protect-toolkit-resources"]
+				var rs []*deploymentmanager.Resource
+				for _, r := range d.Resources {
+					if r.Name != "foo-bucket" {
+						rs = append(rs, r)
+					}
+				}
+				d.Resources = rs
+			},
+			want: []*Difference{
+				{Kind: Missing, Type: "deploy/config/templates/gcs_bucket/gcs_bucket.py", Name: "foo-bucket", Deployment: "data-protect-toolkit-resources"},
+			},
+		},
+		{
+			name: "out_of_band_changes",
+			mutate: func(p *gcp.FakeProject) {
+				p.Deployments["manual-deployment"] = &deploymentmanager.Deployment{}
+				p.Policy.Bindings = append(p.Policy.Bindings,
+					&gcp.Binding{Role: "roles/editor", Members: []string{"user:someone@my-domain.com"}},
+					// Google managed service accounts are ignored.
+					&gcp.Binding{Role: "roles/editor", Members: []string{
+						"serviceAccount:1111@cloudservices.gserviceaccount.com",
+						"serviceAccount:service-1111@compute-system.iam.gserviceaccount.com",
+						"serviceAccount:p1111-2222@gcp-sa-logging.iam.gserviceaccount.com",
+					}},
+				)
+				p.Buckets = append(p.Buckets, "gs://manual-bucket")
+			},
+			want: []*Difference{
+				{Kind: OutOfBand, Type: "deployment", Name: "manual-deployment"},
+				{Kind: OutOfBand, Type: "iam_binding", Name: "roles/editor user:someone@my-domain.com"},
+				{Kind: OutOfBand, Type: "gcs_bucket", Name: "manual-bucket"},
+			},
+		},
+		{
+			name: "default_service_account_bindings",
+			mutate: func(p *gcp.FakeProject) {
+				// Google created default service accounts are not service agents, so their grants are reported.
+				p.Policy.Bindings = append(p.Policy.Bindings,
+					&gcp.Binding{Role: "roles/owner", Members: []string{
+						"serviceAccount:1111-compute@developer.gserviceaccount.com",
+						"serviceAccount:my-project@appspot.gserviceaccount.com",
+					}},
+				)
+			},
+			want: []*Difference{
+				{Kind: OutOfBand, Type: "iam_binding", Name: "roles/owner serviceAccount:1111-compute@developer.gserviceaccount.com"},
+				{Kind: OutOfBand, Type: "iam_binding", Name: "roles/owner serviceAccount:my-project@appspot.gserviceaccount.com"},
+			},
+		},
+		{
+			name: "missing_binding_and_bucket",
+			mutate: func(p *gcp.FakeProject) {
+				var bs []*gcp.Binding
+				for _, b := range p.Policy.Bindings {
+					if b.Role != "roles/iam.securityReviewer" {
+						bs = append(bs, b)
+					}
+				}
+				p.Policy.Bindings = bs
+				p.Buckets = []string{"gs://my-project-logs", "gs://my-project-state"}
+			},
+			want: []*Difference{
+				{Kind: Missing, Type: "iam_binding", Name: "roles/iam.securityReviewer group:my-project-auditors@my-domain.com"},
+				{Kind: Missing, Type: "iam_binding", Name: "roles/iam.securityReviewer serviceAccount:forseti@my-forseti-project.iam.gserviceaccount.com"},
+				{Kind: Missing, Type: "gcs_bucket", Name: "foo-bucket"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, project := testconf.ConfigAndProject(t, &testconf.ConfigData{bucketConfig})
+			fake := newLiveFake(t, conf, project)
+			tc.mutate(fake.Project(project.ID))
+
+			r, err := Detect(conf, fake, false)
+			if err != nil {
+				t.Fatalf("Detect = %v", err)
+			}
+
+			var got []*Difference
+			for _, p := range r.Projects {
+				switch p.ProjectID {
+				case project.ID:
+					got = p.Differences
+				case conf.Forseti.Project.ID:
+					// The Forseti project was not deployed.
+					want := []*Difference{{Kind: Missing, Type: "project", Name: p.ProjectID}}
+					if diff := cmp.Diff(p.Differences, want); diff != "" {
+						t.Errorf("forseti project differences differ (-got +want):\n%v", diff)
+					}
+				}
+			}
+			// Templates are imported by their absolute path.
+			for _, w := range tc.want {
+				if strings.HasPrefix(w.Type, "deploy/") {
+					abs, err := filepath.Abs(w.Type)
+					if err != nil {
+						t.Fatalf("filepath.Abs = %v", err)
+					}
+					w.Type = abs
+				}
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("differences differ (-got +want):\n%v", diff)
+			}
+			if !r.HasDrift() {
+				t.Error("HasDrift = false, want true")
+			}
+		})
+	}
+}
+
+func TestDetectStateBucket(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, &testconf.ConfigData{bucketConfig})
+	project.TerraformConfig.StateBucket.Name = "my-custom-state"
+	fake := newLiveFake(t, conf, project)
+	fake.Project(project.ID).Buckets = []string{"gs://foo-bucket", "gs://my-custom-state", "gs://my-project-logs", "gs://my-project-state"}
+
+	r, err := Detect(conf, fake, false)
+	if err != nil {
+		t.Fatalf("Detect = %v", err)
+	}
+	var got []*Difference
+	for _, p := range r.Projects {
+		if p.ProjectID == project.ID {
+			got = p.Differences
+		}
+	}
+	// Only the configured state bucket is created by the toolkit.
+	want := []*Difference{{Kind: OutOfBand, Type: "gcs_bucket", Name: "my-project-state"}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("differences differ (-got +want):\n%v", diff)
+	}
+}
+
+func TestDetectTerraform(t *testing.T) {
+	conf, project := testconf.ConfigAndProject(t, &testconf.ConfigData{bucketConfig})
+	fake := newLiveFake(t, conf, project)
+	// Resources deployed with terraform are not in deployments.
+	fake.Project(project.ID).Deployments = make(map[string]*deploymentmanager.Deployment)
+
+	r, err := Detect(conf, fake, true)
+	if err != nil {
+		t.Fatalf("Detect = %v", err)
+	}
+	for _, p := range r.Projects {
+		if p.ProjectID == project.ID && len(p.Differences) > 0 {
+			t.Errorf("differences of project %q = %+v, want none", p.ProjectID, p.Differences)
+		}
+	}
+}
+
+func TestReportString(t *testing.T) {
+	r := &Report{Projects: []*ProjectReport{
+		{ProjectID: "project-a"},
+		{ProjectID: "project-b", Differences: []*Difference{
+			{Kind: Changed, Type: "storage.v1.bucket", Name: "foo-bucket", Deployment: "foo-deployment", Details: []string{"properties.location: want \"US\", got \"EU\""}},
+			{Kind: OutOfBand, Type: "iam_binding", Name: "roles/editor user:someone@my-domain.com"},
+		}},
+	}}
+	want := `Project "project-a": no drift
+Project "project-b": 2 difference(s)
+  CHANGED     storage.v1.bucket foo-bucket (deployment foo-deployment)
+      properties.location: want "US", got "EU"
+  OUT_OF_BAND iam_binding roles/editor user:someone@my-domain.com
+`
+	if got := r.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	b, err := json.Marshal(r.Projects[1].Differences[1])
+	if err != nil {
+		t.Fatalf("json.Marshal = %v", err)
+	}
+	wantJSON := `{"kind":"OUT_OF_BAND","type":"iam_binding","name":"roles/editor user:someone@my-domain.com"}`
+	if string(b) != wantJSON {
+		t.Errorf("json.Marshal = %s, want %s", b, wantJSON)
+	}
+}
+
+// newLiveFake returns a fake with the project deployed as expected by the config.
+func newLiveFake(t *testing.T, conf *config.Config, project *config.Project) *gcp.Fake {
+	t.Helper()
+	fake := testconf.DeployedFake(t, conf, project, apply.Deployments)
+	p := fake.Project(project.ID)
+	for _, b := range apply.Bindings(conf, project) {
+		p.Policy.Bindings = append(p.Policy.Bindings, &gcp.Binding{Role: b.Role, Members: b.Members})
+	}
+	p.Policy.Bindings = append(p.Policy.Bindings, &gcp.Binding{Role: "roles/owner", Members: []string{"serviceAccount:1111@cloudservices.gserviceaccount.com"}})
+	p.Buckets = []string{"gs://foo-bucket", "gs://my-project-logs", "gs://my-project-state"}
+	return fake
+}
@@ -0,0 +1,219 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gcp provides a client to make the calls to GCP needed to deploy projects.
+// The calls are grouped behind a single interface so deployments can be tested against the in-memory
+// Fake, and so gcloud can be swapped for direct API clients without changing callers.
+package gcp
+
+import (
+	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
+)
+
+// Client makes calls to GCP.
+type Client interface {
+	// GetProject returns the project with the given ID, or nil if it does not exist or cannot be accessed.
+	GetProject(projectID string) (*Project, error)
+	// CreateProject creates the project under the given parent. The parent type is "folder" or "organization",
+	// or empty if the project has no parent.
+	CreateProject(projectID, parentType, parentID string) error
+	// LinkBillingAccount links the project to the billing account.
+	LinkBillingAccount(projectID, billingAccount string) error
+	// EnableServices enables the service APIs in the project.
+	EnableServices(projectID string, services []string) error
+	// DeleteProject requests the deletion of the project. GCP shuts the project down and deletes it 30 days later.
+	DeleteProject(projectID string) error
+
+	// CurrentAccount returns the account of the currently authenticated user.
+	CurrentAccount() (string, error)
+	// GetIAMPolicy returns the IAM policy of the project.
+	GetIAMPolicy(projectID string) (*IAMPolicy, error)
+	// AddIAMBinding grants the role to the member in the project.
+	AddIAMBinding(projectID, role, member string) error
+	// RemoveIAMBinding removes the role from the member in the project.
+	RemoveIAMBinding(projectID, role, member string) error
+	// ListServiceAccounts returns the emails of the service accounts in the project.
+	ListServiceAccounts(projectID string) ([]string, error)
+
+	// GetLogSinkWriter returns the writer identity (without the "serviceAccount:" prefix) of the log sink in the project.
+	GetLogSinkWriter(projectID, sinkName string) (string, error)
+
+	// ListLiens returns the liens on the project.
+	ListLiens(projectID string) ([]*Lien, error)
+	// CreateLien places a lien with the given restriction on the project.
+	CreateLien(projectID, restriction, reason string) error
+	// DeleteLien deletes the lien with the given name (e.g. liens/123) from the project.
+	DeleteLien(projectID, name string) error
+
+	// ImageExists returns whether the custom compute image exists in the project.
+	ImageExists(projectID, imageName string) (bool, error)
+	// CreateImage creates a custom compute image in the project from the image at the GCS URI.
+	CreateImage(projectID, imageName, sourceURI string) error
+
+	// MonitoringWorkspaceExists returns whether the project is a Stackdriver workspace.
+	MonitoringWorkspaceExists(projectID string) (bool, error)
+	// ListNotificationChannels returns the Stackdriver notification channels of the project.
+	ListNotificationChannels(projectID string) ([]*NotificationChannel, error)
+	// CreateNotificationChannel creates the Stackdriver notification channel and returns its name.
+	CreateNotificationChannel(projectID string, channel *NotificationChannel) (string, error)
+	// ListAlertPolicies returns the Stackdriver alerting policies of the project.
+	ListAlertPolicies(projectID string) ([]*AlertPolicy, error)
+	// CreateAlertPolicy creates the Stackdriver alerting policy.
+	CreateAlertPolicy(projectID string, policy *AlertPolicy) error
+
+	// ListBuckets returns the URLs (e.g. gs://my-bucket) of the GCS buckets in the project.
+	ListBuckets(projectID string) ([]string, error)
+	// CopyBucket copies all objects of the GCS bucket or directory to the destination, e.g. gs://archive/my-bucket.
+	CopyBucket(sourceURL, destinationURL string) error
+
+	// ListTables returns the IDs of the tables in the BigQuery dataset, not including views.
+	ListTables(projectID, datasetID string) ([]string, error)
+	// DatasetExists returns whether the BigQuery dataset exists in the project.
+	DatasetExists(projectID, datasetID string) (bool, error)
+	// ExportTable exports the BigQuery table in Avro format to the destination URI, e.g. gs://archive/my-table/*.avro.
+	ExportTable(projectID, datasetID, tableID, destinationURI string) error
+
+	// ListDeployments returns the names of the deployment manager deployments in the project.
+	ListDeployments(projectID string) ([]string, error)
+
+	// GetDeployment returns the deployment manager deployment as configured by its latest manifest.
+	GetDeployment(projectID, name string) (*deploymentmanager.Deployment, error)
+
+	// UpsertDeployment creates the deployment manager deployment if it does not exist, else updates it.
+	UpsertDeployment(projectID, name string, deployment *deploymentmanager.Deployment) error
+
+	// PreviewDeployment creates or updates the deployment manager deployment in preview mode and returns the
+	// changes it would make. The preview must be committed or cancelled before the deployment can be changed again.
+	PreviewDeployment(projectID, name string, deployment *deploymentmanager.Deployment) (*deploymentmanager.Changes, error)
+
+	// CommitDeploymentPreview commits the preview of the deployment manager deployment.
+	CommitDeploymentPreview(projectID, name string) error
+
+	// CancelDeploymentPreview cancels the preview of the deployment manager deployment.
+	CancelDeploymentPreview(projectID, name string) error
+
+	// AbandonDeployment deletes the deployment manager deployment, leaving its resources in the project unmanaged.
+	AbandonDeployment(projectID, name string) error
+
+	// TerraformPlan plans the terraform config in the given dir and returns a summary of the changes.
+	TerraformPlan(config *terraform.Config, dir string, opts *terraform.Options) (*terraform.PlanSummary, error)
+	// TerraformApply applies the terraform config in the given dir.
+	// It fails without changing anything if the plan deletes protected resources, unless allowed in the options.
+	TerraformApply(config *terraform.Config, dir string, opts *terraform.Options) error
+	// TerraformOutputs returns the values of the outputs of the terraform config applied in the given dir.
+	TerraformOutputs(dir string) (map[string]interface{}, error)
+
+	// GetClusterCredentials fetches the credentials of the GKE cluster so subsequent Kubernetes configs are
+	// applied to it. The location type is either "--region" or "--zone".
+	GetClusterCredentials(projectID, clusterName, locationType, location string) error
+	// ApplyKubernetesConfig applies the Kubernetes config file to the cluster of the last fetched credentials.
+	ApplyKubernetesConfig(path string) error
+	// ImportBinauthzPolicy imports the binary authorization policy file into the project.
+	ImportBinauthzPolicy(projectID, path string) error
+}
+
+// Project is a GCP project.
+type Project struct {
+	ProjectNumber  string   `json:"projectNumber"`
+	LifecycleState string   `json:"lifecycleState"`
+	Parent         Resource `json:"parent"`
+}
+
+// Resource identifies a resource such as a folder or organization.
+type Resource struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// IAMPolicy is the IAM policy of a project.
+type IAMPolicy struct {
+	Bindings []*Binding `json:"bindings,omitempty"`
+}
+
+// Binding grants a role to members.
+type Binding struct {
+	Role    string   `json:"role"`
+	Members []string `json:"members"`
+}
+
+// HasBinding returns whether the policy grants the role to the member.
+func (p *IAMPolicy) HasBinding(role, member string) bool {
+	for _, b := range p.Bindings {
+		if b.Role != role {
+			continue
+		}
+		for _, m := range b.Members {
+			if m == member {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NotificationChannel is a Stackdriver notification channel alerts are sent to.
+type NotificationChannel struct {
+	// Name is the unique name of the channel, e.g. projects/my-project/notificationChannels/123. It is set by GCP.
+	Name        string            `json:"name,omitempty"`
+	Type        string            `json:"type"`
+	DisplayName string            `json:"displayName"`
+	Labels      map[string]string `json:"labels"`
+}
+
+// AlertPolicy is a Stackdriver alerting policy.
+type AlertPolicy struct {
+	// Name is the unique name of the policy, e.g. projects/my-project/alertPolicies/123. It is set by GCP.
+	Name                 string              `json:"name,omitempty"`
+	DisplayName          string              `json:"displayName"`
+	Documentation        *AlertDocumentation `json:"documentation,omitempty"`
+	Conditions           []*AlertCondition   `json:"conditions"`
+	Combiner             string              `json:"combiner"`
+	Enabled              bool                `json:"enabled"`
+	NotificationChannels []string            `json:"notificationChannels"`
+}
+
+// AlertDocumentation is the documentation included in the notifications of an alerting policy.
+type AlertDocumentation struct {
+	Content  string `json:"content"`
+	MimeType string `json:"mimeType"`
+}
+
+// AlertCondition is a condition that triggers an alerting policy.
+type AlertCondition struct {
+	DisplayName        string              `json:"displayName"`
+	ConditionThreshold *ConditionThreshold `json:"conditionThreshold"`
+}
+
+// ConditionThreshold triggers an alert when a time series crosses the threshold for the duration.
+type ConditionThreshold struct {
+	Filter         string         `json:"filter"`
+	Aggregations   []*Aggregation `json:"aggregations,omitempty"`
+	Comparison     string         `json:"comparison"`
+	ThresholdValue float64        `json:"thresholdValue"`
+	Duration       string         `json:"duration"`
+}
+
+// Aggregation aligns the points of a time series before it is compared with the threshold.
+type Aggregation struct {
+	AlignmentPeriod  string `json:"alignmentPeriod"`
+	PerSeriesAligner string `json:"perSeriesAligner"`
+}
+
+// Lien restricts actions on a project.
+type Lien struct {
+	Name         string   `json:"name"`
+	Restrictions []string `json:"restrictions"`
+	Reason       string   `json:"reason"`
+}
@@ -0,0 +1,926 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
+)
+
+// Fake is a stateful in-memory Client.
+// Calls change the state of the fake projects the same way they would change real projects, so a
+// whole deployment can be run against it and the resulting state checked afterwards.
+// It is safe for concurrent use.
+type Fake struct {
+	// Account is the currently authenticated account.
+	Account string
+	// TerraformOutputValues are the values of terraform outputs, keyed by output name, as they would be known
+	// after the resources they refer to were created.
+	TerraformOutputValues map[string]interface{}
+
+	mu                sync.Mutex
+	projects          map[string]*FakeProject
+	nextProjectNumber int64
+	currentCluster    string
+	terraformApplies  []*FakeTerraformApply
+	copies            []*FakeCopy
+	// terraformDirs maps terraform dirs to the last config applied in them.
+	terraformDirs map[string]*terraform.Config
+	// terraformStates maps terraform backends to the addresses of the resources and modules in their state
+	// and their properties.
+	terraformStates map[string]map[string]interface{}
+}
+
+// FakeProject is the state of a project in the Fake.
+// Fields can be set to seed the state before the fake is used and read after it was used.
+type FakeProject struct {
+	Project
+
+	BillingAccount  string
+	Services        map[string]bool
+	Policy          IAMPolicy
+	ServiceAccounts []string
+	// LogSinkWriters maps log sink names to their writer identity.
+	LogSinkWriters map[string]string
+	Liens          []*Lien
+	// Images maps custom image names to their source URI.
+	Images map[string]string
+	// MonitoringWorkspace is whether the project is a Stackdriver workspace.
+	MonitoringWorkspace  bool
+	NotificationChannels []*NotificationChannel
+	AlertPolicies        []*AlertPolicy
+	Buckets              []string
+	// Tables maps the IDs of the BigQuery datasets in the project to the IDs of their tables.
+	Tables map[string][]string
+	// Deployments maps deployment names to their latest deployment.
+	Deployments map[string]*deploymentmanager.Deployment
+	// DeploymentPreviews maps deployment names to their deployment in preview, until committed or cancelled.
+	DeploymentPreviews map[string]*deploymentmanager.Deployment
+	// KubernetesConfigs maps GKE cluster names to the contents of the configs applied to them in order.
+	KubernetesConfigs map[string][]string
+	BinauthzPolicy    string
+}
+
+// FakeTerraformApply is a terraform config applied to the Fake.
+type FakeTerraformApply struct {
+	Config  *terraform.Config
+	Imports []terraform.Import
+}
+
+// FakeCopy is a copy of GCS objects or an export of a BigQuery table made in the Fake.
+type FakeCopy struct {
+	Source      string
+	Destination string
+}
+
+// NewFake returns a new Fake without any projects.
+func NewFake() *Fake {
+	return &Fake{
+		Account:               "fake-user@example.com",
+		projects:              make(map[string]*FakeProject),
+		terraformStates:       make(map[string]map[string]interface{}),
+		terraformDirs:         make(map[string]*terraform.Config),
+		TerraformOutputValues: make(map[string]interface{}),
+		nextProjectNumber:     100000000001,
+	}
+}
+
+// AddProject adds an active project and returns its state so it can be seeded.
+func (f *Fake) AddProject(projectID, projectNumber, parentType, parentID string) *FakeProject {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addProject(projectID, projectNumber, parentType, parentID)
+}
+
+func (f *Fake) addProject(projectID, projectNumber, parentType, parentID string) *FakeProject {
+	p := &FakeProject{
+		Project: Project{
+			ProjectNumber:  projectNumber,
+			LifecycleState: "ACTIVE",
+			Parent:         Resource{Type: parentType, ID: parentID},
+		},
+		Services:           make(map[string]bool),
+		LogSinkWriters:     make(map[string]string),
+		Images:             make(map[string]string),
+		Tables:             make(map[string][]string),
+		Deployments:        make(map[string]*deploymentmanager.Deployment),
+		DeploymentPreviews: make(map[string]*deploymentmanager.Deployment),
+		KubernetesConfigs:  make(map[string][]string),
+	}
+	f.projects[projectID] = p
+	return p
+}
+
+// Project returns the state of the project, or nil if it does not exist.
+// The state must not be modified while the fake is used concurrently.
+func (f *Fake) Project(projectID string) *FakeProject {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.projects[projectID]
+}
+
+// TerraformApplies returns the terraform configs applied so far, in order.
+func (f *Fake) TerraformApplies() []*FakeTerraformApply {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*FakeTerraformApply(nil), f.terraformApplies...)
+}
+
+// Copies returns the bucket copies and table exports made so far, in order.
+func (f *Fake) Copies() []*FakeCopy {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*FakeCopy(nil), f.copies...)
+}
+
+// project returns the existing project. f.mu must be held.
+func (f *Fake) project(projectID string) (*FakeProject, error) {
+	p, ok := f.projects[projectID]
+	if !ok {
+		return nil, fmt.Errorf("project %q not found", projectID)
+	}
+	return p, nil
+}
+
+// GetProject implements Client.GetProject.
+func (f *Fake) GetProject(projectID string) (*Project, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.projects[projectID]
+	if !ok {
+		return nil, nil
+	}
+	cp := p.Project
+	return &cp, nil
+}
+
+// CreateProject implements Client.CreateProject.
+// The current account is made owner of the new project.
+func (f *Fake) CreateProject(projectID, parentType, parentID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.projects[projectID]; ok {
+		return fmt.Errorf("project %q already exists", projectID)
+	}
+	p := f.addProject(projectID, strconv.FormatInt(f.nextProjectNumber, 10), parentType, parentID)
+	f.nextProjectNumber++
+	p.Policy.Bindings = []*Binding{{Role: "roles/owner", Members: []string{"user:" + f.Account}}}
+	return nil
+}
+
+// LinkBillingAccount implements Client.LinkBillingAccount.
+func (f *Fake) LinkBillingAccount(projectID, billingAccount string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	p.BillingAccount = billingAccount
+	return nil
+}
+
+// EnableServices implements Client.EnableServices.
+func (f *Fake) EnableServices(projectID string, services []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	for _, s := range services {
+		p.Services[s] = true
+	}
+	return nil
+}
+
+// DeleteProject implements Client.DeleteProject.
+// Like GCP, it fails if the project has a lien restricting its deletion.
+func (f *Fake) DeleteProject(projectID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	for _, l := range p.Liens {
+		for _, r := range l.Restrictions {
+			if r == "resourcemanager.projects.delete" {
+				return fmt.Errorf("project %q has lien %q restricting its deletion", projectID, l.Name)
+			}
+		}
+	}
+	p.LifecycleState = "DELETE_REQUESTED"
+	return nil
+}
+
+// CurrentAccount implements Client.CurrentAccount.
+func (f *Fake) CurrentAccount() (string, error) {
+	return f.Account, nil
+}
+
+// GetIAMPolicy implements Client.GetIAMPolicy.
+func (f *Fake) GetIAMPolicy(projectID string) (*IAMPolicy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return nil, err
+	}
+	policy := new(IAMPolicy)
+	for _, b := range p.Policy.Bindings {
+		policy.Bindings = append(policy.Bindings, &Binding{Role: b.Role, Members: append([]string(nil), b.Members...)})
+	}
+	return policy, nil
+}
+
+// AddIAMBinding implements Client.AddIAMBinding.
+func (f *Fake) AddIAMBinding(projectID, role, member string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	if p.Policy.HasBinding(role, member) {
+		return nil
+	}
+	for _, b := range p.Policy.Bindings {
+		if b.Role == role {
+			b.Members = append(b.Members, member)
+			return nil
+		}
+	}
+	p.Policy.Bindings = append(p.Policy.Bindings, &Binding{Role: role, Members: []string{member}})
+	return nil
+}
+
+// RemoveIAMBinding implements Client.RemoveIAMBinding.
+func (f *Fake) RemoveIAMBinding(projectID, role, member string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	if !p.Policy.HasBinding(role, member) {
+		return fmt.Errorf("policy binding with role %q and member %q not found", role, member)
+	}
+	var bindings []*Binding
+	for _, b := range p.Policy.Bindings {
+		if b.Role == role {
+			var members []string
+			for _, m := range b.Members {
+				if m != member {
+					members = append(members, m)
+				}
+			}
+			if len(members) == 0 {
+				continue
+			}
+			b.Members = members
+		}
+		bindings = append(bindings, b)
+	}
+	p.Policy.Bindings = bindings
+	return nil
+}
+
+// ListServiceAccounts implements Client.ListServiceAccounts.
+func (f *Fake) ListServiceAccounts(projectID string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), p.ServiceAccounts...), nil
+}
+
+// GetLogSinkWriter implements Client.GetLogSinkWriter.
+func (f *Fake) GetLogSinkWriter(projectID, sinkName string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return "", err
+	}
+	w, ok := p.LogSinkWriters[sinkName]
+	if !ok {
+		return "", fmt.Errorf("log sink %q not found in project %q", sinkName, projectID)
+	}
+	return w, nil
+}
+
+// ListLiens implements Client.ListLiens.
+func (f *Fake) ListLiens(projectID string) ([]*Lien, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*Lien(nil), p.Liens...), nil
+}
+
+// CreateLien implements Client.CreateLien.
+func (f *Fake) CreateLien(projectID, restriction, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	p.Liens = append(p.Liens, &Lien{
+		Name:         fmt.Sprintf("liens/p%s-l%d", p.ProjectNumber, len(p.Liens)+1),
+		Restrictions: []string{restriction},
+		Reason:       reason,
+	})
+	return nil
+}
+
+// DeleteLien implements Client.DeleteLien.
+func (f *Fake) DeleteLien(projectID, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	for i, l := range p.Liens {
+		if l.Name == name {
+			p.Liens = append(p.Liens[:i], p.Liens[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("lien %q not found in project %q", name, projectID)
+}
+
+// ImageExists implements Client.ImageExists.
+func (f *Fake) ImageExists(projectID, imageName string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return false, err
+	}
+	_, ok := p.Images[imageName]
+	return ok, nil
+}
+
+// CreateImage implements Client.CreateImage.
+func (f *Fake) CreateImage(projectID, imageName, sourceURI string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	if _, ok := p.Images[imageName]; ok {
+		return fmt.Errorf("image %q already exists", imageName)
+	}
+	p.Images[imageName] = sourceURI
+	return nil
+}
+
+// MonitoringWorkspaceExists implements Client.MonitoringWorkspaceExists.
+func (f *Fake) MonitoringWorkspaceExists(projectID string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return false, err
+	}
+	return p.MonitoringWorkspace, nil
+}
+
+// ListNotificationChannels implements Client.ListNotificationChannels.
+func (f *Fake) ListNotificationChannels(projectID string) ([]*NotificationChannel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*NotificationChannel(nil), p.NotificationChannels...), nil
+}
+
+// CreateNotificationChannel implements Client.CreateNotificationChannel.
+func (f *Fake) CreateNotificationChannel(projectID string, channel *NotificationChannel) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return "", err
+	}
+	c := *channel
+	c.Name = fmt.Sprintf("projects/%s/notificationChannels/%d", projectID, len(p.NotificationChannels)+1)
+	p.NotificationChannels = append(p.NotificationChannels, &c)
+	return c.Name, nil
+}
+
+// ListAlertPolicies implements Client.ListAlertPolicies.
+func (f *Fake) ListAlertPolicies(projectID string) ([]*AlertPolicy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*AlertPolicy(nil), p.AlertPolicies...), nil
+}
+
+// CreateAlertPolicy implements Client.CreateAlertPolicy.
+func (f *Fake) CreateAlertPolicy(projectID string, policy *AlertPolicy) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	cp := *policy
+	cp.Name = fmt.Sprintf("projects/%s/alertPolicies/%d", projectID, len(p.AlertPolicies)+1)
+	p.AlertPolicies = append(p.AlertPolicies, &cp)
+	return nil
+}
+
+// ListBuckets implements Client.ListBuckets.
+func (f *Fake) ListBuckets(projectID string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), p.Buckets...), nil
+}
+
+// CopyBucket implements Client.CopyBucket.
+func (f *Fake) CopyBucket(sourceURL, destinationURL string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.copies = append(f.copies, &FakeCopy{Source: sourceURL, Destination: destinationURL})
+	return nil
+}
+
+// ListTables implements Client.ListTables.
+func (f *Fake) ListTables(projectID, datasetID string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), p.Tables[datasetID]...), nil
+}
+
+// DatasetExists implements Client.DatasetExists.
+func (f *Fake) DatasetExists(projectID, datasetID string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return false, err
+	}
+	_, ok := p.Tables[datasetID]
+	return ok, nil
+}
+
+// ExportTable implements Client.ExportTable.
+func (f *Fake) ExportTable(projectID, datasetID, tableID, destinationURI string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	for _, t := range p.Tables[datasetID] {
+		if t == tableID {
+			f.copies = append(f.copies, &FakeCopy{
+				Source:      fmt.Sprintf("%s:%s.%s", projectID, datasetID, tableID),
+				Destination: destinationURI,
+			})
+			return nil
+		}
+	}
+	return fmt.Errorf("table %q not found in dataset %q", tableID, datasetID)
+}
+
+// ListDeployments implements Client.ListDeployments.
+func (f *Fake) ListDeployments(projectID string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for n := range p.Deployments {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetDeployment implements Client.GetDeployment.
+func (f *Fake) GetDeployment(projectID, name string) (*deploymentmanager.Deployment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := p.Deployments[name]
+	if !ok {
+		return nil, fmt.Errorf("deployment %q not found", name)
+	}
+	return copyDeployment(d)
+}
+
+// UpsertDeployment implements Client.UpsertDeployment.
+// Log sinks in the deployment are created with a new writer identity, like deployment manager does for
+// sinks with a unique writer identity.
+func (f *Fake) UpsertDeployment(projectID, name string, deployment *deploymentmanager.Deployment) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	if _, ok := p.DeploymentPreviews[name]; ok {
+		return fmt.Errorf("deployment %q is in preview", name)
+	}
+	d, err := copyDeployment(deployment)
+	if err != nil {
+		return err
+	}
+	p.upsertDeployment(name, d)
+	return nil
+}
+
+// upsertDeployment stores the deployment and creates its log sinks. f.mu must be held.
+func (p *FakeProject) upsertDeployment(name string, d *deploymentmanager.Deployment) {
+	p.Deployments[name] = d
+	for _, r := range d.Resources {
+		if r.Type == "logging.v2.sink" {
+			p.addLogSink(r.Name)
+		}
+	}
+}
+
+// addLogSink creates a writer for the log sink if it does not exist yet. f.mu must be held.
+func (p *FakeProject) addLogSink(name string) {
+	if _, ok := p.LogSinkWriters[name]; !ok {
+		p.LogSinkWriters[name] = fmt.Sprintf("p%s-%06d@gcp-sa-logging.iam.gserviceaccount.com", p.ProjectNumber, len(p.LogSinkWriters)+1)
+	}
+}
+
+// addBucket adds the bucket URL to the project if it does not exist yet.
+func (p *FakeProject) addBucket(url string) {
+	for _, b := range p.Buckets {
+		if b == url {
+			return
+		}
+	}
+	p.Buckets = append(p.Buckets, url)
+}
+
+// copyDeployment returns a deep copy of the deployment, so later changes by the caller do not change the state.
+func copyDeployment(deployment *deploymentmanager.Deployment) (*deploymentmanager.Deployment, error) {
+	b, err := json.Marshal(deployment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal deployment: %v", err)
+	}
+	d := new(deploymentmanager.Deployment)
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal deployment: %v", err)
+	}
+	return d, nil
+}
+
+// PreviewDeployment implements Client.PreviewDeployment.
+// Changes are computed from the top level resources of the deployment, resources removed from the deployment
+// are abandoned.
+func (f *Fake) PreviewDeployment(projectID, name string, deployment *deploymentmanager.Deployment) (*deploymentmanager.Changes, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.DeploymentPreviews[name]; ok {
+		return nil, fmt.Errorf("deployment %q is already in preview", name)
+	}
+	d, err := copyDeployment(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	old := make(map[string]*deploymentmanager.Resource)
+	if cur := p.Deployments[name]; cur != nil {
+		for _, r := range cur.Resources {
+			old[r.Name] = r
+		}
+	}
+	changes := new(deploymentmanager.Changes)
+	for _, r := range d.Resources {
+		rc := deploymentmanager.ResourceChange{Name: r.Name, Type: r.Type}
+		o, ok := old[r.Name]
+		delete(old, r.Name)
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, rc)
+		case !reflect.DeepEqual(o, r):
+			changes.Updated = append(changes.Updated, rc)
+		}
+	}
+	for _, r := range old {
+		changes.Abandoned = append(changes.Abandoned, deploymentmanager.ResourceChange{Name: r.Name, Type: r.Type})
+	}
+	changes.Sort()
+
+	p.DeploymentPreviews[name] = d
+	return changes, nil
+}
+
+// CommitDeploymentPreview implements Client.CommitDeploymentPreview.
+func (f *Fake) CommitDeploymentPreview(projectID, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	d, ok := p.DeploymentPreviews[name]
+	if !ok {
+		return fmt.Errorf("deployment %q is not in preview", name)
+	}
+	delete(p.DeploymentPreviews, name)
+	p.upsertDeployment(name, d)
+	return nil
+}
+
+// CancelDeploymentPreview implements Client.CancelDeploymentPreview.
+func (f *Fake) CancelDeploymentPreview(projectID, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	if _, ok := p.DeploymentPreviews[name]; !ok {
+		return fmt.Errorf("deployment %q is not in preview", name)
+	}
+	delete(p.DeploymentPreviews, name)
+	return nil
+}
+
+// AbandonDeployment implements Client.AbandonDeployment.
+func (f *Fake) AbandonDeployment(projectID, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	if _, ok := p.Deployments[name]; !ok {
+		return fmt.Errorf("deployment %q not found in project %q", name, projectID)
+	}
+	delete(p.Deployments, name)
+	return nil
+}
+
+// TerraformPlan implements Client.TerraformPlan.
+// Resources and modules are compared by address and properties with the state of the last config applied with
+// the same backend. Modules are treated as a single resource.
+func (f *Fake) TerraformPlan(config *terraform.Config, _ string, _ *terraform.Options) (*terraform.PlanSummary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, _, err := f.terraformPlan(config)
+	return s, err
+}
+
+// terraformPlan returns the plan of the config and its state after it was applied. f.mu must be held.
+func (f *Fake) terraformPlan(config *terraform.Config) (*terraform.PlanSummary, map[string]interface{}, error) {
+	state := make(map[string]interface{})
+	add := func(addr string, props interface{}) error {
+		// Normalize the properties so they can be compared with the state.
+		b, err := json.Marshal(props)
+		if err != nil {
+			return fmt.Errorf("failed to marshal properties of %q: %v", addr, err)
+		}
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return fmt.Errorf("failed to unmarshal properties of %q: %v", addr, err)
+		}
+		state[addr] = v
+		return nil
+	}
+	for _, r := range config.Resources {
+		if err := add(r.Type+"."+r.Name, r.Properties); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, m := range config.Modules {
+		if err := add("module."+m.Name, m.Properties); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	prev := f.terraformStates[terraformBackendKey(config)]
+	s := new(terraform.PlanSummary)
+	for addr, after := range state {
+		before, ok := prev[addr]
+		switch {
+		case !ok:
+			s.Changes = append(s.Changes, &terraform.ResourceChange{Address: addr, Action: terraform.ActionCreate, After: after})
+		case !reflect.DeepEqual(before, after):
+			s.Changes = append(s.Changes, &terraform.ResourceChange{Address: addr, Action: terraform.ActionUpdate, Before: before, After: after})
+		}
+	}
+	for addr, before := range prev {
+		if _, ok := state[addr]; !ok {
+			s.Changes = append(s.Changes, &terraform.ResourceChange{Address: addr, Action: terraform.ActionDelete, Before: before})
+		}
+	}
+	for _, c := range s.Changes {
+		i := strings.LastIndex(c.Address, ".")
+		c.Type, c.Name = c.Address[:i], c.Address[i+1:]
+	}
+	sort.Slice(s.Changes, func(i, j int) bool { return s.Changes[i].Address < s.Changes[j].Address })
+	return s, state, nil
+}
+
+// terraformBackendKey returns the key of the state of the config in the terraform states.
+func terraformBackendKey(config *terraform.Config) string {
+	return backendKey(config.Terraform.Backend)
+}
+
+// backendKey returns the key of the state in the backend in the terraform states. Local state has an empty key.
+func backendKey(b *terraform.Backend) string {
+	if b == nil {
+		return ""
+	}
+	return b.Bucket + "/" + b.Prefix
+}
+
+// TerraformApply implements Client.TerraformApply.
+func (f *Fake) TerraformApply(config *terraform.Config, dir string, opts *terraform.Options) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, state, err := f.terraformPlan(config)
+	if err != nil {
+		return err
+	}
+	if err := terraform.CheckProtectedDeletes(s, opts); err != nil {
+		return err
+	}
+	if opts != nil && opts.Confirm != nil {
+		if err := opts.Confirm(s); err != nil {
+			return err
+		}
+	}
+	if err := f.createTerraformResources(config); err != nil {
+		return err
+	}
+	key := terraformBackendKey(config)
+	if opts != nil && opts.MigrateStateTo != nil {
+		key = backendKey(opts.MigrateStateTo)
+	}
+	f.terraformStates[key] = state
+	f.terraformDirs[dir] = config
+	a := &FakeTerraformApply{Config: config}
+	if opts != nil {
+		a.Imports = append(a.Imports, opts.Imports...)
+	}
+	f.terraformApplies = append(f.terraformApplies, a)
+	return nil
+}
+
+// createTerraformResources creates the log sinks and storage buckets of the config in their projects.
+// f.mu must be held.
+func (f *Fake) createTerraformResources(config *terraform.Config) error {
+	for _, r := range config.Resources {
+		if r.Type != "google_logging_project_sink" && r.Type != "google_storage_bucket" {
+			continue
+		}
+		b, err := json.Marshal(r.Properties)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %q: %v", r.Type+"."+r.Name, err)
+		}
+		var res struct {
+			Name    string `json:"name"`
+			Project string `json:"project"`
+		}
+		if err := json.Unmarshal(b, &res); err != nil {
+			return fmt.Errorf("failed to unmarshal %q: %v", r.Type+"."+r.Name, err)
+		}
+		// Resources in the provider's default project are not modelled.
+		if res.Project == "" {
+			continue
+		}
+		p, err := f.project(res.Project)
+		if err != nil {
+			return err
+		}
+		switch r.Type {
+		case "google_logging_project_sink":
+			p.addLogSink(res.Name)
+		case "google_storage_bucket":
+			p.addBucket("gs://" + res.Name)
+		}
+	}
+	return nil
+}
+
+// TerraformOutputs implements Client.TerraformOutputs.
+// It returns the values in TerraformOutputValues of the outputs of the config last applied in the dir.
+func (f *Fake) TerraformOutputs(dir string) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	config, ok := f.terraformDirs[dir]
+	if !ok {
+		return nil, fmt.Errorf("no terraform config applied in %q", dir)
+	}
+	outputs := make(map[string]interface{})
+	for _, o := range config.Outputs {
+		v, ok := f.TerraformOutputValues[o.Name]
+		if !ok {
+			return nil, fmt.Errorf("no value for terraform output %q", o.Name)
+		}
+		outputs[o.Name] = v
+	}
+	return outputs, nil
+}
+
+// GetClusterCredentials implements Client.GetClusterCredentials.
+func (f *Fake) GetClusterCredentials(projectID, clusterName, locationType, location string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.project(projectID); err != nil {
+		return err
+	}
+	if locationType != "--region" && locationType != "--zone" {
+		return fmt.Errorf("unexpected location type %q", locationType)
+	}
+	f.currentCluster = projectID + "/" + clusterName
+	return nil
+}
+
+// ApplyKubernetesConfig implements Client.ApplyKubernetesConfig.
+func (f *Fake) ApplyKubernetesConfig(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %v", path, err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.currentCluster == "" {
+		return errors.New("no cluster credentials")
+	}
+	parts := strings.SplitN(f.currentCluster, "/", 2)
+	p, err := f.project(parts[0])
+	if err != nil {
+		return err
+	}
+	p.KubernetesConfigs[parts[1]] = append(p.KubernetesConfigs[parts[1]], string(b))
+	return nil
+}
+
+// ImportBinauthzPolicy implements Client.ImportBinauthzPolicy.
+func (f *Fake) ImportBinauthzPolicy(projectID, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %v", path, err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.project(projectID)
+	if err != nil {
+		return err
+	}
+	p.BinauthzPolicy = string(b)
+	return nil
+}
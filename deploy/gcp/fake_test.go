@@ -0,0 +1,169 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFakeProject(t *testing.T) {
+	f := NewFake()
+	if p, err := f.GetProject("my-project"); p != nil || err != nil {
+		t.Fatalf("GetProject before create = %v, %v; want nil, nil", p, err)
+	}
+	if err := f.CreateProject("my-project", "folder", "98765321"); err != nil {
+		t.Fatalf("CreateProject = %v", err)
+	}
+	if err := f.CreateProject("my-project", "folder", "98765321"); err == nil {
+		t.Error("CreateProject for existing project = nil, want error")
+	}
+
+	p, err := f.GetProject("my-project")
+	if err != nil {
+		t.Fatalf("GetProject = %v", err)
+	}
+	want := &Project{
+		ProjectNumber:  p.ProjectNumber,
+		LifecycleState: "ACTIVE",
+		Parent:         Resource{ID: "98765321", Type: "folder"},
+	}
+	if p.ProjectNumber == "" {
+		t.Error("created project has no project number")
+	}
+	if diff := cmp.Diff(p, want); diff != "" {
+		t.Errorf("project differs (-got +want):\n%v", diff)
+	}
+
+	// The creating user is the owner of a new project.
+	owner := "user:" + f.Account
+	policy, err := f.GetIAMPolicy("my-project")
+	if err != nil {
+		t.Fatalf("GetIAMPolicy = %v", err)
+	}
+	if !policy.HasBinding("roles/owner", owner) {
+		t.Errorf("creating user %q is not owner", owner)
+	}
+	if err := f.RemoveIAMBinding("my-project", "roles/owner", owner); err != nil {
+		t.Fatalf("RemoveIAMBinding = %v", err)
+	}
+	if err := f.RemoveIAMBinding("my-project", "roles/owner", owner); err == nil {
+		t.Error("RemoveIAMBinding for removed member = nil, want error")
+	}
+	if policy, _ := f.GetIAMPolicy("my-project"); policy.HasBinding("roles/owner", owner) {
+		t.Errorf("creating user %q is still owner after removal", owner)
+	}
+}
+
+func TestFakeUpsertDeployment(t *testing.T) {
+	f := NewFake()
+	p := f.AddProject("my-project", "1111", "folder", "98765321")
+
+	d := &deploymentmanager.Deployment{
+		Resources: []*deploymentmanager.Resource{{
+			Name:       "audit-logs-to-bigquery",
+			Type:       "logging.v2.sink",
+			Properties: map[string]interface{}{"sink": "audit-logs-to-bigquery"},
+		}},
+	}
+	if err := f.UpsertDeployment("my-project", "audit", d); err != nil {
+		t.Fatalf("UpsertDeployment = %v", err)
+	}
+	if _, err := f.GetLogSinkWriter("my-project", "audit-logs-to-bigquery"); err != nil {
+		t.Fatalf("GetLogSinkWriter = %v", err)
+	}
+	sa := p.LogSinkWriters["audit-logs-to-bigquery"]
+	if !strings.HasSuffix(sa, "@gcp-sa-logging.iam.gserviceaccount.com") {
+		t.Errorf("log sink writer = %q, want a logging service account", sa)
+	}
+
+	// The stored deployment must not change when the caller modifies its copy.
+	d.Resources[0].Name = "changed"
+	if got := p.Deployments["audit"].Resources[0].Name; got != "audit-logs-to-bigquery" {
+		t.Errorf("stored deployment resource name = %q, want %q", got, "audit-logs-to-bigquery")
+	}
+
+	// Upserting again keeps the writer identity.
+	if err := f.UpsertDeployment("my-project", "audit", d); err != nil {
+		t.Fatalf("UpsertDeployment update = %v", err)
+	}
+	if got := p.LogSinkWriters["audit-logs-to-bigquery"]; got != sa {
+		t.Errorf("log sink writer after update = %q, want %q", got, sa)
+	}
+}
+
+func TestFakeTerraformPlan(t *testing.T) {
+	f := NewFake()
+	conf := terraform.NewConfig()
+	conf.Terraform.Backend = &terraform.Backend{Bucket: "my-project-state"}
+	conf.Resources = []*terraform.Resource{
+		{Name: "a", Type: "google_storage_bucket", Properties: map[string]interface{}{"location": "US"}},
+		{Name: "b", Type: "google_storage_bucket", Properties: map[string]interface{}{"location": "US"}},
+	}
+	if err := f.TerraformApply(conf, "", nil); err != nil {
+		t.Fatalf("TerraformApply = %v", err)
+	}
+
+	conf.Resources = []*terraform.Resource{
+		{Name: "a", Type: "google_storage_bucket", Properties: map[string]interface{}{"location": "EU"}},
+		{Name: "c", Type: "google_storage_bucket", Properties: map[string]interface{}{"location": "US"}},
+	}
+	s, err := f.TerraformPlan(conf, "", nil)
+	if err != nil {
+		t.Fatalf("TerraformPlan = %v", err)
+	}
+	want := &terraform.PlanSummary{Changes: []*terraform.ResourceChange{
+		{
+			Address: "google_storage_bucket.a",
+			Type:    "google_storage_bucket",
+			Name:    "a",
+			Action:  terraform.ActionUpdate,
+			Before:  map[string]interface{}{"location": "US"},
+			After:   map[string]interface{}{"location": "EU"},
+		},
+		{
+			Address: "google_storage_bucket.b",
+			Type:    "google_storage_bucket",
+			Name:    "b",
+			Action:  terraform.ActionDelete,
+			Before:  map[string]interface{}{"location": "US"},
+		},
+		{
+			Address: "google_storage_bucket.c",
+			Type:    "google_storage_bucket",
+			Name:    "c",
+			Action:  terraform.ActionCreate,
+			After:   map[string]interface{}{"location": "US"},
+		},
+	}}
+	if diff := cmp.Diff(s, want); diff != "" {
+		t.Errorf("plan differs (-got +want):\n%v", diff)
+	}
+
+	// Deleting a protected resource fails without applying the config.
+	if err := f.TerraformApply(conf, "", &terraform.Options{Protected: []string{"google_storage_bucket.b"}}); err == nil {
+		t.Fatal("TerraformApply deleting protected resource = nil, want error")
+	}
+	if n := len(f.TerraformApplies()); n != 1 {
+		t.Errorf("got %d terraform applies, want 1", n)
+	}
+	if err := f.TerraformApply(conf, "", &terraform.Options{Protected: []string{"google_storage_bucket.b"}, AllowProtectedDeletes: true}); err != nil {
+		t.Fatalf("TerraformApply allowing protected deletes = %v", err)
+	}
+}
@@ -0,0 +1,503 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/terraform"
+)
+
+// GCloud is the Client that makes calls to GCP by running gcloud, gsutil, kubectl and terraform commands.
+type GCloud struct {
+	Runner runner.Runner
+}
+
+// NewGCloud returns a new GCloud client that runs commands with the given runner.
+func NewGCloud(rn runner.Runner) *GCloud {
+	return &GCloud{Runner: rn}
+}
+
+// GetProject implements Client.GetProject.
+func (g *GCloud) GetProject(projectID string) (*Project, error) {
+	cmd := exec.Command("gcloud", "projects", "describe", projectID, "--format", "json")
+	out, err := g.Runner.CmdOutput(cmd)
+	if err != nil {
+		// `gcloud projects describe` command might fail due to reasons other than project does not
+		// exist (e.g. caller does not have sufficient permission). In that case, project could exist
+		// and the code will return project existence as false. The caller might still attempt to create
+		// the project and fail if the project already exists.
+		return nil, nil
+	}
+	p := new(Project)
+	if err := json.Unmarshal(out, p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal project info output: %v", err)
+	}
+	return p, nil
+}
+
+// CreateProject implements Client.CreateProject.
+func (g *GCloud) CreateProject(projectID, parentType, parentID string) error {
+	args := []string{"projects", "create", projectID}
+	if parentType != "" {
+		args = append(args, fmt.Sprintf("--%s", parentType), parentID)
+	}
+	if err := g.Runner.CmdRun(exec.Command("gcloud", args...)); err != nil {
+		return fmt.Errorf("failed to run project creating command: %v", err)
+	}
+	return nil
+}
+
+// LinkBillingAccount implements Client.LinkBillingAccount.
+func (g *GCloud) LinkBillingAccount(projectID, billingAccount string) error {
+	cmd := exec.Command("gcloud", "beta", "billing", "projects", "link", projectID, "--billing-account", billingAccount)
+	if err := g.Runner.CmdRun(cmd); err != nil {
+		return fmt.Errorf("failed to link project to billing account %q: %v", billingAccount, err)
+	}
+	return nil
+}
+
+// EnableServices implements Client.EnableServices.
+func (g *GCloud) EnableServices(projectID string, services []string) error {
+	min := func(x, y int) int {
+		if x < y {
+			return x
+		}
+		return y
+	}
+
+	// Send in batches to avoid hitting quota limits.
+	batchN := 10
+	for i := 0; i < len(services); i += batchN {
+		args := []string{"--project", projectID, "services", "enable"}
+		args = append(args, services[i:min(i+batchN, len(services))]...)
+		if err := g.Runner.CmdRun(exec.Command("gcloud", args...)); err != nil {
+			return fmt.Errorf("failed to enable service APIs: %v", err)
+		}
+	}
+	return nil
+}
+
+// DeleteProject implements Client.DeleteProject.
+func (g *GCloud) DeleteProject(projectID string) error {
+	if err := g.Runner.CmdRun(exec.Command("gcloud", "projects", "delete", projectID, "--quiet")); err != nil {
+		return fmt.Errorf("failed to delete project %q: %v", projectID, err)
+	}
+	return nil
+}
+
+// CurrentAccount implements Client.CurrentAccount.
+func (g *GCloud) CurrentAccount() (string, error) {
+	cmd := exec.Command("gcloud", "config", "get-value", "account", "--format", "json")
+	out, err := g.Runner.CmdOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to get currently authenticated user: %v", err)
+	}
+	var account string
+	if err := json.Unmarshal(out, &account); err != nil {
+		return "", fmt.Errorf("failed to unmarshal current user: %v", err)
+	}
+	return account, nil
+}
+
+// GetIAMPolicy implements Client.GetIAMPolicy.
+func (g *GCloud) GetIAMPolicy(projectID string) (*IAMPolicy, error) {
+	cmd := exec.Command("gcloud", "projects", "get-iam-policy", projectID, "--project", projectID, "--format", "json")
+	out, err := g.Runner.CmdOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get iam policy bindings: %v", err)
+	}
+	p := new(IAMPolicy)
+	if err := json.Unmarshal(out, p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal get-iam-policy output: %v", err)
+	}
+	return p, nil
+}
+
+// AddIAMBinding implements Client.AddIAMBinding.
+func (g *GCloud) AddIAMBinding(projectID, role, member string) error {
+	cmd := exec.Command(
+		"gcloud", "projects", "add-iam-policy-binding", projectID,
+		"--member", member,
+		"--role", role,
+		"--project", projectID,
+	)
+	if err := g.Runner.CmdRun(cmd); err != nil {
+		return fmt.Errorf("failed to add iam policy binding for member %q for role %q: %v", member, role, err)
+	}
+	return nil
+}
+
+// RemoveIAMBinding implements Client.RemoveIAMBinding.
+func (g *GCloud) RemoveIAMBinding(projectID, role, member string) error {
+	cmd := exec.Command(
+		"gcloud", "projects", "remove-iam-policy-binding", projectID,
+		"--member", member,
+		"--role", role,
+		"--project", projectID,
+	)
+	if err := g.Runner.CmdRun(cmd); err != nil {
+		return fmt.Errorf("failed to remove iam policy binding for member %q for role %q: %v", member, role, err)
+	}
+	return nil
+}
+
+// ListServiceAccounts implements Client.ListServiceAccounts.
+func (g *GCloud) ListServiceAccounts(projectID string) ([]string, error) {
+	cmd := exec.Command("gcloud", "--project", projectID, "iam", "service-accounts", "list", "--format", "json")
+	out, err := g.Runner.CmdOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %v", err)
+	}
+
+	type serviceAccount struct {
+		Email string `json:"email"`
+	}
+	var sas []serviceAccount
+	if err := json.Unmarshal(out, &sas); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal service accounts output: %v", err)
+	}
+	var emails []string
+	for _, sa := range sas {
+		emails = append(emails, sa.Email)
+	}
+	return emails, nil
+}
+
+// GetLogSinkWriter implements Client.GetLogSinkWriter.
+func (g *GCloud) GetLogSinkWriter(projectID, sinkName string) (string, error) {
+	cmd := exec.Command("gcloud", "logging", "sinks", "describe", sinkName, "--format", "json", "--project", projectID)
+	out, err := g.Runner.CmdOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to query log sink service account from gcloud: %v", err)
+	}
+
+	type sink struct {
+		WriterIdentity string `json:"writerIdentity"`
+	}
+	s := new(sink)
+	if err := json.Unmarshal(out, s); err != nil {
+		return "", fmt.Errorf("failed to unmarshal sink output: %v", err)
+	}
+	return strings.TrimPrefix(s.WriterIdentity, "serviceAccount:"), nil
+}
+
+// ListLiens implements Client.ListLiens.
+func (g *GCloud) ListLiens(projectID string) ([]*Lien, error) {
+	cmd := exec.Command("gcloud", "--project", projectID, "alpha", "resource-manager", "liens", "list", "--format", "json")
+	out, err := g.Runner.CmdOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list liens: %v", err)
+	}
+	var liens []*Lien
+	if err := json.Unmarshal(out, &liens); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal liens output: %v", err)
+	}
+	return liens, nil
+}
+
+// CreateLien implements Client.CreateLien.
+func (g *GCloud) CreateLien(projectID, restriction, reason string) error {
+	cmd := exec.Command("gcloud", "--project", projectID, "alpha", "resource-manager", "liens",
+		"create", "--restrictions", restriction, "--reason", reason)
+	if err := g.Runner.CmdRun(cmd); err != nil {
+		return fmt.Errorf("failed to create restriction lien %q: %v", restriction, err)
+	}
+	return nil
+}
+
+// DeleteLien implements Client.DeleteLien.
+func (g *GCloud) DeleteLien(projectID, name string) error {
+	cmd := exec.Command("gcloud", "--project", projectID, "alpha", "resource-manager", "liens",
+		"delete", strings.TrimPrefix(name, "liens/"))
+	if err := g.Runner.CmdRun(cmd); err != nil {
+		return fmt.Errorf("failed to delete lien %q: %v", name, err)
+	}
+	return nil
+}
+
+// ImageExists implements Client.ImageExists.
+func (g *GCloud) ImageExists(projectID, imageName string) (bool, error) {
+	cmd := exec.Command("gcloud", "--project", projectID, "compute", "images", "list",
+		"--no-standard-images", "--filter", fmt.Sprintf("name=%s", imageName), "--format", "value(name)")
+	out, err := g.Runner.CmdOutput(cmd)
+	if err != nil {
+		return false, fmt.Errorf("failed to check the existence of custom image %q: %v", imageName, err)
+	}
+	return len(bytes.TrimSpace(out)) != 0, nil
+}
+
+// CreateImage implements Client.CreateImage.
+func (g *GCloud) CreateImage(projectID, imageName, sourceURI string) error {
+	cmd := exec.Command("gcloud", "--project", projectID, "compute", "images", "create", imageName, "--source-uri", sourceURI)
+	if err := g.Runner.CmdRun(cmd); err != nil {
+		return fmt.Errorf("failed to create custom image %q: %v", imageName, err)
+	}
+	return nil
+}
+
+// MonitoringWorkspaceExists implements Client.MonitoringWorkspaceExists.
+func (g *GCloud) MonitoringWorkspaceExists(projectID string) (bool, error) {
+	cmd := exec.Command("gcloud", "--project", projectID, "alpha", "monitoring", "policies", "list")
+	out, err := g.Runner.CmdCombinedOutput(cmd)
+	if err != nil {
+		if strings.Contains(string(out), "not a Stackdriver workspace") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check stackdriver account existence: %v [%s]", err, string(out))
+	}
+	return true, nil
+}
+
+// ListNotificationChannels implements Client.ListNotificationChannels.
+func (g *GCloud) ListNotificationChannels(projectID string) ([]*NotificationChannel, error) {
+	cmd := exec.Command("gcloud", "--project", projectID, "alpha", "monitoring", "channels", "list", "--format", "json")
+	out, err := g.Runner.CmdOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notification channels: %v", err)
+	}
+	var channels []*NotificationChannel
+	if err := json.Unmarshal(out, &channels); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal notification channels: %v", err)
+	}
+	return channels, nil
+}
+
+// CreateNotificationChannel implements Client.CreateNotificationChannel.
+func (g *GCloud) CreateNotificationChannel(projectID string, channel *NotificationChannel) (string, error) {
+	var name string
+	err := withJSONFile(channel, func(path string) error {
+		cmd := exec.Command("gcloud", "--project", projectID, "alpha", "monitoring", "channels", "create",
+			"--channel-content-from-file", path, "--format", "value(name)")
+		out, err := g.Runner.CmdOutput(cmd)
+		if err != nil {
+			return err
+		}
+		name = strings.TrimSpace(string(out))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create notification channel %q: %v", channel.DisplayName, err)
+	}
+	return name, nil
+}
+
+// ListAlertPolicies implements Client.ListAlertPolicies.
+func (g *GCloud) ListAlertPolicies(projectID string) ([]*AlertPolicy, error) {
+	cmd := exec.Command("gcloud", "--project", projectID, "alpha", "monitoring", "policies", "list", "--format", "json")
+	out, err := g.Runner.CmdOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alert policies: %v", err)
+	}
+	var policies []*AlertPolicy
+	if err := json.Unmarshal(out, &policies); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal alert policies: %v", err)
+	}
+	return policies, nil
+}
+
+// CreateAlertPolicy implements Client.CreateAlertPolicy.
+func (g *GCloud) CreateAlertPolicy(projectID string, policy *AlertPolicy) error {
+	err := withJSONFile(policy, func(path string) error {
+		cmd := exec.Command("gcloud", "--project", projectID, "alpha", "monitoring", "policies", "create",
+			"--policy-from-file", path)
+		return g.Runner.CmdRun(cmd)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create alert policy %q: %v", policy.DisplayName, err)
+	}
+	return nil
+}
+
+// withJSONFile writes v as JSON to a temporary file and calls fn with the path of the file.
+func withJSONFile(v interface{}, fn func(path string) error) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %v", err)
+	}
+	tmp, err := ioutil.TempFile("", "*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		return fmt.Errorf("failed to write temp file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %v", err)
+	}
+	return fn(tmp.Name())
+}
+
+// ListBuckets implements Client.ListBuckets.
+func (g *GCloud) ListBuckets(projectID string) ([]string, error) {
+	out, err := g.Runner.CmdOutput(exec.Command("gsutil", "ls", "-p", projectID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list buckets: %v", err)
+	}
+	var bs []string
+	for _, b := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if b != "" {
+			bs = append(bs, strings.TrimSuffix(b, "/"))
+		}
+	}
+	return bs, nil
+}
+
+// CopyBucket implements Client.CopyBucket.
+func (g *GCloud) CopyBucket(sourceURL, destinationURL string) error {
+	if err := g.Runner.CmdRun(exec.Command("gsutil", "-m", "rsync", "-r", sourceURL, destinationURL)); err != nil {
+		return fmt.Errorf("failed to copy %q to %q: %v", sourceURL, destinationURL, err)
+	}
+	return nil
+}
+
+// DatasetExists implements Client.DatasetExists.
+func (g *GCloud) DatasetExists(projectID, datasetID string) (bool, error) {
+	cmd := exec.Command("bq", "--project_id", projectID, "show", "--format", "json", fmt.Sprintf("%s:%s", projectID, datasetID))
+	out, err := g.Runner.CmdCombinedOutput(cmd)
+	if err != nil {
+		if strings.Contains(string(out), "Not found") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check the existence of dataset %q: %v", datasetID, err)
+	}
+	return true, nil
+}
+
+// ListTables implements Client.ListTables.
+func (g *GCloud) ListTables(projectID, datasetID string) ([]string, error) {
+	cmd := exec.Command("bq", "--project_id", projectID, "ls", "--format", "json", fmt.Sprintf("%s:%s", projectID, datasetID))
+	out, err := g.Runner.CmdOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables of dataset %q: %v", datasetID, err)
+	}
+	var tables []struct {
+		TableReference struct {
+			TableID string `json:"tableId"`
+		} `json:"tableReference"`
+		Type string `json:"type"`
+	}
+	if len(bytes.TrimSpace(out)) > 0 {
+		if err := json.Unmarshal(out, &tables); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tables: %v", err)
+		}
+	}
+	var ids []string
+	for _, t := range tables {
+		if t.Type == "TABLE" {
+			ids = append(ids, t.TableReference.TableID)
+		}
+	}
+	return ids, nil
+}
+
+// ExportTable implements Client.ExportTable.
+func (g *GCloud) ExportTable(projectID, datasetID, tableID, destinationURI string) error {
+	cmd := exec.Command("bq", "--project_id", projectID, "extract", "--destination_format", "AVRO",
+		fmt.Sprintf("%s:%s.%s", projectID, datasetID, tableID), destinationURI)
+	if err := g.Runner.CmdRun(cmd); err != nil {
+		return fmt.Errorf("failed to export table %q: %v", tableID, err)
+	}
+	return nil
+}
+
+// ListDeployments implements Client.ListDeployments.
+func (g *GCloud) ListDeployments(projectID string) ([]string, error) {
+	return deploymentmanager.List(projectID, g.Runner)
+}
+
+// GetDeployment implements Client.GetDeployment.
+func (g *GCloud) GetDeployment(projectID, name string) (*deploymentmanager.Deployment, error) {
+	return deploymentmanager.Get(name, projectID, g.Runner)
+}
+
+// UpsertDeployment implements Client.UpsertDeployment.
+func (g *GCloud) UpsertDeployment(projectID, name string, deployment *deploymentmanager.Deployment) error {
+	return deploymentmanager.Upsert(name, deployment, projectID, g.Runner)
+}
+
+// PreviewDeployment implements Client.PreviewDeployment.
+func (g *GCloud) PreviewDeployment(projectID, name string, deployment *deploymentmanager.Deployment) (*deploymentmanager.Changes, error) {
+	return deploymentmanager.Preview(name, deployment, projectID, g.Runner)
+}
+
+// CommitDeploymentPreview implements Client.CommitDeploymentPreview.
+func (g *GCloud) CommitDeploymentPreview(projectID, name string) error {
+	return deploymentmanager.CommitPreview(name, projectID, g.Runner)
+}
+
+// CancelDeploymentPreview implements Client.CancelDeploymentPreview.
+func (g *GCloud) CancelDeploymentPreview(projectID, name string) error {
+	return deploymentmanager.CancelPreview(name, projectID, g.Runner)
+}
+
+// AbandonDeployment implements Client.AbandonDeployment.
+func (g *GCloud) AbandonDeployment(projectID, name string) error {
+	return deploymentmanager.Abandon(name, projectID, g.Runner)
+}
+
+// TerraformPlan implements Client.TerraformPlan.
+func (g *GCloud) TerraformPlan(config *terraform.Config, dir string, opts *terraform.Options) (*terraform.PlanSummary, error) {
+	return terraform.Plan(config, dir, opts, g.Runner)
+}
+
+// TerraformApply implements Client.TerraformApply.
+func (g *GCloud) TerraformApply(config *terraform.Config, dir string, opts *terraform.Options) error {
+	return terraform.Apply(config, dir, opts, g.Runner)
+}
+
+// TerraformOutputs implements Client.TerraformOutputs.
+func (g *GCloud) TerraformOutputs(dir string) (map[string]interface{}, error) {
+	return terraform.Outputs(dir, g.Runner)
+}
+
+// GetClusterCredentials implements Client.GetClusterCredentials.
+func (g *GCloud) GetClusterCredentials(projectID, clusterName, locationType, location string) error {
+	cmd := exec.Command("gcloud", "container", "clusters", "get-credentials", clusterName, locationType, location, "--project", projectID)
+	if err := g.Runner.CmdRun(cmd); err != nil {
+		return fmt.Errorf("failed to get cluster credentials for %q: %v", clusterName, err)
+	}
+	return nil
+}
+
+// ApplyKubernetesConfig implements Client.ApplyKubernetesConfig.
+func (g *GCloud) ApplyKubernetesConfig(path string) error {
+	// kubectl declarative object configuration
+	// https://kubernetes.io/docs/concepts/overview/object-management-kubectl/overview/
+	if err := g.Runner.CmdRun(exec.Command("kubectl", "apply", "-f", path)); err != nil {
+		return fmt.Errorf("failed to apply workloads with kubectl: %s", err)
+	}
+	return nil
+}
+
+// ImportBinauthzPolicy implements Client.ImportBinauthzPolicy.
+func (g *GCloud) ImportBinauthzPolicy(projectID, path string) error {
+	// binaryauthorization.googleapis.com must be enabled
+	// https://cloud.google.com/binary-authorization/docs/quickstart
+	cmd := exec.Command("gcloud", "beta", "container", "binauthz", "policy", "import", path, "--project", projectID)
+	if err := g.Runner.CmdRun(cmd); err != nil {
+		return fmt.Errorf("failed to import policy for %q: %v", projectID, err)
+	}
+	return nil
+}
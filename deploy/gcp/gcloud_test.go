@@ -0,0 +1,213 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcp
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeRunner records the args of commands and returns canned output.
+type fakeRunner struct {
+	args   [][]string
+	output string
+	err    error
+}
+
+func (r *fakeRunner) CmdRun(cmd *exec.Cmd) error {
+	r.args = append(r.args, cmd.Args)
+	return r.err
+}
+
+func (r *fakeRunner) CmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	r.args = append(r.args, cmd.Args)
+	return []byte(r.output), r.err
+}
+
+func (r *fakeRunner) CmdCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	return r.CmdOutput(cmd)
+}
+
+func TestGetProject(t *testing.T) {
+	const projectJSON = `{
+		"createTime": "2019-04-15T20:00:16.734Z",
+		"lifecycleState": "ACTIVE",
+		"name": "my-project",
+		"parent": {
+			"id": "98765321",
+			"type": "folder"
+		},
+		"projectId": "my-project",
+		"projectNumber": "1111"
+	}`
+
+	tests := []struct {
+		name   string
+		output string
+		err    error
+		want   *Project
+	}{
+		{
+			name:   "project_exists",
+			output: projectJSON,
+			want: &Project{
+				ProjectNumber:  "1111",
+				LifecycleState: "ACTIVE",
+				Parent:         Resource{ID: "98765321", Type: "folder"},
+			},
+		},
+		{
+			name: "project_does_not_exist",
+			err:  errors.New("not found"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rn := &fakeRunner{output: tc.output, err: tc.err}
+			got, err := NewGCloud(rn).GetProject("my-project")
+			if err != nil {
+				t.Fatalf("GetProject = %v", err)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("project differs (-got +want):\n%v", diff)
+			}
+			wantArgs := [][]string{{"gcloud", "projects", "describe", "my-project", "--format", "json"}}
+			if diff := cmp.Diff(rn.args, wantArgs); diff != "" {
+				t.Errorf("commands differ (-got +want):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestMonitoringWorkspaceExists(t *testing.T) {
+	projectID := "my_project"
+	tests := []struct {
+		name      string
+		cmdError  error
+		cmdOutput string
+		wantExist bool
+		wantErr   bool
+	}{
+		{
+			name:      "account_exist",
+			cmdOutput: "Listed 0 items.",
+			wantExist: true,
+		},
+		{
+			name:      "account_does_not_exist",
+			cmdError:  errors.New(""),
+			cmdOutput: fmt.Sprintf("INVALID_ARGUMENT: 'projects/%s' is not a Stackdriver workspace.", projectID),
+		},
+		{
+			name:      "unexpected_cmd_error",
+			cmdError:  errors.New(""),
+			cmdOutput: fmt.Sprintf("does not have permission to access project [%s]", projectID),
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewGCloud(&fakeRunner{output: tc.cmdOutput, err: tc.cmdError})
+			exist, err := g.MonitoringWorkspaceExists(projectID)
+			if exist != tc.wantExist || (err != nil) != tc.wantErr {
+				t.Fatalf("MonitoringWorkspaceExists(%s) = %t, %v; want %t, error %t", projectID, exist, err, tc.wantExist, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetLogSinkWriter(t *testing.T) {
+	const logSinkJSON = `{
+		"createTime": "2019-04-15T20:00:16.734389353Z",
+		"destination": "bigquery.googleapis.com/projects/my-project/datasets/audit_logs",
+		"filter": "logName:\"logs/cloudaudit.googleapis.com\"",
+		"name": "audit-logs-to-bigquery",
+		"outputVersionFormat": "V2",
+		"updateTime": "2019-04-15T20:00:16.734389353Z",
+		"writerIdentity": "serviceAccount:p12345-999999@gcp-sa-logging.iam.gserviceaccount.com"
+	}`
+
+	rn := &fakeRunner{output: logSinkJSON}
+	got, err := NewGCloud(rn).GetLogSinkWriter("my-project", "audit-logs-to-bigquery")
+	want := "p12345-999999@gcp-sa-logging.iam.gserviceaccount.com"
+	if got != want || err != nil {
+		t.Errorf("GetLogSinkWriter = %q, %v; want %q, nil", got, err, want)
+	}
+	wantArgs := [][]string{{"gcloud", "logging", "sinks", "describe", "audit-logs-to-bigquery", "--format", "json", "--project", "my-project"}}
+	if diff := cmp.Diff(rn.args, wantArgs); diff != "" {
+		t.Errorf("commands differ (-got +want):\n%v", diff)
+	}
+}
+
+func TestGetClusterCredentials(t *testing.T) {
+	region := "foo-center"
+	clusterName := "bar-cluster"
+	projectID := "foo-project"
+	rn := &fakeRunner{}
+	wantArgs := [][]string{{
+		"gcloud", "container", "clusters", "get-credentials", clusterName, "--region", region, "--project", projectID}}
+	if err := NewGCloud(rn).GetClusterCredentials(projectID, clusterName, "--region", region); err != nil {
+		t.Fatalf("GetClusterCredentials error: %v", err)
+	}
+	if diff := cmp.Diff(rn.args, wantArgs); len(diff) != 0 {
+		t.Fatalf("GetClusterCredentials commands differ: (-got, +want)\n:%v", diff)
+	}
+}
+
+func TestApplyKubernetesConfig(t *testing.T) {
+	containerYamlPath := "foo/bar/abc.yaml"
+	rn := &fakeRunner{}
+	wantArgs := [][]string{{
+		"kubectl", "apply", "-f", containerYamlPath}}
+	if err := NewGCloud(rn).ApplyKubernetesConfig(containerYamlPath); err != nil {
+		t.Fatalf("ApplyKubernetesConfig error: %v", err)
+	}
+	if diff := cmp.Diff(rn.args, wantArgs); len(diff) != 0 {
+		t.Fatalf("ApplyKubernetesConfig commands differ: (-got, +want)\n:%v", diff)
+	}
+}
+
+func TestListNotificationChannels(t *testing.T) {
+	r := &fakeRunner{output: `[{
+		"displayName": "Email",
+		"enabled": true,
+		"labels": {"email_address": "alerts@my-domain.com"},
+		"name": "projects/my-project/notificationChannels/123",
+		"type": "email"
+	}]`}
+	got, err := NewGCloud(r).ListNotificationChannels("my-project")
+	if err != nil {
+		t.Fatalf("ListNotificationChannels = %v", err)
+	}
+	want := []*NotificationChannel{{
+		Name:        "projects/my-project/notificationChannels/123",
+		Type:        "email",
+		DisplayName: "Email",
+		Labels:      map[string]string{"email_address": "alerts@my-domain.com"},
+	}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("channels differ (-got +want):\n%v", diff)
+	}
+	wantArgs := [][]string{{"gcloud", "--project", "my-project", "alpha", "monitoring", "channels", "list", "--format", "json"}}
+	if diff := cmp.Diff(r.args, wantArgs); diff != "" {
+		t.Errorf("args differ (-got +want):\n%v", diff)
+	}
+}
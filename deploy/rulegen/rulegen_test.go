@@ -37,7 +37,7 @@ func TestRunOutputPath(t *testing.T) {
 		t.Fatalf("ioutil.TempDir = %v", err)
 	}
 
-	if err := Run(conf, tmpDir); err != nil {
+	if err := Run(conf, tmpDir, &fakeRunner{}); err != nil {
 		t.Fatalf("Run = %v", err)
 	}
 
@@ -48,7 +48,7 @@ func TestRunServerBucket(t *testing.T) {
 	conf, _ := testconf.ConfigAndProject(t, nil)
 
 	var gotArgs []string
-	cmdCombinedOutput = func(cmd *exec.Cmd) ([]byte, error) {
+	rn := &fakeRunner{combinedOutput: func(cmd *exec.Cmd) ([]byte, error) {
 		if len(gotArgs) != 0 {
 			return nil, errors.New("fake CombinedOutput: unexpectedly called more than once")
 		}
@@ -59,8 +59,8 @@ func TestRunServerBucket(t *testing.T) {
 		}
 		checkRulesDir(t, filepath.Dir(gotArgs[2]))
 		return nil, nil
-	}
-	if err := Run(conf, ""); err != nil {
+	}}
+	if err := Run(conf, "", rn); err != nil {
 		t.Fatalf("Run = %v", err)
 	}
 
@@ -111,3 +111,22 @@ rules:
 		t.Fatalf("audit logging rules differ (-got, +want):\n%v", diff)
 	}
 }
+
+type fakeRunner struct {
+	combinedOutput func(cmd *exec.Cmd) ([]byte, error)
+}
+
+func (*fakeRunner) CmdRun(cmd *exec.Cmd) error {
+	return fmt.Errorf("fake CmdRun: unexpected args: %v", cmd.Args)
+}
+
+func (*fakeRunner) CmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return nil, fmt.Errorf("fake CmdOutput: unexpected args: %v", cmd.Args)
+}
+
+func (r *fakeRunner) CmdCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	if r.combinedOutput == nil {
+		return nil, fmt.Errorf("fake CmdCombinedOutput: unexpected args: %v", cmd.Args)
+	}
+	return r.combinedOutput(cmd)
+}
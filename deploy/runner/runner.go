@@ -0,0 +1,74 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package runner provides utilities to execute commands.
+package runner
+
+import (
+	"log"
+	"os"
+	"os/exec"
+)
+
+// Runner is the interface to execute commands.
+// Implementations other than Default are useful to fake command execution, e.g. in tests.
+type Runner interface {
+	CmdRun(cmd *exec.Cmd) error
+	CmdOutput(cmd *exec.Cmd) ([]byte, error)
+	CmdCombinedOutput(cmd *exec.Cmd) ([]byte, error)
+}
+
+// Default is the Runner that executes commands on the local machine.
+type Default struct {
+	// Logger logs the commands that are run, e.g. with a prefix to tell concurrently applied projects apart.
+	// If nil, the standard logger is used.
+	Logger *log.Logger
+	// NonInteractive does not forward stdin to the commands, e.g. when projects are applied concurrently and would
+	// read the same stdin.
+	NonInteractive bool
+}
+
+// logRun logs the command that is run to the configured logger.
+func (d *Default) logRun(cmd *exec.Cmd) {
+	if d == nil || d.Logger == nil {
+		log.Printf("Running: %v", cmd.Args)
+		return
+	}
+	d.Logger.Printf("Running: %v", cmd.Args)
+}
+
+// CmdRun executes the command and forwards its stdin (unless non-interactive), stdout and stderr to the current
+// process.
+func (d *Default) CmdRun(cmd *exec.Cmd) error {
+	d.logRun(cmd)
+	if d == nil || !d.NonInteractive {
+		cmd.Stdin = os.Stdin
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// CmdOutput executes the command and returns its stdout. Stderr is forwarded to the current process.
+func (d *Default) CmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	d.logRun(cmd)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
+
+// CmdCombinedOutput executes the command and returns its combined stdout and stderr.
+func (d *Default) CmdCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	d.logRun(cmd)
+	return cmd.CombinedOutput()
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// File is the Provider of secrets in a local encrypted file. The path is the name of the secret in the file.
+// The file holds a JSON object of secrets by name, encrypted by Encrypt with the 32 byte AES-256 key in the key
+// file, written raw or hex encoded.
+type File struct {
+	Path    string
+	KeyPath string
+
+	once    sync.Once
+	secrets map[string]string
+	err     error
+}
+
+// Get returns the secret of the given name in the file.
+func (f *File) Get(name string) (string, error) {
+	f.once.Do(func() {
+		f.secrets, f.err = f.load()
+	})
+	if f.err != nil {
+		return "", f.err
+	}
+	v, ok := f.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret %q not found in %q", name, f.Path)
+	}
+	return v, nil
+}
+
+func (f *File) load() (map[string]string, error) {
+	key, err := ReadKey(f.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file %q: %v", f.Path, err)
+	}
+	plain, err := Decrypt(b, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets file %q: %v", f.Path, err)
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secrets file %q: %v", f.Path, err)
+	}
+	return secrets, nil
+}
+
+// ReadKey reads the raw or hex encoded 32 byte key in the key file.
+func ReadKey(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %q: %v", path, err)
+	}
+	if h, err := hex.DecodeString(strings.TrimSpace(string(b))); err == nil {
+		b = h
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("key in %q must be 32 bytes, got %d", path, len(b))
+	}
+	return b, nil
+}
+
+// Encrypt encrypts the plaintext with the AES-256 key in GCM mode. The nonce is prepended to the ciphertext.
+func Encrypt(plaintext, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt decrypts the ciphertext encrypted by Encrypt with the key.
+func Decrypt(ciphertext, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	n := gcm.NonceSize()
+	return gcm.Open(nil, ciphertext[:n], ciphertext[n:], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := bytes.Repeat([]byte{7}, 32)
+	keyPath := filepath.Join(dir, "secrets.key")
+	if err := ioutil.WriteFile(keyPath, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile = %v", err)
+	}
+	b, err := Encrypt([]byte(`{"alert_email": "alerts@my-domain.com"}`), key)
+	if err != nil {
+		t.Fatalf("Encrypt = %v", err)
+	}
+	path := filepath.Join(dir, "secrets.enc")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile = %v", err)
+	}
+
+	f := &File{Path: path, KeyPath: keyPath}
+	got, err := f.Get("alert_email")
+	if err != nil {
+		t.Fatalf("Get = %v", err)
+	}
+	if want := "alerts@my-domain.com"; got != want {
+		t.Errorf("Get = %q, want %q", got, want)
+	}
+	if _, err := f.Get("missing"); err == nil {
+		t.Error("Get missing secret = nil error, want error")
+	}
+
+	wrongKeyPath := filepath.Join(dir, "wrong.key")
+	if err := ioutil.WriteFile(wrongKeyPath, bytes.Repeat([]byte{8}, 32), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile = %v", err)
+	}
+	wrong := &File{Path: path, KeyPath: wrongKeyPath}
+	if _, err := wrong.Get("alert_email"); err == nil {
+		t.Error("Get with wrong key = nil error, want error")
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secrets resolves references to secrets, e.g. ${secret:env/ALERT_EMAIL}, and redacts resolved secrets from
+// logs.
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+	"github.com/ghodss/yaml"
+)
+
+// Names of the default providers.
+const (
+	EnvProvider           = "env"
+	FileProvider          = "file"
+	SecretManagerProvider = "secretmanager"
+)
+
+// Provider returns the values of secrets by path.
+type Provider interface {
+	Get(path string) (string, error)
+}
+
+// Env is the Provider of secrets in environment variables. The path is the name of the variable.
+type Env struct{}
+
+// Get returns the value of the environment variable.
+func (Env) Get(path string) (string, error) {
+	v, ok := os.LookupEnv(path)
+	if !ok {
+		return "", fmt.Errorf("environment variable %q is not set", path)
+	}
+	return v, nil
+}
+
+// SecretManagerClient accesses secret versions in Secret Manager.
+type SecretManagerClient interface {
+	AccessSecretVersion(projectID, secret, version string) ([]byte, error)
+}
+
+// GCloudSecretManager is the SecretManagerClient that accesses secrets by running gcloud.
+type GCloudSecretManager struct {
+	Runner runner.Runner
+}
+
+// AccessSecretVersion returns the data of the secret version.
+func (g *GCloudSecretManager) AccessSecretVersion(projectID, secret, version string) ([]byte, error) {
+	return g.Runner.CmdOutput(exec.Command("gcloud", "secrets", "versions", "access", version, "--secret", secret, "--project", projectID))
+}
+
+// SecretManager is the Provider of secrets in Secret Manager. The path is <project>/<secret>[/<version>], the latest
+// version by default.
+type SecretManager struct {
+	Client SecretManagerClient
+}
+
+// Get returns the data of the secret version at the path.
+func (s *SecretManager) Get(path string) (string, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", fmt.Errorf("secret path %q must be <project>/<secret>[/<version>]", path)
+	}
+	version := "latest"
+	if len(parts) == 3 {
+		version = parts[2]
+	}
+	b, err := s.Client.AccessSecretVersion(parts[0], parts[1], version)
+	if err != nil {
+		return "", fmt.Errorf("failed to access version %q of secret %q in project %q: %v", version, parts[1], parts[0], err)
+	}
+	return string(b), nil
+}
+
+// refRE matches references to secrets, e.g. ${secret:env/ALERT_EMAIL}.
+var refRE = regexp.MustCompile(`\$\{secret:([a-z_]+)/([^}]+)\}`)
+
+// HasReference returns whether the string references a secret.
+func HasReference(s string) bool {
+	return refRE.MatchString(s)
+}
+
+// Resolve replaces the references to secrets in the string with their values from the providers, keyed by name.
+// Resolved values are registered to be redacted (see Register).
+func Resolve(s string, providers map[string]Provider) (string, error) {
+	var errs []string
+	resolved := refRE.ReplaceAllStringFunc(s, func(ref string) string {
+		m := refRE.FindStringSubmatch(ref)
+		p, ok := providers[m[1]]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown secret provider %q in %q", m[1], ref))
+			return ref
+		}
+		v, err := p.Get(m[2])
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("failed to get secret %q: %v", ref, err))
+			return ref
+		}
+		Register(v)
+		return v
+	})
+	if len(errs) > 0 {
+		return "", errors.New(strings.Join(errs, "; "))
+	}
+	return resolved, nil
+}
+
+// redaction is the placeholder of secrets in logs.
+const redaction = "[REDACTED]"
+
+var (
+	mu      sync.Mutex
+	secrets []string
+)
+
+// Register redacts the secret from the strings passed to Redact and the writes to redacting writers, e.g. the
+// standard logger once its output is set to a writer returned by NewRedactingWriter.
+func Register(secret string) {
+	if secret == "" {
+		return
+	}
+	forms := quotedForms(secret)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, f := range forms {
+		if !contains(secrets, f) {
+			secrets = append(secrets, f)
+		}
+	}
+	// Longer secrets are redacted first, so secrets containing others are fully redacted.
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// quotedForms returns the secret and the forms it takes inside quotes when rendered, e.g. in JSON and YAML configs
+// or shell scripts.
+func quotedForms(secret string) []string {
+	forms := []string{
+		secret,
+		// YAML single-quoted strings.
+		strings.Replace(secret, "'", "''", -1),
+		// Single-quoted shell words.
+		strings.Replace(secret, "'", `'\''`, -1),
+	}
+	if b, err := json.Marshal(secret); err == nil {
+		forms = append(forms, string(b[1:len(b)-1]))
+	}
+	// YAML double-quoted strings escape differently than JSON.
+	if b, err := yaml.Marshal(secret); err == nil {
+		y := strings.TrimSuffix(string(b), "\n")
+		if len(y) > 1 && (y[0] == '"' || y[0] == '\'') && y[len(y)-1] == y[0] {
+			forms = append(forms, y[1:len(y)-1])
+		}
+	}
+	return forms
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns the string with the registered secrets redacted.
+func Redact(s string) string {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, redaction, -1)
+	}
+	return s
+}
+
+// NewRedactingWriter returns a writer that redacts the registered secrets from the writes to w, e.g. to print
+// reports of rendered configs to stdout. Secrets are only redacted within each write.
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return &redactingWriter{w: w}
+}
+
+// redactingWriter redacts the registered secrets from the writes to w. Loggers write each log line with a single
+// call.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
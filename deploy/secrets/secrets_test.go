@@ -0,0 +1,130 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+// fakeSecretManager holds secret versions keyed by project/secret/version.
+type fakeSecretManager map[string]string
+
+func (f fakeSecretManager) AccessSecretVersion(projectID, secret, version string) ([]byte, error) {
+	v, ok := f[projectID+"/"+secret+"/"+version]
+	if !ok {
+		return nil, fmt.Errorf("secret version not found")
+	}
+	return []byte(v), nil
+}
+
+func TestResolve(t *testing.T) {
+	os.Setenv("TEST_ALERT_EMAIL", "alerts@my-domain.com")
+	defer os.Unsetenv("TEST_ALERT_EMAIL")
+
+	providers := map[string]Provider{
+		EnvProvider: Env{},
+		SecretManagerProvider: &SecretManager{Client: fakeSecretManager{
+			"my-project/db-password/latest": "latest-password",
+			"my-project/db-password/2":      "old-password",
+		}},
+	}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"no reference", "no reference"},
+		{"${secret:env/TEST_ALERT_EMAIL}", "alerts@my-domain.com"},
+		{"password=${secret:secretmanager/my-project/db-password}", "password=latest-password"},
+		{"${secret:secretmanager/my-project/db-password/2},${secret:env/TEST_ALERT_EMAIL}", "old-password,alerts@my-domain.com"},
+	}
+	for _, tc := range tests {
+		got, err := Resolve(tc.in, providers)
+		if err != nil {
+			t.Fatalf("Resolve(%q) = %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{
+		"${secret:unknown/foo}",
+		"${secret:env/TEST_UNSET_VARIABLE}",
+		"${secret:secretmanager/my-project/missing}",
+		"${secret:secretmanager/missing}",
+	} {
+		if _, err := Resolve(in, providers); err == nil {
+			t.Errorf("Resolve(%q) = nil error, want error", in)
+		}
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	Register("w5ecret")
+	var buf bytes.Buffer
+	fmt.Fprintf(NewRedactingWriter(&buf), "Dry run: create notification channel %q", "w5ecret")
+	if got, want := buf.String(), `Dry run: create notification channel "[REDACTED]"`; got != want {
+		t.Errorf("redacted output = %q, want %q", got, want)
+	}
+}
+
+func TestRegisterRedactsLogs(t *testing.T) {
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(NewRedactingWriter(&buf))
+	defer log.SetOutput(out)
+
+	Register(`s3cr3t"value`)
+	log.Printf("terraform config:\n{\"password\": %q}", `s3cr3t"value`)
+	log.Printf("raw: s3cr3t\"value")
+
+	got := buf.String()
+	if strings.Contains(got, "s3cr3t") {
+		t.Errorf("log output contains the secret:\n%s", got)
+	}
+	if n := strings.Count(got, redaction); n != 2 {
+		t.Errorf("log output has %d redactions, want 2:\n%s", n, got)
+	}
+}
+
+func TestRegisterRedactsQuotedForms(t *testing.T) {
+	secrets := []string{
+		"y4ml: it's",
+		"y4ml\t\"tab\"",
+		"#y4ml-comment",
+	}
+	for _, s := range secrets {
+		Register(s)
+		// Rendered deployments quote strings with special characters.
+		b, err := yaml.Marshal(map[string]interface{}{"resources": []interface{}{map[string]string{"password": s}}})
+		if err != nil {
+			t.Fatalf("yaml.Marshal = %v", err)
+		}
+		if got := Redact(string(b)); strings.Contains(got, "y4ml") {
+			t.Errorf("redacted YAML contains secret %q:\n%s", s, got)
+		}
+		// Import scripts quote strings for the shell.
+		if got := Redact("echo '" + strings.Replace(s, "'", `'\''`, -1) + "'"); strings.Contains(got, "y4ml") {
+			t.Errorf("redacted shell command contains secret %q: %s", s, got)
+		}
+	}
+}
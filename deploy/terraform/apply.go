@@ -24,32 +24,115 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-)
 
-// The following vars are stubbed in tests.
-var cmdRun = func(cmd *exec.Cmd) error {
-	log.Printf("Running: %v", cmd.Args)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	return cmd.Run()
-}
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+)
 
 // Options configure a terraform apply call.
 type Options struct {
 	Imports []Import
+	// Protected are the addresses of resources or modules that must not be deleted, e.g. the state bucket.
+	// Applying a plan that deletes or replaces them fails unless AllowProtectedDeletes is set.
+	Protected             []string
+	AllowProtectedDeletes bool
+	// MigrateStateTo is the backend the local state is moved to after the config was applied.
+	// It bootstraps configs that create their own state bucket: the bucket does not exist before the first apply, so
+	// the config is applied with local state first.
+	MigrateStateTo *Backend
+	// CacheDir is the dir with the modules and provider plugins vendored by Vendor. If set, remote modules and
+	// plugins are only used from the cache, so applying does not need network access.
+	CacheDir string
+	// Confirm is called with the plan before it is applied, e.g. to ask a user to confirm it. The plan is not
+	// applied if it returns an error.
+	Confirm func(*PlanSummary) error
 }
 
 // Apply applies the config. The config will be written as a .tf.json file in the given dir.
-func Apply(config *Config, dir string, opts *Options) error {
+// The config is planned first and the plan is applied without prompting, unless it deletes protected resources or
+// is not confirmed.
+func Apply(config *Config, dir string, opts *Options, rn runner.Runner) error {
+	if opts == nil {
+		opts = new(Options)
+	}
+	prepared, initArgs, err := prepare(config, dir, opts, rn)
+	if err != nil {
+		return err
+	}
+	if err := importMissing(opts.Imports, dir, rn); err != nil {
+		return err
+	}
+	s, err := plan(dir, rn)
+	if err != nil {
+		return err
+	}
+	log.Printf("terraform plan:\n%v", s)
+	if err := CheckProtectedDeletes(s, opts); err != nil {
+		return err
+	}
+	if opts.Confirm != nil {
+		if err := opts.Confirm(s); err != nil {
+			return err
+		}
+	}
+	if err := runCmd(rn, dir, "apply", "-input=false", planFile); err != nil {
+		return fmt.Errorf("failed to apply plan: %v", err)
+	}
+	if opts.MigrateStateTo != nil {
+		return migrateState(prepared, initArgs, dir, opts.MigrateStateTo, rn)
+	}
+	return nil
+}
+
+// migrateState moves the local state of the config prepared in the dir to the backend. The dir is initialized again
+// with the init args it was prepared with, e.g. to use the vendored plugins.
+func migrateState(config *Config, initArgs []string, dir string, backend *Backend, rn runner.Runner) error {
+	migrated := *config
+	migrated.Terraform.Backend = backend
+	if err := writeConfig(&migrated, dir); err != nil {
+		return err
+	}
+	args := append(append([]string(nil), initArgs...), "-input=false", "-migrate-state", "-force-copy")
+	if err := runCmd(rn, dir, args...); err != nil {
+		return fmt.Errorf("failed to migrate state to bucket %q: %v", backend.Bucket, err)
+	}
+	return nil
+}
+
+// prepare writes the config to the dir and initializes it. It returns the config written, which uses the vendored
+// modules if the options have a cache dir, and the args the dir was initialized with.
+func prepare(config *Config, dir string, opts *Options, rn runner.Runner) (*Config, []string, error) {
 	if opts == nil {
 		opts = new(Options)
 	}
+	if err := copyLocalModules(config, dir, rn); err != nil {
+		return nil, nil, err
+	}
+	args := []string{"init"}
+	if opts.CacheDir != "" {
+		var err error
+		if config, err = useVendored(config, dir, opts.CacheDir, rn); err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "-plugin-dir="+filepath.Join(opts.CacheDir, pluginsDir))
+	}
+	if err := writeConfig(config, dir); err != nil {
+		return nil, nil, err
+	}
+	if err := runCmd(rn, dir, args...); err != nil {
+		return nil, nil, fmt.Errorf("failed to init terraform dir: %v", err)
+	}
+	return config, args, nil
+}
 
+// copyLocalModules copies the modules with local sources to the dir.
+func copyLocalModules(config *Config, dir string, rn runner.Runner) error {
 	// Copy modules to the running dir from Bazel cache.
 	// Terraform needs write access to the modules which Bazel's cache does not allow.
 	dstMap := make(map[string]bool)
 	for _, m := range config.Modules {
+		if !isLocalSource(m.Source) {
+			continue
+		}
 		dst := filepath.Join(dir, filepath.Dir(m.Source))
 		if dstMap[dst] {
 			continue
@@ -58,16 +141,15 @@ func Apply(config *Config, dir string, opts *Options) error {
 		if err := os.MkdirAll(dst, os.ModePerm); err != nil {
 			return fmt.Errorf("failed to mkdir %q: %v", dst, err)
 		}
-		if err := cmdRun(exec.Command("cp", "-r", m.Source, dst)); err != nil {
+		if err := rn.CmdRun(exec.Command("cp", "-r", m.Source, dst)); err != nil {
 			return fmt.Errorf("failed to copy %q to %q: %v", m.Source, dst, err)
 		}
 	}
+	return nil
+}
 
-	runCmd := func(args ...string) error {
-		cmd := exec.Command("terraform", args...)
-		cmd.Dir = dir
-		return cmdRun(cmd)
-	}
+// writeConfig writes the config as main.tf.json in the dir.
+func writeConfig(config *Config, dir string) error {
 	b, err := json.MarshalIndent(config, "", " ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal terraform config: %v", err)
@@ -79,21 +161,12 @@ func Apply(config *Config, dir string, opts *Options) error {
 	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf.json"), b, 0644); err != nil {
 		return fmt.Errorf("failed to write terraform config: %v", err)
 	}
-
-	if err := runCmd("init"); err != nil {
-		return fmt.Errorf("failed to init terraform dir: %v", err)
-	}
-	for _, imp := range opts.Imports {
-		// TODO: this will fail if the resource does not exist
-		// or is already a part of the state. Avoid this in the long run.
-		// For the time being, ignore the error and just log it.
-		if err := runCmd("import", imp.Address, imp.ID); err != nil {
-			log.Print(err)
-		}
-	}
-
-	if err := runCmd("apply"); err != nil {
-		return fmt.Errorf("failed to apply plan: %v", err)
-	}
 	return nil
 }
+
+// runCmd runs terraform with the args in the dir.
+func runCmd(rn runner.Runner, dir string, args ...string) error {
+	cmd := exec.Command("terraform", args...)
+	cmd.Dir = dir
+	return rn.CmdRun(cmd)
+}
@@ -18,6 +18,8 @@ package terraform
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -29,7 +31,7 @@ import (
 
 func TestApply(t *testing.T) {
 	var b []byte
-	cmdRun = func(cmd *exec.Cmd) error {
+	rn := &fakeRunner{run: func(cmd *exec.Cmd) error {
 		if cmd.Args[0] == "terraform" && len(b) == 0 {
 			var err error
 			b, err = ioutil.ReadFile(filepath.Join(cmd.Dir, "main.tf.json"))
@@ -38,13 +40,19 @@ func TestApply(t *testing.T) {
 			}
 		}
 		return nil
-	}
+	}}
 
 	conf := NewConfig()
 	conf.Terraform.Backend = &Backend{
 		Bucket: "foo-state",
 		Prefix: "foo-prefix",
 	}
+	conf.Terraform.RequiredProviders = map[string]string{"google": "~> 2.20"}
+	conf.Providers = []*Provider{{
+		Name:    "google",
+		Project: "foo-project",
+		Region:  "us-central1",
+	}}
 	conf.Resources = []*Resource{{
 		Name:       "foo-resource",
 		Type:       "foo-type",
@@ -55,18 +63,25 @@ func TestApply(t *testing.T) {
 		Source:     "foo-source",
 		Properties: map[string]interface{}{"prop2": "val2"},
 	}}
+	conf.Outputs = []*Output{{
+		Name:  "foo-output",
+		Value: "${module.foo-module.foo}",
+	}}
 	dir, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Fatalf("ioutil.TempDir: %v", err)
 	}
 	defer os.RemoveAll(dir)
-	if err := Apply(conf, dir, nil); err != nil {
+	if err := Apply(conf, dir, nil, rn); err != nil {
 		t.Fatalf("Forseti = %v", err)
 	}
 
 	wantConfig := `{
 	"terraform": {
 		"required_version": ">= 0.12.0",
+		"required_providers": {
+			"google": "~> 2.20"
+		},
 		"backend": {
 			"gcs": {
 				"bucket": "foo-state",
@@ -74,6 +89,12 @@ func TestApply(t *testing.T) {
 			}
 		}
 	},
+	"provider": [{
+		"google": {
+			"project": "foo-project",
+			"region": "us-central1"
+		}
+	}],
 	"resource": [{
 		"foo-type": {
 			"foo-resource": {
@@ -86,6 +107,11 @@ func TestApply(t *testing.T) {
 			 "source": "foo-source",
 			 "prop2": "val2"
 		}
+	}],
+	"output": [{
+		"foo-output": {
+			"value": "${module.foo-module.foo}"
+		}
 	}]
 }`
 
@@ -102,3 +128,117 @@ func TestApply(t *testing.T) {
 
 	// TODO: test with actual modules
 }
+
+func TestApplyMigrateState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var gotArgs [][]string
+	rn := &fakeRunner{run: func(cmd *exec.Cmd) error {
+		gotArgs = append(gotArgs, cmd.Args)
+		return nil
+	}}
+	backend := &Backend{Bucket: "foo-state", Prefix: "foo-prefix"}
+	conf := NewConfig()
+	if err := Apply(conf, dir, &Options{MigrateStateTo: backend}, rn); err != nil {
+		t.Fatalf("Apply = %v", err)
+	}
+
+	wantArgs := [][]string{
+		{"terraform", "init"},
+		{"terraform", "plan", "-input=false", "-out=plan.tfplan"},
+		{"terraform", "apply", "-input=false", "plan.tfplan"},
+		{"terraform", "init", "-input=false", "-migrate-state", "-force-copy"},
+	}
+	if diff := cmp.Diff(gotArgs, wantArgs); diff != "" {
+		t.Errorf("commands differ (-got +want):\n%v", diff)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "main.tf.json"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile = %v", err)
+	}
+	var got struct {
+		Terraform struct {
+			Backend map[string]*Backend `json:"backend"`
+		} `json:"terraform"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal = %v", err)
+	}
+	if diff := cmp.Diff(got.Terraform.Backend, map[string]*Backend{"gcs": backend}); diff != "" {
+		t.Errorf("migrated config backend differs (-got +want):\n%v", diff)
+	}
+	if conf.Terraform.Backend != nil {
+		t.Errorf("Apply set backend %+v on the applied config, want nil", conf.Terraform.Backend)
+	}
+}
+
+func TestApplyConfirm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var gotArgs [][]string
+	rn := &fakeRunner{run: func(cmd *exec.Cmd) error {
+		gotArgs = append(gotArgs, cmd.Args)
+		return nil
+	}}
+	var confirmed *PlanSummary
+	opts := &Options{Confirm: func(s *PlanSummary) error {
+		confirmed = s
+		return errors.New("not confirmed")
+	}}
+	if err := Apply(NewConfig(), dir, opts, rn); err == nil || err.Error() != "not confirmed" {
+		t.Fatalf("Apply = %v, want not confirmed error", err)
+	}
+	if confirmed == nil {
+		t.Error("Apply did not confirm the plan")
+	}
+
+	// The plan is confirmed after it was made, and is not applied.
+	wantArgs := [][]string{
+		{"terraform", "init"},
+		{"terraform", "plan", "-input=false", "-out=plan.tfplan"},
+	}
+	if diff := cmp.Diff(gotArgs, wantArgs); diff != "" {
+		t.Errorf("commands differ (-got +want):\n%v", diff)
+	}
+}
+
+type fakeRunner struct {
+	run func(cmd *exec.Cmd) error
+	// output returns the output of commands with output. If nil, an empty plan is returned for terraform show.
+	output func(cmd *exec.Cmd) ([]byte, error)
+	// combinedOutput returns the combined output of commands. If nil, an empty state is listed for terraform state list.
+	combinedOutput func(cmd *exec.Cmd) ([]byte, error)
+}
+
+func (r *fakeRunner) CmdRun(cmd *exec.Cmd) error {
+	return r.run(cmd)
+}
+
+func (r *fakeRunner) CmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	if r.output != nil {
+		return r.output(cmd)
+	}
+	if len(cmd.Args) > 1 && cmd.Args[0] == "terraform" && cmd.Args[1] == "show" {
+		return []byte(`{"format_version": "0.1"}`), nil
+	}
+	return nil, fmt.Errorf("fake CmdOutput: unexpected args: %v", cmd.Args)
+}
+
+func (r *fakeRunner) CmdCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	if r.combinedOutput != nil {
+		return r.combinedOutput(cmd)
+	}
+	if len(cmd.Args) > 2 && cmd.Args[0] == "terraform" && cmd.Args[1] == "state" && cmd.Args[2] == "list" {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("fake CmdCombinedOutput: unexpected args: %v", cmd.Args)
+}
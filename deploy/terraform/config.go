@@ -26,8 +26,14 @@ import (
 // See https://www.terraform.io/docs/configuration/syntax-json.html for documentation.
 type Config struct {
 	Terraform Terraform   `json:"terraform"`
-	Modules   []*Module   `json:"module,omitempty"`
-	Resources []*Resource `json:"resource,omitempty"`
+	Providers []*Provider `json:"provider,omitempty"`
+	Variables []*Variable `json:"variable,omitempty"`
+	// Locals maps names of local values to their expressions, e.g. "${var.project_id}-state".
+	Locals      map[string]interface{} `json:"locals,omitempty"`
+	DataSources []*DataSource          `json:"data,omitempty"`
+	Modules     []*Module              `json:"module,omitempty"`
+	Resources   []*Resource            `json:"resource,omitempty"`
+	Outputs     []*Output              `json:"output,omitempty"`
 }
 
 // NewConfig returns a new terraform config.
@@ -43,8 +49,11 @@ func NewConfig() *Config {
 // Terraform provides a terraform block config.
 // See https://www.terraform.io/docs/configuration/terraform.html for details.
 type Terraform struct {
-	RequiredVersion string   `json:"required_version,omitempty"`
-	Backend         *Backend `json:"backend,omitempty"`
+	RequiredVersion string `json:"required_version,omitempty"`
+	// RequiredProviders maps provider names to their version constraints, e.g. "google": "~> 2.20".
+	// Constraints are kept in the string form as it is valid for Terraform 0.12 and later.
+	RequiredProviders map[string]string `json:"required_providers,omitempty"`
+	Backend           *Backend          `json:"backend,omitempty"`
 }
 
 // Backend provides a terraform backend config.
@@ -60,11 +69,33 @@ func (b *Backend) MarshalJSON() ([]byte, error) {
 	return json.Marshal(map[string]interface{}{"gcs": alias(*b)})
 }
 
+// Provider provides a terraform provider config.
+// See https://www.terraform.io/docs/configuration/providers.html for details.
+type Provider struct {
+	Name string `json:"-"`
+	// Project and Region are the defaults of the resources that do not set them.
+	Project string `json:"project,omitempty"`
+	Region  string `json:"region,omitempty"`
+}
+
+// MarshalJSON implements a custom marshaller which marshals the provider under its name.
+func (p *Provider) MarshalJSON() ([]byte, error) {
+	type alias Provider // use type alias to avoid infinite recursion
+	return json.Marshal(map[string]interface{}{
+		p.Name: alias(*p),
+	})
+}
+
 // Module provides a terraform module config.
 // See https://www.terraform.io/docs/configuration/modules.html for details.
 type Module struct {
-	Name       string      `json:"-"`
-	Source     string      `json:"source"`
+	Name string `json:"-"`
+	// Source is a local path starting with ./ or ../, a registry source, e.g. namespace/name/provider, or a git
+	// source, e.g. git::https://example.com/module.git?ref=v1.0.0.
+	// See https://www.terraform.io/docs/modules/sources.html.
+	Source string `json:"source"`
+	// Version is the version constraint of a registry source.
+	Version    string      `json:"version,omitempty"`
 	Properties interface{} `json:"-"`
 }
 
@@ -109,9 +140,69 @@ func (r *Resource) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// Variable defines a terraform input variable config.
+// See https://www.terraform.io/docs/configuration/variables.html for details.
+type Variable struct {
+	Name string `json:"-"`
+	// Type is the type constraint of the variable, e.g. "string" or "list(string)".
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Default is the value of the variable if it is not set. If nil, the variable must be set.
+	Default interface{} `json:"default,omitempty"`
+}
+
+// MarshalJSON implements a custom marshaller which marshals the variable under its name.
+func (v *Variable) MarshalJSON() ([]byte, error) {
+	type alias Variable // use type alias to avoid infinite recursion
+	return json.Marshal(map[string]interface{}{
+		v.Name: alias(*v),
+	})
+}
+
+// DataSource defines a terraform data source config, reading existing infrastructure such as an organization or
+// billing account, e.g. referenced as ${data.google_billing_account.acct.id}.
+// See https://www.terraform.io/docs/configuration/data-sources.html for details.
+type DataSource struct {
+	Name       string
+	Type       string
+	Properties interface{}
+}
+
+// MarshalJSON implements a custom marshaller which marshals properties to the top level.
+func (d *DataSource) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		d.Type: map[string]interface{}{
+			d.Name: d.Properties,
+		},
+	})
+}
+
+// Output defines a terraform output config.
+// See https://www.terraform.io/docs/configuration/outputs.html for details.
+type Output struct {
+	Name string `json:"-"`
+	// Value is the expression of the output, e.g. ${module.forseti.forseti-server-service-account}.
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	Sensitive   bool   `json:"sensitive,omitempty"`
+}
+
+// MarshalJSON implements a custom marshaller which marshals the output under its name.
+func (o *Output) MarshalJSON() ([]byte, error) {
+	type alias Output // use type alias to avoid infinite recursion
+	return json.Marshal(map[string]interface{}{
+		o.Name: alias(*o),
+	})
+}
+
 // Import defines fields used for a terraform import.
 // See https://www.terraform.io/docs/import/usage.html.
 type Import struct {
 	Address string
 	ID      string
+
+	// Exists reports whether the resource to import exists.
+	// Resources that do not exist are not imported and are created when the config is applied instead.
+	// If nil, the resource is assumed to exist.
+	Exists func() (bool, error)
 }
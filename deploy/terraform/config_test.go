@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package terraform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfigMarshalJSON(t *testing.T) {
+	conf := NewConfig()
+	conf.Variables = []*Variable{
+		{Name: "org_id", Type: "string", Description: "ID of the organization"},
+		{Name: "enabled", Type: "bool", Default: false},
+	}
+	conf.Locals = map[string]interface{}{"parent": "organizations/${var.org_id}"}
+	conf.DataSources = []*DataSource{{
+		Name:       "org",
+		Type:       "google_organization",
+		Properties: map[string]interface{}{"organization": "${var.org_id}"},
+	}}
+	conf.Outputs = []*Output{{Name: "org_name", Value: "${data.google_organization.org.name}", Sensitive: true}}
+
+	b, err := json.Marshal(conf)
+	if err != nil {
+		t.Fatalf("json.Marshal = %v", err)
+	}
+	var got interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal = %v", err)
+	}
+
+	wantJSON := `{
+	"terraform": {"required_version": ">= 0.12.0"},
+	"variable": [
+		{"org_id": {"type": "string", "description": "ID of the organization"}},
+		{"enabled": {"type": "bool", "default": false}}
+	],
+	"locals": {"parent": "organizations/${var.org_id}"},
+	"data": [{
+		"google_organization": {
+			"org": {"organization": "${var.org_id}"}
+		}
+	}],
+	"output": [{
+		"org_name": {"value": "${data.google_organization.org.name}", "sensitive": true}
+	}]
+}`
+	var want interface{}
+	if err := json.Unmarshal([]byte(wantJSON), &want); err != nil {
+		t.Fatalf("json.Unmarshal = %v", err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("config differs (-got +want):\n%v", diff)
+	}
+}
@@ -0,0 +1,435 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+)
+
+// importScript is the name of the script importing existing resources, written next to the HCL files.
+const importScript = "import.sh"
+
+// mapAttributes are the names of resource arguments whose object values are maps rather than nested blocks.
+// The JSON syntax does not tell them apart, while the HCL native syntax does.
+var mapAttributes = map[string]bool{
+	"labels":           true,
+	"label_extractors": true,
+	"metadata":         true,
+	"resource_labels":  true,
+}
+
+var (
+	// identifierRE matches names that can be written without quotes, e.g. as keys of objects.
+	identifierRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+	// interpolationRE matches strings that only hold a single interpolation, which are written as bare expressions.
+	interpolationRE = regexp.MustCompile(`^\$\{([^{}"]+)\}$`)
+)
+
+// WriteHCL writes the config to the dir as HCL files that can be reviewed or applied with terraform directly:
+// terraform.tf holds the terraform settings, backend and providers, variables.tf the variables, main.tf the locals,
+// data sources, modules and resources and outputs.tf the outputs. The imports are written to import.sh, to run after
+// terraform init. Modules with local sources are copied to the dir.
+func WriteHCL(config *Config, imports []Import, dir string, rn runner.Runner) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to mkdir %q: %v", dir, err)
+	}
+	if err := copyLocalModules(config, dir, rn); err != nil {
+		return err
+	}
+	files, err := marshalHCLFiles(config)
+	if err != nil {
+		return err
+	}
+	files[importScript] = importScriptContent(imports)
+
+	for name, b := range files {
+		if len(b) == 0 {
+			continue
+		}
+		perm := os.FileMode(0644)
+		if name == importScript {
+			perm = 0755
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), b, perm); err != nil {
+			return fmt.Errorf("failed to write %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// marshalHCLFiles returns the contents of the HCL files of the config, keyed by file name.
+// The config is converted through its JSON form, so the HCL files configure exactly what would be applied.
+func marshalHCLFiles(config *Config) (map[string][]byte, error) {
+	b, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal terraform config: %v", err)
+	}
+	var raw struct {
+		Terraform map[string]interface{}              `json:"terraform"`
+		Providers []map[string]map[string]interface{} `json:"provider"`
+		Variables []map[string]map[string]interface{} `json:"variable"`
+		Locals    map[string]interface{}              `json:"locals"`
+		Data      []map[string]map[string]interface{} `json:"data"`
+		Modules   []map[string]map[string]interface{} `json:"module"`
+		Resources []map[string]map[string]interface{} `json:"resource"`
+		Outputs   []map[string]map[string]interface{} `json:"output"`
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	// Keep numbers as written instead of converting them to floats.
+	d.UseNumber()
+	if err := d.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal terraform config: %v", err)
+	}
+
+	tf := new(hclWriter)
+	backend, _ := raw.Terraform["backend"].(map[string]interface{})
+	delete(raw.Terraform, "backend")
+	tf.openBlock("terraform")
+	tf.body(raw.Terraform, false)
+	for _, typ := range sortedKeys(backend) {
+		body, _ := backend[typ].(map[string]interface{})
+		if len(raw.Terraform) > 0 {
+			tf.buf.WriteString("\n")
+		}
+		tf.openBlock("backend", typ)
+		tf.body(body, true)
+		tf.closeBlock()
+	}
+	tf.closeBlock()
+	for _, p := range raw.Providers {
+		tf.labeledBlocks("provider", p, true)
+	}
+
+	variables := new(hclWriter)
+	for _, v := range raw.Variables {
+		for _, name := range sortedKeys(v) {
+			body := v[name]
+			variables.openBlock("variable", name)
+			// The type is a type constraint expression, e.g. list(string), rather than a string.
+			if t, ok := body["type"].(string); ok {
+				body["type"] = hclExpr(t)
+			}
+			variables.body(body, true, "type", "description", "default")
+			variables.closeBlock()
+		}
+	}
+
+	main := new(hclWriter)
+	if len(raw.Locals) > 0 {
+		main.openBlock("locals")
+		main.body(raw.Locals, true)
+		main.closeBlock()
+	}
+	for _, d := range raw.Data {
+		main.typedBlocks("data", d)
+	}
+	for _, m := range raw.Modules {
+		main.labeledBlocks("module", m, true, "source", "version")
+	}
+	for _, r := range raw.Resources {
+		main.typedBlocks("resource", r)
+	}
+
+	outputs := new(hclWriter)
+	for _, o := range raw.Outputs {
+		outputs.labeledBlocks("output", o, true, "value")
+	}
+	return map[string][]byte{
+		"terraform.tf": tf.buf.Bytes(),
+		"variables.tf": variables.buf.Bytes(),
+		"main.tf":      main.buf.Bytes(),
+		"outputs.tf":   outputs.buf.Bytes(),
+	}, nil
+}
+
+// importScriptContent returns a shell script importing the resources that are not part of the state yet.
+func importScriptContent(imports []Import) []byte {
+	if len(imports) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString("#!/bin/bash\n")
+	buf.WriteString("# Imports existing resources into the terraform state. Run after terraform init.\n")
+	buf.WriteString("set -e\n\n")
+	for _, imp := range imports {
+		a, id := shellQuote(imp.Address), shellQuote(imp.ID)
+		cmd := fmt.Sprintf("terraform state show %s > /dev/null 2>&1 || terraform import %s %s", a, a, id)
+		if imp.Exists != nil {
+			// Resources that may not exist yet are created by terraform apply instead.
+			cmd += fmt.Sprintf(" || echo %s", shellQuote(imp.Address+" not imported, it is created by terraform apply if it does not exist"))
+		}
+		buf.WriteString(cmd + "\n")
+	}
+	return buf.Bytes()
+}
+
+// shellQuote quotes the string for bash.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// hclExpr is an expression written as is.
+type hclExpr string
+
+// hclWriter writes blocks in the HCL native syntax, formatted like terraform fmt.
+type hclWriter struct {
+	buf    bytes.Buffer
+	indent int
+}
+
+// separate writes an empty line between top-level blocks.
+func (w *hclWriter) separate() {
+	if w.buf.Len() > 0 && w.indent == 0 {
+		w.buf.WriteString("\n")
+	}
+}
+
+func (w *hclWriter) line(format string, v ...interface{}) {
+	w.buf.WriteString(strings.Repeat("  ", w.indent))
+	fmt.Fprintf(&w.buf, format, v...)
+	w.buf.WriteString("\n")
+}
+
+func (w *hclWriter) openBlock(typ string, labels ...string) {
+	w.separate()
+	parts := []string{typ}
+	for _, l := range labels {
+		parts = append(parts, quote(l))
+	}
+	w.line("%s {", strings.Join(parts, " "))
+	w.indent++
+}
+
+func (w *hclWriter) closeBlock() {
+	w.indent--
+	w.line("}")
+}
+
+// labeledBlocks writes a block labeled by each name in the map, with the keys in first written before the others.
+func (w *hclWriter) labeledBlocks(typ string, blocks map[string]map[string]interface{}, attrsOnly bool, first ...string) {
+	for _, name := range sortedKeys(blocks) {
+		w.openBlock(typ, name)
+		w.body(blocks[name], attrsOnly, first...)
+		w.closeBlock()
+	}
+}
+
+// typedBlocks writes a block labeled by the type and name of each resource or data source in the map, which maps
+// types to names to bodies.
+func (w *hclWriter) typedBlocks(kind string, blocks map[string]map[string]interface{}) {
+	for _, typ := range sortedKeys(blocks) {
+		for _, name := range sortedKeys(blocks[typ]) {
+			body, _ := blocks[typ][name].(map[string]interface{})
+			w.openBlock(kind, typ, name)
+			w.body(body, false)
+			w.closeBlock()
+		}
+	}
+}
+
+// body writes the arguments of a block. Unless attrsOnly is set, objects and lists of objects are written as
+// nested blocks, as providers define them, except for the map attributes.
+// Consecutive single line attributes are aligned.
+func (w *hclWriter) body(body map[string]interface{}, attrsOnly bool, first ...string) {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, k := range first {
+		if _, ok := body[k]; ok {
+			keys = append(keys, k)
+			seen[k] = true
+		}
+	}
+	for _, k := range sortedKeys(body) {
+		if !seen[k] {
+			keys = append(keys, k)
+		}
+	}
+
+	// Attributes are written before nested blocks.
+	var attrs, blocks []string
+	for _, k := range keys {
+		if !attrsOnly && isBlock(k, body[k]) {
+			blocks = append(blocks, k)
+		} else {
+			attrs = append(attrs, k)
+		}
+	}
+
+	width := 0
+	for i, k := range attrs {
+		if width == 0 {
+			// Align the run of single line attributes starting at this one.
+			for _, r := range attrs[i:] {
+				if strings.Contains(w.expr(body[r]), "\n") {
+					break
+				}
+				if len(key(r)) > width {
+					width = len(key(r))
+				}
+			}
+		}
+		e := w.expr(body[k])
+		if strings.Contains(e, "\n") {
+			w.line("%s = %s", key(k), e)
+			width = 0
+			continue
+		}
+		w.line("%-*s = %s", width, key(k), e)
+	}
+
+	wrote := len(attrs) > 0
+	for _, k := range blocks {
+		vs, ok := body[k].([]interface{})
+		if !ok {
+			vs = []interface{}{body[k]}
+		}
+		for _, v := range vs {
+			if wrote {
+				w.buf.WriteString("\n")
+			}
+			wrote = true
+			w.line("%s {", k)
+			w.indent++
+			w.body(v.(map[string]interface{}), false)
+			w.indent--
+			w.line("}")
+		}
+	}
+}
+
+// isBlock returns whether the argument is written as nested blocks.
+func isBlock(name string, v interface{}) bool {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return !mapAttributes[name]
+	case []interface{}:
+		if len(t) == 0 {
+			return false
+		}
+		for _, e := range t {
+			if _, ok := e.(map[string]interface{}); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// expr returns the value as an expression at the current indent.
+func (w *hclWriter) expr(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool, json.Number:
+		return fmt.Sprint(t)
+	case hclExpr:
+		return string(t)
+	case string:
+		if m := interpolationRE.FindStringSubmatch(t); m != nil {
+			return m[1]
+		}
+		return quote(t)
+	case []interface{}:
+		if len(t) == 0 {
+			return "[]"
+		}
+		var es []string
+		multiline := false
+		for _, e := range t {
+			s := (&hclWriter{indent: w.indent + 1}).expr(e)
+			multiline = multiline || strings.Contains(s, "\n")
+			es = append(es, s)
+		}
+		if !multiline && len(strings.Join(es, ", ")) <= 80 {
+			return "[" + strings.Join(es, ", ") + "]"
+		}
+		inner := strings.Repeat("  ", w.indent+1)
+		return "[\n" + inner + strings.Join(es, ",\n"+inner) + ",\n" + strings.Repeat("  ", w.indent) + "]"
+	case map[string]interface{}:
+		if len(t) == 0 {
+			return "{}"
+		}
+		inner := &hclWriter{indent: w.indent + 1}
+		inner.body(t, true)
+		return "{\n" + inner.buf.String() + strings.Repeat("  ", w.indent) + "}"
+	}
+	return quote(fmt.Sprint(v))
+}
+
+// key returns the name as an attribute or object key, quoted if needed.
+func key(name string) string {
+	if identifierRE.MatchString(name) {
+		return name
+	}
+	return quote(name)
+}
+
+// quote returns the string as a quoted HCL string. Interpolations are kept, as in the JSON syntax.
+func quote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&sb, `\u%04x`, r)
+				continue
+			}
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch t := m.(type) {
+	case map[string]interface{}:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string]map[string]interface{}:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
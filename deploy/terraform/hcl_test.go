@@ -0,0 +1,215 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package terraform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func hclTestConfig() *Config {
+	conf := NewConfig()
+	conf.Terraform.RequiredProviders = map[string]string{"google": "~> 2.20"}
+	conf.Terraform.Backend = &Backend{Bucket: "foo-state", Prefix: "foo-project/resources"}
+	conf.Providers = []*Provider{{Name: "google", Project: "foo-project", Region: "us-central1"}}
+	conf.Variables = []*Variable{
+		{Name: "project_id", Type: "string", Description: "ID of the project"},
+		{Name: "zones", Type: "list(string)", Default: []string{"a", "b"}},
+	}
+	conf.Locals = map[string]interface{}{"state_bucket": "${var.project_id}-state"}
+	conf.DataSources = []*DataSource{{
+		Name:       "acct",
+		Type:       "google_billing_account",
+		Properties: map[string]interface{}{"display_name": "My Billing Account", "open": true},
+	}}
+	conf.Modules = []*Module{{
+		Name:       "bar",
+		Source:     "bar-namespace/bar/google",
+		Version:    "1.0.0",
+		Properties: map[string]interface{}{"project_id": "${var.project_id}", "zones": "${var.zones}"},
+	}}
+	conf.Resources = []*Resource{
+		{
+			Name: "foo-bucket",
+			Type: "google_storage_bucket",
+			Properties: map[string]interface{}{
+				"name":       "foo-bucket",
+				"location":   "US",
+				"versioning": map[string]interface{}{"enabled": true},
+				"labels":     map[string]string{"env": "prod", "cost.center": "1"},
+				"lifecycle_rule": []interface{}{
+					map[string]interface{}{
+						"action":    map[string]string{"type": "Delete"},
+						"condition": map[string]int{"age": 7},
+					},
+				},
+			},
+		},
+		{
+			Name: "foo-bucket-roles_storage_objectViewer",
+			Type: "google_storage_bucket_iam_binding",
+			Properties: map[string]interface{}{
+				"bucket":  "${google_storage_bucket.foo-bucket.name}",
+				"role":    "roles/storage.objectViewer",
+				"members": []string{"group:foo@example.com"},
+			},
+		},
+	}
+	conf.Outputs = []*Output{{Name: "bucket", Value: "${google_storage_bucket.foo-bucket.url}", Description: `the "foo" bucket`}}
+	return conf
+}
+
+func TestMarshalHCLFiles(t *testing.T) {
+	got, err := marshalHCLFiles(hclTestConfig())
+	if err != nil {
+		t.Fatalf("marshalHCLFiles = %v", err)
+	}
+	want := map[string]string{
+		"terraform.tf": `terraform {
+  required_version = ">= 0.12.0"
+
+  required_providers {
+    google = "~> 2.20"
+  }
+
+  backend "gcs" {
+    bucket = "foo-state"
+    prefix = "foo-project/resources"
+  }
+}
+
+provider "google" {
+  project = "foo-project"
+  region  = "us-central1"
+}
+`,
+		"variables.tf": `variable "project_id" {
+  type        = string
+  description = "ID of the project"
+}
+
+variable "zones" {
+  type    = list(string)
+  default = ["a", "b"]
+}
+`,
+		"main.tf": `locals {
+  state_bucket = "${var.project_id}-state"
+}
+
+data "google_billing_account" "acct" {
+  display_name = "My Billing Account"
+  open         = true
+}
+
+module "bar" {
+  source     = "bar-namespace/bar/google"
+  version    = "1.0.0"
+  project_id = var.project_id
+  zones      = var.zones
+}
+
+resource "google_storage_bucket" "foo-bucket" {
+  labels = {
+    "cost.center" = "1"
+    env           = "prod"
+  }
+  location = "US"
+  name     = "foo-bucket"
+
+  lifecycle_rule {
+    action {
+      type = "Delete"
+    }
+
+    condition {
+      age = 7
+    }
+  }
+
+  versioning {
+    enabled = true
+  }
+}
+
+resource "google_storage_bucket_iam_binding" "foo-bucket-roles_storage_objectViewer" {
+  bucket  = google_storage_bucket.foo-bucket.name
+  members = ["group:foo@example.com"]
+  role    = "roles/storage.objectViewer"
+}
+`,
+		"outputs.tf": `output "bucket" {
+  value       = google_storage_bucket.foo-bucket.url
+  description = "the \"foo\" bucket"
+}
+`,
+	}
+	for name, w := range want {
+		if diff := cmp.Diff(string(got[name]), w); diff != "" {
+			t.Errorf("%s differs (-got +want):\n%v", name, diff)
+		}
+	}
+}
+
+func TestWriteHCL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := NewConfig()
+	imports := []Import{
+		{Address: "google_storage_bucket.foo-bucket", ID: "foo-project/foo-bucket"},
+		{Address: "google_project_iam_audit_config.allServices", ID: "foo-project allServices", Exists: func() (bool, error) { return true, nil }},
+	}
+	if err := WriteHCL(conf, imports, dir, &fakeRunner{}); err != nil {
+		t.Fatalf("WriteHCL = %v", err)
+	}
+
+	var files []string
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir = %v", err)
+	}
+	for _, i := range infos {
+		files = append(files, i.Name())
+	}
+	// The config has no modules, resources or outputs.
+	if diff := cmp.Diff(files, []string{"import.sh", "terraform.tf"}); diff != "" {
+		t.Errorf("files differ (-got +want):\n%v", diff)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "import.sh"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile = %v", err)
+	}
+	want := `#!/bin/bash
+# Imports existing resources into the terraform state. Run after terraform init.
+set -e
+
+terraform state show 'google_storage_bucket.foo-bucket' > /dev/null 2>&1 || terraform import 'google_storage_bucket.foo-bucket' 'foo-project/foo-bucket'
+terraform state show 'google_project_iam_audit_config.allServices' > /dev/null 2>&1 || terraform import 'google_project_iam_audit_config.allServices' 'foo-project allServices' || echo 'google_project_iam_audit_config.allServices not imported, it is created by terraform apply if it does not exist'
+`
+	if diff := cmp.Diff(string(b), want); diff != "" {
+		t.Errorf("import script differs (-got +want):\n%v", diff)
+	}
+}
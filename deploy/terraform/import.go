@@ -0,0 +1,86 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+)
+
+// importMissing imports the resources that exist but are not part of the state yet.
+// The dir must be initialized.
+func importMissing(imports []Import, dir string, rn runner.Runner) error {
+	if len(imports) == 0 {
+		return nil
+	}
+	addrs, err := stateList(dir, rn)
+	if err != nil {
+		return err
+	}
+	inState := make(map[string]bool)
+	for _, a := range addrs {
+		inState[a] = true
+	}
+
+	for _, imp := range imports {
+		if inState[imp.Address] {
+			log.Printf("%q is already part of the terraform state, skipping import", imp.Address)
+			continue
+		}
+		if imp.Exists != nil {
+			exists, err := imp.Exists()
+			if err != nil {
+				return fmt.Errorf("failed to check whether %q exists: %v", imp.Address, err)
+			}
+			if !exists {
+				log.Printf("%q does not exist, skipping import", imp.Address)
+				continue
+			}
+		}
+		if err := runCmd(rn, dir, "import", imp.Address, imp.ID); err != nil {
+			return fmt.Errorf("failed to import %q with ID %q: %v", imp.Address, imp.ID, err)
+		}
+	}
+	return nil
+}
+
+// noStateMessage is printed by terraform state commands if there is no state yet.
+const noStateMessage = "No state file was found"
+
+// stateList returns the addresses of the resources in the state of the dir.
+func stateList(dir string, rn runner.Runner) ([]string, error) {
+	cmd := exec.Command("terraform", "state", "list")
+	cmd.Dir = dir
+	out, err := rn.CmdCombinedOutput(cmd)
+	if err != nil {
+		if strings.Contains(string(out), noStateMessage) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list terraform state: %v\n%s", err, out)
+	}
+	var addrs []string
+	for _, l := range strings.Split(string(out), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			addrs = append(addrs, l)
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package terraform
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestImportMissing(t *testing.T) {
+	exists := func(b bool) func() (bool, error) {
+		return func() (bool, error) { return b, nil }
+	}
+	imports := []Import{
+		{Address: "google_storage_bucket.in-state", ID: "p/in-state"},
+		{Address: "google_storage_bucket.missing", ID: "p/missing", Exists: exists(false)},
+		{Address: "google_storage_bucket.existing", ID: "p/existing", Exists: exists(true)},
+		{Address: "google_storage_bucket.unchecked", ID: "p/unchecked"},
+	}
+
+	var gotImports []string
+	rn := &fakeRunner{
+		run: func(cmd *exec.Cmd) error {
+			if cmd.Dir != "foo-dir" {
+				t.Errorf("command %v run in %q, want foo-dir", cmd.Args, cmd.Dir)
+			}
+			gotImports = append(gotImports, strings.Join(cmd.Args, " "))
+			return nil
+		},
+		combinedOutput: func(cmd *exec.Cmd) ([]byte, error) {
+			return []byte("google_storage_bucket.in-state\ngoogle_storage_bucket.other\n"), nil
+		},
+	}
+	if err := importMissing(imports, "foo-dir", rn); err != nil {
+		t.Fatalf("importMissing = %v", err)
+	}
+	want := []string{
+		"terraform import google_storage_bucket.existing p/existing",
+		"terraform import google_storage_bucket.unchecked p/unchecked",
+	}
+	if diff := cmp.Diff(gotImports, want); diff != "" {
+		t.Errorf("imports differ (-got +want):\n%v", diff)
+	}
+}
+
+func TestImportMissingNoState(t *testing.T) {
+	var gotImports int
+	rn := &fakeRunner{
+		run: func(*exec.Cmd) error {
+			gotImports++
+			return nil
+		},
+		combinedOutput: func(*exec.Cmd) ([]byte, error) {
+			return []byte("No state file was found!\n"), errors.New("exit status 1")
+		},
+	}
+	if err := importMissing([]Import{{Address: "a.b", ID: "b"}}, "foo-dir", rn); err != nil {
+		t.Fatalf("importMissing = %v", err)
+	}
+	if gotImports != 1 {
+		t.Errorf("got %d imports, want 1", gotImports)
+	}
+}
+
+func TestImportMissingErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		imp  Import
+		rn   *fakeRunner
+	}{
+		{
+			name: "import_failure",
+			imp:  Import{Address: "a.b", ID: "b"},
+			rn: &fakeRunner{run: func(*exec.Cmd) error {
+				return errors.New("permission denied")
+			}},
+		},
+		{
+			name: "exists_failure",
+			imp: Import{Address: "a.b", ID: "b", Exists: func() (bool, error) {
+				return false, errors.New("permission denied")
+			}},
+			rn: &fakeRunner{run: func(*exec.Cmd) error { return nil }},
+		},
+		{
+			name: "state_list_failure",
+			imp:  Import{Address: "a.b", ID: "b"},
+			rn: &fakeRunner{
+				run: func(*exec.Cmd) error { return nil },
+				combinedOutput: func(*exec.Cmd) ([]byte, error) {
+					return []byte("Error: Failed to load state"), errors.New("exit status 1")
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := importMissing([]Import{tc.imp}, "foo-dir", tc.rn); err == nil {
+				t.Fatal("importMissing = nil, want error")
+			}
+		})
+	}
+}
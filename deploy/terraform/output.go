@@ -0,0 +1,63 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+)
+
+// Outputs returns the values of the outputs of the config applied in the dir, keyed by output name.
+// String outputs are returned as strings, other outputs as the types encoding/json unmarshals them to.
+func Outputs(dir string, rn runner.Runner) (map[string]interface{}, error) {
+	cmd := exec.Command("terraform", "output", "-json")
+	cmd.Dir = dir
+	out, err := rn.CmdOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outputs: %v", err)
+	}
+
+	var outputs map[string]struct {
+		Sensitive bool        `json:"sensitive"`
+		Type      interface{} `json:"type"`
+		Value     interface{} `json:"value"`
+	}
+	if err := json.Unmarshal(out, &outputs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal outputs: %v", err)
+	}
+	values := make(map[string]interface{})
+	for name, o := range outputs {
+		values[name] = o.Value
+	}
+	return values, nil
+}
+
+// OutputString returns the string value of the named output.
+func OutputString(outputs map[string]interface{}, name string) (string, error) {
+	v, ok := outputs[name]
+	if !ok {
+		return "", fmt.Errorf("output %q not found", name)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("output %q is a %T, want string", name, v)
+	}
+	return s, nil
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package terraform
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOutputs(t *testing.T) {
+	var gotArgs []string
+	var gotDir string
+	rn := &fakeRunner{output: func(cmd *exec.Cmd) ([]byte, error) {
+		gotArgs, gotDir = cmd.Args, cmd.Dir
+		return []byte(`{
+	"forseti-server-service-account": {
+		"sensitive": false,
+		"type": "string",
+		"value": "forseti-server-gcp-123@my-forseti-project.iam.gserviceaccount.com"
+	},
+	"zones": {
+		"sensitive": false,
+		"type": ["list", "string"],
+		"value": ["us-east1-b", "us-east1-c"]
+	}
+}`), nil
+	}}
+
+	got, err := Outputs("/tmp/foo", rn)
+	if err != nil {
+		t.Fatalf("Outputs = %v", err)
+	}
+	want := map[string]interface{}{
+		"forseti-server-service-account": "forseti-server-gcp-123@my-forseti-project.iam.gserviceaccount.com",
+		"zones":                          []interface{}{"us-east1-b", "us-east1-c"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("outputs differ (-got +want):\n%v", diff)
+	}
+	if diff := cmp.Diff(gotArgs, []string{"terraform", "output", "-json"}); diff != "" {
+		t.Errorf("args differ (-got +want):\n%v", diff)
+	}
+	if gotDir != "/tmp/foo" {
+		t.Errorf("dir = %q, want /tmp/foo", gotDir)
+	}
+
+	if s, err := OutputString(got, "forseti-server-service-account"); err != nil || s != want["forseti-server-service-account"] {
+		t.Errorf("OutputString = %q, %v", s, err)
+	}
+	if _, err := OutputString(got, "zones"); err == nil {
+		t.Error("OutputString of list = nil error, want error")
+	}
+	if _, err := OutputString(got, "missing"); err == nil {
+		t.Error("OutputString of missing output = nil error, want error")
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+)
+
+// planFile is the name of the plan file written in the terraform dir.
+const planFile = "plan.tfplan"
+
+// Action is the action terraform takes on a resource.
+type Action string
+
+// Actions terraform takes on resources.
+const (
+	ActionNoOp    Action = "no-op"
+	ActionCreate  Action = "create"
+	ActionRead    Action = "read"
+	ActionUpdate  Action = "update"
+	ActionDelete  Action = "delete"
+	ActionReplace Action = "replace"
+)
+
+// ResourceChange is a planned change of a single resource.
+type ResourceChange struct {
+	// Address is the absolute address of the resource, e.g. module.forseti.google_storage_bucket.server.
+	Address string      `json:"address"`
+	Type    string      `json:"type"`
+	Name    string      `json:"name"`
+	Action  Action      `json:"action"`
+	Before  interface{} `json:"before,omitempty"`
+	After   interface{} `json:"after,omitempty"`
+}
+
+// PlanSummary summarizes the changes of a terraform plan.
+type PlanSummary struct {
+	// Changes are the planned changes, sorted by address. Resources without changes are not included.
+	Changes []*ResourceChange `json:"changes"`
+}
+
+// Count returns the number of changes with the action.
+func (s *PlanSummary) Count(action Action) int {
+	n := 0
+	for _, c := range s.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Deletes returns the changes that delete a resource, including replacements.
+func (s *PlanSummary) Deletes() []*ResourceChange {
+	var cs []*ResourceChange
+	for _, c := range s.Changes {
+		if c.Action == ActionDelete || c.Action == ActionReplace {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// ProtectedDeletes returns the changes that delete a resource matching one of the protected addresses.
+// A protected address matches the resource with that address and all resources within it, e.g. module.forseti
+// matches every resource of the forseti module.
+func (s *PlanSummary) ProtectedDeletes(protected []string) []*ResourceChange {
+	var cs []*ResourceChange
+	for _, c := range s.Deletes() {
+		for _, p := range protected {
+			if c.Address == p || strings.HasPrefix(c.Address, p+".") || strings.HasPrefix(c.Address, p+"[") {
+				cs = append(cs, c)
+				break
+			}
+		}
+	}
+	return cs
+}
+
+// String returns a human readable summary of the plan, e.g.
+//
+//	Plan: 1 to add, 0 to change, 1 to replace, 0 to destroy.
+//	  + google_storage_bucket.foo
+//	  -/+ google_storage_bucket.bar
+func (s *PlanSummary) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Plan: %d to add, %d to change, %d to replace, %d to destroy.\n",
+		s.Count(ActionCreate), s.Count(ActionUpdate), s.Count(ActionReplace), s.Count(ActionDelete))
+	symbols := map[Action]string{
+		ActionCreate:  "+",
+		ActionRead:    "<=",
+		ActionUpdate:  "~",
+		ActionDelete:  "-",
+		ActionReplace: "-/+",
+	}
+	for _, c := range s.Changes {
+		fmt.Fprintf(&sb, "  %s %s\n", symbols[c.Action], c.Address)
+	}
+	return sb.String()
+}
+
+// CheckProtectedDeletes returns an error if the plan deletes a protected resource and deleting them was not allowed.
+func CheckProtectedDeletes(s *PlanSummary, opts *Options) error {
+	if opts == nil || opts.AllowProtectedDeletes {
+		return nil
+	}
+	cs := s.ProtectedDeletes(opts.Protected)
+	if len(cs) == 0 {
+		return nil
+	}
+	var addrs []string
+	for _, c := range cs {
+		addrs = append(addrs, c.Address)
+	}
+	return fmt.Errorf("plan deletes protected resources %v, explicitly allow deleting protected resources to continue", addrs)
+}
+
+// Plan plans the config and returns a summary of the changes. The config will be written as a .tf.json
+// file in the given dir along with the plan file.
+// A plan-only run only needs read access to the state: the state is not locked and resources are not imported.
+func Plan(config *Config, dir string, opts *Options, rn runner.Runner) (*PlanSummary, error) {
+	if _, _, err := prepare(config, dir, opts, rn); err != nil {
+		return nil, err
+	}
+	if opts != nil {
+		for _, imp := range opts.Imports {
+			log.Printf("not importing %q in plan-only run, it may be planned to be created", imp.Address)
+		}
+	}
+	return plan(dir, rn, "-lock=false")
+}
+
+// plan plans the config initialized in the dir and returns the summary of the plan.
+func plan(dir string, rn runner.Runner, args ...string) (*PlanSummary, error) {
+	args = append([]string{"plan", "-input=false", "-out=" + planFile}, args...)
+	if err := runCmd(rn, dir, args...); err != nil {
+		return nil, fmt.Errorf("failed to plan: %v", err)
+	}
+	cmd := exec.Command("terraform", "show", "-json", planFile)
+	cmd.Dir = dir
+	out, err := rn.CmdOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to show plan: %v", err)
+	}
+	return parsePlan(out)
+}
+
+// parsePlan parses the JSON output of terraform show.
+// See https://www.terraform.io/docs/internals/json-format.html.
+func parsePlan(b []byte) (*PlanSummary, error) {
+	var plan struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Type    string `json:"type"`
+			Name    string `json:"name"`
+			Change  struct {
+				Actions []string    `json:"actions"`
+				Before  interface{} `json:"before"`
+				After   interface{} `json:"after"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(b, &plan); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal plan: %v", err)
+	}
+
+	s := new(PlanSummary)
+	for _, rc := range plan.ResourceChanges {
+		a, err := action(rc.Change.Actions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get action of %q: %v", rc.Address, err)
+		}
+		if a == ActionNoOp {
+			continue
+		}
+		s.Changes = append(s.Changes, &ResourceChange{
+			Address: rc.Address,
+			Type:    rc.Type,
+			Name:    rc.Name,
+			Action:  a,
+			Before:  rc.Change.Before,
+			After:   rc.Change.After,
+		})
+	}
+	sort.Slice(s.Changes, func(i, j int) bool { return s.Changes[i].Address < s.Changes[j].Address })
+	return s, nil
+}
+
+// action returns the action of the list of actions of a resource change.
+// Replacements are listed as a delete and a create, in the order they happen.
+func action(actions []string) (Action, error) {
+	switch len(actions) {
+	case 1:
+		switch a := Action(actions[0]); a {
+		case ActionNoOp, ActionCreate, ActionRead, ActionUpdate, ActionDelete:
+			return a, nil
+		}
+	case 2:
+		if (actions[0] == "delete" && actions[1] == "create") || (actions[0] == "create" && actions[1] == "delete") {
+			return ActionReplace, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected actions %v", actions)
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package terraform
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const planJSON = `{
+	"format_version": "0.1",
+	"terraform_version": "0.12.6",
+	"resource_changes": [
+		{
+			"address": "module.forseti.google_storage_bucket.server_config",
+			"module_address": "module.forseti",
+			"mode": "managed",
+			"type": "google_storage_bucket",
+			"name": "server_config",
+			"change": {"actions": ["delete", "create"], "before": {"name": "old"}, "after": {"name": "new"}}
+		},
+		{
+			"address": "google_storage_bucket.foo-state",
+			"mode": "managed",
+			"type": "google_storage_bucket",
+			"name": "foo-state",
+			"change": {"actions": ["delete"], "before": {"name": "foo-state"}, "after": null}
+		},
+		{
+			"address": "google_storage_bucket.bar",
+			"mode": "managed",
+			"type": "google_storage_bucket",
+			"name": "bar",
+			"change": {"actions": ["create"], "before": null, "after": {"name": "bar"}}
+		},
+		{
+			"address": "google_storage_bucket.baz",
+			"mode": "managed",
+			"type": "google_storage_bucket",
+			"name": "baz",
+			"change": {"actions": ["no-op"], "before": {"name": "baz"}, "after": {"name": "baz"}}
+		}
+	]
+}`
+
+func TestPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var gotArgs [][]string
+	rn := &fakeRunner{
+		run: func(cmd *exec.Cmd) error {
+			gotArgs = append(gotArgs, cmd.Args)
+			return nil
+		},
+		output: func(cmd *exec.Cmd) ([]byte, error) {
+			gotArgs = append(gotArgs, cmd.Args)
+			return []byte(planJSON), nil
+		},
+	}
+
+	// Plan-only runs never import resources.
+	opts := &Options{Imports: []Import{{Address: "google_storage_bucket.foo-state", ID: "foo-project/foo-state"}}}
+	got, err := Plan(NewConfig(), dir, opts, rn)
+	if err != nil {
+		t.Fatalf("Plan = %v", err)
+	}
+
+	want := &PlanSummary{Changes: []*ResourceChange{
+		{
+			Address: "google_storage_bucket.bar",
+			Type:    "google_storage_bucket",
+			Name:    "bar",
+			Action:  ActionCreate,
+			After:   map[string]interface{}{"name": "bar"},
+		},
+		{
+			Address: "google_storage_bucket.foo-state",
+			Type:    "google_storage_bucket",
+			Name:    "foo-state",
+			Action:  ActionDelete,
+			Before:  map[string]interface{}{"name": "foo-state"},
+		},
+		{
+			Address: "module.forseti.google_storage_bucket.server_config",
+			Type:    "google_storage_bucket",
+			Name:    "server_config",
+			Action:  ActionReplace,
+			Before:  map[string]interface{}{"name": "old"},
+			After:   map[string]interface{}{"name": "new"},
+		},
+	}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("plan differs (-got +want):\n%v", diff)
+	}
+
+	wantArgs := [][]string{
+		{"terraform", "init"},
+		{"terraform", "plan", "-input=false", "-out=plan.tfplan", "-lock=false"},
+		{"terraform", "show", "-json", "plan.tfplan"},
+	}
+	if diff := cmp.Diff(gotArgs, wantArgs); diff != "" {
+		t.Errorf("commands differ (-got +want):\n%v", diff)
+	}
+
+	wantString := `Plan: 1 to add, 0 to change, 1 to replace, 1 to destroy.
+  + google_storage_bucket.bar
+  - google_storage_bucket.foo-state
+  -/+ module.forseti.google_storage_bucket.server_config
+`
+	if s := got.String(); s != wantString {
+		t.Errorf("String() = %q, want %q", s, wantString)
+	}
+}
+
+func TestApplyProtectedDeletes(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      *Options
+		wantApply bool
+	}{
+		{
+			name:      "no_protected_resources",
+			opts:      &Options{Protected: []string{"google_storage_bucket.other"}},
+			wantApply: true,
+		},
+		{
+			name: "protected_bucket",
+			opts: &Options{Protected: []string{"google_storage_bucket.foo-state"}},
+		},
+		{
+			name: "protected_module",
+			opts: &Options{Protected: []string{"module.forseti"}},
+		},
+		{
+			name:      "allowed",
+			opts:      &Options{Protected: []string{"module.forseti"}, AllowProtectedDeletes: true},
+			wantApply: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatalf("ioutil.TempDir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			applied := false
+			rn := &fakeRunner{
+				run: func(cmd *exec.Cmd) error {
+					if cmd.Args[1] == "apply" {
+						applied = true
+					}
+					return nil
+				},
+				output: func(*exec.Cmd) ([]byte, error) {
+					return []byte(planJSON), nil
+				},
+			}
+			err = Apply(NewConfig(), dir, tc.opts, rn)
+			if tc.wantApply && err != nil {
+				t.Fatalf("Apply = %v", err)
+			}
+			if !tc.wantApply && (err == nil || !strings.Contains(err.Error(), "protected")) {
+				t.Fatalf("Apply = %v, want protected resources error", err)
+			}
+			if applied != tc.wantApply {
+				t.Errorf("applied = %t, want %t", applied, tc.wantApply)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package terraform
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/healthcare/deploy/runner"
+)
+
+// Layout of the cache dir holding vendored modules and provider plugins.
+const (
+	// lockFile records the sources and checksums of the vendored modules and plugins.
+	lockFile = "vendor.lock.json"
+	// modulesDir holds the vendored modules, keyed by moduleKey. Vendored modules are copied to the same dir in
+	// terraform dirs.
+	modulesDir = "modules"
+	// pluginsDir holds the vendored provider plugins, passed to terraform init as -plugin-dir.
+	pluginsDir = "plugins"
+)
+
+// vendorLock records the sources and checksums of the vendored modules and plugins.
+type vendorLock struct {
+	// Modules maps module keys to the vendored modules.
+	Modules       map[string]*vendoredModule `json:"modules"`
+	PluginsSHA256 string                     `json:"plugins_sha256,omitempty"`
+}
+
+// vendoredModule is a module vendored in the cache dir.
+type vendoredModule struct {
+	Source  string `json:"source"`
+	Version string `json:"version,omitempty"`
+	SHA256  string `json:"sha256"`
+}
+
+// isLocalSource returns whether the module source is a local path, e.g. a module copied from the Bazel cache.
+// Other sources, such as registry (namespace/name/provider) and git (git::https://...) sources, are downloaded.
+func isLocalSource(source string) bool {
+	return strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") || filepath.IsAbs(source)
+}
+
+// moduleKey returns the key of the module in the cache, unique to its source and version.
+func moduleKey(m *Module) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(m.Source+"@"+m.Version)))[:16]
+}
+
+// Vendor downloads the remote modules and the provider plugins of the config into the cache dir and records
+// their checksums. Configs applied with the cache dir set in their options then use the vendored copies and do not
+// need network access. Remote modules called by the vendored modules are not vendored.
+func Vendor(config *Config, cacheDir string, rn runner.Runner) error {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Only the modules and providers are needed to download them, so the backend and properties are left out.
+	vc := &Config{
+		Terraform: Terraform{
+			RequiredVersion:   config.Terraform.RequiredVersion,
+			RequiredProviders: config.Terraform.RequiredProviders,
+		},
+		Providers: config.Providers,
+	}
+	for _, m := range config.Modules {
+		vc.Modules = append(vc.Modules, &Module{Name: m.Name, Source: m.Source, Version: m.Version})
+	}
+	if err := copyLocalModules(vc, dir, rn); err != nil {
+		return err
+	}
+	if err := writeConfig(vc, dir); err != nil {
+		return err
+	}
+	if err := runCmd(rn, dir, "init", "-backend=false", "-input=false"); err != nil {
+		return fmt.Errorf("failed to download modules and plugins: %v", err)
+	}
+
+	lock, err := readVendorLock(cacheDir)
+	if err != nil {
+		return err
+	}
+	var installed map[string]string
+	for _, m := range vc.Modules {
+		if isLocalSource(m.Source) {
+			continue
+		}
+		if installed == nil {
+			if installed, err = installedModules(dir); err != nil {
+				return err
+			}
+		}
+		src, ok := installed[m.Name]
+		if !ok {
+			return fmt.Errorf("module %q was not installed by terraform init", m.Name)
+		}
+		key := moduleKey(m)
+		dst := filepath.Join(cacheDir, modulesDir, key)
+		if err := replaceDir(filepath.Join(dir, src), dst, rn); err != nil {
+			return fmt.Errorf("failed to vendor module %q: %v", m.Source, err)
+		}
+		sum, err := checksumDir(dst)
+		if err != nil {
+			return err
+		}
+		lock.Modules[key] = &vendoredModule{Source: m.Source, Version: m.Version, SHA256: sum}
+	}
+
+	// Plugins of previously vendored configs are kept, so one cache dir can serve several configs.
+	plugins := filepath.Join(cacheDir, pluginsDir)
+	if err := os.MkdirAll(plugins, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to mkdir %q: %v", plugins, err)
+	}
+	src := filepath.Join(dir, ".terraform", "plugins", runtime.GOOS+"_"+runtime.GOARCH)
+	if err := rn.CmdRun(exec.Command("cp", "-r", src+"/.", plugins)); err != nil {
+		return fmt.Errorf("failed to vendor plugins: %v", err)
+	}
+	// Terraform's own lock of the downloaded plugins is replaced by the vendor lock.
+	if err := os.RemoveAll(filepath.Join(plugins, "lock.json")); err != nil {
+		return err
+	}
+	if lock.PluginsSHA256, err = checksumDir(plugins); err != nil {
+		return err
+	}
+	return writeVendorLock(lock, cacheDir)
+}
+
+// useVendored copies the vendored remote modules of the config from the cache dir to the dir after verifying their
+// checksums. It returns a copy of the config whose remote module sources are replaced by the local copies.
+func useVendored(config *Config, dir, cacheDir string, rn runner.Runner) (*Config, error) {
+	lock, err := readVendorLock(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	if lock.PluginsSHA256 == "" {
+		return nil, fmt.Errorf("no plugins vendored in %q", cacheDir)
+	}
+	if err := verifyChecksum(filepath.Join(cacheDir, pluginsDir), lock.PluginsSHA256); err != nil {
+		return nil, fmt.Errorf("vendored plugins: %v", err)
+	}
+
+	vendored := *config
+	vendored.Modules = nil
+	for _, m := range config.Modules {
+		if isLocalSource(m.Source) {
+			vendored.Modules = append(vendored.Modules, m)
+			continue
+		}
+		key := moduleKey(m)
+		vm, ok := lock.Modules[key]
+		if !ok {
+			return nil, fmt.Errorf("module %q with source %q and version %q is not vendored in %q", m.Name, m.Source, m.Version, cacheDir)
+		}
+		src := filepath.Join(cacheDir, modulesDir, key)
+		if err := verifyChecksum(src, vm.SHA256); err != nil {
+			return nil, fmt.Errorf("vendored module %q: %v", m.Source, err)
+		}
+		if err := replaceDir(src, filepath.Join(dir, modulesDir, key), rn); err != nil {
+			return nil, fmt.Errorf("failed to copy vendored module %q: %v", m.Source, err)
+		}
+		local := *m
+		local.Source = "./" + modulesDir + "/" + key
+		local.Version = ""
+		vendored.Modules = append(vendored.Modules, &local)
+	}
+	return &vendored, nil
+}
+
+// installedModules returns the dirs of the modules installed by terraform init in the dir, keyed by module name.
+func installedModules(dir string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, ".terraform", "modules", "modules.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read installed modules: %v", err)
+	}
+	var manifest struct {
+		Modules []struct {
+			Key string `json:"Key"`
+			Dir string `json:"Dir"`
+		} `json:"Modules"`
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal installed modules: %v", err)
+	}
+	dirs := make(map[string]string)
+	for _, m := range manifest.Modules {
+		dirs[m.Key] = m.Dir
+	}
+	return dirs, nil
+}
+
+// replaceDir replaces the dst dir with a copy of the src dir.
+func replaceDir(src, dst string, rn runner.Runner) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to mkdir %q: %v", filepath.Dir(dst), err)
+	}
+	return rn.CmdRun(exec.Command("cp", "-r", src, dst))
+}
+
+// checksumDir returns the SHA256 checksum of the paths, permissions and contents of the files in the dir.
+func checksumDir(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%v\x00", filepath.ToSlash(rel), info.Mode().Perm())
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to checksum %q: %v", dir, err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// verifyChecksum returns an error if the checksum of the dir is not the wanted checksum.
+func verifyChecksum(dir, want string) error {
+	got, err := checksumDir(dir)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("checksum of %q is %q, want %q: vendor the config again", dir, got, want)
+	}
+	return nil
+}
+
+// readVendorLock reads the lock file in the cache dir. An empty lock is returned if there is none yet.
+func readVendorLock(cacheDir string) (*vendorLock, error) {
+	lock := &vendorLock{Modules: make(map[string]*vendoredModule)}
+	b, err := ioutil.ReadFile(filepath.Join(cacheDir, lockFile))
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vendor lock: %v", err)
+	}
+	if err := json.Unmarshal(b, lock); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal vendor lock: %v", err)
+	}
+	if lock.Modules == nil {
+		lock.Modules = make(map[string]*vendoredModule)
+	}
+	return lock, nil
+}
+
+// writeVendorLock writes the lock file in the cache dir.
+func writeVendorLock(lock *vendorLock, cacheDir string) error {
+	b, err := json.MarshalIndent(lock, "", " ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal vendor lock: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cacheDir, lockFile), b, 0644); err != nil {
+		return fmt.Errorf("failed to write vendor lock: %v", err)
+	}
+	return nil
+}
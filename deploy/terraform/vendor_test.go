@@ -0,0 +1,233 @@
+/*
+ * Copyright 2019 Google LLC.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package terraform
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// vendorRunner returns a runner that copies files and fakes terraform init downloading a registry module and the
+// google provider. The terraform commands run are recorded in args.
+func vendorRunner(t *testing.T, args *[][]string) *fakeRunner {
+	return &fakeRunner{run: func(cmd *exec.Cmd) error {
+		if cmd.Args[0] == "cp" {
+			return cmd.Run()
+		}
+		*args = append(*args, cmd.Args)
+		if len(cmd.Args) < 3 || cmd.Args[1] != "init" || cmd.Args[2] != "-backend=false" {
+			return nil
+		}
+		files := map[string]string{
+			".terraform/modules/modules.json": `{"Modules": [
+				{"Key": "", "Source": "", "Dir": "."},
+				{"Key": "foo", "Source": "foo-namespace/foo/google", "Version": "1.0.0", "Dir": ".terraform/modules/foo/foo-namespace-foo-google"}
+			]}`,
+			".terraform/modules/foo/foo-namespace-foo-google/main.tf":                                  "# foo module",
+			".terraform/plugins/" + runtime.GOOS + "_" + runtime.GOARCH + "/terraform-provider-google": "google provider",
+			".terraform/plugins/" + runtime.GOOS + "_" + runtime.GOARCH + "/lock.json":                 "{}",
+		}
+		for name, content := range files {
+			path := filepath.Join(cmd.Dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+				t.Fatalf("os.MkdirAll = %v", err)
+			}
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("ioutil.WriteFile = %v", err)
+			}
+		}
+		return nil
+	}}
+}
+
+func TestVendor(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	var args [][]string
+	rn := vendorRunner(t, &args)
+	conf := NewConfig()
+	conf.Modules = []*Module{{
+		Name:       "foo",
+		Source:     "foo-namespace/foo/google",
+		Version:    "1.0.0",
+		Properties: map[string]interface{}{"bar": "baz"},
+	}}
+	if err := Vendor(conf, cacheDir, rn); err != nil {
+		t.Fatalf("Vendor = %v", err)
+	}
+
+	lock, err := readVendorLock(cacheDir)
+	if err != nil {
+		t.Fatalf("readVendorLock = %v", err)
+	}
+	key := moduleKey(conf.Modules[0])
+	if m := lock.Modules[key]; m == nil || m.Source != "foo-namespace/foo/google" || m.Version != "1.0.0" || m.SHA256 == "" {
+		t.Errorf("vendored module %q = %+v, want source, version and checksum", key, m)
+	}
+	if lock.PluginsSHA256 == "" {
+		t.Error("plugins checksum not recorded")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, pluginsDir, "lock.json")); !os.IsNotExist(err) {
+		t.Errorf("terraform plugin lock was vendored: %v", err)
+	}
+
+	// Applying offline uses the vendored module and plugins.
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	args = nil
+	if err := Apply(conf, dir, &Options{CacheDir: cacheDir}, rn); err != nil {
+		t.Fatalf("Apply = %v", err)
+	}
+	wantInit := []string{"terraform", "init", "-plugin-dir=" + filepath.Join(cacheDir, pluginsDir)}
+	if diff := cmp.Diff(args[0], wantInit); diff != "" {
+		t.Errorf("init command differs (-got +want):\n%v", diff)
+	}
+	if _, err := os.Stat(filepath.Join(dir, modulesDir, key, "main.tf")); err != nil {
+		t.Errorf("vendored module not copied: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "main.tf.json"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile = %v", err)
+	}
+	var got struct {
+		Modules []map[string]map[string]interface{} `json:"module"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal = %v", err)
+	}
+	want := []map[string]map[string]interface{}{{
+		"foo": {"source": "./modules/" + key, "bar": "baz"},
+	}}
+	if diff := cmp.Diff(got.Modules, want); diff != "" {
+		t.Errorf("modules differ (-got +want):\n%v", diff)
+	}
+	if conf.Modules[0].Source != "foo-namespace/foo/google" {
+		t.Errorf("Apply changed module source to %q", conf.Modules[0].Source)
+	}
+
+	// A changed vendored module is not used.
+	if err := ioutil.WriteFile(filepath.Join(cacheDir, modulesDir, key, "main.tf"), []byte("# changed"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile = %v", err)
+	}
+	if err := Apply(conf, dir, &Options{CacheDir: cacheDir}, rn); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Apply with changed vendored module = %v, want checksum error", err)
+	}
+}
+
+func TestApplyMigrateStateVendored(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	var args [][]string
+	rn := vendorRunner(t, &args)
+	conf := NewConfig()
+	conf.Modules = []*Module{{
+		Name:       "foo",
+		Source:     "foo-namespace/foo/google",
+		Version:    "1.0.0",
+		Properties: map[string]interface{}{"bar": "baz"},
+	}}
+	if err := Vendor(conf, cacheDir, rn); err != nil {
+		t.Fatalf("Vendor = %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	args = nil
+	backend := &Backend{Bucket: "foo-state", Prefix: "foo-prefix"}
+	if err := Apply(conf, dir, &Options{CacheDir: cacheDir, MigrateStateTo: backend}, rn); err != nil {
+		t.Fatalf("Apply = %v", err)
+	}
+
+	// The state is migrated offline with the vendored plugins.
+	wantInit := []string{"terraform", "init", "-plugin-dir=" + filepath.Join(cacheDir, pluginsDir), "-input=false", "-migrate-state", "-force-copy"}
+	if diff := cmp.Diff(args[len(args)-1], wantInit); diff != "" {
+		t.Errorf("migrate state command differs (-got +want):\n%v", diff)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "main.tf.json"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile = %v", err)
+	}
+	var got struct {
+		Terraform struct {
+			Backend map[string]*Backend `json:"backend"`
+		} `json:"terraform"`
+		Modules []map[string]map[string]interface{} `json:"module"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal = %v", err)
+	}
+	if diff := cmp.Diff(got.Terraform.Backend, map[string]*Backend{"gcs": backend}); diff != "" {
+		t.Errorf("migrated config backend differs (-got +want):\n%v", diff)
+	}
+	wantModules := []map[string]map[string]interface{}{{
+		"foo": {"source": "./modules/" + moduleKey(conf.Modules[0]), "bar": "baz"},
+	}}
+	if diff := cmp.Diff(got.Modules, wantModules); diff != "" {
+		t.Errorf("migrated config modules differ (-got +want):\n%v", diff)
+	}
+}
+
+func TestApplyNotVendored(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+	var args [][]string
+	rn := vendorRunner(t, &args)
+	if err := Vendor(NewConfig(), cacheDir, rn); err != nil {
+		t.Fatalf("Vendor = %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	conf := NewConfig()
+	conf.Modules = []*Module{{
+		Name:   "bar",
+		Source: "git::https://example.com/bar.git?ref=v1.0.0",
+	}}
+	if err := Apply(conf, dir, &Options{CacheDir: cacheDir}, rn); err == nil || !strings.Contains(err.Error(), "not vendored") {
+		t.Errorf("Apply with module that was not vendored = %v, want not vendored error", err)
+	}
+}
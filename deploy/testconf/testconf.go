@@ -22,6 +22,8 @@ import (
 	"text/template"
 
 	"github.com/GoogleCloudPlatform/healthcare/deploy/config"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/deploymentmanager"
+	"github.com/GoogleCloudPlatform/healthcare/deploy/gcp"
 	"github.com/ghodss/yaml"
 )
 
@@ -155,6 +157,31 @@ func ConfigAndProject(t *testing.T, data *ConfigData) (*config.Config, *config.P
 	return conf, proj
 }
 
+// DeploymentsFunc returns the deployments applying the project creates, e.g. apply.Deployments.
+type DeploymentsFunc func(*config.Config, *config.Project) ([]*deploymentmanager.ProjectDeployment, error)
+
+// DeployedFake gets a fake with the project and its remote audit logs project, if any, in the folder of the config
+// and the deployments applying the project creates.
+func DeployedFake(t *testing.T, conf *config.Config, project *config.Project, deployments DeploymentsFunc) *gcp.Fake {
+	t.Helper()
+	fake := gcp.NewFake()
+	for _, p := range []*config.Project{project, conf.ProjectForAuditLogs(project)} {
+		if fake.Project(p.ID) == nil {
+			fake.AddProject(p.ID, p.GeneratedFields.ProjectNumber, "folder", conf.Overall.FolderID)
+		}
+	}
+	ds, err := deployments(conf, project)
+	if err != nil {
+		t.Fatalf("get deployments: %v", err)
+	}
+	for _, d := range ds {
+		if err := fake.UpsertDeployment(d.ProjectID, d.Name, d.Deployment); err != nil {
+			t.Fatalf("fake.UpsertDeployment = %v", err)
+		}
+	}
+	return fake
+}
+
 func lpad(s string, n int) string {
 	var b strings.Builder
 	for _, line := range strings.Split(s, "\n") {